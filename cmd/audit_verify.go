@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/openebs/mayaserver/lib/audit"
+)
+
+// AuditVerifyCommand is a cli implementation that verifies the chain of the
+// audit log of maya api server.
+type AuditVerifyCommand struct {
+	Meta
+}
+
+// Help returns the usage of audit verify command
+func (c *AuditVerifyCommand) Help() string {
+	helpText := `
+Usage: m-apiserver audit verify [options] [<path>]
+
+  Verifies that the audit log of maya api server has not been tampered
+  with. Every record of the audit log is chained to the previous record by
+  its HMAC. Hence a record that is modified, removed or inserted is reported
+  along with its line in the audit log. The key of the HMACs is required.
+
+  The records removed from the end of the audit log can not be detected
+  this way. Compare the no. of verified records with the no. of records
+  known to be audited so far.
+
+  The audit log at the given path is verified. Otherwise the audit log in
+  the data directory is verified.
+
+Options:
+
+  -data-dir=<path>
+    The data directory of maya api server.
+
+  -key-file=<path>
+    The key file of the audit log i.e. the audit_key_file of maya api
+    server. Defaults to the key within the data directory.
+`
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis returns the synopsis of audit verify command
+func (c *AuditVerifyCommand) Synopsis() string {
+	return "Verifies the audit log of maya api server"
+}
+
+// Run verifies the chain of the audit log
+func (c *AuditVerifyCommand) Run(args []string) int {
+	var dataDir, keyFile string
+
+	flags := c.Meta.FlagSet("audit verify", FlagSetNone)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	flags.StringVar(&dataDir, "data-dir", "", "")
+	flags.StringVar(&keyFile, "key-file", "", "")
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	var path string
+	switch args := flags.Args(); {
+	case len(args) > 1:
+		c.Ui.Error("This command takes at most one argument: <path>")
+		c.Ui.Error("For additional help try 'm-apiserver audit verify -help'")
+		return 1
+	case len(args) == 1:
+		path = args[0]
+	case dataDir != "":
+		path = filepath.Join(dataDir, audit.FileName)
+	default:
+		c.Ui.Error("Either the path of the audit log or -data-dir is required")
+		c.Ui.Error("For additional help try 'm-apiserver audit verify -help'")
+		return 1
+	}
+
+	if keyFile == "" && dataDir == "" {
+		c.Ui.Error("Either -key-file or -data-dir is required to read the key of the audit log")
+		c.Ui.Error("For additional help try 'm-apiserver audit verify -help'")
+		return 1
+	}
+	if keyFile == "" {
+		keyFile = filepath.Join(dataDir, audit.KeyFileName)
+	}
+
+	key, err := audit.ReadKey(keyFile)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error reading audit key: %s", err))
+		return 1
+	}
+
+	n, err := audit.VerifyFile(path, key)
+	if err != nil {
+		if _, ok := err.(*audit.ChainError); ok {
+			c.Ui.Error(fmt.Sprintf("Audit log is tampered after %d valid record(s): %s", n, err))
+		} else {
+			c.Ui.Error(fmt.Sprintf("Error reading audit log: %s", err))
+		}
+		return 1
+	}
+
+	c.Ui.Output(fmt.Sprintf("Audit log is intact: %d record(s) verified in %s", n, path))
+	return 0
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+	"github.com/openebs/mayaserver/lib/audit"
+)
+
+func TestAuditVerifyCommand_Implements(t *testing.T) {
+	var _ cli.Command = &AuditVerifyCommand{}
+}
+
+func TestAuditVerifyCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mayaserver")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := audit.LoadKey(filepath.Join(dir, audit.KeyFileName))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	path := filepath.Join(dir, audit.FileName)
+	a, err := audit.Open(path, key)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, vol := range []string{"vol1", "vol2"} {
+		if err := a.Append(&audit.Record{Operation: audit.OpVolumeCreate, Volume: vol}); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	a.Close()
+
+	ui := new(cli.MockUi)
+	c := &AuditVerifyCommand{Meta: Meta{Ui: ui}}
+	if code := c.Run([]string{"-data-dir=" + dir}); code != 0 {
+		t.Fatalf("expected exit 0, got: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+	if out := ui.OutputWriter.String(); !strings.Contains(out, "2 record(s) verified") {
+		t.Fatalf("bad output: %s", out)
+	}
+
+	// Tamper with the first record
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	data = bytes.Replace(data, []byte(`"vol1"`), []byte(`"vol9"`), 1)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ui = new(cli.MockUi)
+	c = &AuditVerifyCommand{Meta: Meta{Ui: ui}}
+	if code := c.Run([]string{"-key-file=" + filepath.Join(dir, audit.KeyFileName), path}); code != 1 {
+		t.Fatalf("expected exit 1, got: %d", code)
+	}
+	if out := ui.ErrorWriter.String(); !strings.Contains(out, "line 1 (seq 1): hash does not match") {
+		t.Fatalf("bad output: %s", out)
+	}
+
+	ui = new(cli.MockUi)
+	c = &AuditVerifyCommand{Meta: Meta{Ui: ui}}
+	if code := c.Run(nil); code != 1 {
+		t.Fatalf("expected exit 1 without a path, got: %d", code)
+	}
+
+	// The key is required
+	ui = new(cli.MockUi)
+	c = &AuditVerifyCommand{Meta: Meta{Ui: ui}}
+	if code := c.Run([]string{path}); code != 1 {
+		t.Fatalf("expected exit 1 without a key, got: %d", code)
+	}
+	if out := ui.ErrorWriter.String(); !strings.Contains(out, "-key-file or -data-dir is required") {
+		t.Fatalf("bad output: %s", out)
+	}
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/openebs/mayaserver/lib/config"
+)
+
+// flagAliases are the flags that were available before every config field
+// got a flag. These are retained for backward compatibility.
+var flagAliases = map[string]string{
+	"bind": "bind_addr",
+	"node": "name",
+}
+
+// overrideValue is a config field set via a CLI flag
+type overrideValue struct {
+	key   string
+	value string
+}
+
+// overrideFlag is a flag.Value that records the value of a config field.
+// The value is checked when the flag is parsed so that an invalid value is
+// reported against the flag.
+type overrideFlag struct {
+	key    string
+	values *[]overrideValue
+}
+
+func (f *overrideFlag) String() string {
+	return ""
+}
+
+func (f *overrideFlag) Set(value string) error {
+	if err := (&config.MayaConfig{}).Set(f.key, value); err != nil {
+		return err
+	}
+	*f.values = append(*f.values, overrideValue{key: f.key, value: value})
+	return nil
+}
+
+// boolOverrideFlag lets a bool config field be set without a value e.g.
+// -enable-debug
+type boolOverrideFlag struct {
+	overrideFlag
+}
+
+func (f *boolOverrideFlag) IsBoolFlag() bool {
+	return true
+}
+
+// addOverrideFlags adds a flag for every config field to the flag set. The
+// values of the flags that are set are appended to values in the order of
+// the command line.
+func addOverrideFlags(flags *flag.FlagSet, values *[]overrideValue) {
+	add := func(name string, o *config.Override) {
+		f := overrideFlag{key: o.Key, values: values}
+		if o.IsBool() {
+			flags.Var(&boolOverrideFlag{f}, name, "")
+			return
+		}
+		flags.Var(&f, name, "")
+	}
+
+	for _, o := range config.Overrides() {
+		add(o.Flag, o)
+	}
+
+	for alias, key := range flagAliases {
+		for _, o := range config.Overrides() {
+			if o.Key == key {
+				add(alias, o)
+			}
+		}
+	}
+}
+
+// applyOverrideFlags sets the config fields from the flags
+func applyOverrideFlags(mconfig *config.MayaConfig, values []overrideValue) error {
+	for _, v := range values {
+		if err := mconfig.Set(v.key, v.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// overridesHelp lists the flag & the env var of every config field
+func overridesHelp() string {
+	aliases := map[string][]string{}
+	for alias, key := range flagAliases {
+		aliases[key] = append(aliases[key], "-"+alias)
+	}
+
+	var lines []string
+	for _, o := range config.Overrides() {
+		line := fmt.Sprintf("  -%s=%s\n    Overrides %s. Env: %s.", o.Flag, o.Usage(), o.Key, o.Env)
+		if a := aliases[o.Key]; len(a) > 0 {
+			sort.Strings(a)
+			line += fmt.Sprintf(" Alias: %s.", strings.Join(a, ", "))
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n\n")
+}
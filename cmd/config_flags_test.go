@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/openebs/mayaserver/lib/config"
+)
+
+func TestReadMayaConfig_Precedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mayaserver")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	type tcase struct {
+		name  string
+		file  string
+		env   map[string]string
+		args  []string
+		check func(mc *config.MayaConfig) bool
+	}
+	tcases := []tcase{
+		{
+			name:  "defaults",
+			check: func(mc *config.MayaConfig) bool { return mc.Region == "global" && mc.Ports.HTTP == 5656 },
+		},
+		{
+			name:  "file over defaults",
+			file:  `region = "file"`,
+			check: func(mc *config.MayaConfig) bool { return mc.Region == "file" },
+		},
+		{
+			name:  "env over file",
+			file:  `region = "file"`,
+			env:   map[string]string{"MAPI_REGION": "env"},
+			check: func(mc *config.MayaConfig) bool { return mc.Region == "env" },
+		},
+		{
+			name:  "flag over env",
+			file:  `region = "file"`,
+			env:   map[string]string{"MAPI_REGION": "env"},
+			args:  []string{"-region=flag"},
+			check: func(mc *config.MayaConfig) bool { return mc.Region == "flag" },
+		},
+		{
+			name:  "nested env over file",
+			file:  "ports {\n  http = 1234\n}",
+			env:   map[string]string{"MAPI_PORTS_HTTP": "2345"},
+			check: func(mc *config.MayaConfig) bool { return mc.Ports.HTTP == 2345 },
+		},
+		{
+			name:  "nested flag over env",
+			env:   map[string]string{"MAPI_PORTS_HTTP": "2345"},
+			args:  []string{"-ports-http=3456"},
+			check: func(mc *config.MayaConfig) bool { return mc.Ports.HTTP == 3456 },
+		},
+		{
+			name:  "env disables file bool",
+			file:  `leave_on_terminate = true`,
+			env:   map[string]string{"MAPI_LEAVE_ON_TERMINATE": "false"},
+			check: func(mc *config.MayaConfig) bool { return !mc.LeaveOnTerm },
+		},
+		{
+			name:  "bool flag without value",
+			env:   map[string]string{"MAPI_LEAVE_ON_INTERRUPT": "false"},
+			args:  []string{"-leave-on-interrupt"},
+			check: func(mc *config.MayaConfig) bool { return mc.LeaveOnInt },
+		},
+		{
+			name:  "duration env",
+			file:  `drain_timeout = "10s"`,
+			env:   map[string]string{"MAPI_DRAIN_TIMEOUT": "20s"},
+			check: func(mc *config.MayaConfig) bool { return mc.DrainTimeout == 20*time.Second },
+		},
+		{
+			name: "map entries are merged",
+			file: "http_api_response_headers {\n  A = \"file\"\n  B = \"file\"\n}",
+			env:  map[string]string{"MAPI_HTTP_API_RESPONSE_HEADERS": "B=env,C=env"},
+			args: []string{"-http-api-response-headers=C=flag"},
+			check: func(mc *config.MayaConfig) bool {
+				h := mc.HTTPAPIResponseHeaders
+				return h["A"] == "file" && h["B"] == "env" && h["C"] == "flag"
+			},
+		},
+		{
+			name:  "node alias",
+			env:   map[string]string{"MAPI_NAME": "env"},
+			args:  []string{"-node=flag"},
+			check: func(mc *config.MayaConfig) bool { return mc.NodeName == "flag" },
+		},
+	}
+
+	for _, tc := range tcases {
+		var args []string
+		if tc.file != "" {
+			path := filepath.Join(dir, strings.Replace(tc.name, " ", "_", -1)+".hcl")
+			if err := ioutil.WriteFile(path, []byte(tc.file), 0600); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			args = append(args, "-config="+path)
+		}
+		args = append(args, tc.args...)
+
+		for k, v := range tc.env {
+			os.Setenv(k, v)
+		}
+
+		ui := new(cli.MockUi)
+		c := &UpCommand{Ui: ui, args: args}
+		mc := c.readMayaConfig()
+
+		for k := range tc.env {
+			os.Unsetenv(k)
+		}
+
+		if mc == nil {
+			t.Fatalf("%s: failed to read config: %s", tc.name, ui.ErrorWriter.String())
+		}
+		if !tc.check(mc) {
+			t.Fatalf("%s: unexpected config: %#v", tc.name, mc)
+		}
+	}
+}
+
+func TestReadMayaConfig_InvalidOverrides(t *testing.T) {
+	tcases := []struct {
+		env    map[string]string
+		args   []string
+		errOut string
+	}{
+		{
+			args:   []string{"-ports-http=http"},
+			errOut: "invalid value \"http\" for flag -ports-http",
+		},
+		{
+			env:    map[string]string{"MAPI_ENABLE_DEBUG": "maybe"},
+			errOut: "MAPI_ENABLE_DEBUG",
+		},
+		{
+			env:    map[string]string{"MAPI_LOG_LEVEL": "CHATTY"},
+			errOut: "log_level: invalid log level",
+		},
+	}
+
+	for _, tc := range tcases {
+		for k, v := range tc.env {
+			os.Setenv(k, v)
+		}
+
+		ui := new(cli.MockUi)
+		c := &UpCommand{Ui: ui, args: tc.args}
+		mc := c.readMayaConfig()
+
+		for k := range tc.env {
+			os.Unsetenv(k)
+		}
+
+		if mc != nil {
+			t.Fatalf("%v %v: expected failure", tc.env, tc.args)
+		}
+		if out := ui.ErrorWriter.String(); !strings.Contains(out, tc.errOut) {
+			t.Fatalf("expected to find %q\n\n%s", tc.errOut, out)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mitchellh/cli"
+	"github.com/openebs/mayaserver/lib/config"
+)
+
+// ConfigValidateCommand is a cli implementation that validates the config
+// files of maya api server.
+type ConfigValidateCommand struct {
+	Meta
+}
+
+// Help returns the usage of config validate command
+func (c *ConfigValidateCommand) Help() string {
+	helpText := `
+Usage: m-apiserver config validate [options] <path> [<path>...]
+
+  Validates the config files or directories of config files used by maya api
+  server. The paths are loaded & merged in the same order as the -config
+  option of the up command. All the errors are reported along with their
+  positions in the config files.
+
+Options:
+
+  -format=<hcl|json>
+    Prints the effective config obtained after merging the defaults & the
+    config files in the given format.
+`
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis returns the synopsis of config validate command
+func (c *ConfigValidateCommand) Synopsis() string {
+	return "Validates the config files of maya api server"
+}
+
+// Run validates the config files
+func (c *ConfigValidateCommand) Run(args []string) int {
+	var format string
+
+	flags := c.Meta.FlagSet("config validate", FlagSetNone)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	flags.StringVar(&format, "format", "", "")
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		c.Ui.Error("This command requires at least one config path")
+		c.Ui.Error("For additional help try 'm-apiserver config validate -help'")
+		return 1
+	}
+
+	if format != "" && format != "hcl" && format != "json" {
+		c.Ui.Error(fmt.Sprintf("Invalid format: %s. Valid formats are: hcl, json", format))
+		return 1
+	}
+
+	mconfig, err := loadMayaConfigs(c.Ui, paths)
+	if err == nil {
+		err = mconfig.Validate()
+	}
+	if err != nil {
+		reportConfigErrors(c.Ui, err)
+		return 1
+	}
+
+	switch format {
+	case "hcl":
+		c.Ui.Output(strings.TrimSpace(string(mconfig.EncodeHCL())))
+	case "json":
+		out, err := mconfig.EncodeJSON()
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error encoding config: %s", err))
+			return 1
+		}
+		c.Ui.Output(string(out))
+	default:
+		c.Ui.Output(fmt.Sprintf("Configuration is valid: %s", strings.Join(mconfig.Files, ", ")))
+	}
+
+	return 0
+}
+
+// loadMayaConfigs loads the configs at the given paths & merges them over
+// the default config in order. The errors of all the paths are returned at
+// once.
+func loadMayaConfigs(ui cli.Ui, paths []string) (*config.MayaConfig, error) {
+	mconfig := config.DefaultMayaConfig()
+
+	var errs config.ValidationErrors
+	for _, path := range paths {
+		current, err := config.LoadMayaConfig(path)
+		if vErrs, ok := err.(config.ValidationErrors); ok {
+			errs = append(errs, vErrs...)
+			continue
+		}
+		if err != nil {
+			errs = append(errs, &config.ValidationError{
+				Msg: fmt.Sprintf("Error loading configuration from %s: %s", path, err),
+			})
+			continue
+		}
+
+		// The user asked us to load some config here but we didn't find any,
+		// so we'll complain but continue.
+		if current == nil || reflect.DeepEqual(current, &config.MayaConfig{}) {
+			ui.Warn(fmt.Sprintf("No configuration loaded from %s", path))
+			continue
+		}
+
+		mconfig = mconfig.Merge(current)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return mconfig, nil
+}
+
+// reportConfigErrors outputs each of the config errors on its own line
+func reportConfigErrors(ui cli.Ui, err error) {
+	errs, ok := err.(config.ValidationErrors)
+	if !ok {
+		ui.Error(err.Error())
+		return
+	}
+
+	ui.Error(fmt.Sprintf("Invalid configuration, %d error(s) found:", len(errs)))
+	for _, e := range errs {
+		ui.Error(fmt.Sprintf("  %s", e))
+	}
+}
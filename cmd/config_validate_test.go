@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestConfigValidateCommand_Implements(t *testing.T) {
+	var _ cli.Command = &ConfigValidateCommand{}
+}
+
+func TestConfigValidateCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mayaserver")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	valid := filepath.Join(dir, "valid.hcl")
+	if err := ioutil.WriteFile(valid, []byte("region = \"BANG-EAST\"\nports {\n  http = 1234\n}\n"), 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	invalid := filepath.Join(dir, "invalid.hcl")
+	if err := ioutil.WriteFile(invalid, []byte("region = \"BANG-EAST\"\ninterfaces {\n}\nlog_level = \"CHATTY\"\n"), 0600); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ui := new(cli.MockUi)
+	c := &ConfigValidateCommand{Meta: Meta{Ui: ui}}
+	if code := c.Run([]string{"-format=json", valid}); code != 0 {
+		t.Fatalf("expected exit 0, got: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+
+	// The effective config has the defaults merged with the file
+	out := ui.OutputWriter.String()
+	for _, expect := range []string{`"region": "BANG-EAST"`, `"http": 1234`, `"datacenter": "dc1"`} {
+		if !strings.Contains(out, expect) {
+			t.Fatalf("expected to find %q\n\n%s", expect, out)
+		}
+	}
+
+	ui = new(cli.MockUi)
+	c = &ConfigValidateCommand{Meta: Meta{Ui: ui}}
+	if code := c.Run([]string{valid, invalid}); code != 1 {
+		t.Fatalf("expected exit 1, got: %d", code)
+	}
+
+	out = ui.ErrorWriter.String()
+	for _, expect := range []string{invalid + ":2:1: interfaces: invalid key", invalid + ":4:1: log_level: invalid log level"} {
+		if !strings.Contains(out, expect) {
+			t.Fatalf("expected to find %q\n\n%s", expect, out)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openebs/mayaserver/lib/api"
+)
+
+// debugItem is an item of the debug bundle
+type debugItem struct {
+	// name of the debug item as served by maya api server
+	name string
+
+	// file of the debug item within the bundle
+	file string
+
+	// profile is set if the item is a runtime profile. The profiles are
+	// served by net/http/pprof rather than the debug endpoints.
+	profile bool
+
+	params url.Values
+}
+
+// DebugBundleCommand is a cli implementation that collects the debug items
+// of maya api server into a bundle.
+type DebugBundleCommand struct {
+	Meta
+}
+
+// Help returns the usage of debug bundle command
+func (c *DebugBundleCommand) Help() string {
+	helpText := `
+Usage: m-apiserver debug bundle [options]
+
+  Collects the debug items of maya api server into a gzipped tar archive.
+  The bundle has the effective config with its secrets redacted, the
+  version, the goroutine, heap & CPU profiles, the recent logs, the volumes
+  along with their statuses, the registered plugins & the health checks of
+  the orchestrators.
+
+  Maya api server serves the debug items if enable_debug is set & only to
+  the callers of the admin token. The admin token is sent via -token or the
+  MAPI_TOKEN env var. An item that could not be collected is reported in
+  errors.txt of the bundle.
+
+General Options:
+
+  ` + generalOptionsUsage() + `
+
+Bundle Options:
+
+  -output=<path>
+    The path of the bundle. Defaults to maya-debug-<timestamp>.tar.gz in
+    the current directory.
+
+  -profile-seconds=<seconds>
+    The duration of the CPU profile. Defaults to 5 seconds.
+`
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis returns the synopsis of debug bundle command
+func (c *DebugBundleCommand) Synopsis() string {
+	return "Collects the debug items of maya api server"
+}
+
+// Run collects the debug items into a bundle
+func (c *DebugBundleCommand) Run(args []string) int {
+	var output string
+	var seconds int
+
+	flags := c.Meta.FlagSet("debug bundle", FlagSetClient)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	flags.StringVar(&output, "output", "", "")
+	flags.IntVar(&seconds, "profile-seconds", 5, "")
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if len(flags.Args()) != 0 {
+		c.Ui.Error("This command takes no arguments")
+		c.Ui.Error("For additional help try 'm-apiserver debug bundle -help'")
+		return 1
+	}
+	if seconds <= 0 {
+		c.Ui.Error(fmt.Sprintf("Invalid profile-seconds: %d", seconds))
+		return 1
+	}
+	if output == "" {
+		output = fmt.Sprintf("maya-debug-%s.tar.gz", time.Now().UTC().Format("20060102T150405Z"))
+	}
+
+	client, err := c.Meta.Client()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing client: %s", err))
+		return 1
+	}
+
+	// The version is read first to verify that the debug endpoints are
+	// enabled
+	version, err := readDebugItem(client, debugItem{name: "version"})
+	if err != nil {
+		switch api.KindOf(err) {
+		case api.ErrorKindNotImplemented:
+			c.Ui.Error("The debug endpoints of maya api server are not enabled. Set enable_debug to enable them")
+		case api.ErrorKindUnauthorized:
+			c.Ui.Error("The debug endpoints of maya api server need the admin token. Set it via -token or MAPI_TOKEN")
+		default:
+			c.Ui.Error(fmt.Sprintf("Error reading the version: %s", err))
+		}
+		return 1
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error creating the bundle: %s", err))
+		return 1
+	}
+
+	bundle := newDebugBundle(f)
+	bundle.add("version.json", version)
+
+	var failures []string
+	for _, item := range debugItems(seconds) {
+		c.Ui.Output(fmt.Sprintf("Collecting %s", item.name))
+
+		data, err := readDebugItem(client, item)
+		if err != nil {
+			c.Ui.Warn(fmt.Sprintf("Failed to collect %s: %s", item.name, err))
+			failures = append(failures, fmt.Sprintf("%s: %s", item.name, err))
+			continue
+		}
+		bundle.add(item.file, data)
+	}
+	if len(failures) != 0 {
+		bundle.add("errors.txt", []byte(strings.Join(failures, "\n")+"\n"))
+	}
+
+	err = bundle.close()
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error writing the bundle: %s", err))
+		os.Remove(output)
+		return 1
+	}
+
+	c.Ui.Output(fmt.Sprintf("Debug bundle written to %s", output))
+	return 0
+}
+
+// debugItems returns the debug items of the bundle other than the version
+func debugItems(seconds int) []debugItem {
+	return []debugItem{
+		{name: "config", file: "config.json"},
+		{name: "logs", file: "logs.json"},
+		{name: "volumes", file: "volumes.json"},
+		{name: "plugins", file: "plugins.json"},
+		{name: "checks", file: "checks.json"},
+		{name: "goroutine", file: "goroutine.prof", profile: true},
+		{name: "heap", file: "heap.prof", profile: true},
+		{
+			name:    "profile",
+			file:    "cpu.prof",
+			profile: true,
+			params:  url.Values{"seconds": []string{strconv.Itoa(seconds)}},
+		},
+	}
+}
+
+// readDebugItem reads the debug item completely
+func readDebugItem(client *api.Client, item debugItem) ([]byte, error) {
+	read := client.Agent().Debug
+	if item.profile {
+		read = client.Agent().Profile
+	}
+
+	body, err := read(item.name, item.params, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return ioutil.ReadAll(body)
+}
+
+// debugBundle writes the debug items as the files of a gzipped tar archive
+type debugBundle struct {
+	gz  *gzip.Writer
+	tw  *tar.Writer
+	now time.Time
+	err error
+}
+
+func newDebugBundle(w io.Writer) *debugBundle {
+	gz := gzip.NewWriter(w)
+	return &debugBundle{
+		gz:  gz,
+		tw:  tar.NewWriter(gz),
+		now: time.Now(),
+	}
+}
+
+// add writes the data as the named file. The first error is retained &
+// returned by close.
+func (b *debugBundle) add(name string, data []byte) {
+	if b.err != nil {
+		return
+	}
+
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(data)),
+		ModTime: b.now,
+	}
+	if b.err = b.tw.WriteHeader(hdr); b.err != nil {
+		return
+	}
+	_, b.err = io.Copy(b.tw, bytes.NewReader(data))
+}
+
+func (b *debugBundle) close() error {
+	if b.err != nil {
+		return b.err
+	}
+	if err := b.tw.Close(); err != nil {
+		return err
+	}
+	return b.gz.Close()
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+	"github.com/openebs/mayaserver/lib/api"
+)
+
+func TestDebugBundleCommand_Implements(t *testing.T) {
+	var _ cli.Command = &DebugBundleCommand{}
+}
+
+func TestDebugBundleCommand_Run(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		item := strings.TrimPrefix(req.URL.Path, "/v1/agent/debug/")
+		switch item {
+		case "/debug/pprof/profile":
+			if seconds := req.URL.Query().Get("seconds"); seconds != "2" {
+				resp.WriteHeader(400)
+				fmt.Fprintf(resp, "Invalid seconds: %s", seconds)
+				return
+			}
+			fmt.Fprint(resp, "cpu")
+		case "checks":
+			resp.Header().Set(api.HeaderErrorKind, string(api.ErrorKindInternal))
+			resp.WriteHeader(500)
+			fmt.Fprint(resp, "checks failed")
+		default:
+			fmt.Fprintf(resp, `"%s"`, item)
+		}
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "maya")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "bundle.tar.gz")
+
+	ui := new(cli.MockUi)
+	c := &DebugBundleCommand{Meta: Meta{Ui: ui}}
+
+	args := []string{"-address=" + srv.URL, "-output=" + output, "-profile-seconds=2"}
+	if code := c.Run(args); code != 0 {
+		t.Fatalf("expected exit code 0, got: %d %s", code, ui.ErrorWriter.String())
+	}
+	if out := ui.ErrorWriter.String(); !strings.Contains(out, "Failed to collect checks") {
+		t.Fatalf("expected a warning, got: %s", out)
+	}
+
+	files := readBundle(t, output)
+	expected := map[string]string{
+		"version.json":   `"version"`,
+		"config.json":    `"config"`,
+		"logs.json":      `"logs"`,
+		"volumes.json":   `"volumes"`,
+		"plugins.json":   `"plugins"`,
+		"goroutine.prof": `"/debug/pprof/goroutine"`,
+		"heap.prof":      `"/debug/pprof/heap"`,
+		"cpu.prof":       "cpu",
+	}
+	for name, content := range expected {
+		if files[name] != content {
+			t.Fatalf("bad %s: %q", name, files[name])
+		}
+	}
+	if errs := files["errors.txt"]; !strings.Contains(errs, "checks: ") || !strings.Contains(errs, "checks failed") {
+		t.Fatalf("bad errors.txt: %q", errs)
+	}
+	if len(files) != len(expected)+1 {
+		t.Fatalf("bad files: %v", files)
+	}
+}
+
+func TestDebugBundleCommand_Disabled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set(api.HeaderErrorKind, string(api.ErrorKindNotImplemented))
+		resp.WriteHeader(501)
+		fmt.Fprint(resp, "Debug endpoints are not enabled")
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "maya")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "bundle.tar.gz")
+
+	ui := new(cli.MockUi)
+	c := &DebugBundleCommand{Meta: Meta{Ui: ui}}
+
+	if code := c.Run([]string{"-address=" + srv.URL, "-output=" + output}); code != 1 {
+		t.Fatalf("expected exit code 1, got: %d", code)
+	}
+	if out := ui.ErrorWriter.String(); !strings.Contains(out, "enable_debug") {
+		t.Fatalf("bad error: %s", out)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Fatalf("expected no bundle, got: %v", err)
+	}
+}
+
+// readBundle returns the contents of the files of the bundle by their names
+func readBundle(t *testing.T, path string) map[string]string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	files := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		files[hdr.Name] = string(data)
+	}
+}
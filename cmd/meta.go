@@ -2,14 +2,14 @@ package cmd
 
 // This is an adaptation of Hashicorp's Nomad library.
 import (
-	"bufio"
+	"bytes"
 	"flag"
-	"io"
-
+	"os"
 	"strings"
 
 	"github.com/mitchellh/cli"
 	"github.com/mitchellh/colorstring"
+	"github.com/openebs/mayaserver/lib/api"
 )
 
 const (
@@ -18,6 +18,16 @@ const (
 	fullId  = 36
 )
 
+const (
+	// EnvMayaAddress is the env var that sets the address of maya api server
+	// used by the commands that talk to a server
+	EnvMayaAddress = api.EnvAddress
+
+	// defaultMayaAddress is the address of maya api server used if neither
+	// the -address option nor the env var is set
+	defaultMayaAddress = api.DefaultAddress
+)
+
 // FlagSetFlags is an enum to define what flags are present in the
 // default FlagSet returned by Meta.FlagSet.
 type FlagSetFlags uint
@@ -38,6 +48,16 @@ type Meta struct {
 
 	// Whether to not-colorize output
 	noColor bool
+
+	// The address of maya api server
+	flagAddress string
+
+	// The token & the TLS settings used to talk to maya api server
+	token      string
+	caCert     string
+	clientCert string
+	clientKey  string
+	insecure   bool
 }
 
 // FlagSet returns a FlagSet with the common flags that every
@@ -51,24 +71,80 @@ func (m *Meta) FlagSet(n string, fs FlagSetFlags) *flag.FlagSet {
 	// client connectivity options.
 	if fs&FlagSetClient != 0 {
 		f.BoolVar(&m.noColor, "no-color", false, "")
+		f.StringVar(&m.flagAddress, "address", "", "")
+		f.StringVar(&m.token, "token", "", "")
+		f.StringVar(&m.caCert, "ca-cert", "", "")
+		f.StringVar(&m.clientCert, "client-cert", "", "")
+		f.StringVar(&m.clientKey, "client-key", "", "")
+		f.BoolVar(&m.insecure, "tls-skip-verify", false, "")
 	}
 
-	// Create an io.Writer that writes to our UI properly for errors.
-	// This is kind of a hack, but it does the job. Basically: create
-	// a pipe, use a scanner to break it into lines, and output each line
-	// to the UI. Do this forever.
-	errR, errW := io.Pipe()
-	errScanner := bufio.NewScanner(errR)
-	go func() {
-		for errScanner.Scan() {
-			m.Ui.Error(errScanner.Text())
-		}
-	}()
-	f.SetOutput(errW)
+	// The errors of the flags are written to the UI line by line. This is
+	// done in place rather than via a pipe & a scanner, as the goroutine of
+	// the scanner was never stopped.
+	f.SetOutput(&uiErrorWriter{ui: m.Ui})
 
 	return f
 }
 
+// uiErrorWriter writes every line written to it as an error of the UI. An
+// incomplete line is held till it is completed.
+type uiErrorWriter struct {
+	ui  cli.Ui
+	buf bytes.Buffer
+}
+
+func (w *uiErrorWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+
+	for {
+		idx := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if idx < 0 {
+			return len(p), nil
+		}
+
+		line := w.buf.Next(idx + 1)
+		w.ui.Error(string(line[:idx]))
+	}
+}
+
+// Address returns the address of maya api server. The -address option takes
+// precedence over the env var.
+func (m *Meta) Address() string {
+	if m.flagAddress != "" {
+		return strings.TrimRight(m.flagAddress, "/")
+	}
+	if addr := os.Getenv(EnvMayaAddress); addr != "" {
+		return strings.TrimRight(addr, "/")
+	}
+	return defaultMayaAddress
+}
+
+// Client returns a client of maya api server. The options take precedence
+// over the env vars.
+func (m *Meta) Client() (*api.Client, error) {
+	config := api.DefaultConfig()
+	config.Address = m.Address()
+
+	if m.token != "" {
+		config.Token = m.token
+	}
+	if m.caCert != "" {
+		config.TLSConfig.CACert = m.caCert
+	}
+	if m.clientCert != "" {
+		config.TLSConfig.ClientCert = m.clientCert
+	}
+	if m.clientKey != "" {
+		config.TLSConfig.ClientKey = m.clientKey
+	}
+	if m.insecure {
+		config.TLSConfig.Insecure = true
+	}
+
+	return api.NewClient(config)
+}
+
 // Colorize returns all the including fields.
 func (m *Meta) Colorize() *colorstring.Colorize {
 	return &colorstring.Colorize{
@@ -81,8 +157,41 @@ func (m *Meta) Colorize() *colorstring.Colorize {
 // generalOptionsUsage returns the help string for the global options.
 func generalOptionsUsage() string {
 	helpText := `
+  -address=<addr>
+    The address of maya api server. Overrides the MAPI_ADDR environment
+    variable if set. Default = http://127.0.0.1:5656
+
   -no-color
     Disables colored command output.
+
+  -token=<token>
+    The token sent to maya api server. Overrides the MAPI_TOKEN environment
+    variable if set.
+
+  -ca-cert=<path>
+    Path to a PEM encoded CA certificate used to verify the certificate of
+    maya api server. Overrides the MAPI_CACERT environment variable if set.
+
+  -client-cert=<path>
+    Path to a PEM encoded client certificate presented to maya api server.
+    Overrides the MAPI_CLIENT_CERT environment variable if set.
+
+  -client-key=<path>
+    Path to the PEM encoded key of the client certificate. Overrides the
+    MAPI_CLIENT_KEY environment variable if set.
+
+  -tls-skip-verify
+    Do not verify the certificate of maya api server. This is insecure.
+    Overrides the MAPI_SKIP_VERIFY environment variable if set.
 `
 	return strings.TrimSpace(helpText)
 }
+
+// limit truncates the identifier to the given length e.g. shortId unless it
+// is shorter
+func limit(s string, length int) string {
+	if len(s) <= length {
+		return s
+	}
+	return s[:length]
+}
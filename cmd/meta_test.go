@@ -3,8 +3,12 @@ package cmd
 import (
 	"flag"
 	"reflect"
+	"runtime"
 	"sort"
+	"strings"
 	"testing"
+
+	"github.com/mitchellh/cli"
 )
 
 func TestMeta_FlagSet(t *testing.T) {
@@ -19,7 +23,13 @@ func TestMeta_FlagSet(t *testing.T) {
 		{
 			FlagSetClient,
 			[]string{
+				"address",
+				"ca-cert",
+				"client-cert",
+				"client-key",
 				"no-color",
+				"tls-skip-verify",
+				"token",
 			},
 		},
 	}
@@ -41,3 +51,27 @@ func TestMeta_FlagSet(t *testing.T) {
 		}
 	}
 }
+
+func TestMeta_FlagSetErrors(t *testing.T) {
+	ui := new(cli.MockUi)
+	m := Meta{Ui: ui}
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		fs := m.FlagSet("foo", FlagSetClient)
+		fs.Usage = func() {}
+		if err := fs.Parse([]string{"-bogus"}); err == nil {
+			t.Fatalf("expected error with an undefined flag")
+		}
+	}
+
+	// No goroutine is left behind per flag set
+	if after := runtime.NumGoroutine(); after > before {
+		t.Fatalf("expected %d goroutines, got: %d", before, after)
+	}
+
+	lines := strings.Split(strings.TrimSpace(ui.ErrorWriter.String()), "\n")
+	if len(lines) != 10 || lines[0] != "flag provided but not defined: -bogus" {
+		t.Fatalf("bad errors: %q", ui.ErrorWriter.String())
+	}
+}
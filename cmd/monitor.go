@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// MonitorCommand is a cli implementation that streams the logs of a running
+// maya api server.
+type MonitorCommand struct {
+	Meta
+}
+
+// Help returns the usage of monitor command
+func (c *MonitorCommand) Help() string {
+	helpText := `
+Usage: m-apiserver monitor [options]
+
+  Streams the logs of a running maya api server. The recent logs of the
+  server are printed first. The command runs till it is interrupted or the
+  server is shutdown.
+
+  Log lines are dropped by the server if they are not consumed fast enough.
+  The no. of dropped lines is reported in the stream.
+
+  The logs are streamed to the admin token of the server only. Set it via
+  -token or the MAPI_TOKEN environment variable.
+
+General Options:
+
+  ` + generalOptionsUsage() + `
+
+Monitor Options:
+
+  -log-level=<level>
+    The minimum level of the streamed logs. Valid levels are TRACE, DEBUG,
+    INFO, WARN & ERR. Default = INFO
+`
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis returns the synopsis of monitor command
+func (c *MonitorCommand) Synopsis() string {
+	return "Streams the logs of a running maya api server"
+}
+
+// Run streams the logs of maya api server
+func (c *MonitorCommand) Run(args []string) int {
+	var logLevel string
+
+	flags := c.Meta.FlagSet("monitor", FlagSetClient)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	flags.StringVar(&logLevel, "log-level", "INFO", "")
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if len(flags.Args()) != 0 {
+		c.Ui.Error("This command takes no arguments")
+		c.Ui.Error("For additional help try 'm-apiserver monitor -help'")
+		return 1
+	}
+
+	client, err := c.Meta.Client()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing client: %s", err))
+		return 1
+	}
+
+	logs, err := client.Agent().Monitor(logLevel, nil)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error starting monitor: %s", err))
+		return 1
+	}
+	defer logs.Close()
+
+	scanner := bufio.NewScanner(logs)
+	for scanner.Scan() {
+		c.Ui.Output(scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error reading logs: %s", err))
+		return 1
+	}
+
+	return 0
+}
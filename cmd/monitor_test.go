@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+)
+
+func TestMonitorCommand_Implements(t *testing.T) {
+	var _ cli.Command = &MonitorCommand{}
+}
+
+func TestMonitorCommand_Run(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/agent/monitor" {
+			resp.WriteHeader(404)
+			return
+		}
+		if level := req.URL.Query().Get("log_level"); level != "DEBUG" {
+			resp.WriteHeader(400)
+			fmt.Fprintf(resp, "Invalid log level: %s", level)
+			return
+		}
+		fmt.Fprintln(resp, "[DEBUG] line 1")
+		fmt.Fprintln(resp, "[INFO] line 2")
+	}))
+	defer srv.Close()
+
+	ui := new(cli.MockUi)
+	c := &MonitorCommand{Meta: Meta{Ui: ui}}
+
+	if code := c.Run([]string{"-address=" + srv.URL, "-log-level=DEBUG"}); code != 0 {
+		t.Fatalf("expected exit code 0, got: %d %s", code, ui.ErrorWriter.String())
+	}
+	if out := ui.OutputWriter.String(); out != "[DEBUG] line 1\n[INFO] line 2\n" {
+		t.Fatalf("bad output: %q", out)
+	}
+
+	ui = new(cli.MockUi)
+	c = &MonitorCommand{Meta: Meta{Ui: ui}}
+	if code := c.Run([]string{"-address=" + srv.URL, "-log-level=CHATTY"}); code != 1 {
+		t.Fatalf("expected exit code 1, got: %d", code)
+	}
+	if out := ui.ErrorWriter.String(); !strings.Contains(out, "Invalid log level: CHATTY") {
+		t.Fatalf("bad error: %s", out)
+	}
+}
@@ -1,33 +1,29 @@
 package cmd
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/signal"
-	"path/filepath"
-	"reflect"
 	"sort"
 
 	"strings"
 	"syscall"
-	"time"
 
+	"github.com/openebs/mayaserver/lib/audit"
 	"github.com/openebs/mayaserver/lib/config"
 	"github.com/openebs/mayaserver/lib/server"
 
 	"github.com/hashicorp/go-syslog"
-	"github.com/hashicorp/logutils"
 	"github.com/mitchellh/cli"
 	"github.com/openebs/mayaserver/lib/flaghelper"
 	"github.com/openebs/mayaserver/lib/loghelper"
 )
 
-// gracefulTimeout controls how long we wait before forcefully terminating
-const gracefulTimeout = 5 * time.Second
-
 // UpCommand is a cli implementation that runs a Maya server.
 // The command will not end unless a shutdown message is sent on the
 // ShutdownCh. If two messages are sent on the ShutdownCh it will forcibly
@@ -47,57 +43,69 @@ type UpCommand struct {
 	// Need to take care of shuting down & graceful exit scenarios !!
 	maya       *server.MayaApiServer
 	httpServer *server.HTTPServer
-	logFilter  *logutils.LevelFilter
+	logFilter  *loghelper.ComponentFilter
 	logOutput  io.Writer
+	logFile    *loghelper.LogFile
+
+	// restoreGlog stops routing the logs of glog to logOutput & removes the
+	// log dir of glog
+	restoreGlog func()
 }
 
+// readMayaConfig reads the config & reports the errors if any. It returns
+// nil if the config could not be read.
 func (c *UpCommand) readMayaConfig() *config.MayaConfig {
-	var configPath []string
-
-	// Make a new, empty config.
-	cmdConfig := &config.MayaConfig{
-		Ports: &config.Ports{},
+	mconfig, err := c.loadMayaConfig()
+	if err != nil {
+		if err != flag.ErrHelp {
+			reportConfigErrors(c.Ui, err)
+		}
+		return nil
 	}
 
+	return mconfig
+}
+
+// loadMayaConfig loads the config from the config files, env vars & CLI
+// options & validates it. It is invoked afresh on every reload.
+func (c *UpCommand) loadMayaConfig() (*config.MayaConfig, error) {
+	var configPath []string
+	var flagValues []overrideValue
+
 	flags := flag.NewFlagSet("up", flag.ContinueOnError)
 	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	flags.SetOutput(ioutil.Discard)
 
 	// options
 	flags.Var((*flaghelper.StringFlag)(&configPath), "config", "config")
-	flags.StringVar(&cmdConfig.BindAddr, "bind", "", "")
-	flags.StringVar(&cmdConfig.DataDir, "data-dir", "", "")
-	flags.StringVar(&cmdConfig.LogLevel, "log-level", "", "")
+
+	// Every config field can be overridden via a flag
+	addOverrideFlags(flags, &flagValues)
 
 	if err := flags.Parse(c.args); err != nil {
-		return nil
+		return nil, err
 	}
 
-	// Load the configuration
-	mconfig := config.DefaultMayaConfig()
-
-	for _, path := range configPath {
-		current, err := config.LoadMayaConfig(path)
-		if err != nil {
-			c.Ui.Error(fmt.Sprintf(
-				"Error loading configuration from %s: %s", path, err))
-			return nil
-		}
-
-		// The user asked us to load some config here but we didn't find any,
-		// so we'll complain but continue.
-		if current == nil || reflect.DeepEqual(current, &config.MayaConfig{}) {
-			c.Ui.Warn(fmt.Sprintf("No configuration loaded from %s", path))
-		}
+	// Load & validate the configuration
+	mconfig, err := loadMayaConfigs(c.Ui, configPath)
+	if err != nil {
+		return nil, err
+	}
 
-		if mconfig == nil {
-			mconfig = current
-		} else {
-			mconfig = mconfig.Merge(current)
-		}
+	// Apply the env vars over the config file options & then the CLI
+	// options over the env vars
+	if err := mconfig.ApplyEnv(os.Environ()); err != nil {
+		return nil, err
+	}
+	if err := applyOverrideFlags(mconfig, flagValues); err != nil {
+		return nil, err
 	}
 
-	// Merge any CLI options over config file options
-	mconfig = mconfig.Merge(cmdConfig)
+	// Validate the merged configuration as the env vars & the CLI options
+	// are not validated yet
+	if err := mconfig.Validate(); err != nil {
+		return nil, err
+	}
 
 	// Set the version info
 	mconfig.Revision = c.Revision
@@ -106,26 +114,10 @@ func (c *UpCommand) readMayaConfig() *config.MayaConfig {
 
 	// Normalize binds, ports, addresses, and advertise
 	if err := mconfig.NormalizeAddrs(); err != nil {
-		c.Ui.Error(err.Error())
-		return nil
-	}
-
-	// Verify the paths are absolute.
-	dirs := map[string]string{
-		"data-dir": mconfig.DataDir,
-	}
-	for k, dir := range dirs {
-		if dir == "" {
-			continue
-		}
-
-		if !filepath.IsAbs(dir) {
-			c.Ui.Error(fmt.Sprintf("%s must be given as an absolute path: got %v", k, dir))
-			return nil
-		}
+		return nil, err
 	}
 
-	return mconfig
+	return mconfig, nil
 }
 
 // setupLoggers is used to setup the logGate, logWriter, and our logOutput
@@ -137,15 +129,27 @@ func (c *UpCommand) setupLoggers(mconfig *config.MayaConfig) (*loghelper.Writer,
 		Writer: &cli.UiWriter{Ui: c.Ui},
 	}
 
-	c.logFilter = loghelper.LevelFilter()
-	c.logFilter.MinLevel = logutils.LogLevel(strings.ToUpper(mconfig.LogLevel))
-	c.logFilter.Writer = logGate
-	if !loghelper.ValidateLevelFilter(c.logFilter.MinLevel, c.logFilter) {
-		c.Ui.Error(fmt.Sprintf(
-			"Invalid log level: %s. Valid log levels are: %v",
-			c.logFilter.MinLevel, c.logFilter.Levels))
+	// JSON logs are written without the UI prefix & the level prefix so that
+	// each line is a JSON object
+	jsonLogs := mconfig.LogFormat == loghelper.LogFormatJSON
+	if jsonLogs {
+		ui := c.Ui
+		if p, ok := ui.(*cli.PrefixedUi); ok {
+			ui = p.Ui
+		}
+		logGate.Writer = &loghelper.TrimJSONLevelWriter{Writer: &cli.UiWriter{Ui: ui}}
+	}
+
+	// Every component is filtered as per its own level if it has one
+	filter, err := loghelper.NewComponentFilter(mconfig.LogLevel, logGate)
+	if err == nil {
+		err = filter.SetLevels(mconfig.LogLevel, mconfig.LogLevels)
+	}
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Invalid log level: %v", err))
 		return nil, nil, nil
 	}
+	c.logFilter = filter
 
 	// Check if syslog is enabled
 	var syslog io.Writer
@@ -158,21 +162,59 @@ func (c *UpCommand) setupLoggers(mconfig *config.MayaConfig) (*loghelper.Writer,
 		syslog = &loghelper.SyslogWriter{l, c.logFilter}
 	}
 
-	// Create a log writer, and wrap a logOutput around it
+	// Check if the logs are to be written to a file as well
+	var logFile io.Writer
+	if mconfig.LogFile != "" {
+		c.logFile = &loghelper.LogFile{
+			Path:     mconfig.LogFile,
+			LFilter:  c.logFilter,
+			MaxBytes: int64(mconfig.LogRotateBytes),
+			Duration: mconfig.LogRotateDuration,
+			MaxAge:   mconfig.LogRotateMaxAge,
+			MaxFiles: mconfig.LogRotateMaxFiles,
+			Compress: mconfig.LogRotateCompress,
+		}
+		if err := c.logFile.Open(); err != nil {
+			c.Ui.Error(fmt.Sprintf("Log file setup failed: %v", err))
+			return nil, nil, nil
+		}
+		logFile = c.logFile
+	}
+
+	// Create a log writer, and wrap a logOutput around it. Syslog is the last
+	// writer as it reports the filtered logs as short writes.
 	logWriter := loghelper.NewLogRegistrar(512)
-	var logOutput io.Writer
+	writers := []io.Writer{c.logFilter, logWriter}
+	if logFile != nil {
+		writers = append(writers, logFile)
+	}
 	if syslog != nil {
-		logOutput = io.MultiWriter(c.logFilter, logWriter, syslog)
-	} else {
-		logOutput = io.MultiWriter(c.logFilter, logWriter)
+		writers = append(writers, syslog)
+	}
+	logOutput := io.MultiWriter(writers...)
+
+	// Every log line is formatted as JSON before it is filtered, buffered or
+	// sent to syslog
+	if jsonLogs {
+		logOutput = &loghelper.JSONWriter{Writer: logOutput}
 	}
 	c.logOutput = logOutput
 	log.SetOutput(logOutput)
+
+	// The vendored libraries log via glog. Their logs are leveled & filtered
+	// like the other logs rather than being written to stderr.
+	restore, err := loghelper.RouteGlog(logOutput)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to route the glog logs: %v", err))
+		return nil, nil, nil
+	}
+	c.restoreGlog = restore
+
 	return logGate, logWriter, logOutput
 }
 
 // setupMayaServer is used to start Maya server
-func (c *UpCommand) setupMayaServer(mconfig *config.MayaConfig, logOutput io.Writer) error {
+func (c *UpCommand) setupMayaServer(mconfig *config.MayaConfig, logWriter *loghelper.LogRegistrar, logOutput io.Writer) error {
 	c.Ui.Output("Starting maya api server ...")
 
 	// Setup maya service i.e. maya api server
@@ -184,6 +226,15 @@ func (c *UpCommand) setupMayaServer(mconfig *config.MayaConfig, logOutput io.Wri
 
 	c.maya = maya
 
+	// Let the logs be streamed via the monitor endpoint & let the levels of
+	// the logs be changed via the log-level endpoint
+	maya.SetLogRegistrar(logWriter)
+	maya.SetLogLevels(c.logFilter)
+
+	// Let the config be reloaded on SIGHUP & via the reload endpoint
+	maya.SetConfigLoader(c.loadMayaConfig)
+	maya.RegisterReloadable("log level", []string{"log_level", "log_levels"}, c.reloadLogLevel)
+
 	// Setup the HTTP server
 	http, err := server.NewHTTPServer(maya, mconfig, logOutput)
 	if err != nil {
@@ -214,10 +265,14 @@ func (c *UpCommand) Run(args []string) int {
 	}
 
 	// Setup the log outputs
-	logGate, _, logOutput := c.setupLoggers(mconfig)
+	logGate, logWriter, logOutput := c.setupLoggers(mconfig)
 	if logGate == nil {
 		return 1
 	}
+	defer c.restoreGlog()
+	if c.logFile != nil {
+		defer c.logFile.Close()
+	}
 
 	// Log config files
 	if len(mconfig.Files) > 0 {
@@ -227,12 +282,13 @@ func (c *UpCommand) Run(args []string) int {
 	}
 
 	// Setup Maya server
-	if err := c.setupMayaServer(mconfig, logOutput); err != nil {
+	if err := c.setupMayaServer(mconfig, logWriter, logOutput); err != nil {
 		return 1
 	}
 	defer c.maya.Shutdown()
 
-	// Check and shut down at the end
+	// Check and shut down at the end. This does not drain again after a
+	// graceful leave as the http server drains only once.
 	defer func() {
 		if c.httpServer != nil {
 			c.httpServer.Shutdown()
@@ -271,13 +327,13 @@ func (c *UpCommand) Run(args []string) int {
 	logGate.Flush()
 
 	// Wait for exit
-	return c.handleSignals(mconfig)
+	return c.handleSignals()
 }
 
 // handleSignals blocks until we get an exit-causing signal
-func (c *UpCommand) handleSignals(mconfig *config.MayaConfig) int {
+func (c *UpCommand) handleSignals() int {
 	signalCh := make(chan os.Signal, 4)
-	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGPIPE)
+	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGPIPE)
 
 	// Wait for a signal
 WAIT:
@@ -297,14 +353,18 @@ WAIT:
 
 	// Check if this is a SIGHUP
 	if sig == syscall.SIGHUP {
-		if conf := c.handleReload(mconfig); conf != nil {
-			// Update the value only, not address
-			*mconfig = *conf
-		}
+		c.handleReload()
 		goto WAIT
 	}
 
-	// Check if we should do a graceful leave
+	// Reopen the log file on SIGUSR1 e.g. after logrotate has moved it
+	if sig == syscall.SIGUSR1 {
+		c.handleReopenLogFile()
+		goto WAIT
+	}
+
+	// Check if we should do a graceful leave as per the current config
+	mconfig := c.maya.Config()
 	graceful := false
 	if sig == os.Interrupt && mconfig.LeaveOnInt {
 		graceful = true
@@ -317,57 +377,88 @@ WAIT:
 		return 1
 	}
 
-	// Attempt a graceful leave
-	gracefulCh := make(chan struct{})
+	// Attempt a graceful leave. Stop accepting new requests & wait for the
+	// in-flight ones. The whole of it is bound by a single drain timeout.
+	// The context is cancelled on return so that the drain stops at once if
+	// the leave is cut short e.g. by another signal.
+	ctx, cancel := context.WithTimeout(context.Background(), mconfig.DrainTimeout)
+	defer cancel()
+
+	gracefulCh := make(chan error, 1)
 	c.Ui.Output("Gracefully shutting maya api server...")
 	go func() {
-		if err := c.maya.Leave(); err != nil {
-			c.Ui.Error(fmt.Sprintf("Error: %s", err))
-			return
-		}
-		close(gracefulCh)
+		c.httpServer.ShutdownContext(ctx)
+		gracefulCh <- c.maya.LeaveContext(ctx)
 	}()
 
-	// Wait for leave or another signal
+	// Wait for leave, the deadline or another signal
 	select {
 	case <-signalCh:
 		return 1
-	case <-time.After(gracefulTimeout):
+	case <-ctx.Done():
+		c.Ui.Error(fmt.Sprintf("Error: graceful leave did not complete within %v", mconfig.DrainTimeout))
 		return 1
-	case <-gracefulCh:
+	case err := <-gracefulCh:
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err))
+			return 1
+		}
 		return 0
 	}
 }
 
-// handleReload is invoked when we should reload our configs, e.g. SIGHUP
-// TODO
-// The current reload code is very basic.
-// Add ways to reload the orchestrator & plugins without shuting down the
-// process
-func (c *UpCommand) handleReload(mconfig *config.MayaConfig) *config.MayaConfig {
+// handleReload is invoked when we should reload our configs, e.g. SIGHUP.
+// The settings that need a restart are reported but are not applied.
+func (c *UpCommand) handleReload() {
 
 	c.Ui.Output("Reloading maya api server configuration...")
 
-	newConf := c.readMayaConfig()
-	if newConf == nil {
-		c.Ui.Error(fmt.Sprintf("Failed to reload config"))
-		return mconfig
+	result, err := c.maya.Reload()
+
+	var spec interface{}
+	if result != nil {
+		spec = result
 	}
+	c.maya.AuditSignal("SIGHUP", audit.OpConfigReload, spec, err)
 
-	// Change the log level
-	minLevel := logutils.LogLevel(strings.ToUpper(newConf.LogLevel))
-	if loghelper.ValidateLevelFilter(minLevel, c.logFilter) {
-		c.logFilter.SetMinLevel(minLevel)
-	} else {
-		c.Ui.Error(fmt.Sprintf(
-			"Invalid log level: %s. Valid log levels are: %v",
-			minLevel, c.logFilter.Levels))
+	if err != nil {
+		c.Ui.Error("Failed to reload config")
+		reportConfigErrors(c.Ui, err)
+		return
+	}
 
-		// Keep the current log level
-		newConf.LogLevel = mconfig.LogLevel
+	if len(result.RestartRequired) > 0 {
+		c.Ui.Warn(fmt.Sprintf("Restart maya api server to apply: %s",
+			strings.Join(result.RestartRequired, ", ")))
 	}
+}
 
-	return newConf
+// handleReopenLogFile reopens the log file so that the logs are written to a
+// new file once the current one is moved away by an external tool
+func (c *UpCommand) handleReopenLogFile() {
+	if c.logFile == nil {
+		return
+	}
+
+	if err := c.logFile.Reopen(); err != nil {
+		c.Ui.Error(fmt.Sprintf("Failed to reopen the log file: %v", err))
+		return
+	}
+
+	c.Ui.Output("Reopened the log file")
+}
+
+// reloadLogLevel changes the levels of the logs as per the new config. The
+// levels of the components that were set via the log-level endpoint are
+// replaced as well.
+func (c *UpCommand) reloadLogLevel(old, new *config.MayaConfig) (func(), func(), error) {
+	if err := loghelper.ValidateLevels(new.LogLevel, new.LogLevels); err != nil {
+		return nil, nil, err
+	}
+
+	return func() {
+		c.logFilter.SetLevels(new.LogLevel, new.LogLevels)
+	}, nil, nil
 }
 
 // Synopsis returns that maya api server started
@@ -383,8 +474,10 @@ Usage: m-apiserver up [options]
   Starts maya api server and runs until an interrupt is received.
 
   The maya api server's configuration primarily comes from the config
-  files used, but a subset of the options may also be passed directly
-  as CLI arguments, listed below.
+  files used. Every config field may also be set via an env var with the
+  MAPI_ prefix or directly as a CLI argument. The CLI arguments take
+  precedence over the env vars, which take precedence over the config
+  files, which in turn take precedence over the defaults.
 
 General Options :
 
@@ -407,15 +500,18 @@ General Options :
     downloaded artifacts used by drivers. On server nodes, the data
     dir is also used to store the replicated log.
 
+  -drain-timeout=<duration>
+    The duration to wait for in-flight requests to complete during a
+    graceful shutdown e.g. 30s. Requests still in flight after this
+    duration are cut off. The default is 5s.
+
   -log-level=<level>
     Specify the verbosity level of maya api server's logs. Valid values include
     DEBUG, INFO, and WARN, in decreasing order of verbosity. The
     default is INFO.
 
-  -node=<name>
-    The name of the local agent. This name is used to identify the node
-    in the cluster. The name must be unique per region. The default is
-    the current hostname of the machine.
- `
+Config Overrides :
+
+` + overridesHelp()
 	return strings.TrimSpace(helpText)
 }
@@ -1,12 +1,18 @@
 package cmd
 
 import (
+	"encoding/json"
 	"io/ioutil"
+	"log"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/golang/glog"
 	"github.com/mitchellh/cli"
+	"github.com/openebs/mayaserver/lib/config"
+	"github.com/openebs/mayaserver/lib/loghelper"
 )
 
 func TestCommand_Implements(t *testing.T) {
@@ -64,3 +70,141 @@ func TestCommand_Args(t *testing.T) {
 		}
 	}
 }
+
+func TestSetupLoggers_JSON(t *testing.T) {
+	defer log.SetOutput(os.Stderr)
+
+	ui := new(cli.MockUi)
+	c := &UpCommand{Ui: &cli.PrefixedUi{InfoPrefix: "    ", Ui: ui}}
+
+	mconfig := config.DefaultMayaConfig()
+	mconfig.LogFormat = "json"
+
+	logGate, logWriter, logOutput := c.setupLoggers(mconfig)
+	if logGate == nil {
+		t.Fatalf("failed to setup loggers: %s", ui.ErrorWriter.String())
+	}
+	defer c.restoreGlog()
+	logGate.Flush()
+
+	h := &logHandler{}
+	logWriter.RegisterHandler(h)
+
+	loghelper.NewLogger(logOutput).With("volume", "vol1").Printf("[INFO] http: Processed request")
+	log.Printf("[DEBUG] http: Filtered")
+
+	// Every line is a JSON object & the lines below the log level are
+	// filtered
+	lines := strings.Split(strings.TrimSpace(ui.OutputWriter.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 line, got: %q", lines)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("expected a JSON line, got: %s %v", lines[0], err)
+	}
+	if entry["volume"] != "vol1" || entry["message"] != "Processed request" {
+		t.Fatalf("bad entry: %v", entry)
+	}
+
+	// The log registrar receives every line including its level
+	if len(h.logs) != 2 || !strings.HasPrefix(h.logs[1], "[DEBUG] {") {
+		t.Fatalf("bad registrar logs: %q", h.logs)
+	}
+}
+
+type logHandler struct {
+	logs []string
+}
+
+func (h *logHandler) HandleLog(line string) {
+	h.logs = append(h.logs, line)
+}
+
+func TestSetupLoggers_LogFile(t *testing.T) {
+	defer log.SetOutput(os.Stderr)
+
+	dir, err := ioutil.TempDir("", "mayaserver")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ui := new(cli.MockUi)
+	c := &UpCommand{Ui: ui}
+
+	mconfig := config.DefaultMayaConfig()
+	mconfig.LogFile = filepath.Join(dir, "logs", "mapiserver.log")
+
+	if logGate, _, _ := c.setupLoggers(mconfig); logGate == nil {
+		t.Fatalf("failed to setup loggers: %s", ui.ErrorWriter.String())
+	}
+	defer c.restoreGlog()
+
+	log.Printf("[INFO] http: Logged to file")
+	log.Printf("[DEBUG] http: Filtered")
+	c.logFile.Close()
+
+	out, err := ioutil.ReadFile(mconfig.LogFile)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !strings.Contains(string(out), "[INFO] http: Logged to file") || strings.Contains(string(out), "Filtered") {
+		t.Fatalf("bad log file: %s", out)
+	}
+}
+
+func TestSetupLoggers_ComponentLevels(t *testing.T) {
+	defer log.SetOutput(os.Stderr)
+
+	ui := new(cli.MockUi)
+	c := &UpCommand{Ui: ui}
+
+	mconfig := config.DefaultMayaConfig()
+	mconfig.LogLevels = map[string]string{
+		"orchprovider.k8s": "DEBUG",
+		"glog":             "WARN",
+	}
+
+	logGate, _, _ := c.setupLoggers(mconfig)
+	if logGate == nil {
+		t.Fatalf("failed to setup loggers: %s", ui.ErrorWriter.String())
+	}
+	logGate.Flush()
+
+	log.Printf("[DEBUG] orchprovider.k8s: Logged")
+	log.Printf("[DEBUG] http: Filtered")
+	glog.Infof("Filtered glog")
+	glog.Warningf("Logged glog")
+
+	// The pending glog lines are routed once the routing stops
+	c.restoreGlog()
+
+	out := ui.OutputWriter.String()
+	if !strings.Contains(out, "[DEBUG] orchprovider.k8s: Logged") || !strings.Contains(out, "[WARN] glog: Logged glog") {
+		t.Fatalf("expected the logs of the components, got: %s", out)
+	}
+	if strings.Contains(out, "Filtered") {
+		t.Fatalf("expected the logs below the levels to be filtered, got: %s", out)
+	}
+
+	// The levels of the components are replaced on reload
+	next := mconfig.Copy()
+	next.LogLevels = map[string]string{"http": "DEBUG"}
+	commit, _, err := c.reloadLogLevel(mconfig, next)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	commit()
+
+	level, components := c.logFilter.Levels()
+	if level != "INFO" || len(components) != 1 || components["http"] != "DEBUG" {
+		t.Fatalf("bad levels: %s %v", level, components)
+	}
+
+	next.LogLevels["http"] = "CHATTY"
+	if _, _, err := c.reloadLogLevel(mconfig, next); err == nil {
+		t.Fatalf("expected an invalid level to be rejected")
+	}
+}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ghodss/yaml"
+	"github.com/openebs/maya/types/v1"
+	"github.com/openebs/mayaserver/lib/api"
+)
+
+// volumeStatusColors are the colors of the volume statuses in the output
+var volumeStatusColors = map[string]string{
+	api.VolumeStatusRunning:  "green",
+	api.VolumeStatusDegraded: "yellow",
+	api.VolumeStatusPending:  "yellow",
+	api.VolumeStatusFailed:   "red",
+}
+
+// outputFlags are the options of the volume commands that select the format
+// of the output
+type outputFlags struct {
+	json    bool
+	yaml    bool
+	verbose bool
+}
+
+// register adds the options to the flag set
+func (o *outputFlags) register(f *flag.FlagSet) {
+	f.BoolVar(&o.json, "json", false, "")
+	f.BoolVar(&o.yaml, "yaml", false, "")
+	f.BoolVar(&o.verbose, "verbose", false, "")
+}
+
+// validate verifies that at most one format is selected
+func (o *outputFlags) validate() error {
+	if o.json && o.yaml {
+		return fmt.Errorf("Only one of -json & -yaml can be set")
+	}
+	return nil
+}
+
+// encode formats the object as JSON or YAML if either is selected. It
+// returns false if the object is to be formatted as a table.
+func (o *outputFlags) encode(obj interface{}) (string, bool, error) {
+	switch {
+	case o.json:
+		b, err := json.MarshalIndent(obj, "", "    ")
+		return string(b), true, err
+	case o.yaml:
+		b, err := yaml.Marshal(obj)
+		return strings.TrimSpace(string(b)), true, err
+	}
+	return "", false, nil
+}
+
+// idLength returns the length the volume IDs are truncated to
+func (o *outputFlags) idLength() int {
+	if o.verbose {
+		return fullId
+	}
+	return shortId
+}
+
+// outputFlagsUsage returns the help string of the output options
+func outputFlagsUsage() string {
+	helpText := `
+  -json
+    Output the volume in JSON format.
+
+  -yaml
+    Output the volume in YAML format.
+
+  -verbose
+    Display the full volume ID rather than the short ID.
+`
+	return strings.TrimSpace(helpText)
+}
+
+// volumeID returns the ID of the volume truncated to the given length. A
+// volume without an ID e.g. one that is not yet provisioned is shown with a
+// dash.
+func volumeID(pv *v1.PersistentVolume, length int) string {
+	if pv.UID == "" {
+		return "-"
+	}
+	return limit(pv.UID, length)
+}
+
+// volumeAnnotation returns the value of the annotation of the volume or a
+// dash if it is not set
+func volumeAnnotation(pv *v1.PersistentVolume, lbl v1.MayaAPIServiceOutputLabel) string {
+	if v := strings.TrimSpace(pv.Annotations[string(lbl)]); v != "" {
+		return v
+	}
+	return "-"
+}
+
+// coloredStatus returns the status of the volume colored as per its health
+func (m *Meta) coloredStatus(pv *v1.PersistentVolume) string {
+	status := api.VolumeStatus(pv.Annotations)
+	color, ok := volumeStatusColors[status]
+	if !ok {
+		return status
+	}
+	return m.Colorize().Color(fmt.Sprintf("[%s]%s", color, status))
+}
+
+// formatVolumes formats the volumes as a table. The status is the last
+// column as the colors would misalign the columns that follow.
+func (m *Meta) formatVolumes(pvs []v1.PersistentVolume, idLength int) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintln(w, "ID\tName\tSize\tReplicas\tPortal\tStatus")
+	for i := range pvs {
+		pv := &pvs[i]
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			volumeID(pv, idLength),
+			pv.Name,
+			volumeAnnotation(pv, v1.VolumeSizeAPILbl),
+			volumeAnnotation(pv, v1.ReplicaCountAPILbl),
+			volumeAnnotation(pv, v1.TargetPortalsAPILbl),
+			m.coloredStatus(pv))
+	}
+	w.Flush()
+
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+// formatVolume formats the details of the volume as key value pairs
+func (m *Meta) formatVolume(pv *v1.PersistentVolume, idLength int) string {
+	kvs := [][2]string{
+		{"ID", volumeID(pv, idLength)},
+		{"Name", pv.Name},
+		{"Status", m.coloredStatus(pv)},
+		{"Size", volumeAnnotation(pv, v1.VolumeSizeAPILbl)},
+		{"IQN", volumeAnnotation(pv, v1.IQNAPILbl)},
+		{"Target Portals", volumeAnnotation(pv, v1.TargetPortalsAPILbl)},
+		{"Cluster IPs", volumeAnnotation(pv, v1.ClusterIPsAPILbl)},
+		{"Controller IPs", volumeAnnotation(pv, v1.ControllerIPsAPILbl)},
+		{"Controller Status", volumeAnnotation(pv, v1.ControllerStatusAPILbl)},
+		{"Replica Count", volumeAnnotation(pv, v1.ReplicaCountAPILbl)},
+		{"Replica IPs", volumeAnnotation(pv, v1.ReplicaIPsAPILbl)},
+		{"Replica Status", volumeAnnotation(pv, v1.ReplicaStatusAPILbl)},
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 1, ' ', 0)
+	for _, kv := range kvs {
+		fmt.Fprintf(w, "%s\t= %s\n", kv[0], kv[1])
+	}
+	w.Flush()
+
+	return strings.TrimRight(buf.String(), "\n")
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/openebs/maya/types/v1"
+)
+
+// VolumeCreateCommand is a cli implementation that creates a volume from a
+// spec file.
+type VolumeCreateCommand struct {
+	Meta
+}
+
+// Help returns the usage of volume create command
+func (c *VolumeCreateCommand) Help() string {
+	helpText := `
+Usage: m-apiserver volume create [options] -f <spec>
+
+  Creates a volume from the persistent volume claim in the spec file. The
+  spec is expected in YAML or JSON format. The spec is read from stdin if
+  the path is "-".
+
+General Options:
+
+  ` + generalOptionsUsage() + `
+
+Create Options:
+
+  -f=<path>
+    The spec file of the volume.
+
+  ` + outputFlagsUsage() + `
+`
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis returns the synopsis of volume create command
+func (c *VolumeCreateCommand) Synopsis() string {
+	return "Creates a volume"
+}
+
+// Run creates the volume
+func (c *VolumeCreateCommand) Run(args []string) int {
+	var specPath string
+	var output outputFlags
+
+	flags := c.Meta.FlagSet("volume create", FlagSetClient)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	flags.StringVar(&specPath, "f", "", "")
+	output.register(flags)
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if len(flags.Args()) != 0 || specPath == "" {
+		c.Ui.Error("This command takes the spec file via -f & no arguments")
+		c.Ui.Error("For additional help try 'm-apiserver volume create -help'")
+		return 1
+	}
+	if err := output.validate(); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	pvc, err := readVolumeSpec(specPath)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error reading the spec: %s", err))
+		return 1
+	}
+
+	client, err := c.Meta.Client()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing client: %s", err))
+		return 1
+	}
+
+	pv, err := client.Volumes().Create(pvc, nil)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error creating volume: %s", err))
+		return 1
+	}
+
+	out, ok, err := output.encode(pv)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error formatting volume: %s", err))
+		return 1
+	}
+	if !ok {
+		out = fmt.Sprintf("Volume %q created\n\n%s", pv.Name, c.Meta.formatVolume(pv, output.idLength()))
+	}
+
+	c.Ui.Output(out)
+	return 0
+}
+
+// readVolumeSpec reads the claim from the spec file. JSON is read as YAML
+// as it is a subset of YAML.
+func readVolumeSpec(path string) (*v1.PersistentVolumeClaim, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var pvc v1.PersistentVolumeClaim
+	if err := yaml.Unmarshal(data, &pvc); err != nil {
+		return nil, err
+	}
+	if pvc.Name == "" {
+		return nil, fmt.Errorf("the spec does not have a name")
+	}
+	return &pvc, nil
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/openebs/mayaserver/lib/api"
+)
+
+// VolumeDeleteCommand is a cli implementation that deletes a volume.
+type VolumeDeleteCommand struct {
+	Meta
+}
+
+// Help returns the usage of volume delete command
+func (c *VolumeDeleteCommand) Help() string {
+	helpText := `
+Usage: m-apiserver volume delete [options] <name>
+
+  Deletes the volume along with its controllers & replicas.
+
+General Options:
+
+  ` + generalOptionsUsage() + `
+`
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis returns the synopsis of volume delete command
+func (c *VolumeDeleteCommand) Synopsis() string {
+	return "Deletes a volume"
+}
+
+// Run deletes the volume
+func (c *VolumeDeleteCommand) Run(args []string) int {
+	flags := c.Meta.FlagSet("volume delete", FlagSetClient)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if len(flags.Args()) != 1 {
+		c.Ui.Error("This command takes one argument: <name>")
+		c.Ui.Error("For additional help try 'm-apiserver volume delete -help'")
+		return 1
+	}
+	name := flags.Args()[0]
+
+	client, err := c.Meta.Client()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing client: %s", err))
+		return 1
+	}
+
+	err = client.Volumes().Delete(name, nil)
+	if api.IsNotFound(err) {
+		c.Ui.Error(fmt.Sprintf("Volume %q not found", name))
+		return 1
+	}
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error deleting volume: %s", err))
+		return 1
+	}
+
+	c.Ui.Output(fmt.Sprintf("Volume %q deleted", name))
+	return 0
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// VolumeListCommand is a cli implementation that lists the volumes.
+type VolumeListCommand struct {
+	Meta
+}
+
+// Help returns the usage of volume list command
+func (c *VolumeListCommand) Help() string {
+	helpText := `
+Usage: m-apiserver volume list [options]
+
+  Lists the volumes along with their status. The status is derived from the
+  controller & replica pods of the volume.
+
+General Options:
+
+  ` + generalOptionsUsage() + `
+
+List Options:
+
+  ` + outputFlagsUsage() + `
+`
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis returns the synopsis of volume list command
+func (c *VolumeListCommand) Synopsis() string {
+	return "Lists the volumes"
+}
+
+// Run lists the volumes
+func (c *VolumeListCommand) Run(args []string) int {
+	var output outputFlags
+
+	flags := c.Meta.FlagSet("volume list", FlagSetClient)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	output.register(flags)
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if len(flags.Args()) != 0 {
+		c.Ui.Error("This command takes no arguments")
+		c.Ui.Error("For additional help try 'm-apiserver volume list -help'")
+		return 1
+	}
+	if err := output.validate(); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	client, err := c.Meta.Client()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing client: %s", err))
+		return 1
+	}
+
+	pvl, _, err := client.Volumes().List(nil)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error listing volumes: %s", err))
+		return 1
+	}
+
+	out, ok, err := output.encode(pvl)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error formatting volumes: %s", err))
+		return 1
+	}
+	if !ok {
+		if len(pvl.Items) == 0 {
+			out = "No volumes found"
+		} else {
+			out = c.Meta.formatVolumes(pvl.Items, output.idLength())
+		}
+	}
+
+	c.Ui.Output(out)
+	return 0
+}
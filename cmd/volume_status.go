@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/openebs/mayaserver/lib/api"
+)
+
+// VolumeStatusCommand is a cli implementation that displays the status of a
+// volume.
+type VolumeStatusCommand struct {
+	Meta
+}
+
+// Help returns the usage of volume status command
+func (c *VolumeStatusCommand) Help() string {
+	helpText := `
+Usage: m-apiserver volume status [options] <name>
+
+  Displays the status of the volume along with the details of its target
+  portal, controllers & replicas.
+
+General Options:
+
+  ` + generalOptionsUsage() + `
+
+Status Options:
+
+  ` + outputFlagsUsage() + `
+`
+	return strings.TrimSpace(helpText)
+}
+
+// Synopsis returns the synopsis of volume status command
+func (c *VolumeStatusCommand) Synopsis() string {
+	return "Displays the status of a volume"
+}
+
+// Run displays the status of the volume
+func (c *VolumeStatusCommand) Run(args []string) int {
+	var output outputFlags
+
+	flags := c.Meta.FlagSet("volume status", FlagSetClient)
+	flags.Usage = func() { c.Ui.Output(c.Help()) }
+	output.register(flags)
+
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if len(flags.Args()) != 1 {
+		c.Ui.Error("This command takes one argument: <name>")
+		c.Ui.Error("For additional help try 'm-apiserver volume status -help'")
+		return 1
+	}
+	if err := output.validate(); err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+	name := flags.Args()[0]
+
+	client, err := c.Meta.Client()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing client: %s", err))
+		return 1
+	}
+
+	pv, _, err := client.Volumes().Info(name, nil)
+	if api.IsNotFound(err) {
+		c.Ui.Error(fmt.Sprintf("Volume %q not found", name))
+		return 1
+	}
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error reading volume: %s", err))
+		return 1
+	}
+
+	out, ok, err := output.encode(pv)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error formatting volume: %s", err))
+		return 1
+	}
+	if !ok {
+		out = c.Meta.formatVolume(pv, output.idLength())
+	}
+
+	c.Ui.Output(out)
+	return 0
+}
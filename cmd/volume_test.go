@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mitchellh/cli"
+	"github.com/openebs/maya/types/v1"
+)
+
+const testVolumeUID = "8f1a4c2e-5b7d-4e0a-9c3f-2d6b8a1e7f90"
+
+func testVolume(name string) v1.PersistentVolume {
+	pv := v1.PersistentVolume{}
+	pv.Name = name
+	pv.UID = testVolumeUID
+	pv.Annotations = map[string]string{
+		string(v1.ControllerStatusAPILbl): "Running",
+		string(v1.ReplicaStatusAPILbl):    "Running,Pending",
+		string(v1.VolumeSizeAPILbl):       "5G",
+		string(v1.ReplicaCountAPILbl):     "2",
+		string(v1.TargetPortalsAPILbl):    "10.0.0.10:3260",
+		string(v1.IQNAPILbl):              "iqn.2016-09.com.openebs.jiva:" + name,
+	}
+	return pv
+}
+
+// testVolumeServer fakes the volume endpoints of maya api server. Only the
+// volume vol1 exists.
+func testVolumeServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		var out interface{}
+		switch path := req.URL.Path; {
+		case path == "/latest/volumes/" && req.Method == "POST":
+			var pvc v1.PersistentVolumeClaim
+			if err := json.NewDecoder(req.Body).Decode(&pvc); err != nil {
+				resp.WriteHeader(400)
+				return
+			}
+			out = testVolume(pvc.Name)
+		case path == "/latest/volumes/":
+			out = v1.PersistentVolumeList{Items: []v1.PersistentVolume{testVolume("vol1")}}
+		case path == "/latest/volumes/info/vol1":
+			out = testVolume("vol1")
+		case path == "/latest/volumes/delete/vol1":
+			out = "VSM 'vol1' deleted successfully"
+		default:
+			resp.WriteHeader(404)
+			resp.Write([]byte("Volume not found"))
+			return
+		}
+		json.NewEncoder(resp).Encode(out)
+	}))
+}
+
+func TestVolumeCommands_Implements(t *testing.T) {
+	var _ cli.Command = &VolumeCreateCommand{}
+	var _ cli.Command = &VolumeListCommand{}
+	var _ cli.Command = &VolumeStatusCommand{}
+	var _ cli.Command = &VolumeDeleteCommand{}
+}
+
+func TestVolumeCreateCommand_Run(t *testing.T) {
+	srv := testVolumeServer(t)
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "mapiserver")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	spec := filepath.Join(dir, "spec.yaml")
+	if err := ioutil.WriteFile(spec, []byte("kind: PersistentVolumeClaim\nmetadata:\n  name: vol2\n"), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	ui := new(cli.MockUi)
+	c := &VolumeCreateCommand{Meta: Meta{Ui: ui}}
+	if code := c.Run([]string{"-address=" + srv.URL, "-no-color", "-f", spec}); code != 0 {
+		t.Fatalf("expected exit code 0, got: %d %s", code, ui.ErrorWriter.String())
+	}
+	out := ui.OutputWriter.String()
+	if !strings.Contains(out, `Volume "vol2" created`) || !strings.Contains(out, "iqn.2016-09.com.openebs.jiva:vol2") {
+		t.Fatalf("bad output: %s", out)
+	}
+
+	// The spec is required
+	ui = new(cli.MockUi)
+	c = &VolumeCreateCommand{Meta: Meta{Ui: ui}}
+	if code := c.Run([]string{"-address=" + srv.URL}); code != 1 {
+		t.Fatalf("expected exit code 1, got: %d", code)
+	}
+}
+
+func TestVolumeListCommand_Run(t *testing.T) {
+	srv := testVolumeServer(t)
+	defer srv.Close()
+
+	ui := new(cli.MockUi)
+	c := &VolumeListCommand{Meta: Meta{Ui: ui}}
+	if code := c.Run([]string{"-address=" + srv.URL, "-no-color"}); code != 0 {
+		t.Fatalf("expected exit code 0, got: %d %s", code, ui.ErrorWriter.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(ui.OutputWriter.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "ID") {
+		t.Fatalf("bad output: %q", lines)
+	}
+	fields := strings.Fields(lines[1])
+	expected := []string{testVolumeUID[:shortId], "vol1", "5G", "2", "10.0.0.10:3260", "degraded"}
+	if strings.Join(fields, " ") != strings.Join(expected, " ") {
+		t.Fatalf("expected row %v, got: %v", expected, fields)
+	}
+
+	// The full ID is displayed if verbose
+	ui = new(cli.MockUi)
+	c = &VolumeListCommand{Meta: Meta{Ui: ui}}
+	if code := c.Run([]string{"-address=" + srv.URL, "-verbose"}); code != 0 {
+		t.Fatalf("expected exit code 0, got: %d %s", code, ui.ErrorWriter.String())
+	}
+	if out := ui.OutputWriter.String(); !strings.Contains(out, testVolumeUID) {
+		t.Fatalf("expected the full ID, got: %s", out)
+	}
+
+	// The status is colored unless disabled
+	if out := ui.OutputWriter.String(); !strings.Contains(out, "\x1b[33mdegraded") {
+		t.Fatalf("expected a colored status, got: %q", out)
+	}
+}
+
+func TestVolumeListCommand_Formats(t *testing.T) {
+	srv := testVolumeServer(t)
+	defer srv.Close()
+
+	ui := new(cli.MockUi)
+	c := &VolumeListCommand{Meta: Meta{Ui: ui}}
+	if code := c.Run([]string{"-address=" + srv.URL, "-json"}); code != 0 {
+		t.Fatalf("expected exit code 0, got: %d %s", code, ui.ErrorWriter.String())
+	}
+	var pvl v1.PersistentVolumeList
+	if err := json.Unmarshal(ui.OutputWriter.Bytes(), &pvl); err != nil || len(pvl.Items) != 1 {
+		t.Fatalf("expected a JSON list, got: %v %s", err, ui.OutputWriter.String())
+	}
+
+	ui = new(cli.MockUi)
+	c = &VolumeListCommand{Meta: Meta{Ui: ui}}
+	if code := c.Run([]string{"-address=" + srv.URL, "-yaml"}); code != 0 {
+		t.Fatalf("expected exit code 0, got: %d %s", code, ui.ErrorWriter.String())
+	}
+	if out := ui.OutputWriter.String(); !strings.Contains(out, "name: vol1") {
+		t.Fatalf("expected YAML, got: %s", out)
+	}
+
+	ui = new(cli.MockUi)
+	c = &VolumeListCommand{Meta: Meta{Ui: ui}}
+	if code := c.Run([]string{"-address=" + srv.URL, "-json", "-yaml"}); code != 1 {
+		t.Fatalf("expected exit code 1, got: %d", code)
+	}
+}
+
+func TestVolumeStatusCommand_Run(t *testing.T) {
+	srv := testVolumeServer(t)
+	defer srv.Close()
+
+	ui := new(cli.MockUi)
+	c := &VolumeStatusCommand{Meta: Meta{Ui: ui}}
+	if code := c.Run([]string{"-address=" + srv.URL, "-no-color", "vol1"}); code != 0 {
+		t.Fatalf("expected exit code 0, got: %d %s", code, ui.ErrorWriter.String())
+	}
+	out := ui.OutputWriter.String()
+	for _, s := range []string{"= " + testVolumeUID[:shortId] + "\n", "= degraded", "= Running,Pending"} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("expected %q in output: %s", s, out)
+		}
+	}
+
+	ui = new(cli.MockUi)
+	c = &VolumeStatusCommand{Meta: Meta{Ui: ui}}
+	if code := c.Run([]string{"-address=" + srv.URL, "vol9"}); code != 1 {
+		t.Fatalf("expected exit code 1, got: %d", code)
+	}
+	if out := ui.ErrorWriter.String(); !strings.Contains(out, `Volume "vol9" not found`) {
+		t.Fatalf("bad error: %s", out)
+	}
+}
+
+func TestVolumeDeleteCommand_Run(t *testing.T) {
+	srv := testVolumeServer(t)
+	defer srv.Close()
+
+	ui := new(cli.MockUi)
+	c := &VolumeDeleteCommand{Meta: Meta{Ui: ui}}
+	if code := c.Run([]string{"-address=" + srv.URL, "vol1"}); code != 0 {
+		t.Fatalf("expected exit code 0, got: %d %s", code, ui.ErrorWriter.String())
+	}
+	if out := ui.OutputWriter.String(); !strings.Contains(out, `Volume "vol1" deleted`) {
+		t.Fatalf("bad output: %s", out)
+	}
+
+	ui = new(cli.MockUi)
+	c = &VolumeDeleteCommand{Meta: Meta{Ui: ui}}
+	if code := c.Run([]string{"-address=" + srv.URL, "vol9"}); code != 1 {
+		t.Fatalf("expected exit code 1, got: %d", code)
+	}
+}
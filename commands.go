@@ -24,6 +24,26 @@ func Commands(metaPtr *cmd.Meta) map[string]cli.CommandFactory {
 	}
 
 	return map[string]cli.CommandFactory{
+		"audit verify": func() (cli.Command, error) {
+			return &cmd.AuditVerifyCommand{
+				Meta: meta,
+			}, nil
+		},
+		"config validate": func() (cli.Command, error) {
+			return &cmd.ConfigValidateCommand{
+				Meta: meta,
+			}, nil
+		},
+		"debug bundle": func() (cli.Command, error) {
+			return &cmd.DebugBundleCommand{
+				Meta: meta,
+			}, nil
+		},
+		"monitor": func() (cli.Command, error) {
+			return &cmd.MonitorCommand{
+				Meta: meta,
+			}, nil
+		},
 		"up": func() (cli.Command, error) {
 			return &cmd.UpCommand{
 				Revision:          GitCommit,
@@ -54,5 +74,25 @@ func Commands(metaPtr *cmd.Meta) map[string]cli.CommandFactory {
 				Ui:                meta.Ui,
 			}, nil
 		},
+		"volume create": func() (cli.Command, error) {
+			return &cmd.VolumeCreateCommand{
+				Meta: meta,
+			}, nil
+		},
+		"volume delete": func() (cli.Command, error) {
+			return &cmd.VolumeDeleteCommand{
+				Meta: meta,
+			}, nil
+		},
+		"volume list": func() (cli.Command, error) {
+			return &cmd.VolumeListCommand{
+				Meta: meta,
+			}, nil
+		},
+		"volume status": func() (cli.Command, error) {
+			return &cmd.VolumeStatusCommand{
+				Meta: meta,
+			}, nil
+		},
 	}
 }
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"io"
+	"net/url"
+)
+
+// Agent is used to administer maya api server itself
+type Agent struct {
+	client *Client
+}
+
+// Agent returns a handle on the agent endpoints
+func (c *Client) Agent() *Agent {
+	return &Agent{client: c}
+}
+
+// Monitor streams the log lines of the given level & above. The recent
+// lines are streamed first. The stream is to be closed by the caller.
+func (a *Agent) Monitor(level string, q *QueryOptions) (io.ReadCloser, error) {
+	params := url.Values{}
+	params.Set("log_level", level)
+
+	resp, err := a.client.doRequest(&request{
+		ctx:    q.Context(),
+		method: "GET",
+		path:   "/v1/agent/monitor",
+		params: params,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Debug reads the named debug item e.g. config or logs. The item is streamed
+// as served. The stream is to be closed by the caller. Maya api server serves
+// the debug items if enable_debug is set.
+func (a *Agent) Debug(item string, params url.Values, q *QueryOptions) (io.ReadCloser, error) {
+	resp, err := a.client.doRequest(&request{
+		ctx:    q.Context(),
+		method: "GET",
+		path:   "/v1/agent/debug/" + item,
+		params: params,
+		retry:  true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Profile reads the named runtime profile e.g. heap or profile i.e. the CPU
+// profile. The profile is streamed in pprof format as served by
+// net/http/pprof. The stream is to be closed by the caller. Maya api server
+// serves the profiles if enable_debug is set.
+func (a *Agent) Profile(name string, params url.Values, q *QueryOptions) (io.ReadCloser, error) {
+	resp, err := a.client.doRequest(&request{
+		ctx:    q.Context(),
+		method: "GET",
+		path:   "/debug/pprof/" + name,
+		params: params,
+		retry:  true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
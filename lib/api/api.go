@@ -0,0 +1,463 @@
+// Package api is a Go client of the HTTP API of maya api server. It is used
+// by the CLI commands of maya api server & can be imported by the other
+// clients e.g. a flex volume driver rather than hand rolling the HTTP calls.
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sethgrid/pester"
+)
+
+const (
+	// EnvAddress is the env var that sets the address of maya api server
+	EnvAddress = "MAPI_ADDR"
+
+	// EnvToken is the env var that sets the token sent to maya api server
+	EnvToken = "MAPI_TOKEN"
+
+	// EnvCACert is the env var that sets the path of the CA certificate
+	// used to verify the certificate of maya api server
+	EnvCACert = "MAPI_CACERT"
+
+	// EnvClientCert & EnvClientKey are the env vars that set the paths of
+	// the client certificate & key presented to maya api server
+	EnvClientCert = "MAPI_CLIENT_CERT"
+	EnvClientKey  = "MAPI_CLIENT_KEY"
+
+	// EnvSkipVerify is the env var that disables the verification of the
+	// certificate of maya api server
+	EnvSkipVerify = "MAPI_SKIP_VERIFY"
+
+	// DefaultAddress is the address of maya api server if none is set
+	DefaultAddress = "http://127.0.0.1:5656"
+
+	// HeaderIndex is the response header that carries the index of the
+	// queried objects. It is used as the WaitIndex of a blocking query.
+	HeaderIndex = "X-Maya-Index"
+
+	// defaultMaxRetries is the no. of retries of a query as per the default
+	// config
+	defaultMaxRetries = 2
+)
+
+// Config is used to configure the client
+type Config struct {
+	// Address is the address of maya api server e.g. http://127.0.0.1:5656
+	Address string
+
+	// Token is sent as a bearer token along with every request if set
+	Token string
+
+	// TLSConfig is used to talk to maya api server over https
+	TLSConfig *TLSConfig
+
+	// HttpClient is the client used for the requests. A client is built as
+	// per TLSConfig if this is not set.
+	HttpClient *http.Client
+
+	// WaitTime is the max duration a blocking query waits if the query
+	// does not set its own. The server's default is used if this is 0.
+	WaitTime time.Duration
+
+	// MaxRetries is the no. of times a query is retried if maya api server
+	// is unreachable or unavailable. Writes are not retried as they may
+	// have been applied already.
+	MaxRetries int
+
+	// Backoff is the duration to wait before the given retry. It defaults
+	// to a linear backoff of a second per retry along with a jitter.
+	Backoff pester.BackoffStrategy
+}
+
+// TLSConfig is used to configure the TLS of the client
+type TLSConfig struct {
+	// CACert is the path of the PEM encoded CA certificate used to verify
+	// the certificate of maya api server
+	CACert string
+
+	// ClientCert & ClientKey are the paths of the PEM encoded certificate &
+	// key presented to maya api server
+	ClientCert string
+	ClientKey  string
+
+	// Insecure disables the verification of the certificate of maya api
+	// server
+	Insecure bool
+}
+
+// DefaultConfig returns the default config of the client. It is read from
+// the env vars if set.
+func DefaultConfig() *Config {
+	config := &Config{
+		Address:    DefaultAddress,
+		TLSConfig:  &TLSConfig{},
+		MaxRetries: defaultMaxRetries,
+		Backoff:    pester.LinearJitterBackoff,
+	}
+
+	if addr := os.Getenv(EnvAddress); addr != "" {
+		config.Address = addr
+	}
+	config.Token = os.Getenv(EnvToken)
+	config.TLSConfig.CACert = os.Getenv(EnvCACert)
+	config.TLSConfig.ClientCert = os.Getenv(EnvClientCert)
+	config.TLSConfig.ClientKey = os.Getenv(EnvClientKey)
+	if v := os.Getenv(EnvSkipVerify); v != "" {
+		config.TLSConfig.Insecure, _ = strconv.ParseBool(v)
+	}
+
+	return config
+}
+
+// tlsConfig builds the TLS config of the http client
+func (t *TLSConfig) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: t.Insecure}
+
+	if t.CACert != "" {
+		pem, err := ioutil.ReadFile(t.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CA certificate: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("failed to parse the CA certificate: %s", t.CACert)
+		}
+		config.RootCAs = pool
+	}
+
+	if t.ClientCert != "" || t.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(t.ClientCert, t.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// Client is a client of the HTTP API of maya api server
+type Client struct {
+	config     Config
+	httpClient *http.Client
+}
+
+// NewClient returns a client as per the config. The default config is used
+// if the config is nil.
+func NewClient(config *Config) (*Client, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	c := *config
+	c.Address = strings.TrimRight(c.Address, "/")
+	if c.Address == "" {
+		c.Address = DefaultAddress
+	}
+	if _, err := url.Parse(c.Address); err != nil {
+		return nil, fmt.Errorf("invalid address '%s': %v", c.Address, err)
+	}
+	if c.Backoff == nil {
+		c.Backoff = pester.LinearJitterBackoff
+	}
+
+	httpClient := c.HttpClient
+	if httpClient == nil {
+		transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+		if c.TLSConfig != nil {
+			tlsConfig, err := c.TLSConfig.tlsConfig()
+			if err != nil {
+				return nil, err
+			}
+			transport.TLSClientConfig = tlsConfig
+		}
+		httpClient = &http.Client{Transport: transport}
+	}
+
+	return &Client{config: c, httpClient: httpClient}, nil
+}
+
+// Address returns the address of maya api server
+func (c *Client) Address() string {
+	return c.config.Address
+}
+
+// QueryOptions are the options of a query
+type QueryOptions struct {
+	// WaitIndex makes the query a blocking query. The query waits till the
+	// index of the queried objects moves past WaitIndex or WaitTime elapses.
+	WaitIndex uint64
+
+	// WaitTime is the max duration a blocking query waits
+	WaitTime time.Duration
+
+	// ctx cancels the query. It is set via WithContext.
+	ctx context.Context
+}
+
+// WithContext returns a copy of the options whose query is cancelled along
+// with the context
+func (o *QueryOptions) WithContext(ctx context.Context) *QueryOptions {
+	c := &QueryOptions{}
+	if o != nil {
+		*c = *o
+	}
+	c.ctx = ctx
+	return c
+}
+
+// Context returns the context of the query
+func (o *QueryOptions) Context() context.Context {
+	if o != nil && o.ctx != nil {
+		return o.ctx
+	}
+	return context.Background()
+}
+
+// WriteOptions are the options of a write
+type WriteOptions struct {
+	// ctx cancels the write. It is set via WithContext.
+	ctx context.Context
+}
+
+// WithContext returns a copy of the options whose write is cancelled along
+// with the context
+func (o *WriteOptions) WithContext(ctx context.Context) *WriteOptions {
+	c := &WriteOptions{}
+	if o != nil {
+		*c = *o
+	}
+	c.ctx = ctx
+	return c
+}
+
+// Context returns the context of the write
+func (o *WriteOptions) Context() context.Context {
+	if o != nil && o.ctx != nil {
+		return o.ctx
+	}
+	return context.Background()
+}
+
+// QueryMeta is the meta data of the response of a query
+type QueryMeta struct {
+	// LastIndex is the index of the queried objects. It is used as the
+	// WaitIndex of the next blocking query. It is 0 if the endpoint does
+	// not support blocking queries.
+	LastIndex uint64
+
+	// RequestTime is the duration of the query including the retries
+	RequestTime time.Duration
+}
+
+// request is a request to maya api server
+type request struct {
+	ctx    context.Context
+	method string
+	path   string
+	params url.Values
+
+	body        []byte
+	contentType string
+
+	// retry flags if the request is idempotent & hence can be retried
+	retry bool
+}
+
+// query performs a GET request & decodes the JSON response into out
+func (c *Client) query(path string, params url.Values, out interface{}, q *QueryOptions) (*QueryMeta, error) {
+	if params == nil {
+		params = url.Values{}
+	}
+	if q != nil && q.WaitIndex > 0 {
+		params.Set("index", strconv.FormatUint(q.WaitIndex, 10))
+		wait := q.WaitTime
+		if wait == 0 {
+			wait = c.config.WaitTime
+		}
+		if wait > 0 {
+			params.Set("wait", durToMsec(wait))
+		}
+	}
+
+	r := &request{
+		ctx:    q.Context(),
+		method: "GET",
+		path:   path,
+		params: params,
+		retry:  true,
+	}
+
+	start := time.Now()
+	resp, err := c.doRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	qm := &QueryMeta{RequestTime: time.Since(start)}
+	if v := resp.Header.Get(HeaderIndex); v != "" {
+		qm.LastIndex, _ = strconv.ParseUint(v, 10, 64)
+	}
+
+	if err := decodeBody(resp, out); err != nil {
+		return nil, err
+	}
+	return qm, nil
+}
+
+// write performs a request with the JSON encoded body & decodes the JSON
+// response into out. The request is not retried.
+func (c *Client) write(method, path string, in, out interface{}, w *WriteOptions) error {
+	r := &request{
+		ctx:    w.Context(),
+		method: method,
+		path:   path,
+	}
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		r.body = b
+		r.contentType = "application/json"
+	}
+
+	resp, err := c.doRequest(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return decodeBody(resp, out)
+}
+
+// decodeBody decodes the JSON response into out. A text/plain response is
+// read as is into out if it is a string. The response is discarded if out is
+// nil.
+func decodeBody(resp *http.Response, out interface{}) error {
+	if out == nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+
+	if text, ok := out.(*string); ok && strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read the response: %v", err)
+		}
+		*text = string(b)
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode the response: %v", err)
+	}
+	return nil
+}
+
+// doRequest performs the request & returns the response if it is a 2xx. An
+// idempotent request is retried with a backoff if maya api server is
+// unreachable or unavailable. The caller is expected to close the body of
+// the response.
+func (c *Client) doRequest(r *request) (*http.Response, error) {
+	for retry := 1; ; retry++ {
+		resp, err := c.send(r)
+		if err == nil {
+			return resp, nil
+		}
+
+		if !r.retry || retry > c.config.MaxRetries || !retryable(r.ctx, err) {
+			return nil, err
+		}
+
+		select {
+		case <-time.After(c.config.Backoff(retry)):
+		case <-r.ctx.Done():
+			return nil, r.ctx.Err()
+		}
+	}
+}
+
+// send sends the request once
+func (c *Client) send(r *request) (*http.Response, error) {
+	u := c.config.Address + r.path
+	if len(r.params) > 0 {
+		u += "?" + r.params.Encode()
+	}
+
+	var body io.Reader
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+
+	req, err := http.NewRequest(r.method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(r.ctx)
+	if r.contentType != "" {
+		req.Header.Set("Content-Type", r.contentType)
+	}
+	if c.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.config.Token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+
+		kind := ErrorKind(resp.Header.Get(HeaderErrorKind))
+		if kind == "" {
+			kind = KindOfCode(resp.StatusCode)
+		}
+		return nil, &Error{
+			StatusCode: resp.StatusCode,
+			Kind:       kind,
+			Message:    strings.TrimSpace(string(b)),
+		}
+	}
+
+	return resp, nil
+}
+
+// retryable verifies if the failed request may succeed if retried. The
+// connection errors are retried unless the request was cancelled.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if aErr, ok := err.(*Error); ok {
+		return aErr.Kind.retryable()
+	}
+	return true
+}
+
+// durToMsec converts the duration to the milliseconds understood by maya
+// api server as the wait of a blocking query
+func durToMsec(dur time.Duration) string {
+	ms := dur / time.Millisecond
+	if dur > 0 && ms == 0 {
+		ms = 1
+	}
+	return fmt.Sprintf("%dms", ms)
+}
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openebs/maya/types/v1"
+)
+
+func TestDefaultConfig_Env(t *testing.T) {
+	for k, v := range map[string]string{
+		EnvAddress:    "https://mapi:5656",
+		EnvToken:      "secret",
+		EnvSkipVerify: "true",
+	} {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	config := DefaultConfig()
+	if config.Address != "https://mapi:5656" || config.Token != "secret" || !config.TLSConfig.Insecure {
+		t.Fatalf("expected the config to be read from the env, got: %#v %#v", config, config.TLSConfig)
+	}
+}
+
+func TestClient_Token(t *testing.T) {
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		auth = req.Header.Get("Authorization")
+		resp.Write([]byte(`{"items": []}`))
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(&Config{Address: srv.URL + "/", Token: "secret"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if c.Address() != srv.URL {
+		t.Fatalf("expected the trailing slash to be trimmed, got: %s", c.Address())
+	}
+
+	if _, _, err := c.Volumes().List(nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if auth != "Bearer secret" {
+		t.Fatalf("expected a bearer token, got: %q", auth)
+	}
+}
+
+func TestClient_UnexpectedResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(404)
+		resp.Write([]byte("Volume 'vol1' not found\n"))
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(&Config{Address: srv.URL})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	_, _, err = c.Volumes().Info("vol1", nil)
+	if !IsNotFound(err) {
+		t.Fatalf("expected not found, got: %v", err)
+	}
+	if aErr := err.(*Error); aErr.Message != "Volume 'vol1' not found" {
+		t.Fatalf("bad message: %q", aErr.Message)
+	}
+}
+
+func TestClient_ErrorKind(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Set(HeaderErrorKind, string(ErrorKindConflict))
+		resp.WriteHeader(500)
+		resp.Write([]byte("VSM 'vol1' already exists"))
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(&Config{Address: srv.URL})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The kind sent by the server takes precedence over the code
+	if _, err := c.Volumes().Create(&v1.PersistentVolumeClaim{}, nil); !IsConflict(err) {
+		t.Fatalf("expected a conflict, got: %v", err)
+	}
+}
+
+func TestClient_Retry(t *testing.T) {
+	var l sync.Mutex
+	calls := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		l.Lock()
+		calls[req.Method]++
+		n := calls[req.Method]
+		l.Unlock()
+
+		if n < 3 {
+			resp.WriteHeader(503)
+			return
+		}
+		resp.Write([]byte(`{"items": []}`))
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(&Config{
+		Address:    srv.URL,
+		MaxRetries: 2,
+		Backoff:    func(int) time.Duration { return time.Millisecond },
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The query succeeds on the 2nd retry
+	if _, _, err := c.Volumes().List(nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The write is not retried
+	if _, err := c.Volumes().Create(&v1.PersistentVolumeClaim{}, nil); !IsUnavailable(err) {
+		t.Fatalf("expected unavailable, got: %v", err)
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	if calls["GET"] != 3 || calls["POST"] != 1 {
+		t.Fatalf("bad calls: %v", calls)
+	}
+}
+
+func TestClient_RetryCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(503)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(&Config{
+		Address:    srv.URL,
+		MaxRetries: 5,
+		Backoff:    func(int) time.Duration { return time.Hour },
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The backoff is cut short by the context
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err = c.Volumes().List((&QueryOptions{}).WithContext(ctx))
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected the deadline to be exceeded, got: %v", err)
+	}
+}
+
+func TestClient_BlockingQueryParams(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		query = req.URL.RawQuery
+		resp.Header().Set(HeaderIndex, "13")
+		resp.Write([]byte(`{"items": []}`))
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(&Config{Address: srv.URL, WaitTime: time.Minute})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	_, qm, err := c.Volumes().List(&QueryOptions{WaitIndex: 12})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if query != "index=12&wait=60000ms" || qm.LastIndex != 13 {
+		t.Fatalf("bad blocking query: %s %d", query, qm.LastIndex)
+	}
+}
+
+func TestVolumeStatus(t *testing.T) {
+	cases := []struct {
+		controllers string
+		replicas    string
+		expected    string
+	}{
+		{"Running", "Running,Running", VolumeStatusRunning},
+		{"Running", "Running,Pending", VolumeStatusDegraded},
+		{"Pending", "Pending,Pending", VolumeStatusPending},
+		{"Failed", "Running", VolumeStatusFailed},
+		{"", "Running", VolumeStatusUnknown},
+	}
+
+	for _, tc := range cases {
+		annotations := map[string]string{
+			string(v1.ControllerStatusAPILbl): tc.controllers,
+			string(v1.ReplicaStatusAPILbl):    tc.replicas,
+		}
+		if status := VolumeStatus(annotations); status != tc.expected {
+			t.Fatalf("%s/%s: expected %s, got: %s", tc.controllers, tc.replicas, tc.expected, status)
+		}
+	}
+}
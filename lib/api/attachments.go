@@ -0,0 +1,132 @@
+package api
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/openebs/maya/types/v1"
+)
+
+// The access modes of an attachment. A volume is attached read-write to a
+// single node at a time, or read-only to any number of nodes.
+const (
+	AccessModeReadWrite = "read-write"
+	AccessModeReadOnly  = "read-only"
+)
+
+// The annotations of a volume that are set by maya api server along with the
+// details of the volume. These are comma separated lists in the order of the
+// attachments.
+const (
+	// AttachedNodesAPILbl lists the nodes the volume is attached to
+	AttachedNodesAPILbl v1.MayaAPIServiceOutputLabel = "vsm.openebs.io/attached-nodes"
+
+	// AccessModesAPILbl lists the access modes of the attachments
+	AccessModesAPILbl v1.MayaAPIServiceOutputLabel = "vsm.openebs.io/access-modes"
+
+	// AttachTimesAPILbl lists the times of the attachments in RFC 3339
+	AttachTimesAPILbl v1.MayaAPIServiceOutputLabel = "vsm.openebs.io/attach-times"
+)
+
+// Attachment is an attachment of a volume to a node
+type Attachment struct {
+	NodeID     string    `json:"node_id"`
+	AccessMode string    `json:"access_mode"`
+	Device     string    `json:"device,omitempty"`
+	AttachTime time.Time `json:"attach_time"`
+}
+
+// Fence records a node that was detached forcibly. The node can not attach
+// the volume again via maya api server till an admin lifts the fence i.e.
+// till it is known that the node has stopped using the volume. The fence is
+// not enforced by the target. A node that still has a session keeps it.
+type Fence struct {
+	NodeID   string    `json:"node_id"`
+	FencedAt time.Time `json:"fenced_at"`
+}
+
+// VolumeAttachments are the attachments & the fenced nodes of a volume. The
+// detach token is set only in the response of an attach. It is the token of
+// the attachment of the node that detaches the volume normally.
+type VolumeAttachments struct {
+	Volume      string       `json:"volume"`
+	Attachments []Attachment `json:"attachments"`
+	Fenced      []Fence      `json:"fenced,omitempty"`
+	DetachToken string       `json:"detach_token,omitempty"`
+}
+
+// AttachRequest attaches a volume to the node. The access mode defaults to
+// AccessModeReadWrite. The device is the name of the device on the node if
+// the node knows it upfront. It is recorded as is. A repeated attach from a
+// node that is attached already needs the detach token of its attachment,
+// else the admin token.
+type AttachRequest struct {
+	NodeID     string `json:"node_id"`
+	AccessMode string `json:"access_mode,omitempty"`
+	Device     string `json:"device,omitempty"`
+	Token      string `json:"token,omitempty"`
+}
+
+// DetachRequest detaches a volume from the node. A normal detach needs the
+// detach token that was issued by the attach of the node, else the admin
+// token. A forced detach needs the admin token & fences the node i.e. bars
+// it from attaching the volume again. It does not cut the node off the
+// target. Unfence lifts the fence of the node & needs the admin token.
+type DetachRequest struct {
+	NodeID  string `json:"node_id"`
+	Force   bool   `json:"force,omitempty"`
+	Unfence bool   `json:"unfence,omitempty"`
+	Token   string `json:"token,omitempty"`
+}
+
+// Attach attaches the volume to the node. An attach is refused with
+// ErrorKindConflict if it would share the volume with another node while
+// either of them has read-write access. The returned detach token must be
+// kept by the node to detach the volume.
+func (v *Volumes) Attach(name string, args *AttachRequest, w *WriteOptions) (*VolumeAttachments, error) {
+	var va VolumeAttachments
+	if err := v.client.write("POST", "/v1/volumes/"+url.PathEscape(name)+"/attach", args, &va, w); err != nil {
+		return nil, err
+	}
+	return &va, nil
+}
+
+// Detach detaches the volume from the node
+func (v *Volumes) Detach(name string, args *DetachRequest, w *WriteOptions) (*VolumeAttachments, error) {
+	var va VolumeAttachments
+	if err := v.client.write("POST", "/v1/volumes/"+url.PathEscape(name)+"/detach", args, &va, w); err != nil {
+		return nil, err
+	}
+	return &va, nil
+}
+
+// Attachments returns the attachments & the fenced nodes of the volume
+func (v *Volumes) Attachments(name string, q *QueryOptions) (*VolumeAttachments, *QueryMeta, error) {
+	var va VolumeAttachments
+	qm, err := v.client.query("/v1/volumes/"+url.PathEscape(name)+"/attachments", nil, &va, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &va, qm, nil
+}
+
+// VolumeAttachmentsOf returns the attachments of a volume from the
+// annotations set by maya api server in the details of the volume
+func VolumeAttachmentsOf(annotations map[string]string) []Attachment {
+	nodes := VolumeAnnotationList(annotations, AttachedNodesAPILbl)
+	modes := VolumeAnnotationList(annotations, AccessModesAPILbl)
+	times := VolumeAnnotationList(annotations, AttachTimesAPILbl)
+
+	var attachments []Attachment
+	for i, node := range nodes {
+		a := Attachment{NodeID: node}
+		if i < len(modes) {
+			a.AccessMode = modes[i]
+		}
+		if i < len(times) {
+			a.AttachTime, _ = time.Parse(time.RFC3339, times[i])
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments
+}
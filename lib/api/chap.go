@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/url"
+
+	"github.com/openebs/maya/types/v1"
+)
+
+// CHAPLbl is the label of a volume claim that enables CHAP for the volume.
+// Its values are CHAPModeNone, CHAPModeOneWay & CHAPModeMutual.
+const CHAPLbl v1.VolumeProvisionerProfileLabel = "volumeprovisioner.mapi.openebs.io/chap"
+
+// The CHAP modes of a volume. The initiator authenticates itself to the
+// target in one-way CHAP. The target authenticates itself to the initiator
+// as well in mutual CHAP.
+const (
+	CHAPModeNone   = "none"
+	CHAPModeOneWay = "chap"
+	CHAPModeMutual = "mutual"
+)
+
+// CHAPCredentials are the CHAP credentials of a volume. The mutual
+// credentials are set only in CHAPModeMutual.
+type CHAPCredentials struct {
+	Mode     string `json:"mode"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	// MutualUsername & MutualPassword authenticate the target
+	MutualUsername string `json:"mutual_username,omitempty"`
+	MutualPassword string `json:"mutual_password,omitempty"`
+}
+
+// RotateCHAP replaces the CHAP credentials of the volume with new ones. The
+// target details along with the new credentials are returned. The client's token
+// must be the CHAP access token of maya api server.
+func (v *Volumes) RotateCHAP(name string, w *WriteOptions) (*VolumeTarget, error) {
+	var target VolumeTarget
+	if err := v.client.write("POST", "/v1/volumes/"+url.PathEscape(name)+"/chap/rotate", nil, &target, w); err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// HeaderErrorKind is the response header that carries the kind of the error
+// sent by maya api server
+const HeaderErrorKind = "X-Maya-Error-Kind"
+
+// ErrorKind classifies the errors sent by maya api server
+type ErrorKind string
+
+// The kinds of the errors sent by maya api server
+const (
+	// ErrorKindInvalid is sent if the request is invalid e.g. a spec
+	// without a name
+	ErrorKindInvalid ErrorKind = "invalid"
+
+	// ErrorKindUnauthorized is sent if maya api server or its orchestrator
+	// denied the request
+	ErrorKindUnauthorized ErrorKind = "unauthorized"
+
+	// ErrorKindNotFound is sent if the volume or the endpoint does not exist
+	ErrorKindNotFound ErrorKind = "not_found"
+
+	// ErrorKindMethodNotAllowed is sent if the endpoint does not support the
+	// method of the request
+	ErrorKindMethodNotAllowed ErrorKind = "method_not_allowed"
+
+	// ErrorKindConflict is sent if the volume exists already or is attached
+	// exclusively to another node
+	ErrorKindConflict ErrorKind = "conflict"
+
+	// ErrorKindNotImplemented is sent if the feature is not enabled or
+	// supported e.g. the audit log without a data directory
+	ErrorKindNotImplemented ErrorKind = "not_implemented"
+
+	// ErrorKindUnavailable is sent if maya api server is not ready to serve
+	// the request
+	ErrorKindUnavailable ErrorKind = "unavailable"
+
+	// ErrorKindTimeout is sent if the orchestrator timed out
+	ErrorKindTimeout ErrorKind = "timeout"
+
+	// ErrorKindUnreachable is sent if the orchestrator could not be reached
+	ErrorKindUnreachable ErrorKind = "unreachable"
+
+	// ErrorKindInternal is sent for the errors that are not classified
+	ErrorKindInternal ErrorKind = "internal"
+)
+
+// KindOfCode returns the kind of the error sent along with the HTTP code. It
+// is used if maya api server did not send the kind.
+func KindOfCode(code int) ErrorKind {
+	switch code {
+	case http.StatusBadRequest:
+		return ErrorKindInvalid
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrorKindUnauthorized
+	case http.StatusNotFound:
+		return ErrorKindNotFound
+	case http.StatusMethodNotAllowed:
+		return ErrorKindMethodNotAllowed
+	case http.StatusConflict:
+		return ErrorKindConflict
+	case http.StatusNotImplemented:
+		return ErrorKindNotImplemented
+	case http.StatusServiceUnavailable, http.StatusBadGateway:
+		return ErrorKindUnavailable
+	case http.StatusGatewayTimeout:
+		return ErrorKindTimeout
+	default:
+		return ErrorKindInternal
+	}
+}
+
+// retryable verifies if a request that failed with this kind of error may
+// succeed if retried
+func (k ErrorKind) retryable() bool {
+	switch k {
+	case ErrorKindUnavailable, ErrorKindTimeout, ErrorKindUnreachable:
+		return true
+	}
+	return false
+}
+
+// Error is returned if maya api server responds with a code other than 2xx
+type Error struct {
+	StatusCode int
+
+	// Kind classifies the error
+	Kind ErrorKind
+
+	// Message is the error message sent by maya api server
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Unexpected response code: %d (%s)", e.StatusCode, e.Message)
+}
+
+// KindOf returns the kind of the error sent by maya api server. It is empty
+// if the error was not sent by maya api server e.g. a connection error.
+func KindOf(err error) ErrorKind {
+	if aErr, ok := err.(*Error); ok {
+		return aErr.Kind
+	}
+	return ""
+}
+
+// IsNotFound verifies if maya api server could not find the volume or the
+// endpoint
+func IsNotFound(err error) bool {
+	return KindOf(err) == ErrorKindNotFound
+}
+
+// IsInvalid verifies if maya api server rejected the request as invalid
+func IsInvalid(err error) bool {
+	return KindOf(err) == ErrorKindInvalid
+}
+
+// IsConflict verifies if the volume exists already
+func IsConflict(err error) bool {
+	return KindOf(err) == ErrorKindConflict
+}
+
+// IsUnavailable verifies if maya api server or its orchestrator was not able
+// to serve the request for the time being
+func IsUnavailable(err error) bool {
+	return KindOf(err).retryable()
+}
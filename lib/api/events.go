@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Event is an operation that changed the state of maya api server e.g. the
+// creation of a volume. The events are read from the audit log of maya api
+// server.
+type Event struct {
+	// Seq is the position of the event in the audit log
+	Seq uint64 `json:"seq"`
+
+	Time      time.Time `json:"time"`
+	Identity  string    `json:"identity"`
+	SourceIP  string    `json:"source_ip"`
+	RequestID string    `json:"request_id"`
+	Operation string    `json:"operation"`
+	Volume    string    `json:"volume,omitempty"`
+
+	// Spec is the spec of the request with its secrets redacted
+	Spec json.RawMessage `json:"spec,omitempty"`
+
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+
+	PrevHash string `json:"prev_hash"`
+	Hash     string `json:"hash"`
+}
+
+// EventFilter selects the events
+type EventFilter struct {
+	// Since & Until select the events at or after Since & before Until
+	Since time.Time
+	Until time.Time
+
+	// Volume & Operation select the events of the volume & the operation
+	// e.g. volume.create
+	Volume    string
+	Operation string
+
+	// Limit selects the latest events upto this no.
+	Limit int
+}
+
+// params returns the filter as the query params of the audit endpoint
+func (f *EventFilter) params() url.Values {
+	params := url.Values{}
+	if f == nil {
+		return params
+	}
+
+	if !f.Since.IsZero() {
+		params.Set("since", f.Since.Format(time.RFC3339))
+	}
+	if !f.Until.IsZero() {
+		params.Set("until", f.Until.Format(time.RFC3339))
+	}
+	if f.Volume != "" {
+		params.Set("volume", f.Volume)
+	}
+	if f.Operation != "" {
+		params.Set("operation", f.Operation)
+	}
+	if f.Limit > 0 {
+		params.Set("limit", strconv.Itoa(f.Limit))
+	}
+	return params
+}
+
+// Events is used to query the events of maya api server
+type Events struct {
+	client *Client
+}
+
+// Events returns a handle on the events i.e. the audit endpoint
+func (c *Client) Events() *Events {
+	return &Events{client: c}
+}
+
+// List returns the events that match the filter from the oldest to the
+// latest. A blocking query returns once the events past its WaitIndex are
+// available. The events are served to the admin token only.
+func (e *Events) List(f *EventFilter, q *QueryOptions) ([]*Event, *QueryMeta, error) {
+	var events []*Event
+	qm, err := e.client.query("/v1/audit", f.params(), &events, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	return events, qm, nil
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// The statuses of the health checks of maya api server
+const (
+	HealthPassing  = "passing"
+	HealthWarning  = "warning"
+	HealthCritical = "critical"
+)
+
+// HealthCheckResult is the outcome of a health check of maya api server
+type HealthCheckResult struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Critical  bool      `json:"critical"`
+	Output    string    `json:"output,omitempty"`
+	Latency   string    `json:"latency"`
+	CheckedAt time.Time `json:"checkedAt"`
+	Cached    bool      `json:"cached"`
+}
+
+// HealthReport is the aggregated outcome of the health checks of maya api
+// server
+type HealthReport struct {
+	Status string              `json:"status"`
+	Checks []HealthCheckResult `json:"checks"`
+}
+
+// Health is used to probe the health of maya api server
+type Health struct {
+	client *Client
+}
+
+// Health returns a handle on the health endpoints
+func (c *Client) Health() *Health {
+	return &Health{client: c}
+}
+
+// Live reports if maya api server is up & serving requests
+func (h *Health) Live(q *QueryOptions) (*HealthReport, error) {
+	var report HealthReport
+	if _, err := h.client.query("/v1/health/live", nil, &report, q); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// Ready reports if maya api server is ready to serve the volume requests.
+// An unready server is reported via the status of the report rather than
+// an error. The probe is not retried as it reports the current state.
+func (h *Health) Ready(q *QueryOptions) (*HealthReport, error) {
+	resp, err := h.client.send(&request{
+		ctx:    q.Context(),
+		method: "GET",
+		path:   "/v1/health/ready",
+	})
+	if aErr, ok := err.(*Error); ok && aErr.StatusCode == http.StatusServiceUnavailable {
+		var report HealthReport
+		if dErr := json.Unmarshal([]byte(aErr.Message), &report); dErr != nil {
+			return nil, err
+		}
+		return &report, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var report HealthReport
+	if err := decodeBody(resp, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"strings"
+)
+
+// MetaData is used to query the meta data of the compute instance as
+// served by maya api server to the EBS compatible clients
+type MetaData struct {
+	client *Client
+}
+
+// MetaData returns a handle on the meta data endpoints
+func (c *Client) MetaData() *MetaData {
+	return &MetaData{client: c}
+}
+
+// Get returns the entry of the meta data tree at the given path e.g.
+// placement/region
+func (m *MetaData) Get(path string, q *QueryOptions) (string, error) {
+	var value string
+	if _, err := m.client.query("/latest/meta-data/"+strings.TrimPrefix(path, "/"), nil, &value, q); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// List returns the entries of the given directory of the meta data tree.
+// The entries that are directories end with a slash.
+func (m *MetaData) List(dir string, q *QueryOptions) ([]string, error) {
+	dir = strings.Trim(dir, "/")
+	if dir != "" {
+		dir += "/"
+	}
+
+	listing, err := m.Get(dir, q)
+	if err != nil || listing == "" {
+		return nil, err
+	}
+	return strings.Split(listing, "\n"), nil
+}
+
+// InstanceID returns the instance id of the compute instance
+func (m *MetaData) InstanceID(q *QueryOptions) (string, error) {
+	return m.Get("instance-id", q)
+}
+
+// AvailabilityZone returns the availability zone of the compute instance
+func (m *MetaData) AvailabilityZone(q *QueryOptions) (string, error) {
+	return m.Get("placement/availability-zone", q)
+}
+
+// Region returns the region of the compute instance
+func (m *MetaData) Region(q *QueryOptions) (string, error) {
+	return m.Get("placement/region", q)
+}
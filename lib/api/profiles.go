@@ -0,0 +1,98 @@
+package api
+
+import (
+	"net/url"
+	"time"
+)
+
+// StorageProfile is a named & reusable set of the settings of the volumes
+// i.e. a class of volumes. A volume claim refers to a profile by its name
+// via the v1.PVPProfileNameLbl label & inherits the settings that are not
+// set by its own labels. The labels of the claim may override the replica
+// count & the storage size only within the limits of the profile, & the
+// images, the orchestrator & the namespace only with the values in the
+// allow-lists of the profile. An empty allow-list does not restrict its
+// setting.
+type StorageProfile struct {
+	Name string `json:"name"`
+
+	// ReplicaCount is the default replica count of the volumes. The min &
+	// max replica counts limit the replica count of a claim. A zero count
+	// is not set.
+	ReplicaCount    int `json:"replica_count,omitempty"`
+	MinReplicaCount int `json:"min_replica_count,omitempty"`
+	MaxReplicaCount int `json:"max_replica_count,omitempty"`
+
+	ControllerCount int    `json:"controller_count,omitempty"`
+	ReplicaImage    string `json:"replica_image,omitempty"`
+	ControllerImage string `json:"controller_image,omitempty"`
+
+	// StorageSize is the default storage size of the volumes e.g. 5G. The
+	// min & max storage sizes limit the storage size of a claim.
+	StorageSize    string `json:"storage_size,omitempty"`
+	MinStorageSize string `json:"min_storage_size,omitempty"`
+	MaxStorageSize string `json:"max_storage_size,omitempty"`
+
+	// ReplicaTopologyKey is the topology key of the node labels across
+	// which the replicas are spread e.g. kubernetes.io/hostname
+	ReplicaTopologyKey string `json:"replica_topology_key,omitempty"`
+
+	Orchestrator string `json:"orchestrator,omitempty"`
+	Namespace    string `json:"namespace,omitempty"`
+
+	// AllowedImages limits the replica & controller images of a claim.
+	// AllowedOrchestrators & AllowedNamespaces limit its orchestrator &
+	// namespace. Every setting is unrestricted if its allow-list is empty.
+	AllowedImages        []string `json:"allowed_images,omitempty"`
+	AllowedOrchestrators []string `json:"allowed_orchestrators,omitempty"`
+	AllowedNamespaces    []string `json:"allowed_namespaces,omitempty"`
+
+	// ModifyTime is set by maya api server whenever the profile is saved
+	ModifyTime time.Time `json:"modify_time"`
+}
+
+// Profiles is used to manage the storage profiles
+type Profiles struct {
+	client *Client
+}
+
+// Profiles returns a handle on the storage profile endpoints
+func (c *Client) Profiles() *Profiles {
+	return &Profiles{client: c}
+}
+
+// List lists the storage profiles sorted by their names
+func (p *Profiles) List(q *QueryOptions) ([]*StorageProfile, *QueryMeta, error) {
+	var profiles []*StorageProfile
+	qm, err := p.client.query("/v1/profiles/", nil, &profiles, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	return profiles, qm, nil
+}
+
+// Info returns the named storage profile
+func (p *Profiles) Info(name string, q *QueryOptions) (*StorageProfile, *QueryMeta, error) {
+	var profile StorageProfile
+	qm, err := p.client.query("/v1/profiles/"+url.PathEscape(name), nil, &profile, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &profile, qm, nil
+}
+
+// Put creates the storage profile or replaces the profile of the same name.
+// The saved profile is returned.
+func (p *Profiles) Put(profile *StorageProfile, w *WriteOptions) (*StorageProfile, error) {
+	var out StorageProfile
+	if err := p.client.write("PUT", "/v1/profiles/"+url.PathEscape(profile.Name), profile, &out, w); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Delete deletes the named storage profile. The volumes created from the
+// profile are not affected.
+func (p *Profiles) Delete(name string, w *WriteOptions) error {
+	return p.client.write("DELETE", "/v1/profiles/"+url.PathEscape(name), nil, nil, w)
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/url"
+)
+
+// TargetLUN is the LUN of a volume on its iSCSI target. A target exports a
+// single volume.
+const TargetLUN = 0
+
+// VolumeTarget are the details an initiator needs to connect to the iSCSI
+// target of a volume
+type VolumeTarget struct {
+	Volume string `json:"volume"`
+
+	// Portal is the IP:port of the target. It is the first of the portals
+	// if there are several controllers.
+	Portal string `json:"portal"`
+
+	IQN string `json:"iqn"`
+	LUN int    `json:"lun"`
+
+	// CHAPRequired flags if the initiator has to authenticate via CHAP i.e.
+	// if the target enforces CHAP. No jiva controller supports CHAP yet,
+	// hence this is not set even if CHAPEnabled is.
+	CHAPRequired bool `json:"chap_required"`
+
+	// CHAPEnabled flags if the volume has CHAP credentials
+	CHAPEnabled bool `json:"chap_enabled"`
+
+	// CHAP are the CHAP credentials of the volume. These are released only
+	// to the callers whose token is the CHAP access token of maya api
+	// server. The target does not enforce these unless CHAPRequired is set.
+	CHAP *CHAPCredentials `json:"chap,omitempty"`
+
+	// Portals are the portals of every controller for multipath. These are
+	// set only if there are several controllers.
+	Portals []string `json:"portals,omitempty"`
+
+	// ISCSIAdm are the iscsiadm parameters to discover & log in to the
+	// target. These are set only if requested.
+	ISCSIAdm *ISCSIAdmParams `json:"iscsiadm,omitempty"`
+}
+
+// ISCSIAdmParams are the iscsiadm arguments to connect to a target. There
+// is a login per portal.
+type ISCSIAdmParams struct {
+	Discovery []string   `json:"discovery"`
+	Logins    [][]string `json:"logins"`
+}
+
+// Target returns the details of the iSCSI target of the volume. The iscsiadm
+// parameters are returned if iscsiadm is set. The CHAP credentials are
+// returned if the client's token is the CHAP access token of maya api
+// server.
+func (v *Volumes) Target(name string, iscsiadm bool, q *QueryOptions) (*VolumeTarget, *QueryMeta, error) {
+	params := url.Values{}
+	if iscsiadm {
+		params.Set("iscsiadm", "true")
+	}
+
+	var target VolumeTarget
+	qm, err := v.client.query("/v1/volumes/"+url.PathEscape(name)+"/target", params, &target, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &target, qm, nil
+}
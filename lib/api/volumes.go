@@ -0,0 +1,121 @@
+package api
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/openebs/maya/types/v1"
+)
+
+// The statuses of a volume derived from the phases of its controller &
+// replica pods
+const (
+	VolumeStatusRunning  = "running"
+	VolumeStatusDegraded = "degraded"
+	VolumeStatusPending  = "pending"
+	VolumeStatusFailed   = "failed"
+	VolumeStatusUnknown  = "unknown"
+)
+
+// Volumes is used to manage the volumes i.e. VSMs
+type Volumes struct {
+	client *Client
+}
+
+// Volumes returns a handle on the volume endpoints
+func (c *Client) Volumes() *Volumes {
+	return &Volumes{client: c}
+}
+
+// Create creates a volume from the claim & returns the details of the volume
+func (v *Volumes) Create(pvc *v1.PersistentVolumeClaim, w *WriteOptions) (*v1.PersistentVolume, error) {
+	var pv v1.PersistentVolume
+	if err := v.client.write("POST", "/latest/volumes/", pvc, &pv, w); err != nil {
+		return nil, err
+	}
+	return &pv, nil
+}
+
+// List lists the volumes
+func (v *Volumes) List(q *QueryOptions) (*v1.PersistentVolumeList, *QueryMeta, error) {
+	var pvl v1.PersistentVolumeList
+	qm, err := v.client.query("/latest/volumes/", nil, &pvl, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &pvl, qm, nil
+}
+
+// Info returns the details of the volume
+func (v *Volumes) Info(name string, q *QueryOptions) (*v1.PersistentVolume, *QueryMeta, error) {
+	var pv v1.PersistentVolume
+	qm, err := v.client.query("/latest/volumes/info/"+url.PathEscape(name), nil, &pv, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &pv, qm, nil
+}
+
+// Status returns the status of the volume derived from its controller &
+// replica pods e.g. VolumeStatusRunning
+func (v *Volumes) Status(name string, q *QueryOptions) (string, *QueryMeta, error) {
+	pv, qm, err := v.Info(name, q)
+	if err != nil {
+		return "", nil, err
+	}
+	return VolumeStatus(pv.Annotations), qm, nil
+}
+
+// Delete deletes the volume. maya api server deletes a volume via a GET
+// request. Hence the delete is not retried similar to the other writes.
+func (v *Volumes) Delete(name string, w *WriteOptions) error {
+	return v.client.write("GET", "/latest/volumes/delete/"+url.PathEscape(name), nil, nil, w)
+}
+
+// VolumeStatus derives the status of a volume from the phases of its
+// controller & replica pods as set by the orchestrator in the annotations
+// of the volume
+func VolumeStatus(annotations map[string]string) string {
+	controllers := VolumeAnnotationList(annotations, v1.ControllerStatusAPILbl)
+	replicas := VolumeAnnotationList(annotations, v1.ReplicaStatusAPILbl)
+
+	count := func(all []string, phase string) int {
+		n := 0
+		for _, p := range all {
+			if p == phase {
+				n++
+			}
+		}
+		return n
+	}
+
+	all := append(append([]string{}, controllers...), replicas...)
+	running := count(all, "Running")
+
+	switch {
+	case len(controllers) == 0 || len(replicas) == 0:
+		return VolumeStatusUnknown
+	case running == len(all):
+		return VolumeStatusRunning
+	case count(controllers, "Running") == len(controllers) && count(replicas, "Running") > 0:
+		return VolumeStatusDegraded
+	case count(all, "Failed") > 0:
+		return VolumeStatusFailed
+	case count(all, "Pending") > 0:
+		return VolumeStatusPending
+	default:
+		return VolumeStatusUnknown
+	}
+}
+
+// VolumeAnnotationList returns the comma separated values of the annotation
+// set by the orchestrator e.g. the controller IPs
+func VolumeAnnotationList(annotations map[string]string, lbl v1.MayaAPIServiceOutputLabel) []string {
+	var values []string
+	for _, v := range strings.Split(annotations[string(lbl)], ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
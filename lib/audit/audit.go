@@ -0,0 +1,548 @@
+// Package audit provides a tamper-evident audit trail of the operations that
+// change the state of maya api server e.g. the creation of a volume. The
+// records are appended to a file as JSON lines. Every record carries the
+// hash of the previous record & a hash of itself. The hashes are HMACs by a
+// secret key. Hence a record that is modified, removed or inserted breaks
+// the chain & is detected by Verify unless the key is known as well. The key
+// is to be kept apart from the audit log for this reason.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileName is the name of the audit log file within the data directory
+const FileName = "audit.log"
+
+// KeyFileName is the name of the key file within the data directory if the
+// key file is not configured
+const KeyFileName = "audit.key"
+
+// keySize is the size of the key of the HMACs
+const keySize = 32
+
+// The operations that are audited
+const (
+	OpVolumeCreate  = "volume.create"
+	OpVolumeDelete  = "volume.delete"
+	OpVolumeAttach  = "volume.attach"
+	OpVolumeDetach  = "volume.detach"
+	OpCHAPRotate    = "volume.chap_rotate"
+	OpProfilePut    = "profile.put"
+	OpProfileDelete = "profile.delete"
+	OpConfigReload  = "config.reload"
+	OpLogLevelSet   = "log_level.set"
+)
+
+// Redacted replaces the values of the secrets in the audited specs
+const Redacted = "[REDACTED]"
+
+// secretKeys are the parts of the keys whose values are redacted
+var secretKeys = []string{"secret", "password", "passwd", "token", "credential", "private"}
+
+// Record is an entry of the audit log
+type Record struct {
+	// Seq is the position of the record in the log starting from 1
+	Seq uint64 `json:"seq"`
+
+	Time      time.Time `json:"time"`
+	Identity  string    `json:"identity"`
+	SourceIP  string    `json:"source_ip"`
+	RequestID string    `json:"request_id"`
+	Operation string    `json:"operation"`
+	Volume    string    `json:"volume,omitempty"`
+
+	// Spec is the spec of the request with its secrets redacted
+	Spec json.RawMessage `json:"spec,omitempty"`
+
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+
+	// PrevHash is the hash of the previous record. It is empty for the
+	// first record.
+	PrevHash string `json:"prev_hash"`
+
+	// Hash is the hash of this record including PrevHash
+	Hash string `json:"hash"`
+}
+
+// hash computes the HMAC of the record by the key. The record is hashed as
+// JSON with its Hash unset.
+func (r *Record) hash(key []byte) (string, error) {
+	c := *r
+	c.Hash = ""
+
+	b, err := json.Marshal(&c)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// LoadKey reads the key of the HMACs from the file at the path. A random key
+// is generated & written to the file if the file does not exist.
+func LoadKey(path string) ([]byte, error) {
+	key, err := ReadKey(path)
+	if !os.IsNotExist(err) {
+		return key, err
+	}
+
+	key = make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate the audit key: %v", err)
+	}
+	if err := writeKey(path, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ReadKey reads the key of the HMACs from the file at the path. The error
+// satisfies os.IsNotExist if the file does not exist.
+func ReadKey(path string) ([]byte, error) {
+	key, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("invalid audit key '%s': expected %d bytes, got %d", path, keySize, len(key))
+	}
+	return key, nil
+}
+
+// writeKey writes the key to a new file that is readable by its owner only.
+// An existing key is never replaced.
+func writeKey(path string, key []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create the audit key directory: %v", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write the audit key: %v", err)
+	}
+	if _, err := f.Write(key); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write the audit key: %v", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write the audit key: %v", err)
+	}
+	return f.Close()
+}
+
+// Log is an append only audit log file
+type Log struct {
+	l    sync.Mutex
+	path string
+	file *os.File
+	key  []byte
+
+	// seq & last are the sequence no. & the hash of the last record
+	seq  uint64
+	last string
+}
+
+// Open opens the audit log file for appending. The records are chained by
+// HMACs of the key. The chain continues from the last record of an existing
+// file. A record that was partially written e.g. on a crash is truncated so
+// that the next record starts on a line of its own. Open does not verify the
+// chain; use VerifyFile for that.
+func Open(path string, key []byte) (*Log, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("audit key is required")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create the audit directory: %v", err)
+	}
+
+	if err := truncatePartial(path); err != nil {
+		return nil, err
+	}
+
+	last, err := lastRecord(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the audit log: %v", err)
+	}
+
+	a := &Log{path: path, file: f, key: key}
+	if last != nil {
+		a.seq = last.Seq
+		a.last = last.Hash
+	}
+	return a, nil
+}
+
+// Path returns the path of the audit log file
+func (a *Log) Path() string {
+	return a.path
+}
+
+// Append chains the record to the last record & writes it to the file. The
+// record is synced to the disk before Append returns.
+func (a *Log) Append(r *Record) error {
+	a.l.Lock()
+	defer a.l.Unlock()
+
+	if a.file == nil {
+		return fmt.Errorf("audit log is closed")
+	}
+
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	r.Time = r.Time.UTC()
+	r.Seq = a.seq + 1
+	r.PrevHash = a.last
+
+	hash, err := r.hash(a.key)
+	if err != nil {
+		return err
+	}
+	r.Hash = hash
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write the audit record: %v", err)
+	}
+	if err := a.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync the audit log: %v", err)
+	}
+
+	a.seq = r.Seq
+	a.last = r.Hash
+	return nil
+}
+
+// Close closes the audit log file
+func (a *Log) Close() error {
+	a.l.Lock()
+	defer a.l.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
+
+// Query selects the records of the audit log
+type Query struct {
+	// Since & Until select the records logged at or after Since & before
+	// Until. These are ignored if not set.
+	Since time.Time
+	Until time.Time
+
+	// Volume & Operation select the records of the volume & the operation
+	Volume    string
+	Operation string
+
+	// Limit selects the latest records upto this no. Every record is
+	// selected if this is 0.
+	Limit int
+}
+
+// match verifies if the record is selected by the query
+func (q *Query) match(r *Record) bool {
+	switch {
+	case !q.Since.IsZero() && r.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && !r.Time.Before(q.Until):
+		return false
+	case q.Volume != "" && r.Volume != q.Volume:
+		return false
+	case q.Operation != "" && r.Operation != q.Operation:
+		return false
+	}
+	return true
+}
+
+// Query returns the records of the audit log that match the query from the
+// oldest to the latest. The records that can not be decoded are skipped;
+// these are reported by Verify.
+func (a *Log) Query(q Query) ([]*Record, error) {
+	f, err := os.Open(a.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the audit log: %v", err)
+	}
+	defer f.Close()
+
+	records := []*Record{}
+	err = readRecords(f, func(n int, r *Record, err error) error {
+		if err != nil {
+			return nil
+		}
+		if q.match(r) {
+			records = append(records, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if q.Limit > 0 && len(records) > q.Limit {
+		records = records[len(records)-q.Limit:]
+	}
+	return records, nil
+}
+
+// ChainError reports the first record that breaks the chain of the audit log
+type ChainError struct {
+	// Line is the line of the record in the audit log file
+	Line int
+
+	// Seq is the sequence no. of the record if it could be decoded
+	Seq uint64
+
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	if e.Seq == 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+	}
+	return fmt.Sprintf("line %d (seq %d): %s", e.Line, e.Seq, e.Reason)
+}
+
+// Verify checks the chain of the audit log file by the key of its HMACs. It
+// returns the no. of records that were verified. A *ChainError is returned
+// for the first record that breaks the chain. Records removed from the end
+// of the file can not be detected from the file alone. Hence the returned
+// no. is to be compared with the last known no. of records.
+func Verify(r io.Reader, key []byte) (int, error) {
+	var count int
+	var prev *Record
+
+	err := readRecords(r, func(n int, rec *Record, err error) error {
+		if err != nil {
+			return &ChainError{Line: n, Reason: err.Error()}
+		}
+
+		fail := func(format string, v ...interface{}) error {
+			return &ChainError{Line: n, Seq: rec.Seq, Reason: fmt.Sprintf(format, v...)}
+		}
+
+		var prevSeq uint64
+		var prevHash string
+		if prev != nil {
+			prevSeq, prevHash = prev.Seq, prev.Hash
+		}
+
+		if rec.Seq != prevSeq+1 {
+			return fail("expected seq %d", prevSeq+1)
+		}
+		if rec.PrevHash != prevHash {
+			return fail("previous hash does not match the previous record")
+		}
+
+		hash, err := rec.hash(key)
+		if err != nil {
+			return fail("%v", err)
+		}
+		if rec.Hash != hash {
+			return fail("hash does not match the record")
+		}
+
+		prev = rec
+		count++
+		return nil
+	})
+
+	return count, err
+}
+
+// VerifyFile checks the chain of the audit log file at the given path
+func VerifyFile(path string, key []byte) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return Verify(f, key)
+}
+
+// readRecords invokes the func with every record of the audit log along with
+// its line no. A record that can not be decoded is passed as an error. A
+// partially written last line is ignored. Reading stops at the first error
+// returned by the func.
+func readRecords(r io.Reader, fn func(n int, rec *Record, err error) error) error {
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var rec Record
+		dErr := json.Unmarshal(bytes.TrimSpace(line), &rec)
+		if dErr != nil {
+			dErr = fmt.Errorf("invalid record: %v", dErr)
+		}
+		if err := fn(n, &rec, dErr); err != nil {
+			return err
+		}
+	}
+}
+
+// lastRecord returns the last record of the audit log file that could be
+// decoded. It is nil if the file does not exist or is empty.
+func lastRecord(path string) (*Record, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the audit log: %v", err)
+	}
+	defer f.Close()
+
+	var last *Record
+	err = readRecords(f, func(n int, rec *Record, err error) error {
+		if err == nil {
+			last = rec
+		}
+		return nil
+	})
+	return last, err
+}
+
+// truncatePartial truncates the audit log file to its last complete line.
+// A file that does not exist or ends with a newline is left as is.
+func truncatePartial(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open the audit log: %v", err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat the audit log: %v", err)
+	}
+
+	// Look for the last newline from the end of the file
+	size := fi.Size()
+	buf := make([]byte, 4096)
+	for end := size; end > 0; {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+
+		chunk := buf[:end-start]
+		if _, err := f.ReadAt(chunk, start); err != nil {
+			return fmt.Errorf("failed to read the audit log: %v", err)
+		}
+
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			return truncateAt(f, size, start+int64(i)+1)
+		}
+		end = start
+	}
+	return truncateAt(f, size, 0)
+}
+
+// truncateAt truncates the file of the given size at the offset
+func truncateAt(f *os.File, size, offset int64) error {
+	if offset == size {
+		return nil
+	}
+	if err := f.Truncate(offset); err != nil {
+		return fmt.Errorf("failed to truncate the partial audit record: %v", err)
+	}
+	return f.Sync()
+}
+
+// Redact encodes the spec as JSON with the values of its secrets replaced.
+// A key is regarded as a secret if it has any of the words e.g. password or
+// token.
+func Redact(spec interface{}) json.RawMessage {
+	if spec == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(spec)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(spec))
+		return b
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return b
+	}
+
+	out, err := json.Marshal(redact(v))
+	if err != nil {
+		return b
+	}
+	return out
+}
+
+// redact replaces the values of the secrets within the decoded JSON value
+func redact(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			if isSecret(k) {
+				t[k] = Redacted
+				continue
+			}
+			t[k] = redact(val)
+		}
+	case []interface{}:
+		for i, val := range t {
+			t[i] = redact(val)
+		}
+	}
+	return v
+}
+
+// isSecret verifies if the value of the key is a secret
+func isSecret(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range secretKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
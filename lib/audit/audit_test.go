@@ -0,0 +1,340 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testKey is the key of the HMACs of the test logs
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func tmpLog(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "mapiserver")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return filepath.Join(dir, "audit", FileName), func() { os.RemoveAll(dir) }
+}
+
+func TestLog_AppendVerify(t *testing.T) {
+	path, cleanup := tmpLog(t)
+	defer cleanup()
+
+	a, err := Open(path, testKey)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	for _, vol := range []string{"vol1", "vol2"} {
+		if err := a.Append(&Record{Operation: OpVolumeCreate, Volume: vol, Outcome: "success"}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	a.Close()
+
+	// The chain continues once the file is opened again
+	a, err = Open(path, testKey)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	r := &Record{Operation: OpVolumeDelete, Volume: "vol1", Outcome: "success"}
+	if err := a.Append(r); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	a.Close()
+
+	if r.Seq != 3 || r.PrevHash == "" || r.Hash == "" {
+		t.Fatalf("expected the record to be chained, got: %#v", r)
+	}
+
+	if n, err := VerifyFile(path, testKey); err != nil || n != 3 {
+		t.Fatalf("expected 3 verified records, got: %d %v", n, err)
+	}
+}
+
+func TestOpen_PartialRecord(t *testing.T) {
+	path, cleanup := tmpLog(t)
+	defer cleanup()
+
+	a, err := Open(path, testKey)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for _, vol := range []string{"vol1", "vol2"} {
+		if err := a.Append(&Record{Operation: OpVolumeCreate, Volume: vol, Outcome: "success"}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	a.Close()
+
+	// A crash leaves a partially written record
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	f.WriteString(`{"seq":3,"time":"2017-`)
+	f.Close()
+
+	// The partial record is truncated & the chain continues
+	for i := 0; i < 2; i++ {
+		a, err = Open(path, testKey)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if err := a.Append(&Record{Operation: OpVolumeDelete, Volume: "vol1", Outcome: "success"}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		a.Close()
+	}
+
+	if n, err := VerifyFile(path, testKey); err != nil || n != 4 {
+		t.Fatalf("expected 4 verified records, got: %d %v", n, err)
+	}
+}
+
+func TestOpen_BrokenChain(t *testing.T) {
+	path, cleanup := tmpLog(t)
+	defer cleanup()
+
+	a, err := Open(path, testKey)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := a.Append(&Record{Operation: OpVolumeCreate, Volume: "vol1", Outcome: "success"}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	a.Close()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	f.WriteString("garbage\n")
+	f.Close()
+
+	// The log is still appended to & queried though Verify reports it
+	a, err = Open(path, testKey)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	r := &Record{Operation: OpVolumeCreate, Volume: "vol2", Outcome: "success"}
+	if err := a.Append(r); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if r.Seq != 2 {
+		t.Fatalf("expected the record to follow the last valid record, got: %#v", r)
+	}
+
+	records, err := a.Query(Query{})
+	if err != nil || len(records) != 2 {
+		t.Fatalf("expected 2 records, got: %v %v", records, err)
+	}
+	a.Close()
+
+	if _, err := VerifyFile(path, testKey); err == nil {
+		t.Fatalf("expected a chain error")
+	}
+}
+
+func TestVerify_Tampered(t *testing.T) {
+	path, cleanup := tmpLog(t)
+	defer cleanup()
+
+	a, err := Open(path, testKey)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for _, vol := range []string{"vol1", "vol2", "vol3"} {
+		if err := a.Append(&Record{Operation: OpVolumeCreate, Volume: vol, Outcome: "success"}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	a.Close()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+
+	cases := map[string]struct {
+		log  string
+		line int
+	}{
+		"modified":  {strings.Replace(string(data), `"vol2"`, `"vol9"`, 1), 2},
+		"removed":   {lines[0] + lines[2], 2},
+		"reordered": {lines[1] + lines[0] + lines[2], 1},
+		"garbage":   {lines[0] + "garbage\n" + lines[1], 2},
+	}
+
+	for name, tc := range cases {
+		n, err := Verify(bytes.NewBufferString(tc.log), testKey)
+		cErr, ok := err.(*ChainError)
+		if !ok || cErr.Line != tc.line || n != tc.line-1 {
+			t.Fatalf("%s: expected chain error at line %d, got: %d %v", name, tc.line, n, err)
+		}
+	}
+}
+
+func TestVerify_Rechained(t *testing.T) {
+	path, cleanup := tmpLog(t)
+	defer cleanup()
+
+	a, err := Open(path, testKey)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for _, vol := range []string{"vol1", "vol2"} {
+		if err := a.Append(&Record{Operation: OpVolumeCreate, Volume: vol, Outcome: "success"}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	a.Close()
+
+	records, err := (&Log{path: path}).Query(Query{})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// A record is modified & the chain is computed again without the key
+	otherKey := []byte("fedcba9876543210fedcba9876543210")
+	var buf bytes.Buffer
+	var prev string
+	for _, r := range records {
+		if r.Volume == "vol1" {
+			r.Volume = "vol9"
+		}
+		r.PrevHash = prev
+		if r.Hash, err = r.hash(otherKey); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		prev = r.Hash
+
+		line, _ := json.Marshal(r)
+		buf.Write(append(line, '\n'))
+	}
+
+	n, err := Verify(&buf, testKey)
+	if cErr, ok := err.(*ChainError); !ok || cErr.Line != 1 || n != 0 {
+		t.Fatalf("expected chain error at line 1, got: %d %v", n, err)
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mapiserver")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "keys", KeyFileName)
+	if _, err := ReadKey(path); !os.IsNotExist(err) {
+		t.Fatalf("expected no key, got: %v", err)
+	}
+
+	key, err := LoadKey(path)
+	if err != nil || len(key) != keySize {
+		t.Fatalf("expected a new key, got: %v %v", key, err)
+	}
+
+	// The key is retained
+	again, err := LoadKey(path)
+	if err != nil || !bytes.Equal(key, again) {
+		t.Fatalf("expected the same key, got: %v %v", again, err)
+	}
+
+	if _, err := Open(path, nil); err == nil {
+		t.Fatalf("expected the key to be required")
+	}
+}
+
+func TestLog_Query(t *testing.T) {
+	path, cleanup := tmpLog(t)
+	defer cleanup()
+
+	a, err := Open(path, testKey)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer a.Close()
+
+	start := time.Date(2017, 1, 2, 15, 0, 0, 0, time.UTC)
+	records := []*Record{
+		{Time: start, Operation: OpVolumeCreate, Volume: "vol1"},
+		{Time: start.Add(time.Minute), Operation: OpVolumeCreate, Volume: "vol2"},
+		{Time: start.Add(2 * time.Minute), Operation: OpConfigReload},
+		{Time: start.Add(3 * time.Minute), Operation: OpVolumeDelete, Volume: "vol1"},
+	}
+	for _, r := range records {
+		if err := a.Append(r); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	cases := []struct {
+		q    Query
+		seqs []uint64
+	}{
+		{Query{}, []uint64{1, 2, 3, 4}},
+		{Query{Volume: "vol1"}, []uint64{1, 4}},
+		{Query{Operation: OpVolumeCreate}, []uint64{1, 2}},
+		{Query{Since: start.Add(time.Minute), Until: start.Add(3 * time.Minute)}, []uint64{2, 3}},
+		{Query{Limit: 2}, []uint64{3, 4}},
+	}
+
+	for i, tc := range cases {
+		out, err := a.Query(tc.q)
+		if err != nil {
+			t.Fatalf("%d: err: %v", i, err)
+		}
+
+		var seqs []uint64
+		for _, r := range out {
+			seqs = append(seqs, r.Seq)
+		}
+		if len(seqs) != len(tc.seqs) {
+			t.Fatalf("%d: expected %v, got: %v", i, tc.seqs, seqs)
+		}
+		for j := range seqs {
+			if seqs[j] != tc.seqs[j] {
+				t.Fatalf("%d: expected %v, got: %v", i, tc.seqs, seqs)
+			}
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	spec := map[string]interface{}{
+		"name": "vol1",
+		"labels": map[string]string{
+			"volumeprovisioner.mapi.openebs.io/replica-count": "2",
+			"auth.openebs.io/chap-password":                   "hunter2",
+		},
+		"Token": "abc",
+		"items": []interface{}{map[string]string{"clientSecret": "xyz"}},
+	}
+
+	var out map[string]interface{}
+	if err := json.Unmarshal(Redact(spec), &out); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	labels := out["labels"].(map[string]interface{})
+	item := out["items"].([]interface{})[0].(map[string]interface{})
+	switch {
+	case out["name"] != "vol1", labels["volumeprovisioner.mapi.openebs.io/replica-count"] != "2":
+		t.Fatalf("expected the other values to be retained, got: %v", out)
+	case labels["auth.openebs.io/chap-password"] != Redacted, out["Token"] != Redacted, item["clientSecret"] != Redacted:
+		t.Fatalf("expected the secrets to be redacted, got: %v", out)
+	}
+
+	if Redact(nil) != nil {
+		t.Fatalf("expected no spec")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // MayaConfig is the configuration for Maya server.
@@ -31,6 +32,15 @@ type MayaConfig struct {
 	// LogLevel is the level of the logs to putout
 	LogLevel string `mapstructure:"log_level"`
 
+	// LogLevels are the levels of the logs of specific components e.g.
+	// orchprovider.k8s. A component that is not set here inherits the level
+	// of its parent component e.g. orchprovider & then log_level.
+	LogLevels map[string]string `mapstructure:"log_levels"`
+
+	// LogFormat is the format of the logs. It can be text or json. The json
+	// format carries the fields of the log entries e.g. request_id.
+	LogFormat string `mapstructure:"log_format"`
+
 	// BindAddr is the address on which maya's services will
 	// be bound. If not specified, this defaults to 127.0.0.1.
 	BindAddr string `mapstructure:"bind_addr"`
@@ -68,6 +78,87 @@ type MayaConfig struct {
 	// SyslogFacility is used to control the syslog facility used.
 	SyslogFacility string `mapstructure:"syslog_facility"`
 
+	// LogFile is the file to which the logs are written along with stdout.
+	// The logs are not written to any file if this is not set.
+	LogFile string `mapstructure:"log_file"`
+
+	// LogRotateBytes is the size in bytes after which the log file is
+	// rotated. The log file is not rotated by size if this is not set.
+	LogRotateBytes int `mapstructure:"log_rotate_bytes"`
+
+	// LogRotateDuration is the duration after which the log file is rotated.
+	// The log file is not rotated by time if this is not set.
+	LogRotateDuration time.Duration `mapstructure:"log_rotate_duration"`
+
+	// LogRotateMaxAge is the age after which the rotated log files are
+	// removed. The rotated files are not removed by age if this is not set.
+	LogRotateMaxAge time.Duration `mapstructure:"log_rotate_max_age"`
+
+	// LogRotateMaxFiles is the no. of rotated log files to keep. Every rotated
+	// file is kept if this is not set.
+	LogRotateMaxFiles int `mapstructure:"log_rotate_max_files"`
+
+	// LogRotateCompress is used to gzip the rotated log files
+	LogRotateCompress bool `mapstructure:"log_rotate_compress"`
+
+	// DrainTimeout is the duration to wait for in-flight requests & background
+	// operations to complete during a graceful shutdown.
+	DrainTimeout time.Duration `mapstructure:"drain_timeout"`
+
+	// AccessLogFile is the file to which the HTTP requests are logged. Access
+	// logging is disabled if this is not set.
+	AccessLogFile string `mapstructure:"access_log_file"`
+
+	// AccessLogFormat is the format of the access log entries. It can be
+	// either common i.e. Common Log Format or json. Defaults to common.
+	AccessLogFormat string `mapstructure:"access_log_format"`
+
+	// TraceCollectorAddr is the address of the OTLP/HTTP collector to which
+	// the trace spans are exported e.g. http://otel-collector:4318. Spans are
+	// not exported if this is not set.
+	TraceCollectorAddr string `mapstructure:"trace_collector_addr"`
+
+	// CHAPAccessToken is the bearer token that authorizes the callers to read
+	// the CHAP credentials of the volumes via the target details. The
+	// credentials are never released if this is not set.
+	CHAPAccessToken string `mapstructure:"chap_access_token"`
+
+	// InstanceID is served as the instance-id of the meta data service to
+	// the node on the host of maya api server. The other nodes get an id
+	// derived from their addresses. AvailabilityZone is served as the
+	// placement/availability-zone to every node. The volumes are reported in
+	// the availability zone via the EC2 API as well. These default to
+	// any-compute & any-zone respectively.
+	InstanceID       string `mapstructure:"instance_id"`
+	AvailabilityZone string `mapstructure:"availability_zone"`
+
+	// AdminToken is the bearer token of the admin scope. It authorizes the
+	// callers of the debug endpoints i.e. /v1/agent/self, /v1/agent/debug/*,
+	// /debug/pprof/* & /debug/vars. These are served to no one if this is not
+	// set.
+	AdminToken string `mapstructure:"admin_token"`
+
+	// EC2AccessKeyID & EC2SecretAccessKey are the AWS access keys of the
+	// admin scope. The requests of the EC2 query API that are signed by
+	// these via AWS Signature Version 4 are authorized as if these had the
+	// admin token. The EBS volume plugins need these to detach the volumes
+	// as they send no bearer token.
+	EC2AccessKeyID     string `mapstructure:"ec2_access_key_id"`
+	EC2SecretAccessKey string `mapstructure:"ec2_secret_access_key"`
+
+	// AuditKeyFile is the file of the key by which the records of the audit
+	// log are chained. It is kept apart from the data directory so that
+	// those who can write the audit log can not chain a modified record. A
+	// key is generated within the data directory if this is not set.
+	AuditKeyFile string `mapstructure:"audit_key_file"`
+
+	// StateKeyFile is the file of the key that seals the secrets of the
+	// state e.g. the CHAP credentials of the volumes. It is kept apart from
+	// the data directory so that a copy of the state does not disclose the
+	// secrets. A key is generated within the data directory if this is not
+	// set.
+	StateKeyFile string `mapstructure:"state_key_file"`
+
 	// NomadConfig is used to communicate with Nomad agent.
 	//NomadConfig *nomad.Config `mapstructure:"nomad_config"`
 
@@ -107,15 +198,18 @@ type AdvertiseAddrs struct {
 func DefaultMayaConfig() *MayaConfig {
 	return &MayaConfig{
 		LogLevel:   "INFO",
+		LogFormat:  "text",
 		Region:     "global",
 		Datacenter: "dc1",
 		BindAddr:   "127.0.0.1",
 		Ports: &Ports{
 			HTTP: 5656,
 		},
-		Addresses:      &Addresses{},
-		AdvertiseAddrs: &AdvertiseAddrs{},
-		SyslogFacility: "LOCAL0",
+		Addresses:       &Addresses{},
+		AdvertiseAddrs:  &AdvertiseAddrs{},
+		SyslogFacility:  "LOCAL0",
+		DrainTimeout:    5 * time.Second,
+		AccessLogFormat: "common",
 	}
 }
 
@@ -163,6 +257,9 @@ func (mc *MayaConfig) Merge(b *MayaConfig) *MayaConfig {
 	if b.LogLevel != "" {
 		result.LogLevel = b.LogLevel
 	}
+	if b.LogFormat != "" {
+		result.LogFormat = b.LogFormat
+	}
 	if b.BindAddr != "" {
 		result.BindAddr = b.BindAddr
 	}
@@ -181,6 +278,60 @@ func (mc *MayaConfig) Merge(b *MayaConfig) *MayaConfig {
 	if b.SyslogFacility != "" {
 		result.SyslogFacility = b.SyslogFacility
 	}
+	if b.LogFile != "" {
+		result.LogFile = b.LogFile
+	}
+	if b.LogRotateBytes != 0 {
+		result.LogRotateBytes = b.LogRotateBytes
+	}
+	if b.LogRotateDuration != 0 {
+		result.LogRotateDuration = b.LogRotateDuration
+	}
+	if b.LogRotateMaxAge != 0 {
+		result.LogRotateMaxAge = b.LogRotateMaxAge
+	}
+	if b.LogRotateMaxFiles != 0 {
+		result.LogRotateMaxFiles = b.LogRotateMaxFiles
+	}
+	if b.LogRotateCompress {
+		result.LogRotateCompress = true
+	}
+	if b.DrainTimeout != 0 {
+		result.DrainTimeout = b.DrainTimeout
+	}
+	if b.AccessLogFile != "" {
+		result.AccessLogFile = b.AccessLogFile
+	}
+	if b.AccessLogFormat != "" {
+		result.AccessLogFormat = b.AccessLogFormat
+	}
+	if b.TraceCollectorAddr != "" {
+		result.TraceCollectorAddr = b.TraceCollectorAddr
+	}
+	if b.CHAPAccessToken != "" {
+		result.CHAPAccessToken = b.CHAPAccessToken
+	}
+	if b.AdminToken != "" {
+		result.AdminToken = b.AdminToken
+	}
+	if b.EC2AccessKeyID != "" {
+		result.EC2AccessKeyID = b.EC2AccessKeyID
+	}
+	if b.EC2SecretAccessKey != "" {
+		result.EC2SecretAccessKey = b.EC2SecretAccessKey
+	}
+	if b.AuditKeyFile != "" {
+		result.AuditKeyFile = b.AuditKeyFile
+	}
+	if b.StateKeyFile != "" {
+		result.StateKeyFile = b.StateKeyFile
+	}
+	if b.InstanceID != "" {
+		result.InstanceID = b.InstanceID
+	}
+	if b.AvailabilityZone != "" {
+		result.AvailabilityZone = b.AvailabilityZone
+	}
 
 	// Apply the ports config
 	if result.Ports == nil && b.Ports != nil {
@@ -217,6 +368,14 @@ func (mc *MayaConfig) Merge(b *MayaConfig) *MayaConfig {
 		result.HTTPAPIResponseHeaders[k] = v
 	}
 
+	// Add the component log levels
+	if result.LogLevels == nil && b.LogLevels != nil {
+		result.LogLevels = make(map[string]string)
+	}
+	for k, v := range b.LogLevels {
+		result.LogLevels[k] = v
+	}
+
 	return &result
 }
 
@@ -368,6 +527,9 @@ func LoadMayaConfig(path string) (*MayaConfig, error) {
 
 	cleaned := filepath.Clean(path)
 	mconfig, err := ParseMayaConfigFile(cleaned)
+	if _, ok := err.(ValidationErrors); ok {
+		return nil, err
+	}
 	if err != nil {
 		return nil, fmt.Errorf("Error loading %s: %s", cleaned, err)
 	}
@@ -377,7 +539,8 @@ func LoadMayaConfig(path string) (*MayaConfig, error) {
 }
 
 // LoadMayaConfigDir loads all the configurations in the given directory
-// in alphabetical order.
+// in alphabetical order. The validation errors of all the files are
+// returned at once.
 func LoadMayaConfigDir(dir string) (*MayaConfig, error) {
 	f, err := os.Open(dir)
 	if err != nil {
@@ -434,8 +597,13 @@ func LoadMayaConfigDir(dir string) (*MayaConfig, error) {
 	sort.Strings(files)
 
 	var result *MayaConfig
+	var errs ValidationErrors
 	for _, f := range files {
 		mconfig, err := ParseMayaConfigFile(f)
+		if vErrs, ok := err.(ValidationErrors); ok {
+			errs = append(errs, vErrs...)
+			continue
+		}
 		if err != nil {
 			return nil, fmt.Errorf("Error loading %s: %s", f, err)
 		}
@@ -448,6 +616,10 @@ func LoadMayaConfigDir(dir string) (*MayaConfig, error) {
 		}
 	}
 
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
 	return result, nil
 }
 
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// configField is a field of the config as it is written in a config file.
+// The value is either a string, bool, int, nested fields or a map of
+// strings.
+type configField struct {
+	key   string
+	value interface{}
+}
+
+// fields returns the fields of the config that can be set in a config file
+// in the order of their declaration
+func (mc *MayaConfig) fields() []configField {
+	var fields []configField
+	for _, f := range structFields(reflect.ValueOf(mc).Elem()) {
+		if _, ok := configSchema[f.key]; ok {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+func structFields(v reflect.Value) []configField {
+	var fields []configField
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("mapstructure")
+		if key == "" || key == "-" {
+			continue
+		}
+
+		fv := v.Field(i)
+		switch fv.Kind() {
+		case reflect.Ptr:
+			if fv.IsNil() {
+				continue
+			}
+			fields = append(fields, configField{key, structFields(fv.Elem())})
+		case reflect.Map:
+			if fv.Len() == 0 {
+				continue
+			}
+			fields = append(fields, configField{key, fv.Interface()})
+		default:
+			value := fv.Interface()
+			if d, ok := value.(time.Duration); ok {
+				value = d.String()
+			}
+			fields = append(fields, configField{key, value})
+		}
+	}
+
+	return fields
+}
+
+// EncodeHCL encodes the config in HCL. The encoded config can be parsed
+// back via ParseMayaConfig.
+func (mc *MayaConfig) EncodeHCL() []byte {
+	var buf bytes.Buffer
+	writeHCL(&buf, mc.fields(), "")
+	return buf.Bytes()
+}
+
+func writeHCL(buf *bytes.Buffer, fields []configField, indent string) {
+	for _, f := range fields {
+		switch v := f.value.(type) {
+		case []configField:
+			fmt.Fprintf(buf, "%s%s {\n", indent, f.key)
+			writeHCL(buf, v, indent+"  ")
+			fmt.Fprintf(buf, "%s}\n", indent)
+		case map[string]string:
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			fmt.Fprintf(buf, "%s%s {\n", indent, f.key)
+			for _, k := range keys {
+				fmt.Fprintf(buf, "%s  %s = %s\n", indent, strconv.Quote(k), strconv.Quote(v[k]))
+			}
+			fmt.Fprintf(buf, "%s}\n", indent)
+		case string:
+			fmt.Fprintf(buf, "%s%s = %s\n", indent, f.key, strconv.Quote(v))
+		default:
+			fmt.Fprintf(buf, "%s%s = %v\n", indent, f.key, v)
+		}
+	}
+}
+
+// EncodeJSON encodes the config in JSON. The encoded config can be parsed
+// back via ParseMayaConfig.
+func (mc *MayaConfig) EncodeJSON() ([]byte, error) {
+	return json.MarshalIndent(jsonFields(mc.fields()), "", "  ")
+}
+
+func jsonFields(fields []configField) map[string]interface{} {
+	m := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		if nested, ok := f.value.([]configField); ok {
+			m[f.key] = jsonFields(nested)
+			continue
+		}
+		m[f.key] = f.value
+	}
+	return m
+}
@@ -0,0 +1,305 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix is the prefix of the env vars that override the config fields
+// e.g. MAPI_PORTS_HTTP overrides ports.http
+const EnvPrefix = "MAPI_"
+
+// Override is a config field that can be overridden via an env var or a CLI
+// flag. Every field that can be set in a config file has an override.
+type Override struct {
+	// Key is the key of the field in the config file e.g. ports.http
+	Key string
+
+	// Env is the env var that overrides the field e.g. MAPI_PORTS_HTTP
+	Env string
+
+	// Flag is the CLI flag that overrides the field e.g. ports-http
+	Flag string
+
+	// index is the path of the field in MayaConfig
+	index []int
+	typ   reflect.Type
+}
+
+// IsBool returns true if the field is a bool. Such flags can be set without
+// a value.
+func (o *Override) IsBool() bool {
+	return o.typ.Kind() == reflect.Bool
+}
+
+// Usage describes the value expected by the override
+func (o *Override) Usage() string {
+	switch {
+	case o.typ == reflect.TypeOf(time.Duration(0)):
+		return "<duration>"
+	case o.typ.Kind() == reflect.Bool:
+		return "<bool>"
+	case o.typ.Kind() == reflect.Int:
+		return "<int>"
+	case o.typ.Kind() == reflect.Map:
+		return "<key=value,...>"
+	default:
+		return "<string>"
+	}
+}
+
+// Overrides returns the overrides of all the config fields sorted by their
+// keys
+func Overrides() []*Override {
+	overrides := structOverrides(reflect.TypeOf(MayaConfig{}), "", nil)
+	sort.Sort(overridesByKey(overrides))
+	return overrides
+}
+
+type overridesByKey []*Override
+
+func (o overridesByKey) Len() int           { return len(o) }
+func (o overridesByKey) Less(i, j int) bool { return o[i].Key < o[j].Key }
+func (o overridesByKey) Swap(i, j int)      { o[i], o[j] = o[j], o[i] }
+
+func structOverrides(t reflect.Type, prefix string, index []int) []*Override {
+	var overrides []*Override
+
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("mapstructure")
+		if key == "" || key == "-" {
+			continue
+		}
+
+		if prefix == "" {
+			if _, ok := configSchema[key]; !ok {
+				continue
+			}
+		} else {
+			key = prefix + "." + key
+		}
+
+		fIndex := append(append([]int{}, index...), i)
+		ft := t.Field(i).Type
+
+		if ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct {
+			overrides = append(overrides, structOverrides(ft.Elem(), key, fIndex)...)
+			continue
+		}
+
+		name := strings.Replace(key, ".", "_", -1)
+		overrides = append(overrides, &Override{
+			Key:   key,
+			Env:   EnvPrefix + strings.ToUpper(name),
+			Flag:  strings.Replace(name, "_", "-", -1),
+			index: fIndex,
+			typ:   ft,
+		})
+	}
+
+	return overrides
+}
+
+// settable returns the field of the override in the config. The blocks on
+// the way to the field are allocated if not set.
+func (o *Override) settable(mc *MayaConfig) reflect.Value {
+	v := reflect.ValueOf(mc).Elem()
+	for i, idx := range o.index {
+		v = v.Field(idx)
+		if i < len(o.index)-1 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+	}
+	return v
+}
+
+// value returns the value of the field of the override in the config. The
+// zero value is returned if a block on the way to the field is not set.
+func (o *Override) value(mc *MayaConfig) reflect.Value {
+	v := reflect.ValueOf(mc).Elem()
+	for i, idx := range o.index {
+		v = v.Field(idx)
+		if i < len(o.index)-1 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Zero(o.typ)
+			}
+			v = v.Elem()
+		}
+	}
+	return v
+}
+
+// ChangedKeys returns the keys of the fields whose values differ between the
+// configs. An empty map & a map that is not set are considered equal.
+func ChangedKeys(a, b *MayaConfig) []string {
+	var keys []string
+	for _, o := range Overrides() {
+		av, bv := o.value(a), o.value(b)
+		if av.Kind() == reflect.Map && av.Len() == 0 && bv.Len() == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(av.Interface(), bv.Interface()) {
+			keys = append(keys, o.Key)
+		}
+	}
+	return keys
+}
+
+// Copy returns a deep copy of the config
+func (mc *MayaConfig) Copy() *MayaConfig {
+	result := *mc
+
+	if mc.Ports != nil {
+		ports := *mc.Ports
+		result.Ports = &ports
+	}
+	if mc.Addresses != nil {
+		addrs := *mc.Addresses
+		result.Addresses = &addrs
+	}
+	if mc.NormalizedAddrs != nil {
+		addrs := *mc.NormalizedAddrs
+		result.NormalizedAddrs = &addrs
+	}
+	if mc.AdvertiseAddrs != nil {
+		advertise := *mc.AdvertiseAddrs
+		result.AdvertiseAddrs = &advertise
+	}
+	if mc.Files != nil {
+		result.Files = append([]string{}, mc.Files...)
+	}
+	if mc.HTTPAPIResponseHeaders != nil {
+		result.HTTPAPIResponseHeaders = make(map[string]string, len(mc.HTTPAPIResponseHeaders))
+		for k, v := range mc.HTTPAPIResponseHeaders {
+			result.HTTPAPIResponseHeaders[k] = v
+		}
+	}
+	if mc.LogLevels != nil {
+		result.LogLevels = make(map[string]string, len(mc.LogLevels))
+		for k, v := range mc.LogLevels {
+			result.LogLevels[k] = v
+		}
+	}
+
+	return &result
+}
+
+// Retain returns a copy of the config with the fields of the given keys set
+// to their values in old e.g. to retain the settings that cannot be changed
+// without a restart.
+func (mc *MayaConfig) Retain(old *MayaConfig, keys []string) *MayaConfig {
+	result := mc.Copy()
+	old = old.Copy()
+
+	for _, key := range keys {
+		if o := lookupOverride(key); o != nil {
+			o.settable(result).Set(o.value(old))
+		}
+	}
+
+	return result
+}
+
+// lookupOverride returns the override of the given key
+func lookupOverride(key string) *Override {
+	for _, o := range Overrides() {
+		if o.Key == key {
+			return o
+		}
+	}
+	return nil
+}
+
+// Set overrides the config field of the given key with the value. Unlike
+// Merge, zero values e.g. false are set as well. Entries of a map field
+// are given as key=value pairs separated by commas & are merged with the
+// existing entries.
+func (mc *MayaConfig) Set(key, value string) error {
+	o := lookupOverride(key)
+	if o == nil {
+		return fmt.Errorf("invalid key: %s", key)
+	}
+
+	v := o.settable(mc)
+
+	switch {
+	case o.typ == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case o.typ.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case o.typ.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case o.typ.Kind() == reflect.String:
+		v.SetString(value)
+	case o.typ.Kind() == reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(o.typ))
+		}
+		for _, pair := range strings.Split(value, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+				return fmt.Errorf("expected key=value, got: %s", pair)
+			}
+			v.SetMapIndex(reflect.ValueOf(strings.TrimSpace(kv[0])), reflect.ValueOf(strings.TrimSpace(kv[1])))
+		}
+	default:
+		return fmt.Errorf("cannot override %s of type %s", key, o.typ)
+	}
+
+	return nil
+}
+
+// ApplyEnv overrides the config fields with the MAPI_ prefixed env vars in
+// the given environment e.g. os.Environ(). Env vars with the prefix that do
+// not match a config field are ignored as they may be meant for other
+// tools. The errors of all the env vars are returned at once.
+func (mc *MayaConfig) ApplyEnv(environ []string) error {
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if !strings.HasPrefix(kv, EnvPrefix) {
+			continue
+		}
+		pair := strings.SplitN(kv, "=", 2)
+		if len(pair) == 2 {
+			env[pair[0]] = pair[1]
+		}
+	}
+
+	var errs ValidationErrors
+	for _, o := range Overrides() {
+		value, ok := env[o.Env]
+		if !ok {
+			continue
+		}
+		if err := mc.Set(o.Key, value); err != nil {
+			errs = append(errs, &ValidationError{Key: o.Env, Msg: err.Error()})
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOverrides(t *testing.T) {
+	overrides := map[string]*Override{}
+	for _, o := range Overrides() {
+		overrides[o.Key] = o
+	}
+
+	// Every key of the config file has an override
+	for key, sk := range configSchema {
+		if sk.block && sk.keys != nil {
+			for _, nested := range sk.keys {
+				if _, ok := overrides[key+"."+nested]; !ok {
+					t.Fatalf("expected an override of %s.%s", key, nested)
+				}
+			}
+			continue
+		}
+		if _, ok := overrides[key]; !ok {
+			t.Fatalf("expected an override of %s", key)
+		}
+	}
+
+	o := overrides["ports.http"]
+	if o.Env != "MAPI_PORTS_HTTP" || o.Flag != "ports-http" {
+		t.Fatalf("bad override of ports.http: %s %s", o.Env, o.Flag)
+	}
+
+	o = overrides["http_api_response_headers"]
+	if o.Env != "MAPI_HTTP_API_RESPONSE_HEADERS" || o.Flag != "http-api-response-headers" {
+		t.Fatalf("bad override of http_api_response_headers: %s %s", o.Env, o.Flag)
+	}
+}
+
+func TestMayaConfig_Set(t *testing.T) {
+	mc := &MayaConfig{EnableDebug: true}
+
+	sets := [][2]string{
+		{"region", "BANG-EAST"},
+		{"enable_debug", "false"},
+		{"ports.http", "1234"},
+		{"advertise.http", "10.0.0.1"},
+		{"drain_timeout", "30s"},
+		{"http_api_response_headers", "A=1, B=2"},
+		{"http_api_response_headers", "B=3"},
+	}
+	for _, s := range sets {
+		if err := mc.Set(s[0], s[1]); err != nil {
+			t.Fatalf("%s: err: %v", s[0], err)
+		}
+	}
+
+	expected := &MayaConfig{
+		Region:         "BANG-EAST",
+		Ports:          &Ports{HTTP: 1234},
+		AdvertiseAddrs: &AdvertiseAddrs{HTTP: "10.0.0.1"},
+		DrainTimeout:   30 * time.Second,
+		HTTPAPIResponseHeaders: map[string]string{
+			"A": "1",
+			"B": "3",
+		},
+	}
+	if !reflect.DeepEqual(mc, expected) {
+		t.Fatalf("expected: %#v\n\nactual: %#v", expected, mc)
+	}
+
+	for _, s := range [][2]string{
+		{"ports.http", "http"},
+		{"enable_debug", "maybe"},
+		{"drain_timeout", "5"},
+		{"http_api_response_headers", "A"},
+		{"interfaces", "eth0"},
+	} {
+		if err := mc.Set(s[0], s[1]); err == nil {
+			t.Fatalf("%s=%s: expected error", s[0], s[1])
+		}
+	}
+}
+
+func TestMayaConfig_ApplyEnv(t *testing.T) {
+	mc := DefaultMayaConfig()
+
+	err := mc.ApplyEnv([]string{
+		"PATH=/usr/bin",
+		"MAPI_ADDR=http://127.0.0.1:5656",
+		"MAPI_LOG_LEVEL=DEBUG",
+		"MAPI_PORTS_HTTP=1234",
+		"MAPI_LEAVE_ON_TERMINATE=true",
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if mc.LogLevel != "DEBUG" || mc.Ports.HTTP != 1234 || !mc.LeaveOnTerm {
+		t.Fatalf("expected the env vars to be applied, got: %#v", mc)
+	}
+
+	err = mc.ApplyEnv([]string{
+		"MAPI_PORTS_HTTP=http",
+		"MAPI_DRAIN_TIMEOUT=soon",
+	})
+	errs, ok := err.(ValidationErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expected errors of both the env vars, got: %v", err)
+	}
+	if errs[0].Key != "MAPI_DRAIN_TIMEOUT" || errs[1].Key != "MAPI_PORTS_HTTP" {
+		t.Fatalf("expected the env vars in the errors, got: %v", errs)
+	}
+}
+
+func TestChangedKeys_Retain(t *testing.T) {
+	old := DefaultMayaConfig()
+	newConf := old.Copy()
+	newConf.Region = "BANG-EAST"
+	newConf.Ports.HTTP = 1234
+	newConf.HTTPAPIResponseHeaders = map[string]string{"foo": "bar"}
+
+	// The copy does not share the nested structs of the original
+	if old.Ports.HTTP == 1234 {
+		t.Fatalf("expected copy to not modify the original")
+	}
+
+	changed := ChangedKeys(old, newConf)
+	expected := []string{"http_api_response_headers", "ports.http", "region"}
+	if !reflect.DeepEqual(changed, expected) {
+		t.Fatalf("expected: %v, got: %v", expected, changed)
+	}
+
+	result := newConf.Retain(old, []string{"ports.http"})
+	if result.Ports.HTTP != old.Ports.HTTP || result.Region != "BANG-EAST" {
+		t.Fatalf("bad: %#v", result)
+	}
+	if newConf.Ports.HTTP != 1234 {
+		t.Fatalf("expected retain to not modify the new config")
+	}
+
+	if keys := ChangedKeys(old, old.Copy()); len(keys) != 0 {
+		t.Fatalf("expected no changes, got: %v", keys)
+	}
+}
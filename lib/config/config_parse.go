@@ -10,6 +10,7 @@ import (
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/hcl"
 	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/parser"
 	"github.com/mitchellh/mapstructure"
 )
 
@@ -27,6 +28,10 @@ func ParseMayaConfigFile(path string) (*MayaConfig, error) {
 	defer f.Close()
 
 	mconfig, err := ParseMayaConfig(f)
+	if errs, ok := err.(ValidationErrors); ok {
+		errs.setFilename(path)
+		return nil, errs
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -34,7 +39,9 @@ func ParseMayaConfigFile(path string) (*MayaConfig, error) {
 	return mconfig, nil
 }
 
-// ParseMayaConfig parses the config from the given io.Reader.
+// ParseMayaConfig parses the config from the given io.Reader. The config is
+// validated before it is decoded. All the invalid keys & values are returned
+// as ValidationErrors.
 //
 // Due to current internal limitations, the entire contents of the
 // io.Reader will be copied into memory first before parsing.
@@ -47,6 +54,9 @@ func ParseMayaConfig(r io.Reader) (*MayaConfig, error) {
 
 	// Parse the buffer
 	root, err := hcl.Parse(buf.String())
+	if pErr, ok := err.(*parser.PosError); ok {
+		return nil, ValidationErrors{{Pos: pErr.Pos, Msg: pErr.Err.Error()}}
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error parsing: %s", err)
 	}
@@ -58,6 +68,10 @@ func ParseMayaConfig(r io.Reader) (*MayaConfig, error) {
 		return nil, fmt.Errorf("error parsing: root should be an object")
 	}
 
+	if errs := validateConfig(list); len(errs) > 0 {
+		return nil, errs
+	}
+
 	var mconfig MayaConfig
 	if err := parseConfig(&mconfig, list); err != nil {
 		return nil, fmt.Errorf("error parsing 'config': %v", err)
@@ -68,23 +82,9 @@ func ParseMayaConfig(r io.Reader) (*MayaConfig, error) {
 
 func parseConfig(result *MayaConfig, list *ast.ObjectList) error {
 	// Check for invalid keys
-	valid := []string{
-		"region",
-		"datacenter",
-		"name",
-		"data_dir",
-		"log_level",
-		"bind_addr",
-		"enable_debug",
-		"ports",
-		"addresses",
-		"interfaces",
-		"advertise",
-		"leave_on_interrupt",
-		"leave_on_terminate",
-		"enable_syslog",
-		"syslog_facility",
-		"http_api_response_headers",
+	valid := make([]string, 0, len(configSchema))
+	for key := range configSchema {
+		valid = append(valid, key)
 	}
 	if err := checkHCLKeys(list, valid); err != nil {
 		return multierror.Prefix(err, "config:")
@@ -97,12 +97,12 @@ func parseConfig(result *MayaConfig, list *ast.ObjectList) error {
 	}
 	delete(m, "ports")
 	delete(m, "addresses")
-	delete(m, "interfaces")
 	delete(m, "advertise")
 	delete(m, "http_api_response_headers")
+	delete(m, "log_levels")
 
 	// Decode the rest
-	if err := mapstructure.WeakDecode(m, result); err != nil {
+	if err := weakDecode(m, result); err != nil {
 		return err
 	}
 
@@ -136,21 +136,47 @@ func parseConfig(result *MayaConfig, list *ast.ObjectList) error {
 
 	// Parse out http_api_response_headers fields. These are in HCL as a list so
 	// we need to iterate over them and merge them.
-	if headersO := list.Filter("http_api_response_headers"); len(headersO.Items) > 0 {
-		for _, o := range headersO.Elem().Items {
-			var m map[string]interface{}
-			if err := hcl.DecodeObject(&m, o.Val); err != nil {
-				return err
-			}
-			if err := mapstructure.WeakDecode(m, &result.HTTPAPIResponseHeaders); err != nil {
-				return err
-			}
-		}
+	if err := parseStringMap(&result.HTTPAPIResponseHeaders, list.Filter("http_api_response_headers")); err != nil {
+		return err
+	}
+
+	// Parse out the log levels of the components similar to the headers
+	if err := parseStringMap(&result.LogLevels, list.Filter("log_levels")); err != nil {
+		return multierror.Prefix(err, "log_levels ->")
 	}
 
 	return nil
 }
 
+// parseStringMap merges the blocks of key value pairs into the map
+func parseStringMap(result *map[string]string, list *ast.ObjectList) error {
+	for _, o := range list.Elem().Items {
+		var m map[string]interface{}
+		if err := hcl.DecodeObject(&m, o.Val); err != nil {
+			return err
+		}
+		if err := mapstructure.WeakDecode(m, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// weakDecode is similar to mapstructure.WeakDecode. In addition, it decodes
+// duration strings e.g. "5s" into time.Duration fields.
+func weakDecode(m interface{}, result interface{}) error {
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		WeaklyTypedInput: true,
+		Result:           result,
+	})
+	if err != nil {
+		return err
+	}
+
+	return dec.Decode(m)
+}
+
 func parsePorts(result **Ports, list *ast.ObjectList) error {
 	list = list.Elem()
 	if len(list.Items) > 1 {
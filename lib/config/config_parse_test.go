@@ -4,6 +4,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestMayaConfig_Parse(t *testing.T) {
@@ -15,11 +16,16 @@ func TestMayaConfig_Parse(t *testing.T) {
 		{
 			"dummy_mayaserver_config.hcl",
 			&MayaConfig{
-				Region:      "BANG-EAST",
-				Datacenter:  "dc2",
-				NodeName:    "my-vsm",
-				DataDir:     "/tmp/mayaserver",
-				LogLevel:    "ERR",
+				Region:     "BANG-EAST",
+				Datacenter: "dc2",
+				NodeName:   "my-vsm",
+				DataDir:    "/tmp/mayaserver",
+				LogLevel:   "ERR",
+				LogFormat:  "json",
+				LogLevels: map[string]string{
+					"http":             "WARN",
+					"orchprovider.k8s": "TRACE",
+				},
 				BindAddr:    "192.168.0.1",
 				EnableDebug: true,
 				Ports: &Ports{
@@ -28,11 +34,29 @@ func TestMayaConfig_Parse(t *testing.T) {
 				Addresses: &Addresses{
 					HTTP: "127.0.0.1",
 				},
-				AdvertiseAddrs: &AdvertiseAddrs{},
-				LeaveOnInt:     true,
-				LeaveOnTerm:    true,
-				EnableSyslog:   true,
-				SyslogFacility: "LOCAL1",
+				AdvertiseAddrs:     &AdvertiseAddrs{},
+				LeaveOnInt:         true,
+				LeaveOnTerm:        true,
+				EnableSyslog:       true,
+				SyslogFacility:     "LOCAL1",
+				LogFile:            "/tmp/mayaserver/mapiserver.log",
+				LogRotateBytes:     10485760,
+				LogRotateDuration:  24 * time.Hour,
+				LogRotateMaxAge:    7 * 24 * time.Hour,
+				LogRotateMaxFiles:  5,
+				LogRotateCompress:  true,
+				DrainTimeout:       10 * time.Second,
+				AccessLogFile:      "/tmp/mayaserver/access.log",
+				AccessLogFormat:    "json",
+				TraceCollectorAddr: "http://127.0.0.1:4318",
+				CHAPAccessToken:    "0123456789abcdef",
+				AdminToken:         "fedcba9876543210",
+				EC2AccessKeyID:     "AKIDEXAMPLE",
+				EC2SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+				AuditKeyFile:       "/etc/mayaserver/audit.key",
+				StateKeyFile:       "/etc/mayaserver/state.key",
+				InstanceID:         "i-0123456789abcdef0",
+				AvailabilityZone:   "bang-east-1a",
 				HTTPAPIResponseHeaders: map[string]string{
 					"Access-Control-Allow-Origin": "*",
 				},
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 )
 
 var (
@@ -17,17 +18,20 @@ var (
 
 func TestMayaConfig_Merge(t *testing.T) {
 	c1 := &MayaConfig{
-		Region:         "global",
-		Datacenter:     "dc1",
-		NodeName:       "node1",
-		DataDir:        "/tmp/dir1",
-		LogLevel:       "INFO",
-		EnableDebug:    false,
-		LeaveOnInt:     false,
-		LeaveOnTerm:    false,
-		EnableSyslog:   false,
-		SyslogFacility: "local0.info",
-		BindAddr:       "127.0.0.1",
+		Region:          "global",
+		Datacenter:      "dc1",
+		NodeName:        "node1",
+		DataDir:         "/tmp/dir1",
+		LogLevel:        "INFO",
+		LogFormat:       "text",
+		EnableDebug:     false,
+		LeaveOnInt:      false,
+		LeaveOnTerm:     false,
+		EnableSyslog:    false,
+		SyslogFacility:  "local0.info",
+		DrainTimeout:    5 * time.Second,
+		AccessLogFormat: "common",
+		BindAddr:        "127.0.0.1",
 		Ports: &Ports{
 			HTTP: 4646,
 		},
@@ -41,17 +45,31 @@ func TestMayaConfig_Merge(t *testing.T) {
 	}
 
 	c2 := &MayaConfig{
-		Region:         "region2",
-		Datacenter:     "dc2",
-		NodeName:       "node2",
-		DataDir:        "/tmp/dir2",
-		LogLevel:       "DEBUG",
-		EnableDebug:    true,
-		LeaveOnInt:     true,
-		LeaveOnTerm:    true,
-		EnableSyslog:   true,
-		SyslogFacility: "local0.debug",
-		BindAddr:       "127.0.0.2",
+		Region:     "region2",
+		Datacenter: "dc2",
+		NodeName:   "node2",
+		DataDir:    "/tmp/dir2",
+		LogLevel:   "DEBUG",
+		LogFormat:  "json",
+		LogLevels: map[string]string{
+			"orchprovider.k8s": "TRACE",
+		},
+		EnableDebug:        true,
+		LeaveOnInt:         true,
+		LeaveOnTerm:        true,
+		EnableSyslog:       true,
+		SyslogFacility:     "local0.debug",
+		LogFile:            "/tmp/dir2/mapiserver.log",
+		LogRotateBytes:     1024,
+		LogRotateDuration:  time.Hour,
+		LogRotateMaxAge:    24 * time.Hour,
+		LogRotateMaxFiles:  3,
+		LogRotateCompress:  true,
+		DrainTimeout:       30 * time.Second,
+		AccessLogFile:      "/tmp/dir2/access.log",
+		AccessLogFormat:    "json",
+		TraceCollectorAddr: "http://127.0.0.1:4318",
+		BindAddr:           "127.0.0.2",
 		Ports: &Ports{
 			HTTP: 20000,
 		},
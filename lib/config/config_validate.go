@@ -0,0 +1,418 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/token"
+	"github.com/hashicorp/logutils"
+	"github.com/mitchellh/mapstructure"
+	"github.com/openebs/mayaserver/lib/loghelper"
+)
+
+// schemaKey describes a key of the config file
+type schemaKey struct {
+	// block is set if the key is a block of nested keys
+	block bool
+
+	// keys are the valid nested keys of a block. A block without keys
+	// accepts any key e.g. http_api_response_headers.
+	keys []string
+}
+
+// minCHAPAccessTokenLen is the min length of the token that releases the
+// CHAP credentials
+const minCHAPAccessTokenLen = 16
+
+// minAdminTokenLen is the min length of the token of the admin scope
+const minAdminTokenLen = 16
+
+// minEC2SecretAccessKeyLen is the min length of the secret access key of the
+// admin scope
+const minEC2SecretAccessKeyLen = 16
+
+// configSchema is the set of keys that are valid in a config file
+var configSchema = map[string]schemaKey{
+	"region":                    {},
+	"datacenter":                {},
+	"name":                      {},
+	"data_dir":                  {},
+	"log_level":                 {},
+	"log_format":                {},
+	"bind_addr":                 {},
+	"enable_debug":              {},
+	"ports":                     {block: true, keys: []string{"http"}},
+	"addresses":                 {block: true, keys: []string{"http"}},
+	"advertise":                 {block: true, keys: []string{"http"}},
+	"leave_on_interrupt":        {},
+	"leave_on_terminate":        {},
+	"enable_syslog":             {},
+	"syslog_facility":           {},
+	"log_file":                  {},
+	"log_rotate_bytes":          {},
+	"log_rotate_duration":       {},
+	"log_rotate_max_age":        {},
+	"log_rotate_max_files":      {},
+	"log_rotate_compress":       {},
+	"drain_timeout":             {},
+	"access_log_file":           {},
+	"access_log_format":         {},
+	"trace_collector_addr":      {},
+	"chap_access_token":         {},
+	"admin_token":               {},
+	"ec2_access_key_id":         {},
+	"ec2_secret_access_key":     {},
+	"audit_key_file":            {},
+	"state_key_file":            {},
+	"instance_id":               {},
+	"availability_zone":         {},
+	"http_api_response_headers": {block: true},
+	"log_levels":                {block: true},
+}
+
+// syslogFacilities are the facilities supported by syslog
+var syslogFacilities = []string{
+	"KERN", "USER", "MAIL", "DAEMON", "AUTH", "SYSLOG", "LPR", "NEWS",
+	"UUCP", "CRON", "AUTHPRIV", "FTP", "LOCAL0", "LOCAL1", "LOCAL2",
+	"LOCAL3", "LOCAL4", "LOCAL5", "LOCAL6", "LOCAL7",
+}
+
+// accessLogFormats are the supported formats of the access log
+var accessLogFormats = []string{"common", "json"}
+
+// ValidationError is an invalid key or value of the config. Pos is the
+// position of the key in the config file. It is not valid if the error is
+// in a value that was not read from a config file e.g. a CLI option.
+type ValidationError struct {
+	Pos token.Pos
+	Key string
+	Msg string
+}
+
+func (e *ValidationError) Error() string {
+	msg := e.Msg
+	if e.Key != "" {
+		msg = e.Key + ": " + msg
+	}
+
+	if e.Pos.IsValid() || e.Pos.Filename != "" {
+		return fmt.Sprintf("%s: %s", e.Pos, msg)
+	}
+	return msg
+}
+
+// ValidationErrors are all the errors found while validating the config
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	points := make([]string, len(e))
+	for i, err := range e {
+		points[i] = fmt.Sprintf("* %s", err)
+	}
+
+	return fmt.Sprintf(
+		"%d error(s) occurred:\n\n%s",
+		len(e), strings.Join(points, "\n"))
+}
+
+// setFilename sets the file name of the positions of the errors
+func (e ValidationErrors) setFilename(path string) {
+	for _, err := range e {
+		err.Pos.Filename = path
+	}
+}
+
+// Validate validates the values of the config e.g. the one obtained after
+// merging the config files & the CLI options.
+func (mc *MayaConfig) Validate() error {
+	var errs ValidationErrors
+	for _, fe := range mc.fieldErrors() {
+		errs = append(errs, &ValidationError{Key: fe.key, Msg: fe.msg})
+	}
+
+	// The access keys are set apart from each other e.g. via several files
+	if (mc.EC2AccessKeyID == "") != (mc.EC2SecretAccessKey == "") {
+		errs = append(errs, &ValidationError{Key: "ec2_access_key_id", Msg: "must be set along with ec2_secret_access_key"})
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// fieldError is an invalid value of a config field. key is the key of the
+// field in the config file e.g. ports.http
+type fieldError struct {
+	key string
+	msg string
+}
+
+// fieldErrors validates the values of the config. Fields that are not set
+// are not validated.
+func (mc *MayaConfig) fieldErrors() []fieldError {
+	var errs []fieldError
+	add := func(key, format string, v ...interface{}) {
+		errs = append(errs, fieldError{key: key, msg: fmt.Sprintf(format, v...)})
+	}
+
+	if mc.LogLevel != "" {
+		filter := loghelper.LevelFilter()
+		if !oneOf(strings.ToUpper(mc.LogLevel), levelNames(filter.Levels)) {
+			add("log_level", "invalid log level %q, valid log levels are: %s",
+				mc.LogLevel, strings.Join(levelNames(filter.Levels), ", "))
+		}
+	}
+
+	for component, level := range mc.LogLevels {
+		if err := loghelper.ValidateLevel(level); err != nil {
+			add("log_levels."+component, "%v", err)
+		}
+	}
+
+	if mc.LogFormat != "" && !oneOf(mc.LogFormat, loghelper.LogFormats) {
+		add("log_format", "invalid format %q, valid formats are: %s",
+			mc.LogFormat, strings.Join(loghelper.LogFormats, ", "))
+	}
+
+	if mc.DataDir != "" && !filepath.IsAbs(mc.DataDir) {
+		add("data_dir", "must be given as an absolute path: got %s", mc.DataDir)
+	}
+
+	if mc.BindAddr != "" {
+		if _, _, err := net.SplitHostPort(mc.BindAddr); err == nil {
+			add("bind_addr", "must not include a port: got %s", mc.BindAddr)
+		}
+	}
+
+	// A port of 0 is the unset value; the merge keeps the default port then.
+	if mc.Ports != nil && (mc.Ports.HTTP < 0 || mc.Ports.HTTP > 65535) {
+		add("ports.http", "invalid port %d, must be between 1 and 65535 or 0 to use the default port", mc.Ports.HTTP)
+	}
+
+	if mc.Addresses != nil && mc.Addresses.HTTP != "" {
+		if _, _, err := net.SplitHostPort(mc.Addresses.HTTP); err == nil {
+			add("addresses.http", "must not include a port: got %s", mc.Addresses.HTTP)
+		}
+	}
+
+	if mc.AdvertiseAddrs != nil && mc.AdvertiseAddrs.HTTP != "" {
+		if _, _, err := net.SplitHostPort(mc.AdvertiseAddrs.HTTP); err != nil && !isMissingPort(err) {
+			add("advertise.http", "invalid address %q: %v", mc.AdvertiseAddrs.HTTP, err)
+		}
+	}
+
+	if mc.SyslogFacility != "" && !oneOf(strings.ToUpper(mc.SyslogFacility), syslogFacilities) {
+		add("syslog_facility", "invalid syslog facility %q, valid facilities are: %s",
+			mc.SyslogFacility, strings.Join(syslogFacilities, ", "))
+	}
+
+	if mc.LogRotateBytes < 0 {
+		add("log_rotate_bytes", "must not be negative: got %d", mc.LogRotateBytes)
+	}
+	if mc.LogRotateDuration < 0 {
+		add("log_rotate_duration", "must not be negative: got %s", mc.LogRotateDuration)
+	}
+	if mc.LogRotateMaxAge < 0 {
+		add("log_rotate_max_age", "must not be negative: got %s", mc.LogRotateMaxAge)
+	}
+	if mc.LogRotateMaxFiles < 0 {
+		add("log_rotate_max_files", "must not be negative: got %d", mc.LogRotateMaxFiles)
+	}
+
+	if mc.DrainTimeout < 0 {
+		add("drain_timeout", "must not be negative: got %s", mc.DrainTimeout)
+	}
+
+	if mc.AccessLogFormat != "" && !oneOf(mc.AccessLogFormat, accessLogFormats) {
+		add("access_log_format", "invalid format %q, valid formats are: %s",
+			mc.AccessLogFormat, strings.Join(accessLogFormats, ", "))
+	}
+
+	if mc.TraceCollectorAddr != "" {
+		u, err := url.Parse(mc.TraceCollectorAddr)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("trace_collector_addr", "must be an http or https URL: got %s", mc.TraceCollectorAddr)
+		}
+	}
+
+	if mc.CHAPAccessToken != "" && len(mc.CHAPAccessToken) < minCHAPAccessTokenLen {
+		add("chap_access_token", "must be at least %d characters", minCHAPAccessTokenLen)
+	}
+
+	if mc.AdminToken != "" && len(mc.AdminToken) < minAdminTokenLen {
+		add("admin_token", "must be at least %d characters", minAdminTokenLen)
+	}
+
+	if mc.EC2SecretAccessKey != "" && len(mc.EC2SecretAccessKey) < minEC2SecretAccessKeyLen {
+		add("ec2_secret_access_key", "must be at least %d characters", minEC2SecretAccessKeyLen)
+	}
+
+	keyFiles := []struct {
+		key, path string
+	}{
+		{"audit_key_file", mc.AuditKeyFile},
+		{"state_key_file", mc.StateKeyFile},
+	}
+	for _, f := range keyFiles {
+		if f.path == "" {
+			continue
+		}
+		if !filepath.IsAbs(f.path) {
+			add(f.key, "must be given as an absolute path: got %s", f.path)
+		} else if mc.DataDir != "" && isWithin(mc.DataDir, f.path) {
+			add(f.key, "must be outside the data directory: got %s", f.path)
+		}
+	}
+
+	return errs
+}
+
+// isWithin verifies if the path is within the directory
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// validateConfig validates the keys & the values of a parsed config file.
+// All the errors are returned along with their positions.
+func validateConfig(list *ast.ObjectList) ValidationErrors {
+	var errs ValidationErrors
+	add := func(pos token.Pos, key, format string, v ...interface{}) {
+		errs = append(errs, &ValidationError{Pos: pos, Key: key, Msg: fmt.Sprintf(format, v...)})
+	}
+
+	seen := map[string]bool{}
+	for _, item := range list.Items {
+		key := itemKey(item)
+		pos := item.Pos()
+
+		if seen[key] {
+			add(pos, key, "duplicate key")
+			continue
+		}
+		seen[key] = true
+
+		sk, ok := configSchema[key]
+		if !ok {
+			add(pos, key, "invalid key")
+			continue
+		}
+
+		if !sk.block {
+			if _, ok := item.Val.(*ast.LiteralType); !ok {
+				add(pos, key, "expected a value, got a %s", nodeKind(item.Val))
+				continue
+			}
+			errs = append(errs, validateValue(pos, key, item.Val, nil)...)
+			continue
+		}
+
+		obj, ok := item.Val.(*ast.ObjectType)
+		if !ok || len(item.Keys) > 1 {
+			add(pos, key, "expected a block")
+			continue
+		}
+
+		nested := map[string]bool{}
+		for _, n := range obj.List.Items {
+			nkey := key + "." + itemKey(n)
+			npos := n.Pos()
+
+			if nested[nkey] {
+				add(npos, nkey, "duplicate key")
+				continue
+			}
+			nested[nkey] = true
+
+			if sk.keys != nil && !oneOf(itemKey(n), sk.keys) {
+				add(npos, nkey, "invalid key")
+				continue
+			}
+
+			if _, ok := n.Val.(*ast.LiteralType); !ok {
+				add(npos, nkey, "expected a value, got a %s", nodeKind(n.Val))
+				continue
+			}
+
+			errs = append(errs, validateValue(npos, nkey, n.Val, []string{key, itemKey(n)})...)
+		}
+	}
+
+	return errs
+}
+
+// validateValue decodes the value of a single key & validates it. path is
+// the path of a nested key within its block.
+func validateValue(pos token.Pos, key string, node ast.Node, path []string) ValidationErrors {
+	var errs ValidationErrors
+
+	var v interface{}
+	if err := hcl.DecodeObject(&v, node); err != nil {
+		return append(errs, &ValidationError{Pos: pos, Key: key, Msg: err.Error()})
+	}
+
+	if path == nil {
+		path = []string{key}
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		v = map[string]interface{}{path[i]: v}
+	}
+
+	var mc MayaConfig
+	if err := weakDecode(v, &mc); err != nil {
+		msgs := []string{err.Error()}
+		if mErr, ok := err.(*mapstructure.Error); ok {
+			msgs = mErr.Errors
+		}
+		for _, msg := range msgs {
+			errs = append(errs, &ValidationError{Pos: pos, Key: key, Msg: msg})
+		}
+		return errs
+	}
+
+	for _, fe := range mc.fieldErrors() {
+		errs = append(errs, &ValidationError{Pos: pos, Key: fe.key, Msg: fe.msg})
+	}
+	return errs
+}
+
+// itemKey returns the key of the item
+func itemKey(item *ast.ObjectItem) string {
+	return item.Keys[0].Token.Value().(string)
+}
+
+// nodeKind describes the kind of the value in error messages
+func nodeKind(node ast.Node) string {
+	switch node.(type) {
+	case *ast.ObjectType:
+		return "block"
+	case *ast.ListType:
+		return "list"
+	default:
+		return "value"
+	}
+}
+
+// levelNames returns the names of the log levels
+func levelNames(levels []logutils.LogLevel) []string {
+	names := make([]string, len(levels))
+	for i, l := range levels {
+		names[i] = string(l)
+	}
+	return names
+}
+
+func oneOf(s string, valid []string) bool {
+	for _, v := range valid {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,223 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMayaConfig_Validation(t *testing.T) {
+	input := `region = "BANG-EAST"
+interfaces {
+	http = "eth0"
+}
+log_level = "CHATTY"
+ports {
+	http = 70000
+	rpc = 4647
+}
+enable_debug = "maybe"
+region = "dc3"
+syslog_facility = "LOCAL9"
+drain_timeout = "-5s"
+log_format = "xml"
+log_rotate_max_files = -1
+log_levels {
+	orchprovider.k8s = "CHATTY"
+}
+chap_access_token = "short"
+admin_token = "short"
+ec2_access_key_id = "AKIDEXAMPLE"
+ec2_secret_access_key = "short"
+audit_key_file = "audit.key"
+state_key_file = "state.key"
+`
+
+	_, err := ParseMayaConfig(strings.NewReader(input))
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("expected validation errors, got: %v", err)
+	}
+
+	expected := []struct {
+		line int
+		key  string
+	}{
+		{2, "interfaces"},
+		{5, "log_level"},
+		{7, "ports.http"},
+		{8, "ports.rpc"},
+		{10, "enable_debug"},
+		{11, "region"},
+		{12, "syslog_facility"},
+		{13, "drain_timeout"},
+		{14, "log_format"},
+		{15, "log_rotate_max_files"},
+		{17, "log_levels.orchprovider.k8s"},
+		{19, "chap_access_token"},
+		{20, "admin_token"},
+		{22, "ec2_secret_access_key"},
+		{23, "audit_key_file"},
+		{24, "state_key_file"},
+	}
+
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got: %v", len(expected), errs)
+	}
+
+	for i, e := range expected {
+		if errs[i].Pos.Line != e.line || errs[i].Key != e.key {
+			t.Fatalf("error %d: expected %s at line %d, got: %v", i, e.key, e.line, errs[i])
+		}
+	}
+}
+
+func TestParseMayaConfig_SyntaxError(t *testing.T) {
+	_, err := ParseMayaConfig(strings.NewReader("region = \"BANG-EAST\"\nlog_level = = \"INFO\"\n"))
+	errs, ok := err.(ValidationErrors)
+	if !ok || len(errs) != 1 || errs[0].Pos.Line != 2 {
+		t.Fatalf("expected a positioned syntax error, got: %v", err)
+	}
+}
+
+func TestLoadMayaConfigDir_Validation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mayaserver")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"a.hcl":  `log_level = "CHATTY"`,
+		"b.json": `{"ports": {"http": -1}}`,
+		"c.hcl":  `region = "BANG-EAST"`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	_, err = LoadMayaConfig(dir)
+	errs, ok := err.(ValidationErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expected errors of both the invalid files, got: %v", err)
+	}
+
+	if errs[0].Pos.Filename != filepath.Join(dir, "a.hcl") || errs[1].Pos.Filename != filepath.Join(dir, "b.json") {
+		t.Fatalf("expected file names in the errors, got: %v", errs)
+	}
+}
+
+func TestMayaConfig_Validate(t *testing.T) {
+	mc := DefaultMayaConfig()
+	if err := mc.Validate(); err != nil {
+		t.Fatalf("expected the default config to be valid, got: %v", err)
+	}
+
+	mc.DataDir = "tmp/mayaserver"
+	mc.AccessLogFormat = "xml"
+	mc.TraceCollectorAddr = "127.0.0.1:4318"
+
+	errs, ok := mc.Validate().(ValidationErrors)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("expected 3 errors, got: %v", errs)
+	}
+
+	for i, key := range []string{"data_dir", "access_log_format", "trace_collector_addr"} {
+		if errs[i].Key != key || errs[i].Pos.IsValid() {
+			t.Fatalf("expected unpositioned error of %s, got: %v", key, errs[i])
+		}
+	}
+
+	// The audit key is kept apart from the audit log
+	mc = DefaultMayaConfig()
+	mc.DataDir = "/var/lib/mayaserver"
+	mc.AuditKeyFile = "/var/lib/mayaserver/keys/audit.key"
+
+	errs, ok = mc.Validate().(ValidationErrors)
+	if !ok || len(errs) != 1 || errs[0].Key != "audit_key_file" {
+		t.Fatalf("expected an error of audit_key_file, got: %v", errs)
+	}
+
+	mc.AuditKeyFile = "/etc/mayaserver/audit.key"
+	if err := mc.Validate(); err != nil {
+		t.Fatalf("expected the audit key file to be valid, got: %v", err)
+	}
+
+	// So is the key of the secrets of the state
+	mc.StateKeyFile = "/var/lib/mayaserver/state.key"
+
+	errs, ok = mc.Validate().(ValidationErrors)
+	if !ok || len(errs) != 1 || errs[0].Key != "state_key_file" {
+		t.Fatalf("expected an error of state_key_file, got: %v", errs)
+	}
+
+	mc.StateKeyFile = "/etc/mayaserver/state.key"
+	if err := mc.Validate(); err != nil {
+		t.Fatalf("expected the state key file to be valid, got: %v", err)
+	}
+
+	// The EC2 access keys are set together
+	mc.EC2AccessKeyID = "AKIDEXAMPLE"
+
+	errs, ok = mc.Validate().(ValidationErrors)
+	if !ok || len(errs) != 1 || errs[0].Key != "ec2_access_key_id" {
+		t.Fatalf("expected an error of ec2_access_key_id, got: %v", errs)
+	}
+
+	mc.EC2SecretAccessKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	if err := mc.Validate(); err != nil {
+		t.Fatalf("expected the EC2 access keys to be valid, got: %v", err)
+	}
+}
+
+func TestIsWithin(t *testing.T) {
+	cases := []struct {
+		dir, path string
+		within    bool
+	}{
+		{"/var/lib/mayaserver", "/var/lib/mayaserver/audit.key", true},
+		{"/var/lib/mayaserver", "/var/lib/mayaserver/../mayaserver/audit.key", true},
+		{"/var/lib/mayaserver", "/var/lib/mayaserver-keys/audit.key", false},
+		{"/var/lib/mayaserver", "/etc/mayaserver/audit.key", false},
+	}
+
+	for _, tc := range cases {
+		if within := isWithin(tc.dir, tc.path); within != tc.within {
+			t.Fatalf("%s in %s: expected %v, got: %v", tc.path, tc.dir, tc.within, within)
+		}
+	}
+}
+
+func TestMayaConfig_Encode(t *testing.T) {
+	path, err := filepath.Abs(filepath.Join("../mockit", "dummy_mayaserver_config.hcl"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected, err := ParseMayaConfigFile(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	encoded, err := expected.EncodeJSON()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for format, out := range map[string][]byte{"hcl": expected.EncodeHCL(), "json": encoded} {
+		actual, err := ParseMayaConfig(bytes.NewReader(out))
+		if err != nil {
+			t.Fatalf("%s: err: %s\n\n%s", format, err, out)
+		}
+
+		if !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("%s: expected: %#v\n\nactual: %#v\n\n%s", format, expected, actual, out)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package loghelper
+
+import (
+	"bufio"
+	"flag"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// GlogComponent is the component of the glog lines whose source file does
+// not belong to any known component
+const GlogComponent = "glog"
+
+// glogComponents maps the source files of the vendored libraries that log
+// via glog to their components. glog reports just the name of the source
+// file.
+var glogComponents = map[string]string{
+	"k8s.go":        "orchprovider.k8s",
+	"nomad_plug.go": "orchprovider.nomad",
+	"jiva.go":       "provisioner.jiva",
+}
+
+// glogLevels maps the severities of glog to the log levels that we use
+var glogLevels = map[string]string{
+	"I": "INFO",
+	"W": "WARN",
+	"E": "ERR",
+	"F": "ERR",
+}
+
+// glogLine matches a line logged by glog i.e.
+// Lmmdd hh:mm:ss.uuuuuu threadid file:line] msg
+var glogLine = regexp.MustCompile(`^([IWEF])\d{4} \d{2}:\d{2}:\d{2}\.\d{6}\s+\d+ ([^:\]]+):\d+\] (.*)$`)
+
+// parseGlogLine converts a glog line to a [LEVEL] component: message line.
+// It returns false if the line is not a glog line.
+func parseGlogLine(line string) (string, bool) {
+	m := glogLine.FindStringSubmatch(line)
+	if m == nil {
+		return "", false
+	}
+
+	component, ok := glogComponents[m[2]]
+	if !ok {
+		component = GlogComponent
+	}
+
+	return "[" + glogLevels[m[1]] + "] " + component + ": " + m[3], true
+}
+
+// glogMaxSize is the size at which glog rotates its log files. It bounds the
+// disk used by the files from which the glog lines are routed.
+const glogMaxSize = 16 * 1024 * 1024
+
+// glogRouteInterval is the interval at which the glog lines are flushed &
+// routed
+const glogRouteInterval = time.Second
+
+// glogTail reads the lines of the INFO log file of glog. The INFO file has
+// the lines of every severity. The file is followed across its rotations.
+type glogTail struct {
+	l sync.Mutex
+
+	dir    string
+	link   string
+	logger *log.Logger
+
+	file    *os.File
+	name    string
+	reader  *bufio.Reader
+	partial string
+}
+
+// glogRoute is the tail of the log files of glog. glog picks its log_dir on
+// its first log & retains its files thereafter. Hence the log_dir & the tail
+// are shared by every route of the process.
+var glogRoute struct {
+	once sync.Once
+	tail *glogTail
+	err  error
+}
+
+// route flushes glog & writes the lines that glog logged since the last call
+// to the logger
+func (t *glogTail) route() {
+	glog.Flush()
+
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	name, err := os.Readlink(t.link)
+	if err != nil && t.file == nil {
+		// glog has not logged yet
+		return
+	}
+	if err != nil {
+		// The log_dir was removed by a restore. glog keeps writing to its
+		// current file till it rotates this into the log_dir.
+		name = t.name
+	}
+
+	if name != t.name {
+		// glog rotated its file. The remaining lines of the previous file
+		// are read before following the new one.
+		if t.file != nil {
+			t.read()
+			t.file.Close()
+		}
+
+		f, err := os.Open(filepath.Join(t.dir, name))
+		if err != nil {
+			return
+		}
+		t.file, t.name, t.reader = f, name, bufio.NewReader(f)
+	}
+
+	t.read()
+	t.prune()
+}
+
+// read writes the complete lines of the current file to the logger. A line
+// that is not complete yet is retained till its rest is written by glog.
+func (t *glogTail) read() {
+	for {
+		text, err := t.reader.ReadString('\n')
+		if err != nil {
+			t.partial += text
+			return
+		}
+
+		text = strings.TrimRight(t.partial+text, "\n")
+		t.partial = ""
+		if line, ok := parseGlogLine(text); ok {
+			t.logger.Println(line)
+		} else {
+			// e.g. the continuation of a multi line message
+			t.logger.Println(text)
+		}
+	}
+}
+
+// removeDir removes the log_dir. The current file is kept open as glog
+// keeps writing to it if glog is routed again.
+func (t *glogTail) removeDir() {
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	os.RemoveAll(t.dir)
+}
+
+// setLogger sets the logger to which the lines are written
+func (t *glogTail) setLogger(logger *log.Logger) {
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	t.logger = logger
+}
+
+// prune removes the files of glog other than the current INFO file. The
+// files of the other severities have a copy of the lines of the INFO file.
+func (t *glogTail) prune() {
+	entries, err := ioutil.ReadDir(t.dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if !e.Mode().IsRegular() || e.Name() == t.name {
+			continue
+		}
+		os.Remove(filepath.Join(t.dir, e.Name()))
+	}
+}
+
+// RouteGlog routes the logs of glog to the given writer so that these are
+// leveled & filtered like the other logs. glog writes its logs to the files
+// of a private log_dir. These are flushed, converted & written to the writer
+// periodically. Only the fatal logs are written to stderr by glog as the
+// process exits after these.
+//
+// The returned func routes the pending lines, lets glog log to stderr again
+// & removes the log_dir. A later route creates the log_dir again as glog
+// retains its log_dir.
+func RouteGlog(w io.Writer) (func(), error) {
+	glogRoute.once.Do(func() {
+		dir, err := ioutil.TempDir("", "mapi-glog")
+		if err != nil {
+			glogRoute.err = err
+			return
+		}
+		glogRoute.tail = &glogTail{
+			dir:  dir,
+			link: filepath.Join(dir, filepath.Base(os.Args[0])+".INFO"),
+		}
+	})
+	if glogRoute.err != nil {
+		return nil, glogRoute.err
+	}
+	t := glogRoute.tail
+
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return nil, err
+	}
+
+	for name, value := range map[string]string{
+		"logtostderr":     "false",
+		"alsologtostderr": "false",
+		"stderrthreshold": "FATAL",
+		"log_dir":         t.dir,
+	} {
+		if err := flag.Set(name, value); err != nil {
+			return nil, err
+		}
+	}
+	glog.MaxSize = glogMaxSize
+
+	// glog logs to its files only after the command line flags are parsed
+	if !flag.Parsed() {
+		flag.CommandLine.Parse([]string{})
+	}
+
+	t.setLogger(log.New(w, "", log.LstdFlags|log.Lmicroseconds))
+
+	stopCh := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(glogRouteInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.route()
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	restore := func() {
+		close(stopCh)
+		wg.Wait()
+
+		t.route()
+		flag.Set("logtostderr", "true")
+
+		t.removeDir()
+	}
+	return restore, nil
+}
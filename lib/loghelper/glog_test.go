@@ -0,0 +1,71 @@
+package loghelper
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/golang/glog"
+)
+
+func TestParseGlogLine(t *testing.T) {
+	cases := []struct {
+		in       string
+		expected string
+		ok       bool
+	}{
+		{"I0102 15:04:05.000001    1234 k8s.go:42] Listing pods", "[INFO] orchprovider.k8s: Listing pods", true},
+		{"W0102 15:04:05.000001 1234 nomad_plug.go:7] Job failed", "[WARN] orchprovider.nomad: Job failed", true},
+		{"E0102 15:04:05.000001 1234 client.go:7] Request failed", "[ERR] glog: Request failed", true},
+		{"[INFO] http: Request /v1/health/live", "", false},
+		{"panic: boom", "", false},
+	}
+
+	for _, tc := range cases {
+		out, ok := parseGlogLine(tc.in)
+		if ok != tc.ok || out != tc.expected {
+			t.Fatalf("%q: expected %q %v, got: %q %v", tc.in, tc.expected, tc.ok, out, ok)
+		}
+	}
+}
+
+func TestRouteGlog(t *testing.T) {
+	stderr := os.Stderr
+	buf := new(bytes.Buffer)
+	restore, err := RouteGlog(buf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// stderr is left as is for the other writers
+	if os.Stderr != stderr {
+		t.Fatalf("expected stderr not to be replaced")
+	}
+
+	glog.Warningf("Routed")
+	restore()
+
+	out := buf.String()
+	if !strings.Contains(out, "[WARN] glog: Routed\n") {
+		t.Fatalf("expected the glog line to be routed, got: %q", out)
+	}
+
+	// The log_dir is not left behind
+	if _, err := os.Stat(glogRoute.tail.dir); !os.IsNotExist(err) {
+		t.Fatalf("expected the glog log dir to be removed, got: %v", err)
+	}
+
+	// glog can be routed again
+	buf.Reset()
+	restore, err = RouteGlog(buf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	glog.Warningf("Routed again")
+	restore()
+
+	if out := buf.String(); !strings.Contains(out, "[WARN] glog: Routed again\n") {
+		t.Fatalf("expected the glog line to be routed again, got: %q", out)
+	}
+}
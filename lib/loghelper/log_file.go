@@ -0,0 +1,345 @@
+package loghelper
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeLayout is the layout of the timestamp in the name of a rotated
+// log file e.g. mapiserver-2017-01-02T15-04-05.000.log
+const backupTimeLayout = "2006-01-02T15-04-05.000"
+
+// compressSuffix is the suffix of the gzipped rotated log files
+const compressSuffix = ".gz"
+
+// LogFile is used to write the logs to a file. The file is rotated once it
+// exceeds MaxBytes or once it is older than Duration. The rotated files are
+// optionally gzipped & are removed as per MaxFiles & MaxAge.
+//
+// JSON log lines are written without their level prefix similar to stdout.
+//
+// LogFile implements:
+//  1. io.Writer interface
+type LogFile struct {
+	// Path is the path of the log file
+	Path string
+
+	// LFilter if set is used to skip the logs of the filtered levels
+	LFilter LineFilter
+
+	// MaxBytes is the size after which the file is rotated. The file is not
+	// rotated by size if this is 0.
+	MaxBytes int64
+
+	// Duration is the duration after which the file is rotated. The file is
+	// not rotated by time if this is 0.
+	Duration time.Duration
+
+	// MaxAge is the age after which the rotated files are removed. The
+	// rotated files are not removed by age if this is 0.
+	MaxAge time.Duration
+
+	// MaxFiles is the no. of rotated files to keep. Every rotated file is
+	// kept if this is 0.
+	MaxFiles int
+
+	// Compress is used to gzip the rotated files
+	Compress bool
+
+	l       sync.Mutex
+	file    *os.File
+	size    int64
+	created time.Time
+
+	// mill serializes the compression & removal of the rotated files
+	mill sync.Mutex
+	wg   sync.WaitGroup
+
+	// now is used to tell the time. It is time.Now if not set.
+	now func() time.Time
+}
+
+// Open opens the log file for appending. It is opened on the first write if
+// not opened explicitly.
+func (w *LogFile) Open() error {
+	w.l.Lock()
+	defer w.l.Unlock()
+
+	return w.open()
+}
+
+// Reopen closes & opens the log file again. It lets an external tool e.g.
+// logrotate move the log file away.
+func (w *LogFile) Reopen() error {
+	w.l.Lock()
+	defer w.l.Unlock()
+
+	if err := w.close(); err != nil {
+		return err
+	}
+	return w.open()
+}
+
+// Close closes the log file & waits for the rotated files to be compressed
+func (w *LogFile) Close() error {
+	w.l.Lock()
+	err := w.close()
+	w.l.Unlock()
+
+	w.wg.Wait()
+	return err
+}
+
+// Write is used to implement io.Writer
+func (w *LogFile) Write(p []byte) (int, error) {
+	if w.LFilter != nil && !w.LFilter.Check(p) {
+		return len(p), nil
+	}
+
+	line := TrimJSONLevel(p)
+
+	w.l.Lock()
+	defer w.l.Unlock()
+
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if w.shouldRotate(len(line)) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// shouldRotate verifies if the file is to be rotated before writing the
+// given no. of bytes. A file that is empty is never rotated.
+func (w *LogFile) shouldRotate(n int) bool {
+	if w.size == 0 {
+		return false
+	}
+	if w.MaxBytes > 0 && w.size+int64(n) > w.MaxBytes {
+		return true
+	}
+	return w.Duration > 0 && w.timeNow().Sub(w.created) >= w.Duration
+}
+
+// open opens the log file for appending. The creation time of an existing
+// file is approximated by its modification time.
+func (w *LogFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create the log directory: %v", err)
+	}
+
+	f, err := os.OpenFile(w.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open the log file: %v", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat the log file: %v", err)
+	}
+
+	w.file = f
+	w.size = info.Size()
+	w.created = w.timeNow()
+	if w.size > 0 {
+		w.created = info.ModTime()
+	}
+
+	return nil
+}
+
+// close closes the log file if it is open
+func (w *LogFile) close() error {
+	if w.file == nil {
+		return nil
+	}
+
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// rotate moves the log file to a backup file & opens a new log file. The
+// backup files are compressed & removed in the background.
+func (w *LogFile) rotate() error {
+	if err := w.close(); err != nil {
+		return err
+	}
+
+	backup := w.backupName(w.timeNow())
+	if err := os.Rename(w.Path, backup); err != nil {
+		return fmt.Errorf("failed to rotate the log file: %v", err)
+	}
+
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.millBackups(backup)
+	}()
+
+	return nil
+}
+
+// backupName returns the name of the file to which the log file is moved
+// on rotation
+func (w *LogFile) backupName(t time.Time) string {
+	dir, prefix, ext := w.nameParts()
+	return filepath.Join(dir, prefix+t.UTC().Format(backupTimeLayout)+ext)
+}
+
+// nameParts returns the directory of the log file along with the prefix &
+// extension of its backup files
+func (w *LogFile) nameParts() (dir, prefix, ext string) {
+	dir = filepath.Dir(w.Path)
+	name := filepath.Base(w.Path)
+	ext = filepath.Ext(name)
+	prefix = strings.TrimSuffix(name, ext) + "-"
+	return
+}
+
+// logBackup is a rotated log file
+type logBackup struct {
+	path string
+	time time.Time
+}
+
+// logBackupsByTime sorts the backups from the newest to the oldest
+type logBackupsByTime []logBackup
+
+func (b logBackupsByTime) Len() int           { return len(b) }
+func (b logBackupsByTime) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b logBackupsByTime) Less(i, j int) bool { return b[i].time.After(b[j].time) }
+
+// backups returns the rotated log files from the newest to the oldest
+func (w *LogFile) backups() ([]logBackup, error) {
+	dir, prefix, ext := w.nameParts()
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []logBackup
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		ts := strings.TrimPrefix(name, prefix)
+		ts = strings.TrimSuffix(ts, compressSuffix)
+		if !strings.HasSuffix(ts, ext) {
+			continue
+		}
+
+		t, err := time.Parse(backupTimeLayout, strings.TrimSuffix(ts, ext))
+		if err != nil {
+			continue
+		}
+
+		backups = append(backups, logBackup{path: filepath.Join(dir, name), time: t})
+	}
+
+	sort.Sort(logBackupsByTime(backups))
+	return backups, nil
+}
+
+// millBackups compresses the given backup file & removes the backup files
+// that are in excess or are too old. Errors are reported to stderr as the
+// logs can not be relied upon.
+func (w *LogFile) millBackups(backup string) {
+	w.mill.Lock()
+	defer w.mill.Unlock()
+
+	if w.Compress {
+		if err := compressFile(backup); err != nil {
+			fmt.Fprintf(os.Stderr, "[ERR] log file: Failed to compress '%s': %v\n", backup, err)
+		}
+	}
+
+	if w.MaxFiles == 0 && w.MaxAge == 0 {
+		return
+	}
+
+	backups, err := w.backups()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[ERR] log file: Failed to list the rotated log files: %v\n", err)
+		return
+	}
+
+	cutoff := w.timeNow().Add(-w.MaxAge)
+	for i, b := range backups {
+		if (w.MaxFiles > 0 && i >= w.MaxFiles) || (w.MaxAge > 0 && b.time.Before(cutoff)) {
+			if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+				fmt.Fprintf(os.Stderr, "[ERR] log file: Failed to remove '%s': %v\n", b.path, err)
+			}
+		}
+	}
+}
+
+// compressFile gzips the file & removes the original file
+func compressFile(path string) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+compressSuffix, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			dst.Close()
+			os.Remove(path + compressSuffix)
+		}
+	}()
+
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err != nil {
+		return err
+	}
+	if err = gz.Close(); err != nil {
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// timeNow returns the current time
+func (w *LogFile) timeNow() time.Time {
+	if w.now != nil {
+		return w.now()
+	}
+	return time.Now()
+}
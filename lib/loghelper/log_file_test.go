@@ -0,0 +1,193 @@
+package loghelper
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/logutils"
+)
+
+func tmpLogDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "loghelper")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return dir
+}
+
+func readFile(t *testing.T, path string) string {
+	out, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return string(out)
+}
+
+func TestLogFile_RotateBySize(t *testing.T) {
+	dir := tmpLogDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "mapiserver.log")
+	now := time.Date(2017, 1, 2, 15, 4, 5, 0, time.UTC)
+	w := &LogFile{Path: path, MaxBytes: 10, now: func() time.Time { return now }}
+
+	w.Write([]byte("[INFO] one\n"))
+	now = now.Add(time.Second)
+	w.Write([]byte("[INFO] two\n"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if out := readFile(t, path); out != "[INFO] two\n" {
+		t.Fatalf("bad log file: %q", out)
+	}
+
+	backup := filepath.Join(dir, "mapiserver-2017-01-02T15-04-06.000.log")
+	if out := readFile(t, backup); out != "[INFO] one\n" {
+		t.Fatalf("bad rotated file: %q", out)
+	}
+}
+
+func TestLogFile_RotateByTime(t *testing.T) {
+	dir := tmpLogDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "mapiserver.log")
+	now := time.Date(2017, 1, 2, 15, 4, 5, 0, time.UTC)
+	w := &LogFile{Path: path, Duration: time.Hour, now: func() time.Time { return now }}
+
+	w.Write([]byte("[INFO] one\n"))
+	now = now.Add(30 * time.Minute)
+	w.Write([]byte("[INFO] two\n"))
+	now = now.Add(30 * time.Minute)
+	w.Write([]byte("[INFO] three\n"))
+	w.Close()
+
+	if out := readFile(t, path); out != "[INFO] three\n" {
+		t.Fatalf("bad log file: %q", out)
+	}
+
+	backups, err := w.backups()
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("expected 1 rotated file, got: %v %v", backups, err)
+	}
+	if out := readFile(t, backups[0].path); out != "[INFO] one\n[INFO] two\n" {
+		t.Fatalf("bad rotated file: %q", out)
+	}
+}
+
+func TestLogFile_CompressAndPrune(t *testing.T) {
+	dir := tmpLogDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "mapiserver.log")
+	now := time.Date(2017, 1, 2, 15, 4, 5, 0, time.UTC)
+	w := &LogFile{
+		Path:     path,
+		MaxBytes: 1,
+		MaxFiles: 2,
+		MaxAge:   time.Hour,
+		Compress: true,
+		now:      func() time.Time { return now },
+	}
+
+	// A rotated file of some other log file is left alone
+	other := filepath.Join(dir, "access-2017-01-01T00-00-00.000.log")
+	ioutil.WriteFile(other, []byte("other"), 0644)
+
+	for i := 0; i < 5; i++ {
+		w.Write([]byte("[INFO] line\n"))
+		w.wg.Wait()
+		now = now.Add(time.Minute)
+	}
+
+	// The oldest files beyond max files are removed
+	backups, err := w.backups()
+	if err != nil || len(backups) != 2 {
+		t.Fatalf("expected 2 rotated files, got: %v %v", backups, err)
+	}
+
+	f, err := os.Open(backups[0].path)
+	if err != nil || !strings.HasSuffix(backups[0].path, ".log.gz") {
+		t.Fatalf("expected a gzipped file, got: %s %v", backups[0].path, err)
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out, _ := ioutil.ReadAll(gz); string(out) != "[INFO] line\n" {
+		t.Fatalf("bad rotated file: %q", out)
+	}
+	f.Close()
+
+	// The files older than max age are removed
+	now = now.Add(2 * time.Hour)
+	w.Write([]byte("[INFO] line\n"))
+	w.Close()
+
+	backups, err = w.backups()
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("expected 1 rotated file, got: %v %v", backups, err)
+	}
+
+	if _, err := os.Stat(other); err != nil {
+		t.Fatalf("expected other files to be left alone: %v", err)
+	}
+}
+
+func TestLogFile_Reopen(t *testing.T) {
+	dir := tmpLogDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "mapiserver.log")
+	w := &LogFile{Path: path}
+	defer w.Close()
+
+	w.Write([]byte("[INFO] one\n"))
+
+	// An external tool moves the log file away
+	moved := path + ".1"
+	if err := os.Rename(path, moved); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if err := w.Reopen(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	w.Write([]byte("[INFO] two\n"))
+
+	if out := readFile(t, moved); out != "[INFO] one\n" {
+		t.Fatalf("bad moved file: %q", out)
+	}
+	if out := readFile(t, path); out != "[INFO] two\n" {
+		t.Fatalf("bad log file: %q", out)
+	}
+}
+
+func TestLogFile_Filter(t *testing.T) {
+	dir := tmpLogDir(t)
+	defer os.RemoveAll(dir)
+
+	filter := LevelFilter()
+	filter.MinLevel = logutils.LogLevel("INFO")
+
+	path := filepath.Join(dir, "mapiserver.log")
+	w := &LogFile{Path: path, LFilter: filter}
+
+	for _, line := range []string{"[DEBUG] skipped\n", "[INFO] {\"message\":\"kept\"}\n"} {
+		if n, err := w.Write([]byte(line)); err != nil || n != len(line) {
+			t.Fatalf("bad write: %d %v", n, err)
+		}
+	}
+	w.Close()
+
+	// JSON lines are written without their level prefix
+	if out := readFile(t, path); out != "{\"message\":\"kept\"}\n" {
+		t.Fatalf("bad log file: %q", out)
+	}
+}
@@ -0,0 +1,343 @@
+package loghelper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// LogFormatText formats the logs as [LEVEL] component: message lines
+	// followed by the fields as key=value pairs
+	LogFormatText = "text"
+
+	// LogFormatJSON formats the logs as JSON objects of timestamp, level,
+	// component, message & the fields
+	LogFormatJSON = "json"
+)
+
+// LogFormats are the supported formats of the logs
+var LogFormats = []string{LogFormatText, LogFormatJSON}
+
+// stdTimeLayouts are the layouts of the timestamps prefixed by the loggers of
+// the log package with & without microseconds
+var stdTimeLayouts = []string{"2006/01/02 15:04:05.000000", "2006/01/02 15:04:05"}
+
+// defaultLevel is the level of the log lines that do not have any
+const defaultLevel = "INFO"
+
+// Field is a key & value that is logged along with a log message
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Entry is a structured log entry
+type Entry struct {
+	Time      time.Time
+	Level     string
+	Component string
+	Message   string
+	Fields    []Field
+}
+
+// EntryWriter is implemented by the log outputs that encode the log entries
+// themselves. Logger hands its entries as is to such outputs rather than
+// formatting them as text.
+type EntryWriter interface {
+	WriteEntry(e *Entry) error
+}
+
+// Logger logs messages along with fields such as the volume or request id.
+// Messages are formatted the same way as the other logs of maya api server
+// i.e. [LEVEL] component: message. Hence these flow through the level
+// filter, the log registrar & syslog just like the other logs.
+type Logger struct {
+	out    io.Writer
+	std    *log.Logger
+	fields []Field
+}
+
+// NewLogger returns a logger that logs to the given output
+func NewLogger(out io.Writer) *Logger {
+	return &Logger{
+		out: out,
+		std: log.New(out, "", log.LstdFlags|log.Lmicroseconds),
+	}
+}
+
+// With returns a logger that logs the given key value pairs along with the
+// fields of this logger
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]Field, 0, len(l.fields)+len(kv)/2)
+	fields = append(fields, l.fields...)
+
+	for i := 0; i+1 < len(kv); i += 2 {
+		fields = append(fields, Field{Key: fmt.Sprint(kv[i]), Value: kv[i+1]})
+	}
+
+	return &Logger{
+		out:    l.out,
+		std:    l.std,
+		fields: fields,
+	}
+}
+
+// Printf logs similar to log.Printf. The level & the component if any are
+// expected at the start of the format e.g. [DEBUG] http: ...
+func (l *Logger) Printf(format string, v ...interface{}) {
+	e := parseMessage(fmt.Sprintf(format, v...))
+	e.Time = time.Now()
+	e.Fields = l.fields
+
+	if ew, ok := l.out.(EntryWriter); ok {
+		ew.WriteEntry(e)
+		return
+	}
+
+	l.std.Output(2, e.text())
+}
+
+// text formats the entry as a text log line without the timestamp
+func (e *Entry) text() string {
+	var buf bytes.Buffer
+
+	if e.Level != "" {
+		fmt.Fprintf(&buf, "[%s] ", e.Level)
+	}
+	if e.Component != "" {
+		fmt.Fprintf(&buf, "%s: ", e.Component)
+	}
+	buf.WriteString(e.Message)
+
+	for _, f := range e.Fields {
+		fmt.Fprintf(&buf, " %s=%s", f.Key, textValue(f.Value))
+	}
+
+	return buf.String()
+}
+
+// textValue formats the value of a field. It is quoted if it has spaces or
+// quotes so that the fields can be told apart.
+func textValue(v interface{}) string {
+	s := fmt.Sprint(v)
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// jsonLine formats the entry as a JSON object prefixed with the level i.e.
+// [LEVEL] {...}. The prefix lets the level filter & syslog treat this line
+// similar to the text lines. The prefix is removed by TrimJSONLevel.
+func (e *Entry) jsonLine() []byte {
+	var buf bytes.Buffer
+
+	level := e.Level
+	if level == "" {
+		level = defaultLevel
+	}
+
+	fmt.Fprintf(&buf, "[%s] {", level)
+
+	// Values that can not be encoded as JSON are logged as their text
+	write := func(key string, value interface{}) {
+		k, _ := json.Marshal(key)
+		v, err := json.Marshal(value)
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(value))
+		}
+		if buf.Bytes()[buf.Len()-1] != '{' {
+			buf.WriteByte(',')
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+
+	write("timestamp", e.Time.UTC().Format(time.RFC3339Nano))
+	write("level", level)
+	if e.Component != "" {
+		write("component", e.Component)
+	}
+	write("message", e.Message)
+
+	for _, f := range e.Fields {
+		write(f.Key, fieldValue(f.Value))
+	}
+
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+// fieldValue returns the value of a field as it should be encoded as JSON.
+// Errors & stringers are logged as their text.
+func fieldValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case error:
+		return t.Error()
+	case fmt.Stringer:
+		return t.String()
+	default:
+		return v
+	}
+}
+
+// JSONWriter formats the logs as JSON. The log entries of Logger are
+// formatted along with their fields, while the text log lines written by
+// the other loggers are parsed into the level, component & message.
+//
+// JSONWriter implements:
+//  1. io.Writer interface
+//  2. EntryWriter interface
+type JSONWriter struct {
+	Writer io.Writer
+
+	l sync.Mutex
+}
+
+// Write is used to format a text log line as JSON
+func (w *JSONWriter) Write(p []byte) (int, error) {
+	if err := w.WriteEntry(parseLine(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteEntry is used to format a log entry as JSON
+func (w *JSONWriter) WriteEntry(e *Entry) error {
+	line := e.jsonLine()
+
+	w.l.Lock()
+	defer w.l.Unlock()
+
+	_, err := w.Writer.Write(line)
+	return err
+}
+
+// parseLine parses a text log line written by a logger of the log package
+// i.e. a line with an optional timestamp followed by the message
+func parseLine(p []byte) *Entry {
+	line := strings.TrimRight(string(p), "\n")
+
+	t := time.Now()
+	for _, layout := range stdTimeLayouts {
+		if len(line) <= len(layout) || line[len(layout)] != ' ' {
+			continue
+		}
+		if ts, err := time.ParseInLocation(layout, line[:len(layout)], time.Local); err == nil {
+			t = ts
+			line = line[len(layout)+1:]
+			break
+		}
+	}
+
+	e := parseMessage(line)
+	e.Time = t
+	return e
+}
+
+// parseMessage splits a message into its level, component & the message
+// e.g. [DEBUG] http: Request /v1/health/live
+func parseMessage(msg string) *Entry {
+	e := &Entry{}
+
+	if strings.HasPrefix(msg, "[") {
+		if y := strings.IndexByte(msg, ']'); y > 0 {
+			e.Level = msg[1:y]
+			msg = strings.TrimPrefix(msg[y+1:], " ")
+		}
+	}
+
+	if x := strings.Index(msg, ": "); x > 0 && isComponent(msg[:x]) {
+		e.Component = msg[:x]
+		msg = msg[x+2:]
+	}
+
+	e.Message = msg
+	return e
+}
+
+// LineComponent returns the component of a text or a JSON log line e.g. http
+// in [DEBUG] http: Request /v1/health/live. It is empty if the line does not
+// have a component.
+func LineComponent(p []byte) string {
+	x := bytes.IndexByte(p, '[')
+	if x < 0 {
+		return ""
+	}
+	y := bytes.IndexByte(p[x:], ']')
+	if y < 0 {
+		return ""
+	}
+	rest := bytes.TrimPrefix(p[x+y+1:], []byte(" "))
+
+	// The component of a JSON line follows its timestamp & level
+	if len(rest) > 0 && rest[0] == '{' {
+		key := []byte(`"component":"`)
+		i := bytes.Index(rest, key)
+		if i < 0 {
+			return ""
+		}
+		rest = rest[i+len(key):]
+		j := bytes.IndexByte(rest, '"')
+		if j < 0 {
+			return ""
+		}
+		return string(rest[:j])
+	}
+
+	i := bytes.Index(rest, []byte(": "))
+	if i <= 0 || !isComponent(string(rest[:i])) {
+		return ""
+	}
+	return string(rest[:i])
+}
+
+// isComponent verifies if the text can be the name of a component e.g.
+// http or maya api server
+func isComponent(s string) bool {
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == ' ', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// TrimJSONLevel removes the level prefixed to a JSON log line. Other lines
+// are returned as is.
+func TrimJSONLevel(p []byte) []byte {
+	if len(p) == 0 || p[0] != '[' {
+		return p
+	}
+
+	y := bytes.IndexByte(p, ']')
+	if y < 0 || y+2 >= len(p) || p[y+1] != ' ' || p[y+2] != '{' {
+		return p
+	}
+
+	return p[y+2:]
+}
+
+// TrimJSONLevelWriter writes the JSON log lines without their level prefix.
+// It is meant for the outputs that are read by log pipelines e.g. stdout.
+type TrimJSONLevelWriter struct {
+	Writer io.Writer
+}
+
+// Write is used to implement io.Writer
+func (w *TrimJSONLevelWriter) Write(p []byte) (int, error) {
+	if _, err := w.Writer.Write(TrimJSONLevel(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,129 @@
+package loghelper
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/logutils"
+)
+
+func TestLogger_Text(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger(&buf).With("volume", "vol1", "request_id", "abc def")
+
+	l.Printf("[DEBUG] http: Processed %s request", "read")
+
+	out := buf.String()
+	expected := `[DEBUG] http: Processed read request volume=vol1 request_id="abc def"` + "\n"
+	if !strings.HasSuffix(out, expected) {
+		t.Fatalf("expected suffix %q, got: %q", expected, out)
+	}
+}
+
+func TestLogger_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	w := &JSONWriter{Writer: &buf}
+
+	l := NewLogger(w).With("volume", "vol1")
+	l.With("error", errors.New("boom"), "replicas", 2).Printf("[WARN] orchestrator: Failed to read")
+
+	line := buf.String()
+	if !strings.HasPrefix(line, "[WARN] {") {
+		t.Fatalf("expected level prefix, got: %s", line)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(TrimJSONLevel(buf.Bytes()), &entry); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"level":     "WARN",
+		"component": "orchestrator",
+		"message":   "Failed to read",
+		"volume":    "vol1",
+		"error":     "boom",
+		"replicas":  float64(2),
+	}
+	for k, v := range expected {
+		if entry[k] != v {
+			t.Fatalf("expected %s to be %v, got: %v", k, v, entry[k])
+		}
+	}
+	if _, ok := entry["timestamp"]; !ok {
+		t.Fatalf("expected timestamp, got: %v", entry)
+	}
+}
+
+func TestJSONWriter_StdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	filter := LevelFilter()
+	filter.MinLevel = logutils.LogLevel("INFO")
+	filter.Writer = &buf
+
+	// The JSON lines are filtered by their level similar to the text lines
+	std := log.New(&JSONWriter{Writer: filter}, "", log.LstdFlags|log.Lmicroseconds)
+	std.Printf("[DEBUG] http: Request /v1/health/live")
+	std.Printf("[ERR] maya api server: failed to export: broken [pipe]")
+	log.New(&JSONWriter{Writer: filter}, "", log.LstdFlags).Printf("no level")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got: %q", lines)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(TrimJSONLevel([]byte(lines[0])), &entry); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if entry["level"] != "ERR" || entry["component"] != "maya api server" ||
+		entry["message"] != "failed to export: broken [pipe]" {
+		t.Fatalf("bad entry: %v", entry)
+	}
+
+	if err := json.Unmarshal(TrimJSONLevel([]byte(lines[1])), &entry); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if entry["level"] != "INFO" || entry["message"] != "no level" {
+		t.Fatalf("bad entry: %v", entry)
+	}
+}
+
+func TestTrimJSONLevel(t *testing.T) {
+	cases := map[string]string{
+		`[INFO] {"message":"hi"}`: `{"message":"hi"}`,
+		`[INFO] http: hi`:         `[INFO] http: hi`,
+		`{"message":"hi"}`:        `{"message":"hi"}`,
+		`[INFO]`:                  `[INFO]`,
+		``:                        ``,
+	}
+
+	for in, expected := range cases {
+		if out := string(TrimJSONLevel([]byte(in))); out != expected {
+			t.Fatalf("%q: expected %q, got: %q", in, expected, out)
+		}
+	}
+}
+
+func TestLineComponent(t *testing.T) {
+	cases := map[string]string{
+		"2017/01/02 15:04:05 [DEBUG] http: Request /v1/health/live": "http",
+		"[TRACE] orchprovider.k8s: Listing pods":                    "orchprovider.k8s",
+		"[INFO] maya api server: Started":                           "maya api server",
+		"[INFO] Started: at last":                                   "",
+		"[INFO] no component":                                       "",
+		"no level: at all":                                          "",
+		`[INFO] {"timestamp":"t","level":"INFO","component":"volume","message":"m"}`: "volume",
+		`[INFO] {"timestamp":"t","level":"INFO","message":"m"}`:                      "",
+	}
+
+	for in, expected := range cases {
+		if out := LineComponent([]byte(in)); out != expected {
+			t.Fatalf("%q: expected %q, got: %q", in, expected, out)
+		}
+	}
+}
@@ -2,7 +2,11 @@ package loghelper
 
 // This is an adaptation of Hashicorp's Nomad library
 import (
+	"fmt"
+	"io"
 	"io/ioutil"
+	"strings"
+	"sync"
 
 	"github.com/hashicorp/logutils"
 )
@@ -27,3 +31,155 @@ func ValidateLevelFilter(minLevel logutils.LogLevel, filter *logutils.LevelFilte
 	}
 	return false
 }
+
+// LineFilter verifies if a log line is to be logged. Both LevelFilter &
+// ComponentFilter are line filters.
+type LineFilter interface {
+	Check(line []byte) bool
+}
+
+// ValidateLevel verifies if the log level is one of the log levels that we
+// use. The level is case insensitive.
+func ValidateLevel(level string) error {
+	filter := LevelFilter()
+	if !ValidateLevelFilter(logutils.LogLevel(strings.ToUpper(level)), filter) {
+		return fmt.Errorf("invalid log level %q, valid log levels are: %v", level, filter.Levels)
+	}
+	return nil
+}
+
+// ComponentFilter is a level filter with an independent level per component
+// e.g. orchprovider.k8s. The component of a log line is the one that
+// follows its level i.e. [LEVEL] component: message. A component that does
+// not have a level of its own inherits the level of its parent e.g.
+// orchprovider & then the default level.
+//
+// ComponentFilter implements:
+//  1. io.Writer interface
+//  2. LineFilter interface
+type ComponentFilter struct {
+	Writer io.Writer
+
+	l          sync.RWMutex
+	level      *logutils.LevelFilter
+	components map[string]*logutils.LevelFilter
+}
+
+// NewComponentFilter returns a filter of the given default level that writes
+// to the given writer
+func NewComponentFilter(level string, w io.Writer) (*ComponentFilter, error) {
+	f := &ComponentFilter{Writer: w}
+	if err := f.SetLevels(level, nil); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// newLevelFilter returns a level filter of the given level
+func newLevelFilter(level string) *logutils.LevelFilter {
+	filter := LevelFilter()
+	filter.SetMinLevel(logutils.LogLevel(strings.ToUpper(level)))
+	return filter
+}
+
+// ValidateLevels verifies the default level & the levels of the components
+func ValidateLevels(level string, components map[string]string) error {
+	if err := ValidateLevel(level); err != nil {
+		return err
+	}
+	for component, l := range components {
+		if component == "" {
+			return fmt.Errorf("component name is missing")
+		}
+		if err := ValidateLevel(l); err != nil {
+			return fmt.Errorf("%s: %v", component, err)
+		}
+	}
+	return nil
+}
+
+// SetLevels replaces the default level & the levels of the components. No
+// level is changed if any of the levels is invalid.
+func (f *ComponentFilter) SetLevels(level string, components map[string]string) error {
+	if err := ValidateLevels(level, components); err != nil {
+		return err
+	}
+
+	filters := map[string]*logutils.LevelFilter{}
+	for component, l := range components {
+		filters[component] = newLevelFilter(l)
+	}
+
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	f.level = newLevelFilter(level)
+	f.components = filters
+	return nil
+}
+
+// SetLevel sets the level of the component. The default level is set if the
+// component is empty. The component inherits the level of its parent if the
+// level is empty.
+func (f *ComponentFilter) SetLevel(component, level string) error {
+	if component == "" || level != "" {
+		if err := ValidateLevel(level); err != nil {
+			return err
+		}
+	}
+
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	switch {
+	case component == "":
+		f.level = newLevelFilter(level)
+	case level == "":
+		delete(f.components, component)
+	default:
+		f.components[component] = newLevelFilter(level)
+	}
+	return nil
+}
+
+// Levels returns the default level & the levels of the components
+func (f *ComponentFilter) Levels() (string, map[string]string) {
+	f.l.RLock()
+	defer f.l.RUnlock()
+
+	components := map[string]string{}
+	for component, filter := range f.components {
+		components[component] = string(filter.MinLevel)
+	}
+	return string(f.level.MinLevel), components
+}
+
+// Check verifies if the log line is of the level of its component or above
+func (f *ComponentFilter) Check(line []byte) bool {
+	component := LineComponent(line)
+
+	f.l.RLock()
+	defer f.l.RUnlock()
+
+	for component != "" {
+		if filter, ok := f.components[component]; ok {
+			return filter.Check(line)
+		}
+
+		x := strings.LastIndexByte(component, '.')
+		if x < 0 {
+			break
+		}
+		component = component[:x]
+	}
+
+	return f.level.Check(line)
+}
+
+// Write writes the log line if it is of the level of its component or above
+func (f *ComponentFilter) Write(p []byte) (int, error) {
+	if !f.Check(p) {
+		return len(p), nil
+	}
+	return f.Writer.Write(p)
+}
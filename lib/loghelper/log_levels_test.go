@@ -1,6 +1,8 @@
 package loghelper
 
 import (
+	"bytes"
+	"io/ioutil"
 	"testing"
 
 	"github.com/hashicorp/logutils"
@@ -25,3 +27,88 @@ func TestLevelFilter(t *testing.T) {
 	}
 
 }
+
+func TestComponentFilter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	filter, err := NewComponentFilter("INFO", buf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if err := filter.SetLevels("info", map[string]string{"orchprovider": "WARN", "orchprovider.k8s": "TRACE"}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	cases := []struct {
+		line string
+		ok   bool
+	}{
+		{"[DEBUG] http: Request /v1/health/live", false},
+		{"[INFO] http: Request /v1/health/live", true},
+		{"[TRACE] orchprovider.k8s: Listing pods", true},
+		{"[INFO] orchprovider.nomad: Job registered", false},
+		{"[WARN] orchprovider.nomad: Job failed", true},
+		{"[TRACE] orchprovider.k8s.client: Request", true},
+		{`[DEBUG] {"timestamp":"t","level":"DEBUG","component":"orchprovider.k8s","message":"m"}`, true},
+		{`[DEBUG] {"timestamp":"t","level":"DEBUG","component":"http","message":"m"}`, false},
+		{"no level or component", true},
+	}
+
+	for _, tc := range cases {
+		if ok := filter.Check([]byte(tc.line)); ok != tc.ok {
+			t.Fatalf("line: %s\nexpected %v, got %v", tc.line, tc.ok, ok)
+		}
+	}
+
+	filter.Write([]byte("[DEBUG] http: Filtered\n"))
+	filter.Write([]byte("[TRACE] orchprovider.k8s: Written\n"))
+	if buf.String() != "[TRACE] orchprovider.k8s: Written\n" {
+		t.Fatalf("bad output: %q", buf.String())
+	}
+}
+
+func TestComponentFilter_SetLevel(t *testing.T) {
+	filter, err := NewComponentFilter("INFO", ioutil.Discard)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if _, err := NewComponentFilter("CHATTY", ioutil.Discard); err == nil {
+		t.Fatalf("expected an invalid default level to be rejected")
+	}
+	if err := filter.SetLevels("INFO", map[string]string{"http": "CHATTY"}); err == nil {
+		t.Fatalf("expected an invalid component level to be rejected")
+	}
+	if err := filter.SetLevel("http", "CHATTY"); err == nil {
+		t.Fatalf("expected an invalid component level to be rejected")
+	}
+	if err := filter.SetLevel("", ""); err == nil {
+		t.Fatalf("expected the default level to be required")
+	}
+
+	if err := filter.SetLevel("http", "debug"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := filter.SetLevel("", "WARN"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	level, components := filter.Levels()
+	if level != "WARN" || len(components) != 1 || components["http"] != "DEBUG" {
+		t.Fatalf("bad levels: %s %v", level, components)
+	}
+	if !filter.Check([]byte("[DEBUG] http: Request")) || filter.Check([]byte("[INFO] volume: Processing")) {
+		t.Fatalf("expected the levels to be applied")
+	}
+
+	// An empty level lets the component inherit the default level
+	if err := filter.SetLevel("http", ""); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, components := filter.Levels(); len(components) != 0 {
+		t.Fatalf("expected no component levels, got: %v", components)
+	}
+	if filter.Check([]byte("[DEBUG] http: Request")) {
+		t.Fatalf("expected the default level to be applied")
+	}
+}
@@ -66,6 +66,18 @@ func (l *LogRegistrar) RegisterHandler(lh LogHandler) {
 	}
 }
 
+// Recent returns the buffered logs from the oldest to the latest
+func (l *LogRegistrar) Recent() []string {
+	l.Lock()
+	defer l.Unlock()
+
+	lines := make([]string, 0, len(l.logs))
+	if l.logs[l.index] != "" {
+		lines = append(lines, l.logs[l.index:]...)
+	}
+	return append(lines, l.logs[:l.index]...)
+}
+
 // DeregisterHandler removes a LogHandler and prevents more invocations
 func (l *LogRegistrar) DeregisterHandler(lh LogHandler) {
 	l.Lock()
@@ -1,6 +1,7 @@
 package loghelper
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -49,3 +50,22 @@ func TestLogRegistrar(t *testing.T) {
 		}
 	}
 }
+
+func TestLogRegistrar_Recent(t *testing.T) {
+	w := NewLogRegistrar(3)
+	if lines := w.Recent(); len(lines) != 0 {
+		t.Fatalf("expected no lines, got: %v", lines)
+	}
+
+	w.Write([]byte("one"))
+	w.Write([]byte("two"))
+	if lines := w.Recent(); !reflect.DeepEqual(lines, []string{"one", "two"}) {
+		t.Fatalf("bad lines: %v", lines)
+	}
+
+	w.Write([]byte("three"))
+	w.Write([]byte("four"))
+	if lines := w.Recent(); !reflect.DeepEqual(lines, []string{"two", "three", "four"}) {
+		t.Fatalf("bad lines: %v", lines)
+	}
+}
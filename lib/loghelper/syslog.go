@@ -3,7 +3,6 @@ package loghelper
 import (
 	"bytes"
 	"github.com/hashicorp/go-syslog"
-	"github.com/hashicorp/logutils"
 )
 
 // levelPriority is used to map a log level to a
@@ -23,7 +22,7 @@ var levelPriority = map[string]gsyslog.Priority{
 // Implements the io.Writer interface.
 type SyslogWriter struct {
 	GSyslog gsyslog.Syslogger
-	LFilter *logutils.LevelFilter
+	LFilter LineFilter
 }
 
 // Write is used to implement io.Writer
@@ -3,6 +3,11 @@ datacenter = "dc2"
 name = "my-vsm"
 data_dir = "/tmp/mayaserver"
 log_level = "ERR"
+log_format = "json"
+log_levels {
+	http = "WARN"
+	orchprovider.k8s = "TRACE"
+}
 bind_addr = "192.168.0.1"
 enable_debug = true
 ports {
@@ -17,6 +22,24 @@ leave_on_interrupt = true
 leave_on_terminate = true
 enable_syslog = true
 syslog_facility = "LOCAL1"
+log_file = "/tmp/mayaserver/mapiserver.log"
+log_rotate_bytes = 10485760
+log_rotate_duration = "24h"
+log_rotate_max_age = "168h"
+log_rotate_max_files = 5
+log_rotate_compress = true
+drain_timeout = "10s"
+access_log_file = "/tmp/mayaserver/access.log"
+access_log_format = "json"
+trace_collector_addr = "http://127.0.0.1:4318"
+chap_access_token = "0123456789abcdef"
+admin_token = "fedcba9876543210"
+ec2_access_key_id = "AKIDEXAMPLE"
+ec2_secret_access_key = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+audit_key_file = "/etc/mayaserver/audit.key"
+state_key_file = "/etc/mayaserver/state.key"
+instance_id = "i-0123456789abcdef0"
+availability_zone = "bang-east-1a"
 http_api_response_headers {
 	Access-Control-Allow-Origin = "*"
 }
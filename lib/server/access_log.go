@@ -0,0 +1,244 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/openebs/mayaserver/lib/config"
+)
+
+const (
+	// AccessLogCommon logs the requests in Common Log Format. The duration &
+	// request id are appended to every entry.
+	AccessLogCommon = "common"
+
+	// AccessLogJSON logs the requests as JSON; one object per line
+	AccessLogJSON = "json"
+
+	// clfTimeFormat is the time format of Common Log Format
+	clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+)
+
+// accessLogEntry is an entry of the access log
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"requestID"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Identity   string    `json:"identity"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	Duration   float64   `json:"durationSeconds"`
+}
+
+// accessLogger writes the access log entries to a file
+type accessLogger struct {
+	l      sync.Mutex
+	w      io.WriteCloser
+	format string
+}
+
+// newAccessLogger opens the access log file in append mode
+func newAccessLogger(path, format string) (*accessLogger, error) {
+	if format == "" {
+		format = AccessLogCommon
+	}
+
+	if format != AccessLogCommon && format != AccessLogJSON {
+		return nil, fmt.Errorf("invalid access log format '%s', expected one of: %s, %s", format, AccessLogCommon, AccessLogJSON)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open access log: %v", err)
+	}
+
+	return &accessLogger{
+		w:      f,
+		format: format,
+	}, nil
+}
+
+// log writes the entry in the configured format
+func (a *accessLogger) log(e *accessLogEntry) error {
+	var line []byte
+	switch a.format {
+	case AccessLogJSON:
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		line = append(b, '\n')
+	default:
+		line = []byte(e.common())
+	}
+
+	a.l.Lock()
+	defer a.l.Unlock()
+
+	_, err := a.w.Write(line)
+	return err
+}
+
+// Close closes the access log file
+func (a *accessLogger) Close() error {
+	a.l.Lock()
+	defer a.l.Unlock()
+
+	return a.w.Close()
+}
+
+// common formats the entry in Common Log Format i.e.
+// host ident authuser [date] "request" status bytes
+// followed by the duration in seconds & the request id
+func (e *accessLogEntry) common() string {
+	size := "-"
+	if e.Bytes > 0 {
+		size = fmt.Sprintf("%d", e.Bytes)
+	}
+
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s %.6f %s\n",
+		e.RemoteAddr, e.Identity, e.Time.Format(clfTimeFormat),
+		e.Method, e.Path, e.Proto, e.Status, size, e.Duration, e.RequestID)
+}
+
+// statusRecorder captures the HTTP code & the size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Flush lets streaming responses flush through the recorder
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// requestIdentity returns the identity of the client. It is '-' if the
+// client did not identify itself.
+func requestIdentity(req *http.Request) string {
+	if user, _, ok := req.BasicAuth(); ok && user != "" {
+		return user
+	}
+
+	return "-"
+}
+
+// remoteHost returns the host of the client's address
+func remoteHost(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+
+	return host
+}
+
+// withAccessLog assigns a request id to every request served by the handler.
+// In addition, the request is logged to the access log if enabled.
+func (s *HTTPServer) withAccessLog(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		req, id := withRequestID(resp, req)
+
+		s.accessLogLock.RLock()
+		enabled := s.accessLog != nil
+		s.accessLogLock.RUnlock()
+
+		if !enabled {
+			h.ServeHTTP(resp, req)
+			return
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: resp}
+
+		h.ServeHTTP(rec, req)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		// The access log may have been replaced or disabled on reload while
+		// the request was served
+		s.accessLogLock.RLock()
+		defer s.accessLogLock.RUnlock()
+		if s.accessLog == nil {
+			return
+		}
+
+		err := s.accessLog.log(&accessLogEntry{
+			Time:       start,
+			RequestID:  id,
+			RemoteAddr: remoteHost(req),
+			Identity:   requestIdentity(req),
+			Method:     req.Method,
+			Path:       req.URL.RequestURI(),
+			Proto:      req.Proto,
+			Status:     rec.status,
+			Bytes:      rec.bytes,
+			Duration:   time.Since(start).Seconds(),
+		})
+		if err != nil {
+			s.maya.log.With("request_id", id).Printf("[ERR] http: Failed to write access log: %v", err)
+		}
+	})
+}
+
+// reloadAccessLog opens the access log as per the new config. The current
+// access log is closed once the new one is in place. The new access log is
+// closed if the reload is aborted.
+func (s *HTTPServer) reloadAccessLog(old, new *config.MayaConfig) (func(), func(), error) {
+	var accessLog *accessLogger
+	if new.AccessLogFile != "" {
+		var err error
+		accessLog, err = newAccessLogger(new.AccessLogFile, new.AccessLogFormat)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	commit := func() {
+		s.accessLogLock.Lock()
+		previous := s.accessLog
+		s.accessLog = accessLog
+		s.accessLogLock.Unlock()
+
+		if previous != nil {
+			previous.Close()
+		}
+	}
+
+	abort := func() {
+		if accessLog != nil {
+			accessLog.Close()
+		}
+	}
+
+	return commit, abort, nil
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openebs/mayaserver/lib/config"
+)
+
+func TestAccessLog(t *testing.T) {
+	cases := []struct {
+		format string
+		check  func(t *testing.T, line, id string)
+	}{
+		{
+			AccessLogCommon,
+			func(t *testing.T, line, id string) {
+				for _, part := range []string{"127.0.0.1 - admin [", `"GET /latest/meta-data/instance-id HTTP/1.1" 200`, id} {
+					if !strings.Contains(line, part) {
+						t.Fatalf("expected '%s' in access log: %s", part, line)
+					}
+				}
+			},
+		},
+		{
+			AccessLogJSON,
+			func(t *testing.T, line, id string) {
+				var e accessLogEntry
+				if err := json.Unmarshal([]byte(line), &e); err != nil {
+					t.Fatalf("err decoding access log: %v", err)
+				}
+
+				if e.RequestID != id || e.Status != 200 || e.Method != "GET" ||
+					e.Path != "/latest/meta-data/instance-id" || e.Identity != "admin" ||
+					e.RemoteAddr != "127.0.0.1" || e.Bytes == 0 {
+					t.Fatalf("bad access log entry: %#v", e)
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		dir := tmpDir(t)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "access.log")
+
+		format := tc.format
+		s := makeHTTPTestServer(t, func(mc *config.MayaConfig) {
+			mc.AccessLogFile = path
+			mc.AccessLogFormat = format
+		})
+
+		req, _ := http.NewRequest("GET", fmt.Sprintf("http://%s/latest/meta-data/instance-id", s.Server.addr), nil)
+		req.SetBasicAuth("admin", "secret")
+
+		client := &http.Client{Timeout: 5 * time.Second}
+		resp, err := client.Do(req)
+		if err != nil {
+			s.Cleanup()
+			t.Fatalf("err: %v", err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		// The access log is closed on shutdown
+		s.Cleanup()
+
+		id := resp.Header.Get(RequestIDHeader)
+		if id == "" {
+			t.Fatalf("%s: expected the request id in response", tc.format)
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+		if len(lines) != 1 {
+			t.Fatalf("%s: expected a single access log entry, got: %q", tc.format, lines)
+		}
+
+		tc.check(t, lines[0], id)
+	}
+}
+
+func TestAccessLogInvalidFormat(t *testing.T) {
+	dir := tmpDir(t)
+	defer os.RemoveAll(dir)
+
+	_, err := newAccessLogger(filepath.Join(dir, "access.log"), "xml")
+	if err == nil || !strings.Contains(err.Error(), "invalid access log format") {
+		t.Fatalf("expected invalid format error, got: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/openebs/mayaserver/lib/audit"
+	"github.com/openebs/mayaserver/lib/config"
+)
+
+// AgentSpecificRequest is a http handler implementation. It deals with the
+// administration of maya api server itself.
+func (s *HTTPServer) AgentSpecificRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+
+	path := strings.TrimPrefix(req.URL.Path, "/v1/agent")
+
+	// Is req valid ?
+	if path == req.URL.Path {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+
+	if strings.HasPrefix(path, "/debug/") {
+		return s.agentDebug(resp, req, strings.TrimPrefix(path, "/debug/"))
+	}
+
+	switch path {
+	case "/reload":
+		return s.agentReload(resp, req)
+	case "/monitor":
+		return s.agentMonitor(resp, req)
+	case "/log-level":
+		return s.agentLogLevel(resp, req)
+	case "/self":
+		return s.agentSelf(resp, req)
+	default:
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+}
+
+// agentReload reads the config afresh & applies it the same way as SIGHUP
+// does. An invalid config is reported as a 400 & is not applied at all. The
+// reload is audited along with the settings that changed. Only the callers
+// of the admin scope may reload.
+func (s *HTTPServer) agentReload(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if req.Method != "PUT" && req.Method != "POST" {
+		return nil, CodedError(405, ErrPutMethodRequired)
+	}
+
+	if err := s.requireAdminRequest(req); err != nil {
+		return nil, err
+	}
+
+	result, err := s.maya.Reload()
+	if _, ok := err.(config.ValidationErrors); ok {
+		err = CodedError(400, err.Error())
+	}
+
+	var spec interface{}
+	if result != nil {
+		spec = result
+	}
+	s.auditRequest(req, audit.OpConfigReload, "", spec, err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,382 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openebs/maya/orchprovider"
+	"github.com/openebs/maya/types/v1"
+	volProfile "github.com/openebs/maya/volumes/profile/volumeprovisioner"
+	"github.com/openebs/mayaserver/lib/api"
+	"github.com/openebs/mayaserver/lib/audit"
+	"github.com/openebs/mayaserver/lib/config"
+)
+
+// fakeOrchestratorName is the name of the fake orchestrator. It is selected
+// via the env var that sets the default orchestrator.
+const fakeOrchestratorName v1.OrchProviderRegistry = "fake"
+
+var registerFakeOrchestrator sync.Once
+
+// fakeOrchestrator keeps the volumes in memory. Its volumes are always
+// running.
+type fakeOrchestrator struct {
+	l       sync.Mutex
+	volumes map[string]*v1.PersistentVolume
+
+	// readErr fails the reads while reads counts the reads
+	readErr error
+	reads   int
+
+	// listErr fails the listings similar to the orchestrators that can not
+	// list the volumes e.g. Nomad
+	listErr error
+
+	// claimLabels are the labels of the claims of the volumes as the
+	// orchestrators get these
+	claimLabels map[string]map[string]string
+}
+
+func (f *fakeOrchestrator) Label() string                               { return string(v1.OrchestratorNameLbl) }
+func (f *fakeOrchestrator) Name() string                                { return string(fakeOrchestratorName) }
+func (f *fakeOrchestrator) Region() string                              { return "" }
+func (f *fakeOrchestrator) StorageOps() (orchprovider.StorageOps, bool) { return f, true }
+
+func (f *fakeOrchestrator) AddStorage(p volProfile.VolumeProvisionerProfile) (*v1.PersistentVolume, error) {
+	name, err := p.VSMName()
+	if err != nil {
+		return nil, err
+	}
+
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	if _, ok := f.volumes[name]; ok {
+		return nil, fmt.Errorf("VSM '%s' already exists", name)
+	}
+
+	size, _ := p.StorageSize()
+
+	if pvc, _ := p.PVC(); pvc != nil {
+		f.claimLabels[name] = pvc.Labels
+	}
+
+	pv := &v1.PersistentVolume{}
+	pv.Name = name
+	pv.UID = fmt.Sprintf("uid-%s", name)
+	pv.Annotations = map[string]string{
+		string(v1.ControllerStatusAPILbl): "Running",
+		string(v1.ReplicaStatusAPILbl):    "Running,Running",
+		string(v1.VolumeSizeAPILbl):       size,
+	}
+	f.volumes[name] = pv
+	return pv, nil
+}
+
+func (f *fakeOrchestrator) DeleteStorage(p volProfile.VolumeProvisionerProfile) (bool, error) {
+	name, err := p.VSMName()
+	if err != nil {
+		return false, err
+	}
+
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	_, ok := f.volumes[name]
+	delete(f.volumes, name)
+	delete(f.claimLabels, name)
+	return ok, nil
+}
+
+func (f *fakeOrchestrator) ReadStorage(p volProfile.VolumeProvisionerProfile) (*v1.PersistentVolume, error) {
+	name, err := p.VSMName()
+	if err != nil {
+		return nil, err
+	}
+
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	f.reads++
+	if f.readErr != nil {
+		return nil, f.readErr
+	}
+	if pv, ok := f.volumes[name]; ok {
+		return copyVolume(pv), nil
+	}
+	return nil, nil
+}
+
+func (f *fakeOrchestrator) ListStorage(p volProfile.VolumeProvisionerProfile) (*v1.PersistentVolumeList, error) {
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	if f.listErr != nil {
+		return nil, f.listErr
+	}
+
+	pvl := &v1.PersistentVolumeList{}
+	for _, pv := range f.volumes {
+		pvl.Items = append(pvl.Items, *copyVolume(pv))
+	}
+	return pvl, nil
+}
+
+// copyVolume copies the volume along with its annotations so that the
+// volumes served are not changed by the handlers
+func copyVolume(pv *v1.PersistentVolume) *v1.PersistentVolume {
+	c := *pv
+	c.Annotations = map[string]string{}
+	for k, v := range pv.Annotations {
+		c.Annotations[k] = v
+	}
+	return &c
+}
+
+// currentFakeOrchestrator is the fake orchestrator of the running test
+var currentFakeOrchestrator *fakeOrchestrator
+
+// makeAPIClientTestServer returns a test server backed by a fake
+// orchestrator along with a client of the server
+func makeAPIClientTestServer(t *testing.T) (*TestServer, *api.Client, func()) {
+	return makeAPIClientTestServerWithConfig(t, nil)
+}
+
+// makeAPIClientTestServerWithConfig is makeAPIClientTestServer with the
+// config of the test server changed by fnmc
+func makeAPIClientTestServerWithConfig(t *testing.T, fnmc func(mc *config.MayaConfig)) (*TestServer, *api.Client, func()) {
+	registerFakeOrchestrator.Do(func() {
+		orchprovider.RegisterOrchestrator(fakeOrchestratorName,
+			func(label v1.NameLabel, name v1.OrchProviderRegistry) (orchprovider.OrchestratorInterface, error) {
+				return currentFakeOrchestrator, nil
+			})
+	})
+	currentFakeOrchestrator = &fakeOrchestrator{
+		volumes:     map[string]*v1.PersistentVolume{},
+		claimLabels: map[string]map[string]string{},
+	}
+
+	env := string(v1.EnvVariableContextDef) + string(v1.OrchestratorNameEnvVarKey)
+	os.Setenv(env, string(fakeOrchestratorName))
+
+	s := makeHTTPTestServer(t, fnmc)
+
+	client, err := api.NewClient(&api.Config{
+		Address:    "http://" + s.Server.addr,
+		MaxRetries: 2,
+		Backoff:    func(int) time.Duration { return time.Millisecond },
+	})
+	if err != nil {
+		s.Cleanup()
+		os.Unsetenv(env)
+		t.Fatalf("err: %v", err)
+	}
+
+	return s, client, func() {
+		s.Cleanup()
+		os.Unsetenv(env)
+	}
+}
+
+func TestAPIClient_Volumes(t *testing.T) {
+	_, client, cleanup := makeAPIClientTestServer(t)
+	defer cleanup()
+
+	volumes := client.Volumes()
+
+	pvc := &v1.PersistentVolumeClaim{}
+	pvc.Name = "vol1"
+	pv, err := volumes.Create(pvc, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if pv.Name != "vol1" || pv.UID != "uid-vol1" {
+		t.Fatalf("bad volume: %#v", pv)
+	}
+
+	// A duplicate is a conflict
+	if _, err := volumes.Create(pvc, nil); !api.IsConflict(err) {
+		t.Fatalf("expected a conflict, got: %v", err)
+	}
+
+	// A volume without a name is invalid
+	if _, err := volumes.Create(&v1.PersistentVolumeClaim{}, nil); !api.IsInvalid(err) {
+		t.Fatalf("expected an invalid request, got: %v", err)
+	}
+
+	pvl, qm, err := volumes.List(nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(pvl.Items) != 1 || pvl.Items[0].Name != "vol1" || qm.LastIndex == 0 {
+		t.Fatalf("bad list: %#v %#v", pvl, qm)
+	}
+
+	status, _, err := volumes.Status("vol1", nil)
+	if err != nil || status != api.VolumeStatusRunning {
+		t.Fatalf("expected a running volume, got: %s %v", status, err)
+	}
+
+	if err := volumes.Delete("vol1", nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if _, _, err := volumes.Info("vol1", nil); !api.IsNotFound(err) {
+		t.Fatalf("expected not found, got: %v", err)
+	}
+	if err := volumes.Delete("vol1", nil); !api.IsNotFound(err) {
+		t.Fatalf("expected not found, got: %v", err)
+	}
+}
+
+func TestAPIClient_BlockingQuery(t *testing.T) {
+	_, client, cleanup := makeAPIClientTestServer(t)
+	defer cleanup()
+
+	volumes := client.Volumes()
+
+	_, qm, err := volumes.List(nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The blocking query times out if there is no change
+	start := time.Now()
+	_, qm2, err := volumes.List(&api.QueryOptions{WaitIndex: qm.LastIndex, WaitTime: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if time.Since(start) < 50*time.Millisecond || qm2.LastIndex != qm.LastIndex {
+		t.Fatalf("expected the query to block till the wait time, got: %v %d", time.Since(start), qm2.LastIndex)
+	}
+
+	// The blocking query returns once a volume is created
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		pvc := &v1.PersistentVolumeClaim{}
+		pvc.Name = "vol1"
+		volumes.Create(pvc, nil)
+	}()
+
+	pvl, qm3, err := volumes.List(&api.QueryOptions{WaitIndex: qm.LastIndex, WaitTime: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if qm3.LastIndex <= qm.LastIndex || len(pvl.Items) != 1 {
+		t.Fatalf("expected the new volume, got: %d %#v", qm3.LastIndex, pvl)
+	}
+
+	// The blocking query is cancelled along with its context
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	q := (&api.QueryOptions{WaitIndex: qm3.LastIndex}).WithContext(ctx)
+	if _, _, err := volumes.List(q); err == nil || ctx.Err() == nil {
+		t.Fatalf("expected the query to be cancelled, got: %v", err)
+	}
+}
+
+func TestAPIClient_Events(t *testing.T) {
+	s, client, cleanup := makeAPIClientTestServerWithConfig(t, func(mc *config.MayaConfig) {
+		mc.AdminToken = testAdminToken
+	})
+	defer cleanup()
+
+	// Only the admin may read the events
+	if _, _, err := client.Events().List(nil, nil); err == nil {
+		t.Fatalf("expected error without the admin token")
+	}
+
+	admin, err := api.NewClient(&api.Config{
+		Address: "http://" + s.Server.addr,
+		Token:   testAdminToken,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	_, qm, err := admin.Events().List(nil, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pvc := &v1.PersistentVolumeClaim{}
+	pvc.Name = "vol1"
+	if _, err := client.Volumes().Create(pvc, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	events, _, err := admin.Events().List(
+		&api.EventFilter{Volume: "vol1"},
+		&api.QueryOptions{WaitIndex: qm.LastIndex, WaitTime: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(events) != 1 || events[0].Operation != audit.OpVolumeCreate || events[0].Outcome != outcomeSuccess {
+		t.Fatalf("expected the create event, got: %#v", events)
+	}
+}
+
+func TestAPIClient_MetaDataHealth(t *testing.T) {
+	_, client, cleanup := makeAPIClientTestServer(t)
+	defer cleanup()
+
+	if id, err := client.MetaData().InstanceID(nil); err != nil || id != AnyInstance {
+		t.Fatalf("bad instance id: %s %v", id, err)
+	}
+	if zone, err := client.MetaData().AvailabilityZone(nil); err != nil || zone != AnyZone {
+		t.Fatalf("bad zone: %s %v", zone, err)
+	}
+	if region, err := client.MetaData().Region(nil); err != nil || region != "global" {
+		t.Fatalf("bad region: %s %v", region, err)
+	}
+	if entries, err := client.MetaData().List("placement", nil); err != nil || !reflect.DeepEqual(entries, []string{"availability-zone", "region"}) {
+		t.Fatalf("bad placement: %v %v", entries, err)
+	}
+
+	report, err := client.Health().Live(nil)
+	if err != nil || report.Status != api.HealthPassing {
+		t.Fatalf("bad liveness: %#v %v", report, err)
+	}
+
+	// The readiness is reported even if the server is not ready
+	report, err = client.Health().Ready(nil)
+	if err != nil || report.Status == "" {
+		t.Fatalf("bad readiness: %#v %v", report, err)
+	}
+}
+
+func TestAPIClient_ErrorKind(t *testing.T) {
+	_, client, cleanup := makeAPIClientTestServer(t)
+	defer cleanup()
+
+	err := client.Volumes().Delete("", nil)
+	if aErr, ok := err.(*api.Error); !ok || aErr.StatusCode != 400 || aErr.Kind != api.ErrorKindInvalid {
+		t.Fatalf("expected an invalid request, got: %#v", err)
+	}
+
+	// The errors of the orchestrator are classified & the retryable ones
+	// are retried
+	f := currentFakeOrchestrator
+	f.l.Lock()
+	f.readErr = fmt.Errorf("dial tcp 10.0.0.1:443: i/o timeout")
+	f.l.Unlock()
+
+	_, _, err = client.Volumes().Info("vol1", nil)
+	if aErr, ok := err.(*api.Error); !ok || aErr.StatusCode != 500 || aErr.Kind != api.ErrorKindTimeout {
+		t.Fatalf("expected a timeout, got: %#v", err)
+	}
+	if !api.IsUnavailable(err) {
+		t.Fatalf("expected a timeout to be retryable")
+	}
+	f.l.Lock()
+	reads := f.reads
+	f.l.Unlock()
+	if reads != 3 {
+		t.Fatalf("expected the query to be retried twice, got %d reads", reads)
+	}
+}
@@ -0,0 +1,431 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/openebs/maya/types/v1"
+	"github.com/openebs/mayaserver/lib/api"
+	"github.com/openebs/mayaserver/lib/audit"
+)
+
+const (
+	// attachmentsBucket is the bucket of the state that has the attachments
+	// of the volumes by their names
+	attachmentsBucket = "attachments"
+
+	// detachTokensBucket is the bucket of the state that has the hashes of
+	// the detach tokens of the attachments by the names of the volumes
+	detachTokensBucket = "detach_tokens"
+
+	// detachTokenLen is the no. of random bytes of a detach token
+	detachTokenLen = 32
+)
+
+// VolumeRequest serves the requests w.r.t a single volume i.e.
+// /v1/volumes/{name}/{action}. The action may have several segments e.g.
+// chap/rotate.
+func (s *HTTPServer) VolumeRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	path := strings.TrimPrefix(req.URL.Path, "/v1/volumes/")
+
+	idx := strings.Index(path, "/")
+	if idx <= 0 {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+	name, action := path[:idx], path[idx+1:]
+
+	switch action {
+	case "attach":
+		return s.volumeAttach(resp, req, name)
+	case "detach":
+		return s.volumeDetach(resp, req, name)
+	case "attachments":
+		return s.volumeAttachments(resp, req, name)
+	case "target":
+		return s.volumeTarget(resp, req, name)
+	case "chap/rotate":
+		return s.volumeRotateCHAP(resp, req, name)
+	default:
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+}
+
+// volumeAttach attaches the volume to the node of the request. Every request
+// whose spec could be decoded is audited along with its outcome.
+func (s *HTTPServer) volumeAttach(resp http.ResponseWriter, req *http.Request, name string) (out interface{}, err error) {
+	if req.Method != "PUT" && req.Method != "POST" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+
+	var args api.AttachRequest
+	if err := decodeBody(req, &args); err != nil {
+		return nil, CodedError(400, err.Error())
+	}
+
+	defer func() {
+		s.auditRequest(req, audit.OpVolumeAttach, name, &args, err)
+	}()
+
+	return s.attachVolume(req, name, &args)
+}
+
+// volumeDetach detaches the volume from the node of the request. Every
+// request whose spec could be decoded is audited along with its outcome.
+func (s *HTTPServer) volumeDetach(resp http.ResponseWriter, req *http.Request, name string) (out interface{}, err error) {
+	if req.Method != "PUT" && req.Method != "POST" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+
+	var args api.DetachRequest
+	if err := decodeBody(req, &args); err != nil {
+		return nil, CodedError(400, err.Error())
+	}
+
+	defer func() {
+		s.auditRequest(req, audit.OpVolumeDetach, name, &args, err)
+	}()
+
+	return s.detachVolume(req, name, &args)
+}
+
+// volumeAttachments returns the attachments & the fenced nodes of the volume
+func (s *HTTPServer) volumeAttachments(resp http.ResponseWriter, req *http.Request, name string) (interface{}, error) {
+	if req.Method != "GET" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+
+	if err := s.blockingQuery(resp, req, s.maya.volumeIndex); err != nil {
+		return nil, err
+	}
+
+	return s.maya.attachmentsOf(name)
+}
+
+// attachVolume attaches the named volume to the node. The volume is shared
+// by the nodes only if every one of them has read-only access. A node that
+// was fenced off the volume can not attach it till an admin lifts the fence.
+// The other nodes attach a volume that has fenced nodes only via the admin
+// token. An attach from a node that is attached already changes its access
+// mode & needs the detach token of its attachment, else the admin token.
+// The detach token of the attachment is returned along with the attachments.
+// It is kept in the state as a hash only.
+func (s *HTTPServer) attachVolume(req *http.Request, name string, args *api.AttachRequest) (*api.VolumeAttachments, error) {
+	nodeID, mode := args.NodeID, args.AccessMode
+	if nodeID == "" {
+		return nil, CodedError(400, "Node id is missing")
+	}
+	if strings.Contains(nodeID, ",") {
+		return nil, CodedError(400, fmt.Sprintf("Invalid node id '%s'", nodeID))
+	}
+
+	switch mode {
+	case "":
+		mode = api.AccessModeReadWrite
+	case api.AccessModeReadWrite, api.AccessModeReadOnly:
+	default:
+		return nil, CodedError(400, fmt.Sprintf("Invalid access mode '%s'. Expected %s or %s", mode, api.AccessModeReadWrite, api.AccessModeReadOnly))
+	}
+
+	// The volume must exist
+	if _, err := s.readVolume(req, name); err != nil {
+		return nil, err
+	}
+
+	ms := s.maya
+	ms.stateLock.Lock()
+	defer ms.stateLock.Unlock()
+
+	va, err := ms.attachmentsOf(name)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range va.Fenced {
+		if f.NodeID == nodeID {
+			return nil, CodedError(409, fmt.Sprintf("Node '%s' is fenced off VSM '%s' since %s. The fence must be lifted by an admin before attaching again", nodeID, name, f.FencedAt.UTC().Format(time.RFC3339)))
+		}
+	}
+
+	admin := s.adminAuthorized(req)
+	if len(va.Fenced) != 0 && !admin {
+		return nil, CodedError(403, fmt.Sprintf("VSM '%s' has fenced nodes. Attaching it needs the admin token till the fences are lifted", name))
+	}
+
+	tokens, err := ms.detachTokensOf(name)
+	if err != nil {
+		return nil, err
+	}
+
+	attachment := api.Attachment{
+		NodeID:     nodeID,
+		AccessMode: mode,
+		Device:     args.Device,
+		AttachTime: time.Now().UTC(),
+	}
+
+	// The detach token is retained on a repeated attach that presents it
+	token := args.Token
+	repeated := false
+	var attachments []api.Attachment
+	for _, a := range va.Attachments {
+		if a.NodeID == nodeID {
+			repeated = true
+			if !detachTokenMatches(tokens[nodeID], token) {
+				if !admin {
+					return nil, CodedError(403, fmt.Sprintf("VSM '%s' is attached to node '%s' already. A repeated attach needs the detach token of the attachment", name, nodeID))
+				}
+				token = ""
+			}
+
+			// The time of the attachment is retained on a repeated attach
+			if a.AccessMode == mode {
+				attachment.AttachTime = a.AttachTime
+			}
+			continue
+		}
+		if a.AccessMode == api.AccessModeReadWrite || mode == api.AccessModeReadWrite {
+			return nil, CodedError(409, fmt.Sprintf("VSM '%s' is attached %s to node '%s'", name, a.AccessMode, a.NodeID))
+		}
+		attachments = append(attachments, a)
+	}
+	va.Attachments = append(attachments, attachment)
+
+	if !repeated || token == "" {
+		if token, err = newDetachToken(); err != nil {
+			return nil, err
+		}
+		tokens[nodeID] = hashDetachToken(token)
+		if err := ms.putDetachTokens(name, tokens); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ms.putAttachments(va); err != nil {
+		return nil, err
+	}
+
+	s.requestLogger(req).With("volume", name).Printf("[INFO] volume: Attached VSM to node '%s' %s", nodeID, mode)
+
+	va.DetachToken = token
+	return va, nil
+}
+
+// detachVolume detaches the named volume from the node. A normal detach
+// needs the detach token of the attachment, else the admin token. A forced
+// detach needs the admin token & fences the node off the volume. The fence
+// is lifted only by an admin via an unfence. A detach from a node that is
+// not attached is a no-op. The fence is enforced by maya api server while
+// attaching the volume only. The target is not told of it i.e. the node is
+// not cut off the target. Hence no orchestrator is called here & the state
+// lock is held only to update the state.
+func (s *HTTPServer) detachVolume(req *http.Request, name string, args *api.DetachRequest) (*api.VolumeAttachments, error) {
+	nodeID, force, unfence := args.NodeID, args.Force, args.Unfence
+	if nodeID == "" {
+		return nil, CodedError(400, "Node id is missing")
+	}
+	if force && unfence {
+		return nil, CodedError(400, "A forced detach can not lift the fence of the node")
+	}
+
+	admin := s.adminAuthorized(req)
+	switch {
+	case unfence && !admin:
+		return nil, CodedError(403, fmt.Sprintf("Lifting the fence of node '%s' needs the admin token", nodeID))
+	case force && !admin:
+		return nil, CodedError(403, fmt.Sprintf("Detaching VSM '%s' forcibly needs the admin token", name))
+	}
+
+	ms := s.maya
+	ms.stateLock.Lock()
+	defer ms.stateLock.Unlock()
+
+	va, err := ms.attachmentsOf(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := ms.detachTokensOf(name)
+	if err != nil {
+		return nil, err
+	}
+
+	detached := false
+	attachments := []api.Attachment{}
+	for _, a := range va.Attachments {
+		if a.NodeID == nodeID {
+			detached = true
+			continue
+		}
+		attachments = append(attachments, a)
+	}
+	va.Attachments = attachments
+
+	if detached && !admin && !detachTokenMatches(tokens[nodeID], args.Token) {
+		return nil, CodedError(403, fmt.Sprintf("VSM '%s' is detached normally from node '%s' only via the detach token of the attachment", name, nodeID))
+	}
+
+	// The fence of the node is replaced by a forced detach & is dropped by
+	// an unfence
+	fenced := va.Fenced
+	lifted := false
+	if unfence || (force && detached) {
+		fenced = nil
+		for _, f := range va.Fenced {
+			if f.NodeID != nodeID {
+				fenced = append(fenced, f)
+			}
+		}
+		lifted = unfence && len(fenced) != len(va.Fenced)
+	}
+	if force && detached {
+		fenced = append(fenced, api.Fence{NodeID: nodeID, FencedAt: time.Now().UTC()})
+	}
+	va.Fenced = fenced
+
+	if !detached && !lifted {
+		return va, nil
+	}
+
+	if detached {
+		delete(tokens, nodeID)
+		if err := ms.putDetachTokens(name, tokens); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ms.putAttachments(va); err != nil {
+		return nil, err
+	}
+
+	logger := s.requestLogger(req).With("volume", name)
+	switch {
+	case force && detached:
+		logger.Printf("[WARN] volume: Detached VSM from node '%s' forcibly. The node can not attach it again till its fence is lifted, but is not cut off the target", nodeID)
+	case detached:
+		logger.Printf("[INFO] volume: Detached VSM from node '%s'", nodeID)
+	}
+	if lifted {
+		logger.Printf("[INFO] volume: Lifted the fence of node '%s'", nodeID)
+	}
+
+	return va, nil
+}
+
+// attachmentsOf returns the attachments of the named volume as per the
+// state
+func (ms *MayaApiServer) attachmentsOf(name string) (*api.VolumeAttachments, error) {
+	va := &api.VolumeAttachments{}
+	if _, err := ms.state.Get(attachmentsBucket, name, va); err != nil {
+		return nil, err
+	}
+
+	va.Volume = name
+	if va.Attachments == nil {
+		va.Attachments = []api.Attachment{}
+	}
+	return va, nil
+}
+
+// putAttachments saves the attachments of the volume in the state. The
+// volume is removed from the state if it has neither attachments nor fenced
+// nodes.
+func (ms *MayaApiServer) putAttachments(va *api.VolumeAttachments) error {
+	var err error
+	if len(va.Attachments) == 0 && len(va.Fenced) == 0 {
+		_, err = ms.state.Delete(attachmentsBucket, va.Volume)
+	} else {
+		err = ms.state.Put(attachmentsBucket, va.Volume, va)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Release the blocking queries of the volumes
+	ms.volumeIndex.bump()
+
+	return nil
+}
+
+// detachTokensOf returns the hashes of the detach tokens of the attachments
+// of the named volume by their nodes
+func (ms *MayaApiServer) detachTokensOf(name string) (map[string]string, error) {
+	tokens := map[string]string{}
+	if _, err := ms.state.Get(detachTokensBucket, name, &tokens); err != nil {
+		return nil, err
+	}
+	if tokens == nil {
+		tokens = map[string]string{}
+	}
+	return tokens, nil
+}
+
+// putDetachTokens saves the hashes of the detach tokens of the named volume
+// in the state. The volume is removed from the state if it has no tokens.
+func (ms *MayaApiServer) putDetachTokens(name string, tokens map[string]string) error {
+	if len(tokens) == 0 {
+		_, err := ms.state.Delete(detachTokensBucket, name)
+		return err
+	}
+	return ms.state.Put(detachTokensBucket, name, tokens)
+}
+
+// newDetachToken returns a random detach token
+func newDetachToken() (string, error) {
+	b := make([]byte, detachTokenLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashDetachToken returns the hash of the detach token that is kept in the
+// state
+func hashDetachToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// detachTokenMatches verifies the detach token against the hash. An empty
+// token matches no hash.
+func detachTokenMatches(hash, token string) bool {
+	if hash == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashDetachToken(token)), []byte(hash)) == 1
+}
+
+// annotateAttachments sets the attachments of the volume as its annotations
+func (ms *MayaApiServer) annotateAttachments(pv *v1.PersistentVolume) error {
+	va, err := ms.attachmentsOf(pv.Name)
+	if err != nil {
+		return err
+	}
+	if len(va.Attachments) == 0 {
+		delete(pv.Annotations, string(api.AttachedNodesAPILbl))
+		delete(pv.Annotations, string(api.AccessModesAPILbl))
+		delete(pv.Annotations, string(api.AttachTimesAPILbl))
+		return nil
+	}
+
+	var nodes, modes, times []string
+	for _, a := range va.Attachments {
+		nodes = append(nodes, a.NodeID)
+		modes = append(modes, a.AccessMode)
+		times = append(times, a.AttachTime.UTC().Format(time.RFC3339))
+	}
+
+	if pv.Annotations == nil {
+		pv.Annotations = map[string]string{}
+	}
+	pv.Annotations[string(api.AttachedNodesAPILbl)] = strings.Join(nodes, ",")
+	pv.Annotations[string(api.AccessModesAPILbl)] = strings.Join(modes, ",")
+	pv.Annotations[string(api.AttachTimesAPILbl)] = strings.Join(times, ",")
+
+	return nil
+}
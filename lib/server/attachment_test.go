@@ -0,0 +1,251 @@
+package server
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/openebs/maya/types/v1"
+	"github.com/openebs/mayaserver/lib/api"
+	"github.com/openebs/mayaserver/lib/audit"
+	"github.com/openebs/mayaserver/lib/config"
+	"github.com/openebs/mayaserver/lib/state"
+)
+
+// tokenClient returns a client of the test server that is authorized by
+// the token
+func tokenClient(t *testing.T, s *TestServer, token string) *api.Volumes {
+	client, err := api.NewClient(&api.Config{
+		Address: "http://" + s.Server.addr,
+		Token:   token,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return client.Volumes()
+}
+
+func TestVolumeAttachments(t *testing.T) {
+	s, client, cleanup := makeAPIClientTestServerWithConfig(t, func(mc *config.MayaConfig) {
+		mc.AdminToken = testAdminToken
+	})
+	defer cleanup()
+
+	volumes := client.Volumes()
+	admin := tokenClient(t, s, testAdminToken)
+
+	pvc := &v1.PersistentVolumeClaim{}
+	pvc.Name = "vol1"
+	if _, err := volumes.Create(pvc, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	attach := func(c *api.Volumes, node, mode, token string) (*api.VolumeAttachments, error) {
+		return c.Attach("vol1", &api.AttachRequest{NodeID: node, AccessMode: mode, Token: token}, nil)
+	}
+	detach := func(c *api.Volumes, args *api.DetachRequest) (*api.VolumeAttachments, error) {
+		return c.Detach("vol1", args, nil)
+	}
+	conflict := func(node, mode string) {
+		if _, err := attach(admin, node, mode, ""); api.KindOf(err) != api.ErrorKindConflict {
+			t.Fatalf("expected a conflict attaching %s %s, got: %v", node, mode, err)
+		}
+	}
+	unauthorized := func(err error) {
+		if api.KindOf(err) != api.ErrorKindUnauthorized {
+			t.Fatalf("expected unauthorized, got: %v", err)
+		}
+	}
+
+	va, err := attach(volumes, "node1", "", "")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(va.Attachments) != 1 || va.Attachments[0].AccessMode != api.AccessModeReadWrite || va.DetachToken == "" {
+		t.Fatalf("bad attachments: %#v", va)
+	}
+	token1 := va.DetachToken
+
+	// A read-write volume is not shared
+	conflict("node2", api.AccessModeReadWrite)
+	conflict("node2", api.AccessModeReadOnly)
+
+	// A repeated attach needs the detach token of the attachment
+	_, err = attach(volumes, "node1", api.AccessModeReadWrite, "")
+	unauthorized(err)
+	if va, err = attach(volumes, "node1", api.AccessModeReadWrite, token1); err != nil || va.DetachToken != token1 {
+		t.Fatalf("bad attachments: %#v %v", va, err)
+	}
+
+	// The detach token is not kept in the state as is
+	b, err := ioutil.ReadFile(s.Maya.state.Path())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if strings.Contains(string(b), token1) {
+		t.Fatalf("expected no detach token in the state: %s", b)
+	}
+
+	// The attachments are part of the details of the volume
+	pv, _, err := volumes.Info("vol1", nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	attachments := api.VolumeAttachmentsOf(pv.Annotations)
+	if len(attachments) != 1 || attachments[0].NodeID != "node1" ||
+		attachments[0].AccessMode != api.AccessModeReadWrite || attachments[0].AttachTime.IsZero() {
+		t.Fatalf("bad annotations: %#v", pv.Annotations)
+	}
+
+	// An attached volume is not deleted
+	if err := volumes.Delete("vol1", nil); api.KindOf(err) != api.ErrorKindConflict {
+		t.Fatalf("expected a conflict, got: %v", err)
+	}
+
+	// A normal detach needs the detach token
+	for _, token := range []string{"", "bad"} {
+		_, err := detach(volumes, &api.DetachRequest{NodeID: "node1", Token: token})
+		unauthorized(err)
+	}
+
+	// A forced detach needs the admin token
+	_, err = detach(volumes, &api.DetachRequest{NodeID: "node1", Force: true, Token: token1})
+	unauthorized(err)
+
+	// A forced detach fences the node off the volume
+	va, err = detach(admin, &api.DetachRequest{NodeID: "node1", Force: true})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(va.Attachments) != 0 || len(va.Fenced) != 1 || va.Fenced[0].NodeID != "node1" {
+		t.Fatalf("bad attachments: %#v", va)
+	}
+	conflict("node1", api.AccessModeReadWrite)
+
+	// A volume that has fenced nodes is attached via the admin token only
+	_, err = attach(volumes, "node2", api.AccessModeReadWrite, "")
+	unauthorized(err)
+	va, err = attach(admin, "node2", api.AccessModeReadWrite, "")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	token2 := va.DetachToken
+
+	// A normal detach from the fenced node does not lift its fence
+	va, err = detach(volumes, &api.DetachRequest{NodeID: "node1", Token: token1})
+	if err != nil || len(va.Fenced) != 1 {
+		t.Fatalf("bad attachments: %#v %v", va, err)
+	}
+	conflict("node1", api.AccessModeReadOnly)
+
+	// Only an admin lifts the fence
+	_, err = detach(volumes, &api.DetachRequest{NodeID: "node1", Unfence: true, Token: token1})
+	unauthorized(err)
+	if _, err := detach(admin, &api.DetachRequest{NodeID: "node1", Unfence: true}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	va, _, err = volumes.Attachments("vol1", nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(va.Attachments) != 1 || va.Attachments[0].NodeID != "node2" || len(va.Fenced) != 0 || va.DetachToken != "" {
+		t.Fatalf("bad attachments: %#v", va)
+	}
+
+	// The detach token of a node does not detach another node
+	_, err = detach(volumes, &api.DetachRequest{NodeID: "node2", Token: token1})
+	unauthorized(err)
+	if _, err := detach(volumes, &api.DetachRequest{NodeID: "node2", Token: token2}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// A read-only volume is shared by the read-only nodes
+	tokens := map[string]string{}
+	for _, node := range []string{"node1", "node2"} {
+		va, err := attach(volumes, node, api.AccessModeReadOnly, "")
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		tokens[node] = va.DetachToken
+	}
+	if tokens["node1"] == tokens["node2"] {
+		t.Fatalf("expected the detach tokens to differ: %v", tokens)
+	}
+	conflict("node3", api.AccessModeReadWrite)
+
+	// The attachments survive a restart of maya api server
+	store, err := state.Open(s.Maya.state.Path())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for _, bucket := range []string{attachmentsBucket, detachTokensBucket} {
+		if keys := store.Keys(bucket); len(keys) != 1 || keys[0] != "vol1" {
+			t.Fatalf("bad state of %s: %v", bucket, keys)
+		}
+	}
+
+	for node, token := range tokens {
+		if _, err := detach(volumes, &api.DetachRequest{NodeID: node, Token: token}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if err := volumes.Delete("vol1", nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for _, bucket := range []string{attachmentsBucket, detachTokensBucket} {
+		if keys := s.Maya.state.Keys(bucket); len(keys) != 0 {
+			t.Fatalf("bad state of %s: %v", bucket, keys)
+		}
+	}
+
+	// The attaches & detaches are audited
+	records, err := s.Maya.audit.Query(audit.Query{Operation: audit.OpVolumeAttach})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(records) == 0 {
+		t.Fatalf("expected the attaches to be audited")
+	}
+}
+
+func TestVolumeAttachments_Invalid(t *testing.T) {
+	_, client, cleanup := makeAPIClientTestServer(t)
+	defer cleanup()
+
+	volumes := client.Volumes()
+
+	// The volume must exist
+	_, err := volumes.Attach("missing", &api.AttachRequest{NodeID: "node1"}, nil)
+	if api.KindOf(err) != api.ErrorKindNotFound {
+		t.Fatalf("expected not found, got: %v", err)
+	}
+
+	pvc := &v1.PersistentVolumeClaim{}
+	pvc.Name = "vol1"
+	if _, err := volumes.Create(pvc, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	cases := []*api.AttachRequest{
+		{},
+		{NodeID: "node1,node2"},
+		{NodeID: "node1", AccessMode: "read-many"},
+	}
+	for _, c := range cases {
+		if _, err := volumes.Attach("vol1", c, nil); api.KindOf(err) != api.ErrorKindInvalid {
+			t.Fatalf("expected invalid for %#v, got: %v", c, err)
+		}
+	}
+
+	for _, c := range []*api.DetachRequest{{}, {NodeID: "node1", Force: true, Unfence: true}} {
+		if _, err := volumes.Detach("vol1", c, nil); api.KindOf(err) != api.ErrorKindInvalid {
+			t.Fatalf("expected invalid for %#v, got: %v", c, err)
+		}
+	}
+
+	// A detach of a node that is not attached is a no-op
+	va, err := volumes.Detach("vol1", &api.DetachRequest{NodeID: "node1"}, nil)
+	if err != nil || len(va.Attachments) != 0 || len(va.Fenced) != 0 {
+		t.Fatalf("bad attachments: %#v %v", va, err)
+	}
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/openebs/mayaserver/lib/audit"
+	"github.com/openebs/mayaserver/lib/config"
+	"github.com/openebs/mayaserver/lib/loghelper"
+)
+
+// Outcomes of an audited operation in addition to the outcome classes of the
+// orchestrator operations
+const (
+	outcomeInvalid  = "invalid"
+	outcomeRejected = "rejected"
+)
+
+// Principals of the audited requests i.e. the scope whose token the request
+// was authorized by
+const (
+	principalAdmin     = "admin"
+	principalCHAP      = "chap"
+	principalAnonymous = "-"
+)
+
+// openAuditLog opens the audit log within the data directory. Auditing is
+// disabled if the data directory is not set. A broken chain is logged rather
+// than failing the start as the log is still appended to.
+func openAuditLog(mc *config.MayaConfig, logger *loghelper.Logger) (*audit.Log, error) {
+	if mc.DataDir == "" {
+		return nil, nil
+	}
+
+	keyFile := mc.AuditKeyFile
+	if keyFile == "" {
+		keyFile = filepath.Join(mc.DataDir, audit.KeyFileName)
+		logger.Printf("[WARN] audit: Key of the audit log is kept in the data directory. " +
+			"Set audit_key_file to a path outside it to detect the records modified by those who can write the data directory.")
+	}
+
+	key, err := audit.LoadKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := audit.Open(filepath.Join(mc.DataDir, audit.FileName), key)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := audit.VerifyFile(a.Path(), key); err != nil {
+		logger.Printf("[ERR] audit: Chain of the audit log '%s' is broken: %v", a.Path(), err)
+	}
+	return a, nil
+}
+
+// Audit appends the record to the audit log if auditing is enabled. A
+// failure to audit is logged as the operation has happened already.
+func (ms *MayaApiServer) Audit(r *audit.Record) {
+	if ms.audit == nil {
+		return
+	}
+
+	if err := ms.audit.Append(r); err != nil {
+		ms.log.With("request_id", r.RequestID, "operation", r.Operation).Printf("[ERR] audit: Failed to audit: %v", err)
+		return
+	}
+
+	// Release the blocking queries of the audit log
+	ms.auditIndex.bump()
+}
+
+// AuditSignal audits the operation invoked via a signal e.g. a reload on
+// SIGHUP. The signal is audited as the identity of the caller.
+func (ms *MayaApiServer) AuditSignal(signal, op string, spec interface{}, err error) {
+	r := newAuditRecord(op, "", spec, err)
+	r.Identity = signal
+
+	ms.Audit(r)
+}
+
+// auditRequest audits the operation invoked by the request
+func (s *HTTPServer) auditRequest(req *http.Request, op, volume string, spec interface{}, err error) {
+	r := newAuditRecord(op, volume, spec, err)
+	r.Identity = s.requestPrincipal(req)
+	r.SourceIP = remoteHost(req)
+	r.RequestID = requestIDOf(req)
+
+	s.maya.Audit(r)
+}
+
+// requestPrincipal returns the principal whose token authorizes the request.
+// The names the client claims e.g. the Basic auth username are not verified
+// & hence are not audited.
+func (s *HTTPServer) requestPrincipal(req *http.Request) string {
+	switch {
+	case s.adminAuthorized(req):
+		return principalAdmin
+	case s.chapAuthorized(req):
+		return principalCHAP
+	default:
+		return principalAnonymous
+	}
+}
+
+// newAuditRecord returns the audit record of the operation. The spec is
+// audited with its secrets redacted.
+func newAuditRecord(op, volume string, spec interface{}, err error) *audit.Record {
+	r := &audit.Record{
+		Operation: op,
+		Volume:    volume,
+		Spec:      audit.Redact(spec),
+		Outcome:   auditOutcome(err),
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// auditOutcome classifies the error of an audited operation. The errors of
+// the orchestrators are classified the same way as in the metrics.
+func auditOutcome(err error) string {
+	cErr, ok := err.(HTTPCodedError)
+	if !ok {
+		return classifyOutcome(err)
+	}
+
+	switch code := cErr.Code(); {
+	case code == 404:
+		return outcomeNotFound
+	case code == 400:
+		return outcomeInvalid
+	case code >= 400 && code < 500:
+		return outcomeRejected
+	default:
+		return outcomeError
+	}
+}
+
+// AuditRequest is a http handler implementation. It queries the audit log.
+// A blocking query returns once a record is appended. Only the callers of the
+// admin scope may query the audit log.
+func (s *HTTPServer) AuditRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if req.Method != "GET" {
+		return nil, CodedError(405, ErrGetMethodRequired)
+	}
+
+	if err := s.requireAdminRequest(req); err != nil {
+		return nil, err
+	}
+
+	if s.maya.audit == nil {
+		return nil, CodedError(501, "Audit log is not enabled as data_dir is not set")
+	}
+
+	q, err := parseAuditQuery(req)
+	if err != nil {
+		return nil, CodedError(400, err.Error())
+	}
+
+	if err := s.blockingQuery(resp, req, s.maya.auditIndex); err != nil {
+		return nil, err
+	}
+
+	return s.maya.audit.Query(q)
+}
+
+// parseAuditQuery parses the filters of an audit query. The times are
+// expected in RFC 3339 format.
+func parseAuditQuery(req *http.Request) (audit.Query, error) {
+	params := req.URL.Query()
+
+	q := audit.Query{
+		Volume:    params.Get("volume"),
+		Operation: params.Get("operation"),
+	}
+
+	for name, t := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		v := params.Get(name)
+		if v == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return q, fmt.Errorf("Invalid %s: %s. Expected an RFC 3339 time", name, v)
+		}
+		*t = parsed
+	}
+
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return q, fmt.Errorf("Invalid limit: %s", v)
+		}
+		q.Limit = limit
+	}
+
+	return q, nil
+}
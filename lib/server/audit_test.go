@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openebs/mayaserver/lib/audit"
+	"github.com/openebs/mayaserver/lib/config"
+	"github.com/openebs/mayaserver/lib/loghelper"
+)
+
+func TestAuditRequest(t *testing.T) {
+	s := makeHTTPTestServer(t, func(mc *config.MayaConfig) {
+		mc.AdminToken = testAdminToken
+	})
+	defer s.Cleanup()
+
+	filter, err := loghelper.NewComponentFilter("INFO", ioutil.Discard)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	s.Maya.SetLogLevels(filter)
+
+	// A volume spec that is invalid is audited with its secrets redacted. The
+	// Basic auth username is not verified & hence is not the identity.
+	body := bytes.NewBufferString(`{"metadata": {"labels": {"chap-password": "hunter2"}}}`)
+	req, _ := http.NewRequest("POST", "/latest/volumes/", body)
+	req.SetBasicAuth("admin", "")
+	req.RemoteAddr = "10.0.0.1:1234"
+	req, id := withRequestID(httptest.NewRecorder(), req)
+	if _, err := s.Server.VSMSpecificRequest(httptest.NewRecorder(), req); err == nil {
+		t.Fatalf("expected error for a volume without a name")
+	}
+
+	body = bytes.NewBufferString(`{"component": "http", "level": "DEBUG"}`)
+	req, _ = http.NewRequest("PUT", "/v1/agent/log-level", body)
+	if _, err := s.Server.AgentSpecificRequest(httptest.NewRecorder(), asAdmin(req)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Only the admin may query the audit log
+	req, _ = http.NewRequest("GET", "/v1/audit", nil)
+	if _, err := s.Server.AuditRequest(httptest.NewRecorder(), req); err == nil {
+		t.Fatalf("expected error without the admin token")
+	} else if cErr, ok := err.(HTTPCodedError); !ok || cErr.Code() != 403 {
+		t.Fatalf("expected 403, got: %v", err)
+	}
+
+	// Every record is returned without any filter
+	req, _ = http.NewRequest("GET", "/v1/audit", nil)
+	obj, err := s.Server.AuditRequest(httptest.NewRecorder(), asAdmin(req))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	records := obj.([]*audit.Record)
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got: %d", len(records))
+	}
+
+	r := records[0]
+	switch {
+	case r.Operation != audit.OpVolumeCreate, r.Outcome != outcomeInvalid, r.Identity != principalAnonymous,
+		r.SourceIP != "10.0.0.1", r.RequestID != id:
+		t.Fatalf("bad record: %#v", r)
+	case strings.Contains(string(r.Spec), "hunter2") || !strings.Contains(string(r.Spec), audit.Redacted):
+		t.Fatalf("expected the secret to be redacted, got: %s", r.Spec)
+	}
+
+	// The identity is the principal whose token authorized the request
+	if r := records[1]; r.Operation != audit.OpLogLevelSet || r.Outcome != outcomeSuccess || r.Identity != principalAdmin {
+		t.Fatalf("bad record: %#v", r)
+	}
+
+	// The records are filtered by the operation & time
+	req, _ = http.NewRequest("GET", "/v1/audit?operation=log_level.set&since="+r.Time.Format("2006-01-02T15:04:05Z"), nil)
+	obj, err = s.Server.AuditRequest(httptest.NewRecorder(), asAdmin(req))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if records := obj.([]*audit.Record); len(records) != 1 || records[0].Seq != 2 {
+		t.Fatalf("expected the log level record, got: %v", records)
+	}
+
+	req, _ = http.NewRequest("GET", "/v1/audit?since=yesterday", nil)
+	if _, err := s.Server.AuditRequest(httptest.NewRecorder(), asAdmin(req)); err == nil {
+		t.Fatalf("expected error for invalid time")
+	} else if cErr, ok := err.(HTTPCodedError); !ok || cErr.Code() != 400 {
+		t.Fatalf("expected 400, got: %v", err)
+	}
+
+	// The chain of the audit log is intact
+	key, err := audit.ReadKey(filepath.Join(s.Dir, audit.KeyFileName))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if n, err := audit.VerifyFile(filepath.Join(s.Dir, audit.FileName), key); err != nil || n != 2 {
+		t.Fatalf("expected 2 verified records, got: %d %v", n, err)
+	}
+}
+
+func TestAuditRequest_Disabled(t *testing.T) {
+	s := makeHTTPTestServer(t, func(mc *config.MayaConfig) {
+		mc.DataDir = ""
+		mc.AdminToken = testAdminToken
+	})
+	defer s.Cleanup()
+
+	req, _ := http.NewRequest("GET", "/v1/audit", nil)
+	if _, err := s.Server.AuditRequest(httptest.NewRecorder(), asAdmin(req)); err == nil {
+		t.Fatalf("expected error without a data dir")
+	} else if cErr, ok := err.(HTTPCodedError); !ok || cErr.Code() != 501 {
+		t.Fatalf("expected 501, got: %v", err)
+	}
+}
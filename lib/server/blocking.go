@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultBlockingWait is the duration a blocking query waits if the
+	// query does not set its own
+	defaultBlockingWait = 5 * time.Minute
+
+	// maxBlockingWait is the max duration a blocking query is allowed to
+	// wait
+	maxBlockingWait = 10 * time.Minute
+)
+
+// watchIndex is the index of a set of objects e.g. the volumes. The index
+// moves forward whenever the objects are changed via maya api server. The
+// blocking queries wait for the index to move past the index they have
+// seen.
+//
+// The changes made directly via the orchestrator e.g. a pod that fails are
+// not tracked. Hence a blocking query may see such changes only along with a
+// change made via maya api server or once it times out.
+type watchIndex struct {
+	l     sync.Mutex
+	index uint64
+
+	// changed is closed & replaced whenever the index moves forward
+	changed chan struct{}
+}
+
+// newWatchIndex returns a watch index that starts from 1 as 0 is not a
+// valid wait index
+func newWatchIndex() *watchIndex {
+	return &watchIndex{index: 1, changed: make(chan struct{})}
+}
+
+// current returns the index along with a channel that is closed once the
+// index moves forward
+func (w *watchIndex) current() (uint64, <-chan struct{}) {
+	w.l.Lock()
+	defer w.l.Unlock()
+
+	return w.index, w.changed
+}
+
+// bump moves the index forward by 1
+func (w *watchIndex) bump() {
+	w.l.Lock()
+	defer w.l.Unlock()
+
+	w.index++
+	close(w.changed)
+	w.changed = make(chan struct{})
+}
+
+// blockingQuery blocks the request till the index moves past the ?index of
+// the request or the ?wait elapses. The index is sent in the X-Maya-Index
+// header. A request without ?index is not blocked. A request that is
+// cancelled or is in flight during a shutdown returns with the current index.
+func (s *HTTPServer) blockingQuery(resp http.ResponseWriter, req *http.Request, w *watchIndex) error {
+	minIndex, wait, err := parseWait(req)
+	if err != nil {
+		return CodedError(400, err.Error())
+	}
+
+	var timeout <-chan time.Time
+	if minIndex > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		index, changed := w.current()
+		if index > minIndex {
+			setIndex(resp, index)
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-timeout:
+			setIndex(resp, index)
+			return nil
+		case <-s.stopCh:
+			setIndex(resp, index)
+			return nil
+		case <-req.Context().Done():
+			return req.Context().Err()
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWatchIndex(t *testing.T) {
+	w := newWatchIndex()
+
+	index, changed := w.current()
+	if index != 1 {
+		t.Fatalf("expected the index to start from 1, got: %d", index)
+	}
+
+	w.bump()
+	select {
+	case <-changed:
+	default:
+		t.Fatalf("expected the change to be notified")
+	}
+	if index, _ := w.current(); index != 2 {
+		t.Fatalf("expected index 2, got: %d", index)
+	}
+}
+
+func TestParseWait(t *testing.T) {
+	cases := []struct {
+		query string
+		index uint64
+		wait  time.Duration
+		err   bool
+	}{
+		{"", 0, defaultBlockingWait, false},
+		{"index=12&wait=30s", 12, 30 * time.Second, false},
+		{"index=12&wait=1h", 12, maxBlockingWait, false},
+		{"index=abc", 0, 0, true},
+		{"wait=abc", 0, 0, true},
+		{"wait=-1s", 0, 0, true},
+	}
+
+	for _, tc := range cases {
+		req, _ := http.NewRequest("GET", "/latest/volumes/?"+tc.query, nil)
+		index, wait, err := parseWait(req)
+		if (err != nil) != tc.err || index != tc.index || wait != tc.wait {
+			t.Fatalf("%s: got: %d %v %v", tc.query, index, wait, err)
+		}
+	}
+}
+
+func TestBlockingQuery(t *testing.T) {
+	s := makeHTTPTestServer(t, nil)
+	defer s.Cleanup()
+
+	w := newWatchIndex()
+
+	// A query without an index is not blocked
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/latest/volumes/", nil)
+	if err := s.Server.blockingQuery(resp, req, w); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if index := getIndex(t, resp); index != 1 {
+		t.Fatalf("expected index 1, got: %d", index)
+	}
+
+	// A query with the current index is blocked till the index moves
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		w.bump()
+	}()
+	resp = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/latest/volumes/?index=1&wait=5s", nil)
+	if err := s.Server.blockingQuery(resp, req, w); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if index := getIndex(t, resp); index != 2 {
+		t.Fatalf("expected index 2, got: %d", index)
+	}
+
+	// The blocked queries are released on shutdown
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req, _ := http.NewRequest("GET", "/latest/volumes/?index=2&wait=5s", nil)
+		s.Server.blockingQuery(httptest.NewRecorder(), req, w)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	s.Server.Shutdown()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the query to be released on shutdown")
+	}
+}
+
+func TestErrorKindHeader(t *testing.T) {
+	s := makeHTTPTestServer(t, nil)
+	defer s.Cleanup()
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/latest/volumes/info/", nil)
+	s.Server.wrap(RequestCounter, RequestDuration, s.Server.VSMSpecificRequest)(resp, req)
+
+	if resp.Code != 400 || resp.Header().Get("X-Maya-Error-Kind") != "invalid" {
+		t.Fatalf("expected an invalid request, got: %d %v", resp.Code, resp.Header())
+	}
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/openebs/maya/types/v1"
+	"github.com/openebs/mayaserver/lib/api"
+	"github.com/openebs/mayaserver/lib/audit"
+)
+
+const (
+	// chapBucket is the bucket of the state that has the sealed CHAP
+	// credentials of the volumes by their names
+	chapBucket = "chap"
+
+	// chapSecretLen is the length of the generated CHAP secrets. The iSCSI
+	// initiators expect secrets of 12 to 16 characters.
+	chapSecretLen = 16
+
+	// chapSecretChars are the characters of the generated CHAP secrets
+	chapSecretChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// chapModeOf returns the CHAP mode requested by the claim. CHAP is disabled
+// if the claim does not request it.
+func chapModeOf(pvc *v1.PersistentVolumeClaim) (string, error) {
+	mode := strings.TrimSpace(pvc.Labels[string(api.CHAPLbl)])
+	switch mode {
+	case "", api.CHAPModeNone:
+		return api.CHAPModeNone, nil
+	case api.CHAPModeOneWay, api.CHAPModeMutual:
+		return mode, nil
+	default:
+		return "", CodedError(400, fmt.Sprintf("Invalid %s '%s'. Expected %s, %s or %s",
+			api.CHAPLbl, mode, api.CHAPModeNone, api.CHAPModeOneWay, api.CHAPModeMutual))
+	}
+}
+
+// newCHAPCredentials generates the CHAP credentials of the named volume
+func newCHAPCredentials(name, mode string) (*api.CHAPCredentials, error) {
+	password, err := newCHAPSecret()
+	if err != nil {
+		return nil, err
+	}
+	creds := &api.CHAPCredentials{
+		Mode:     mode,
+		Username: name,
+		Password: password,
+	}
+
+	if mode == api.CHAPModeMutual {
+		if creds.MutualPassword, err = newCHAPSecret(); err != nil {
+			return nil, err
+		}
+		creds.MutualUsername = name + "-target"
+	}
+	return creds, nil
+}
+
+// chapCredentialsFor generates the CHAP credentials of the volume of the
+// claim. The credentials are kept in the sealed state of maya api server
+// only i.e. these are neither set in the claim nor passed to the orchestrator.
+// Hence CHAP is refused if the state is kept in memory only as the
+// credentials would be lost on restart. Nothing is generated if CHAP is
+// disabled.
+func (ms *MayaApiServer) chapCredentialsFor(pvc *v1.PersistentVolumeClaim, mode string) (*api.CHAPCredentials, error) {
+	if mode == api.CHAPModeNone {
+		return nil, nil
+	}
+
+	if ms.state.Path() == "" {
+		return nil, CodedError(501, fmt.Sprintf("CHAP is not supported for VSM '%s' as maya api server has no data_dir to keep the CHAP credentials in", pvc.Name))
+	}
+	return newCHAPCredentials(pvc.Name, mode)
+}
+
+func newCHAPSecret() (string, error) {
+	max := big.NewInt(int64(len(chapSecretChars)))
+
+	b := make([]byte, chapSecretLen)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = chapSecretChars[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// chapCredentialsOf returns the CHAP credentials of the named volume. It
+// returns nil if CHAP is disabled for the volume.
+func (ms *MayaApiServer) chapCredentialsOf(name string) (*api.CHAPCredentials, error) {
+	var sealed string
+	ok, err := ms.state.Get(chapBucket, name, &sealed)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	b, err := ms.cipher.Open(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the CHAP credentials of VSM '%s': %v", name, err)
+	}
+
+	creds := &api.CHAPCredentials{}
+	if err := json.Unmarshal(b, creds); err != nil {
+		return nil, fmt.Errorf("failed to read the CHAP credentials of VSM '%s': %v", name, err)
+	}
+	return creds, nil
+}
+
+// putCHAPCredentials seals the CHAP credentials of the named volume & saves
+// them in the state
+func (ms *MayaApiServer) putCHAPCredentials(name string, creds *api.CHAPCredentials) error {
+	b, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := ms.cipher.Seal(b)
+	if err != nil {
+		return fmt.Errorf("failed to seal the CHAP credentials of VSM '%s': %v", name, err)
+	}
+	return ms.state.Put(chapBucket, name, sealed)
+}
+
+// chapAuthorized verifies if the bearer token of the request is the CHAP
+// access token. No request is authorized if the CHAP access token is not set.
+func (s *HTTPServer) chapAuthorized(req *http.Request) bool {
+	return bearerAuthorized(req, s.maya.Config().CHAPAccessToken)
+}
+
+// volumeRotateCHAP replaces the CHAP credentials of the volume with new ones
+// of the same mode. The target details along with the new credentials are
+// returned. Every request is audited along with its outcome. The initiators
+// that watch the target details via blocking queries pick the new
+// credentials.
+func (s *HTTPServer) volumeRotateCHAP(resp http.ResponseWriter, req *http.Request, name string) (out interface{}, err error) {
+	if req.Method != "PUT" && req.Method != "POST" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+
+	defer func() {
+		s.auditRequest(req, audit.OpCHAPRotate, name, nil, err)
+	}()
+
+	if !s.chapAuthorized(req) {
+		return nil, CodedError(403, "Rotating the CHAP credentials needs the CHAP access token")
+	}
+
+	pv, err := s.readVolume(req, name)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := volumeTargetOf(pv)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := s.maya.rotateCHAPCredentials(name)
+	if err != nil {
+		return nil, err
+	}
+
+	s.requestLogger(req).With("volume", name).Printf("[INFO] volume: Rotated the CHAP credentials of VSM")
+
+	target.CHAPEnabled = true
+	target.CHAP = creds
+	return target, nil
+}
+
+// rotateCHAPCredentials generates new CHAP credentials of the named volume &
+// saves these in place of the current ones
+func (ms *MayaApiServer) rotateCHAPCredentials(name string) (*api.CHAPCredentials, error) {
+	ms.stateLock.Lock()
+	defer ms.stateLock.Unlock()
+
+	current, err := ms.chapCredentialsOf(name)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		return nil, CodedError(400, fmt.Sprintf("CHAP is not enabled for VSM '%s'", name))
+	}
+
+	creds, err := newCHAPCredentials(name, current.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ms.putCHAPCredentials(name, creds); err != nil {
+		return nil, err
+	}
+
+	// Release the blocking queries of the volumes
+	ms.volumeIndex.bump()
+
+	return creds, nil
+}
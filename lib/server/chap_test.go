@@ -0,0 +1,226 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openebs/maya/types/v1"
+	"github.com/openebs/mayaserver/lib/api"
+	"github.com/openebs/mayaserver/lib/config"
+	"github.com/openebs/mayaserver/lib/state"
+)
+
+const testCHAPAccessToken = "0123456789abcdef"
+
+func TestVolumeCHAP(t *testing.T) {
+	s, client, cleanup := makeAPIClientTestServerWithConfig(t, func(mc *config.MayaConfig) {
+		mc.CHAPAccessToken = testCHAPAccessToken
+	})
+	defer cleanup()
+
+	authorized, err := api.NewClient(&api.Config{
+		Address: "http://" + s.Server.addr,
+		Token:   testCHAPAccessToken,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pvc := &v1.PersistentVolumeClaim{}
+	pvc.Name = "vol1"
+	pvc.Labels = map[string]string{string(api.CHAPLbl): api.CHAPModeMutual}
+	if _, err := client.Volumes().Create(pvc, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	currentFakeOrchestrator.l.Lock()
+	currentFakeOrchestrator.volumes["vol1"].Annotations[string(v1.TargetPortalsAPILbl)] = "10.0.0.1:3260"
+	currentFakeOrchestrator.l.Unlock()
+
+	// The credentials are not released to the callers without the token
+	target, _, err := client.Volumes().Target("vol1", true, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !target.CHAPEnabled || target.CHAPRequired || target.CHAP != nil {
+		t.Fatalf("bad target: %#v", target)
+	}
+
+	target, _, err = authorized.Volumes().Target("vol1", true, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	creds := target.CHAP
+	if creds == nil || creds.Mode != api.CHAPModeMutual || len(creds.Password) != chapSecretLen ||
+		creds.MutualUsername == "" || len(creds.MutualPassword) != chapSecretLen {
+		t.Fatalf("bad credentials: %#v", creds)
+	}
+
+	// The target does not enforce the credentials, hence the initiators log
+	// in without these
+	if target.CHAPRequired || !reflect.DeepEqual(target.ISCSIAdm.Logins, [][]string{
+		{"-m", "node", "-T", target.IQN, "-p", "10.0.0.1:3260", "--login"},
+	}) {
+		t.Fatalf("bad target: %#v", target)
+	}
+
+	// The credentials are not passed to the orchestrator
+	currentFakeOrchestrator.l.Lock()
+	labels := currentFakeOrchestrator.claimLabels["vol1"]
+	currentFakeOrchestrator.l.Unlock()
+	for k, v := range labels {
+		if strings.Contains(v, creds.Password) || strings.Contains(v, creds.MutualPassword) {
+			t.Fatalf("expected no credentials in the labels, got: %s=%s", k, v)
+		}
+	}
+
+	// The credentials are sealed in the state
+	b, err := ioutil.ReadFile(s.Maya.state.Path())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if strings.Contains(string(b), creds.Password) || strings.Contains(string(b), creds.MutualPassword) {
+		t.Fatalf("expected the credentials to be sealed: %s", b)
+	}
+
+	// The credentials are rotated by the callers with the token only
+	if _, err := client.Volumes().RotateCHAP("vol1", nil); api.KindOf(err) != api.ErrorKindUnauthorized {
+		t.Fatalf("expected unauthorized, got: %v", err)
+	}
+	rotated, err := authorized.Volumes().RotateCHAP("vol1", nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if rotated.CHAP == nil || rotated.CHAP.Mode != api.CHAPModeMutual || rotated.CHAP.Password == creds.Password {
+		t.Fatalf("bad rotated credentials: %#v", rotated.CHAP)
+	}
+
+	target, _, err = authorized.Volumes().Target("vol1", false, nil)
+	if err != nil || target.CHAP == nil || *target.CHAP != *rotated.CHAP {
+		t.Fatalf("expected the rotated credentials, got: %#v %v", target, err)
+	}
+
+	// The credentials go along with the volume
+	if err := client.Volumes().Delete("vol1", nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if keys := s.Maya.state.Keys(chapBucket); len(keys) != 0 {
+		t.Fatalf("bad state: %v", keys)
+	}
+}
+
+func TestVolumeCHAP_NoDataDir(t *testing.T) {
+	s, client, cleanup := makeAPIClientTestServerWithConfig(t, func(mc *config.MayaConfig) {
+		mc.DataDir = ""
+	})
+	defer cleanup()
+
+	// CHAP is refused as the credentials would be lost on restart
+	pvc := &v1.PersistentVolumeClaim{}
+	pvc.Name = "vol1"
+	pvc.Labels = map[string]string{string(api.CHAPLbl): api.CHAPModeOneWay}
+	if _, err := client.Volumes().Create(pvc, nil); api.KindOf(err) != api.ErrorKindNotImplemented {
+		t.Fatalf("expected not implemented, got: %v", err)
+	}
+
+	currentFakeOrchestrator.l.Lock()
+	n := len(currentFakeOrchestrator.volumes)
+	currentFakeOrchestrator.l.Unlock()
+	if n != 0 {
+		t.Fatalf("expected no volume, got: %d", n)
+	}
+
+	pvc.Labels[string(api.CHAPLbl)] = api.CHAPModeNone
+	if _, err := client.Volumes().Create(pvc, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if keys := s.Maya.state.Keys(chapBucket); len(keys) != 0 {
+		t.Fatalf("bad state: %v", keys)
+	}
+}
+
+func TestVolumeCHAP_Disabled(t *testing.T) {
+	s, client, cleanup := makeAPIClientTestServer(t)
+	defer cleanup()
+
+	// The credentials are never released if there is no token
+	authorized, err := api.NewClient(&api.Config{
+		Address: "http://" + s.Server.addr,
+		Token:   testCHAPAccessToken,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pvc := &v1.PersistentVolumeClaim{}
+	pvc.Name = "vol1"
+	pvc.Labels = map[string]string{string(api.CHAPLbl): "kerberos"}
+	if _, err := client.Volumes().Create(pvc, nil); api.KindOf(err) != api.ErrorKindInvalid {
+		t.Fatalf("expected invalid, got: %v", err)
+	}
+
+	pvc.Labels[string(api.CHAPLbl)] = api.CHAPModeOneWay
+	if _, err := client.Volumes().Create(pvc, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pvc = &v1.PersistentVolumeClaim{}
+	pvc.Name = "vol2"
+	if _, err := client.Volumes().Create(pvc, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	currentFakeOrchestrator.l.Lock()
+	for _, pv := range currentFakeOrchestrator.volumes {
+		pv.Annotations[string(v1.TargetPortalsAPILbl)] = "10.0.0.1:3260"
+	}
+	currentFakeOrchestrator.l.Unlock()
+
+	target, _, err := authorized.Volumes().Target("vol1", false, nil)
+	if err != nil || !target.CHAPEnabled || target.CHAP != nil {
+		t.Fatalf("bad target: %#v %v", target, err)
+	}
+	if _, err := authorized.Volumes().RotateCHAP("vol1", nil); api.KindOf(err) != api.ErrorKindUnauthorized {
+		t.Fatalf("expected unauthorized, got: %v", err)
+	}
+
+	target, _, err = authorized.Volumes().Target("vol2", false, nil)
+	if err != nil || target.CHAPEnabled {
+		t.Fatalf("bad target: %#v %v", target, err)
+	}
+}
+
+func TestVolumeCHAP_StateKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mayaserver-keys")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyFile := filepath.Join(dir, "state.key")
+	s, client, cleanup := makeAPIClientTestServerWithConfig(t, func(mc *config.MayaConfig) {
+		mc.StateKeyFile = keyFile
+	})
+	defer cleanup()
+
+	pvc := &v1.PersistentVolumeClaim{}
+	pvc.Name = "vol1"
+	pvc.Labels = map[string]string{string(api.CHAPLbl): api.CHAPModeOneWay}
+	if _, err := client.Volumes().Create(pvc, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The key is kept apart from the sealed credentials
+	if _, err := os.Stat(keyFile); err != nil {
+		t.Fatalf("expected the state key at %s, got: %v", keyFile, err)
+	}
+	if _, err := os.Stat(filepath.Join(s.Dir, state.KeyFileName)); !os.IsNotExist(err) {
+		t.Fatalf("expected no state key in the data dir, got: %v", err)
+	}
+	if keys := s.Maya.state.Keys(chapBucket); len(keys) != 1 {
+		t.Fatalf("bad state: %v", keys)
+	}
+}
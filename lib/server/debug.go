@@ -0,0 +1,342 @@
+package server
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/openebs/maya/orchprovider"
+	"github.com/openebs/maya/types/v1"
+	"github.com/openebs/maya/volumes/provisioner"
+	"github.com/openebs/mayaserver/lib/api"
+	"github.com/openebs/mayaserver/lib/audit"
+)
+
+const (
+	// blockProfileRate samples a blocking event per these many nanoseconds
+	// spent blocked
+	blockProfileRate = 10000
+
+	// mutexProfileFraction samples one in these many mutex contentions
+	mutexProfileFraction = 10
+
+	// defaultContentionProfileSeconds is the duration for which the block &
+	// the mutex profiles are sampled if the request does not set its own
+	defaultContentionProfileSeconds = 10
+
+	// errAdminTokenRequired is the error of the admin requests that are not
+	// authorized by the admin token
+	errAdminTokenRequired = "This endpoint needs the admin token. Set admin_token & send it as the bearer token"
+)
+
+// publishOnce publishes the expvars once per process as expvar panics on
+// the names that are published again
+var publishOnce sync.Once
+
+// contention samples the blocking events & the mutex contentions while the
+// block or the mutex profile is requested
+var contention contentionSampler
+
+// BuildInfo is the version & the build of maya api server
+type BuildInfo struct {
+	Version           string `json:"version"`
+	VersionPrerelease string `json:"versionPrerelease"`
+	Revision          string `json:"revision"`
+	GoVersion         string `json:"goVersion"`
+	OS                string `json:"os"`
+	Arch              string `json:"arch"`
+	NumCPU            int    `json:"numCPU"`
+}
+
+// PluginRegistry is the state of the registries of the volume provisioners
+// & the orchestrators
+type PluginRegistry struct {
+	// Provisioners & Orchestrators flag if the known plugins are registered
+	Provisioners  map[string]bool `json:"provisioners"`
+	Orchestrators map[string]bool `json:"orchestrators"`
+
+	DefaultProvisioner  string `json:"defaultProvisioner"`
+	DefaultOrchestrator string `json:"defaultOrchestrator"`
+}
+
+// AgentSelf describes a running maya api server
+type AgentSelf struct {
+	// Config is the effective config with the values of its secrets redacted
+	Config json.RawMessage `json:"config"`
+
+	Build     *BuildInfo      `json:"build"`
+	StartTime time.Time       `json:"startTime"`
+	Uptime    string          `json:"uptime"`
+	Plugins   *PluginRegistry `json:"plugins"`
+
+	// Listeners are the addresses listened on by their names
+	Listeners map[string]string `json:"listeners"`
+}
+
+// VolumeInventory is the list of the volumes along with their statuses
+type VolumeInventory struct {
+	Orchestrator string                 `json:"orchestrator"`
+	Namespace    string                 `json:"namespace"`
+	Volumes      []VolumeInventoryEntry `json:"volumes"`
+
+	// Error is set if the volumes could not be listed
+	Error string `json:"error,omitempty"`
+}
+
+// VolumeInventoryEntry is a volume of the volume inventory
+type VolumeInventoryEntry struct {
+	Name             string `json:"name"`
+	UID              string `json:"uid"`
+	Status           string `json:"status"`
+	ControllerStatus string `json:"controllerStatus"`
+	ReplicaStatus    string `json:"replicaStatus"`
+}
+
+// agentDebug serves the debug endpoints. These are used by the debug bundle
+// command & are served only if enable_debug is set. The callers must send
+// the admin token.
+func (s *HTTPServer) agentDebug(resp http.ResponseWriter, req *http.Request, path string) (interface{}, error) {
+	if err := s.requireDebug(req); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case path == "config":
+		return s.debugConfig(), nil
+	case path == "version":
+		return s.debugVersion(), nil
+	case path == "logs":
+		return s.debugLogs()
+	case path == "volumes":
+		return s.debugVolumes(req), nil
+	case path == "plugins":
+		return debugPlugins(s.maya.Config().ServiceProvider), nil
+	case path == "checks":
+		return s.maya.health.run(), nil
+	default:
+		return nil, CodedError(404, fmt.Sprintf("Unknown debug endpoint: %s", path))
+	}
+}
+
+// agentSelf describes this maya api server. It is served only if
+// enable_debug is set & to the callers of the admin token.
+func (s *HTTPServer) agentSelf(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if err := s.requireDebug(req); err != nil {
+		return nil, err
+	}
+
+	uptime := time.Since(s.maya.startTime)
+	return &AgentSelf{
+		Config:    audit.Redact(s.maya.Config()),
+		Build:     s.debugVersion(),
+		StartTime: s.maya.startTime.UTC(),
+		Uptime:    uptime.Truncate(time.Second).String(),
+		Plugins:   debugPlugins(s.maya.Config().ServiceProvider),
+		Listeners: map[string]string{
+			"http": s.listener.Addr().String(),
+		},
+	}, nil
+}
+
+// requireDebug verifies if the debug endpoints are enabled & are requested
+// via GET by a caller of the admin scope
+func (s *HTTPServer) requireDebug(req *http.Request) error {
+	if !s.enableDebug {
+		return CodedError(501, "Debug endpoints are not enabled. Set enable_debug to enable them")
+	}
+
+	if req.Method != "GET" {
+		return CodedError(405, ErrGetMethodRequired)
+	}
+
+	return s.requireAdminRequest(req)
+}
+
+// requireAdminRequest verifies if the request is sent by a caller of the
+// admin scope. The handlers curried via wrap are gated via this.
+func (s *HTTPServer) requireAdminRequest(req *http.Request) error {
+	if !s.adminAuthorized(req) {
+		return CodedError(403, errAdminTokenRequired)
+	}
+	return nil
+}
+
+// adminAuthorized verifies if the bearer token of the request is the admin
+// token, or if the request is an EC2 request signed by the EC2 access keys of
+// the admin scope. No request is authorized if neither is set.
+func (s *HTTPServer) adminAuthorized(req *http.Request) bool {
+	return bearerAuthorized(req, s.maya.Config().AdminToken) || ec2AdminSigned(req)
+}
+
+// requireAdmin serves the handler to the callers of the admin scope only.
+// The debug handlers of net/http/pprof & expvar are served via this.
+func (s *HTTPServer) requireAdmin(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if !s.adminAuthorized(req) {
+			resp.Header().Set(api.HeaderErrorKind, string(api.ErrorKindUnauthorized))
+			http.Error(resp, errAdminTokenRequired, 403)
+			return
+		}
+		h.ServeHTTP(resp, req)
+	})
+}
+
+// debugConfig returns the effective config with the values of its secrets
+// redacted
+func (s *HTTPServer) debugConfig() interface{} {
+	return audit.Redact(s.maya.Config())
+}
+
+// debugVersion returns the version & the build of maya api server
+func (s *HTTPServer) debugVersion() *BuildInfo {
+	conf := s.maya.Config()
+	return &BuildInfo{
+		Version:           conf.Version,
+		VersionPrerelease: conf.VersionPrerelease,
+		Revision:          conf.Revision,
+		GoVersion:         runtime.Version(),
+		OS:                runtime.GOOS,
+		Arch:              runtime.GOARCH,
+		NumCPU:            runtime.NumCPU(),
+	}
+}
+
+// debugLogs returns the recent logs buffered by the log registrar
+func (s *HTTPServer) debugLogs() (interface{}, error) {
+	registrar := s.maya.logRegistrar
+	if registrar == nil {
+		return nil, CodedError(501, "Log buffering is not supported")
+	}
+	return registrar.Recent(), nil
+}
+
+// debugVolumes lists the volumes along with their statuses. A failure to
+// list is reported within the inventory as the orchestrator may well be the
+// reason of the debugging.
+func (s *HTTPServer) debugVolumes(req *http.Request) *VolumeInventory {
+	namespace := v1.GetOrchestratorNS(nil)
+	orchestrator := string(v1.GetOrchestratorName(nil))
+	pvl, err := s.listVolumes(req)
+
+	inv := &VolumeInventory{
+		Orchestrator: orchestrator,
+		Namespace:    namespace,
+		Volumes:      []VolumeInventoryEntry{},
+	}
+	if err != nil {
+		inv.Error = err.Error()
+		return inv
+	}
+
+	for _, pv := range pvl.Items {
+		inv.Volumes = append(inv.Volumes, VolumeInventoryEntry{
+			Name:             pv.Name,
+			UID:              pv.UID,
+			Status:           api.VolumeStatus(pv.Annotations),
+			ControllerStatus: pv.Annotations[string(v1.ControllerStatusAPILbl)],
+			ReplicaStatus:    pv.Annotations[string(v1.ReplicaStatusAPILbl)],
+		})
+	}
+	sort.Slice(inv.Volumes, func(i, j int) bool {
+		return inv.Volumes[i].Name < inv.Volumes[j].Name
+	})
+	return inv
+}
+
+// debugPlugins returns the state of the plugin registries. The registries
+// can not be enumerated. Hence the plugins known to maya api server are
+// looked up.
+func debugPlugins(serviceProvider string) *PluginRegistry {
+	defOrch := serviceProvider
+	if defOrch == "" {
+		defOrch = v1.DefaultOrchestratorName()
+	}
+
+	return &PluginRegistry{
+		Provisioners: map[string]bool{
+			string(v1.JivaVolumeProvisioner): provisioner.HasVolumeProvisioner(v1.JivaVolumeProvisioner),
+		},
+		Orchestrators: map[string]bool{
+			string(v1.K8sOrchestrator):   orchprovider.HasOrchestrator(v1.K8sOrchestrator),
+			string(v1.NomadOrchestrator): orchprovider.HasOrchestrator(v1.NomadOrchestrator),
+		},
+		DefaultProvisioner:  string(v1.DefaultVolumeProvisionerName()),
+		DefaultOrchestrator: defOrch,
+	}
+}
+
+// runtimeStats are the runtime stats published as the runtime expvar
+func runtimeStats() interface{} {
+	return map[string]interface{}{
+		"goroutines": runtime.NumGoroutine(),
+		"gomaxprocs": runtime.GOMAXPROCS(0),
+		"numCPU":     runtime.NumCPU(),
+		"cgoCalls":   runtime.NumCgoCall(),
+		"goVersion":  runtime.Version(),
+	}
+}
+
+// publishRuntimeStats publishes the runtime stats as the runtime expvar
+func publishRuntimeStats() {
+	publishOnce.Do(func() {
+		expvar.Publish("runtime", expvar.Func(runtimeStats))
+	})
+}
+
+// contentionSampler samples the blocking events & the mutex contentions
+// while any of the block or the mutex profiles is being requested. These
+// profiles are empty otherwise. The sampling has an overhead & hence is not
+// left on.
+type contentionSampler struct {
+	l sync.Mutex
+	n int
+}
+
+func (c *contentionSampler) start() {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if c.n == 0 {
+		runtime.SetBlockProfileRate(blockProfileRate)
+		runtime.SetMutexProfileFraction(mutexProfileFraction)
+	}
+	c.n++
+}
+
+func (c *contentionSampler) stop() {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	c.n--
+	if c.n == 0 {
+		runtime.SetBlockProfileRate(0)
+		runtime.SetMutexProfileFraction(0)
+	}
+}
+
+// contentionProfile serves the named block or mutex profile. The events are
+// sampled only for the ?seconds of the request & the profile is the delta
+// over these seconds.
+func contentionProfile(name string) http.Handler {
+	h := pprof.Handler(name)
+
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		if q.Get("seconds") == "" {
+			q.Set("seconds", strconv.Itoa(defaultContentionProfileSeconds))
+			req.URL.RawQuery = q.Encode()
+		}
+
+		contention.start()
+		defer contention.stop()
+
+		h.ServeHTTP(resp, req)
+	})
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/openebs/maya/types/v1"
+	"github.com/openebs/mayaserver/lib/config"
+	"github.com/openebs/mayaserver/lib/loghelper"
+)
+
+const testAdminToken = "fedcba9876543210"
+
+// asAdmin sets the admin token as the bearer token of the request
+func asAdmin(req *http.Request) *http.Request {
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	return req
+}
+
+func TestAgentDebug_Disabled(t *testing.T) {
+	s := makeHTTPTestServer(t, nil)
+	defer s.Cleanup()
+
+	req, _ := http.NewRequest("GET", "/v1/agent/debug/version", nil)
+	if _, err := s.Server.AgentSpecificRequest(httptest.NewRecorder(), req); err == nil {
+		t.Fatalf("expected error without enable_debug")
+	} else if cErr, ok := err.(HTTPCodedError); !ok || cErr.Code() != 501 {
+		t.Fatalf("expected 501, got: %v", err)
+	}
+}
+
+func TestAgentDebug(t *testing.T) {
+	s := makeHTTPTestServer(t, func(mc *config.MayaConfig) {
+		mc.EnableDebug = true
+		mc.AdminToken = testAdminToken
+		mc.Version = "0.3.0"
+	})
+	defer s.Cleanup()
+
+	debug := func(method, path string) (*httptest.ResponseRecorder, interface{}, error) {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/v1/agent/debug/"+path, nil)
+		obj, err := s.Server.AgentSpecificRequest(resp, asAdmin(req))
+		return resp, obj, err
+	}
+	expectCode := func(err error, code int) {
+		if cErr, ok := err.(HTTPCodedError); !ok || cErr.Code() != code {
+			t.Fatalf("expected %d, got: %v", code, err)
+		}
+	}
+
+	// Version
+	_, obj, err := debug("GET", "version")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if info := obj.(*BuildInfo); info.Version != "0.3.0" || info.GoVersion == "" {
+		t.Fatalf("bad build info: %#v", info)
+	}
+
+	// Config
+	_, obj, err = debug("GET", "config")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var conf map[string]interface{}
+	if err := json.Unmarshal(obj.(json.RawMessage), &conf); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if conf["EnableDebug"] != true {
+		t.Fatalf("bad config: %v", conf)
+	}
+
+	// Logs are not supported without a registrar
+	_, _, err = debug("GET", "logs")
+	expectCode(err, 501)
+
+	registrar := loghelper.NewLogRegistrar(2)
+	registrar.Write([]byte("[INFO] one"))
+	s.Maya.SetLogRegistrar(registrar)
+
+	_, obj, err = debug("GET", "logs")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if lines := obj.([]string); len(lines) != 1 || lines[0] != "[INFO] one" {
+		t.Fatalf("bad logs: %v", lines)
+	}
+
+	// Plugins
+	_, obj, err = debug("GET", "plugins")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	plugins := obj.(*PluginRegistry)
+	if _, ok := plugins.Orchestrators[string(v1.K8sOrchestrator)]; !ok || plugins.DefaultOrchestrator == "" {
+		t.Fatalf("bad plugins: %#v", plugins)
+	}
+
+	// Profiles are served by net/http/pprof only
+	_, _, err = debug("GET", "pprof/heap")
+	expectCode(err, 404)
+
+	// Unknown items & methods
+	_, _, err = debug("GET", "secrets")
+	expectCode(err, 404)
+
+	_, _, err = debug("PUT", "version")
+	expectCode(err, 405)
+
+	// The admin token is required
+	for _, auth := range []string{"", "Bearer 0123456789abcdef"} {
+		req, _ := http.NewRequest("GET", "/v1/agent/debug/version", nil)
+		req.Header.Set("Authorization", auth)
+		_, err = s.Server.AgentSpecificRequest(httptest.NewRecorder(), req)
+		expectCode(err, 403)
+
+		req, _ = http.NewRequest("GET", "/v1/agent/self", nil)
+		req.Header.Set("Authorization", auth)
+		_, err = s.Server.AgentSpecificRequest(httptest.NewRecorder(), req)
+		expectCode(err, 403)
+	}
+}
+
+func TestAgentSelf(t *testing.T) {
+	s := makeHTTPTestServer(t, func(mc *config.MayaConfig) {
+		mc.EnableDebug = true
+		mc.AdminToken = testAdminToken
+		mc.Revision = "deadbeef"
+	})
+	defer s.Cleanup()
+
+	req, _ := http.NewRequest("GET", "/v1/agent/self", nil)
+	obj, err := s.Server.AgentSpecificRequest(httptest.NewRecorder(), asAdmin(req))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	self := obj.(*AgentSelf)
+	if self.Build.Revision != "deadbeef" || self.Uptime == "" || self.Plugins == nil {
+		t.Fatalf("bad self: %#v", self)
+	}
+	if self.Listeners["http"] != s.Server.listener.Addr().String() {
+		t.Fatalf("bad listeners: %v", self.Listeners)
+	}
+	if len(self.Config) == 0 {
+		t.Fatalf("expected the config")
+	}
+}
+
+func TestDebugRoutes(t *testing.T) {
+	get := func(s *TestServer, path string, admin bool) (int, string) {
+		req, _ := http.NewRequest("GET", "http://"+s.Server.addr+path, nil)
+		if admin {
+			asAdmin(req)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return resp.StatusCode, string(body)
+	}
+
+	// Not mounted without enable_debug
+	s := makeHTTPTestServer(t, nil)
+	for _, path := range []string{"/debug/pprof/heap", "/debug/vars"} {
+		if code, _ := get(s, path, true); code != 404 {
+			t.Fatalf("expected 404 for %s, got: %d", path, code)
+		}
+	}
+	s.Cleanup()
+
+	s = makeHTTPTestServer(t, func(mc *config.MayaConfig) {
+		mc.EnableDebug = true
+		mc.AdminToken = testAdminToken
+	})
+	defer s.Cleanup()
+
+	for _, path := range []string{"/debug/pprof/goroutine", "/debug/pprof/block?seconds=1", "/debug/pprof/mutex?seconds=1"} {
+		if code, body := get(s, path, true); code != 200 || len(body) == 0 {
+			t.Fatalf("bad %s: %d %s", path, code, body)
+		}
+	}
+
+	// The contention is sampled only while the profiles are requested
+	if rate := runtime.SetMutexProfileFraction(-1); rate != 0 {
+		t.Fatalf("expected the mutex profile to be disabled, got: %d", rate)
+	}
+
+	// The admin token is required
+	for _, path := range []string{"/debug/pprof/heap", "/debug/pprof/block", "/debug/vars"} {
+		if code, _ := get(s, path, false); code != 403 {
+			t.Fatalf("expected 403 for %s, got: %d", path, code)
+		}
+	}
+
+	code, body := get(s, "/debug/vars", true)
+	if code != 200 {
+		t.Fatalf("bad code: %d", code)
+	}
+	var vars map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &vars); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	stats, ok := vars["runtime"].(map[string]interface{})
+	if !ok || stats["goroutines"] == nil {
+		t.Fatalf("bad runtime stats: %v", vars["runtime"])
+	}
+}
@@ -0,0 +1,788 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openebs/maya/types/v1"
+	"github.com/openebs/mayaserver/lib/api"
+	"github.com/openebs/mayaserver/lib/audit"
+)
+
+const (
+	// ec2XMLNS is the namespace of the EC2 query API responses
+	ec2XMLNS = "http://ec2.amazonaws.com/doc/2016-11-15/"
+
+	// ec2VolumeIDPrefix prefixes the EC2 ids of the volumes
+	ec2VolumeIDPrefix = "vol-"
+
+	// ec2DefaultVolumeType is the volume type reported for every volume
+	ec2DefaultVolumeType = "gp2"
+
+	// ec2TimeFormat is the format of the timestamps of the EC2 responses
+	ec2TimeFormat = "2006-01-02T15:04:05.000Z"
+
+	// ec2VolumesBucket is the bucket of the state that has the names of the
+	// volumes by their EC2 volume ids. The ids are resolved via it as these
+	// can not be reverted to the names.
+	ec2VolumesBucket = "ec2_volumes"
+)
+
+// ec2NameTags are the tags whose value is used as the name of a volume
+// created via the EC2 query API. These are set by the EBS CSI driver, the
+// in-tree EBS volume plugin & the users respectively. A volume reports its
+// name as the value of these tags.
+var ec2NameTags = []string{
+	"CSIVolumeName",
+	"kubernetes.io/created-for/pv/name",
+	"Name",
+}
+
+// The codes of the EC2 errors
+const (
+	ec2ErrMissingAction        = "MissingAction"
+	ec2ErrInvalidAction        = "InvalidAction"
+	ec2ErrMissingParameter     = "MissingParameter"
+	ec2ErrInvalidParameter     = "InvalidParameterValue"
+	ec2ErrVolumeNotFound       = "InvalidVolume.NotFound"
+	ec2ErrVolumeInUse          = "VolumeInUse"
+	ec2ErrIncorrectState       = "IncorrectState"
+	ec2ErrUnsupportedOperation = "UnsupportedOperation"
+	ec2ErrUnauthorized         = "UnauthorizedOperation"
+	ec2ErrUnavailable          = "Unavailable"
+	ec2ErrInternal             = "InternalError"
+)
+
+// ec2Error is an error of the EC2 query API
+type ec2Error struct {
+	code    int
+	ec2Code string
+	msg     string
+}
+
+func (e *ec2Error) Error() string {
+	return e.msg
+}
+
+func newEC2Error(code int, ec2Code, format string, v ...interface{}) *ec2Error {
+	return &ec2Error{code: code, ec2Code: ec2Code, msg: fmt.Sprintf(format, v...)}
+}
+
+// ec2ErrorResponse is the response of a failed EC2 action
+type ec2ErrorResponse struct {
+	XMLName   xml.Name      `xml:"Response"`
+	Errors    []ec2ErrorXML `xml:"Errors>Error"`
+	RequestID string        `xml:"RequestID"`
+}
+
+type ec2ErrorXML struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// ec2Volume is a volume as described by EC2
+type ec2Volume struct {
+	VolumeID         string          `xml:"volumeId"`
+	Size             int             `xml:"size"`
+	SnapshotID       string          `xml:"snapshotId"`
+	AvailabilityZone string          `xml:"availabilityZone"`
+	Status           string          `xml:"status"`
+	CreateTime       string          `xml:"createTime"`
+	Attachments      []ec2Attachment `xml:"attachmentSet>item"`
+	VolumeType       string          `xml:"volumeType"`
+	Encrypted        bool            `xml:"encrypted"`
+	Tags             []ec2Tag        `xml:"tagSet>item"`
+}
+
+// ec2Attachment is an attachment of a volume as described by EC2
+type ec2Attachment struct {
+	VolumeID            string `xml:"volumeId"`
+	InstanceID          string `xml:"instanceId"`
+	Device              string `xml:"device"`
+	Status              string `xml:"status"`
+	AttachTime          string `xml:"attachTime"`
+	DeleteOnTermination bool   `xml:"deleteOnTermination"`
+}
+
+type ec2Tag struct {
+	Key   string `xml:"key"`
+	Value string `xml:"value"`
+}
+
+type ec2CreateVolumeResponse struct {
+	XMLName   xml.Name `xml:"CreateVolumeResponse"`
+	XMLNS     string   `xml:"xmlns,attr"`
+	RequestID string   `xml:"requestId"`
+	ec2Volume
+}
+
+type ec2DescribeVolumesResponse struct {
+	XMLName   xml.Name    `xml:"DescribeVolumesResponse"`
+	XMLNS     string      `xml:"xmlns,attr"`
+	RequestID string      `xml:"requestId"`
+	Volumes   []ec2Volume `xml:"volumeSet>item"`
+}
+
+// ec2AttachmentResponse is the response of AttachVolume & DetachVolume
+type ec2AttachmentResponse struct {
+	XMLName   xml.Name
+	XMLNS     string `xml:"xmlns,attr"`
+	RequestID string `xml:"requestId"`
+	ec2Attachment
+}
+
+type ec2DeleteVolumeResponse struct {
+	XMLName   xml.Name `xml:"DeleteVolumeResponse"`
+	XMLNS     string   `xml:"xmlns,attr"`
+	RequestID string   `xml:"requestId"`
+	Return    bool     `xml:"return"`
+}
+
+// EC2Request serves the volume actions of the EC2 query API so that the AWS
+// SDK based volume plugins can work with maya api server. The actions are
+// translated into the calls of the volume provisioner. The requests signed
+// by the EC2 access keys of the admin scope via AWS Signature Version 4 are
+// authorized as the admin. The other requests are served anonymously.
+//
+// The volumes are identified by EC2 volume ids that are derived from their
+// names. Hence the id of a volume is stable. The ids are resolved via the
+// state & a read of the volume. The volumes are listed only to resolve the
+// ids of the volumes that are not in the state yet e.g. the ones created by
+// an earlier release, or to describe every volume. The orchestrators that
+// can not list the volumes e.g. Nomad report these as unsupported.
+//
+// The snapshot actions e.g. CreateSnapshot are not served as the volume
+// provisioner has no snapshot operation. These are reported as unsupported
+// so that the clients can tell them from the invalid actions.
+func (s *HTTPServer) EC2Request(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if req.Method != "GET" && req.Method != "POST" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+
+	authReq, err := s.ec2Authenticate(req)
+	if err != nil {
+		return s.ec2Failure(req, err), nil
+	}
+
+	obj, err := s.ec2Action(authReq)
+	if err != nil {
+		return s.ec2Failure(authReq, err), nil
+	}
+	return XMLResponse(obj), nil
+}
+
+// ec2Action dispatches the action of the request
+func (s *HTTPServer) ec2Action(req *http.Request) (interface{}, error) {
+	if err := req.ParseForm(); err != nil {
+		return nil, newEC2Error(400, ec2ErrInvalidParameter, "Invalid query: %v", err)
+	}
+
+	action := req.Form.Get("Action")
+	s.requestLogger(req).Printf("[DEBUG] ec2: Processing %s request", action)
+
+	switch action {
+	case "CreateVolume":
+		return s.ec2CreateVolume(req)
+	case "DescribeVolumes":
+		return s.ec2DescribeVolumes(req)
+	case "DeleteVolume":
+		return s.ec2DeleteVolume(req)
+	case "AttachVolume":
+		return s.ec2AttachVolume(req)
+	case "DetachVolume":
+		return s.ec2DetachVolume(req)
+	case "CreateSnapshot", "DeleteSnapshot", "DescribeSnapshots":
+		return nil, newEC2Error(400, ec2ErrUnsupportedOperation, "%s is not supported by the volume provisioner", action)
+	case "":
+		return nil, newEC2Error(400, ec2ErrMissingAction, "The request must contain the parameter Action")
+	default:
+		return nil, newEC2Error(400, ec2ErrInvalidAction, "The action %s is not valid for this web service", action)
+	}
+}
+
+// ec2Failure returns the EC2 error response of the error. The errors of
+// maya api server are translated to their EC2 equivalents.
+func (s *HTTPServer) ec2Failure(req *http.Request, err error) interface{} {
+	s.requestLogger(req).Printf("[ERR] ec2: Request %s failed: %v", req.Form.Get("Action"), err)
+
+	eErr, ok := err.(*ec2Error)
+	if !ok {
+		eErr = &ec2Error{code: 500, ec2Code: ec2ErrInternal, msg: err.Error()}
+
+		switch errorKind(err) {
+		case api.ErrorKindNotFound:
+			eErr.code, eErr.ec2Code = 400, ec2ErrVolumeNotFound
+		case api.ErrorKindInvalid:
+			eErr.code, eErr.ec2Code = 400, ec2ErrInvalidParameter
+		case api.ErrorKindConflict:
+			eErr.code, eErr.ec2Code = 400, ec2ErrVolumeInUse
+		case api.ErrorKindUnauthorized:
+			eErr.code, eErr.ec2Code = 403, ec2ErrUnauthorized
+		case api.ErrorKindNotImplemented:
+			eErr.code, eErr.ec2Code = 400, ec2ErrUnsupportedOperation
+		case api.ErrorKindUnavailable, api.ErrorKindTimeout, api.ErrorKindUnreachable:
+			eErr.code, eErr.ec2Code = 503, ec2ErrUnavailable
+		}
+	}
+
+	return CodedResponse(eErr.code, XMLResponse(&ec2ErrorResponse{
+		Errors:    []ec2ErrorXML{{Code: eErr.ec2Code, Message: eErr.msg}},
+		RequestID: requestIDOf(req),
+	}))
+}
+
+// ec2CreateVolume creates a volume of the requested size in GiB. The volume
+// is named after its name tag, else its client token, else randomly.
+func (s *HTTPServer) ec2CreateVolume(req *http.Request) (out interface{}, err error) {
+	form := req.Form
+
+	if form.Get("SnapshotId") != "" {
+		return nil, newEC2Error(400, ec2ErrUnsupportedOperation, "Volumes can not be created from snapshots")
+	}
+
+	sizeParam := form.Get("Size")
+	if sizeParam == "" {
+		return nil, newEC2Error(400, ec2ErrMissingParameter, "The request must contain the parameter Size")
+	}
+	size, err := strconv.Atoi(sizeParam)
+	if err != nil || size < 1 {
+		return nil, newEC2Error(400, ec2ErrInvalidParameter, "Invalid Size: %s", sizeParam)
+	}
+
+	tags := ec2VolumeTags(form)
+	name, err := ec2NewVolumeName(tags, form.Get("ClientToken"))
+	if err != nil {
+		return nil, err
+	}
+
+	pvc := &v1.PersistentVolumeClaim{}
+	pvc.Name = name
+	pvc.Labels = map[string]string{
+		string(v1.PVPStorageSizeLbl): fmt.Sprintf("%dG", size),
+	}
+
+	spec := audit.Redact(pvc)
+	defer func() {
+		s.auditRequest(req, audit.OpVolumeCreate, name, spec, err)
+	}()
+
+	pv, err := s.addVolume(req, pvc)
+	if err != nil {
+		return nil, err
+	}
+
+	vol := ec2VolumeOf(pv, s.availabilityZone())
+	if zone := form.Get("AvailabilityZone"); zone != "" {
+		vol.AvailabilityZone = zone
+	}
+	if volType := form.Get("VolumeType"); volType != "" {
+		vol.VolumeType = volType
+	}
+	if vol.Size == 0 {
+		vol.Size = size
+	}
+	vol.Tags = ec2SortedTags(tags)
+
+	return &ec2CreateVolumeResponse{
+		XMLNS:     ec2XMLNS,
+		RequestID: requestIDOf(req),
+		ec2Volume: vol,
+	}, nil
+}
+
+// ec2DescribeVolumes describes the volumes of the VolumeId.N parameters, or
+// every volume, that match the Filter.N parameters
+func (s *HTTPServer) ec2DescribeVolumes(req *http.Request) (interface{}, error) {
+	ids := ec2IndexedParams(req.Form, "VolumeId")
+
+	filters, err := ec2VolumeFilters(req.Form)
+	if err != nil {
+		return nil, err
+	}
+
+	var pvs []v1.PersistentVolume
+	if len(ids) != 0 {
+		// The requested volumes are read rather than listed
+		for _, id := range ids {
+			pv, err := s.ec2ReadVolume(req, id)
+			if err != nil {
+				return nil, err
+			}
+			pvs = append(pvs, *pv)
+		}
+	} else {
+		pvl, err := s.listVolumes(req)
+		if err != nil {
+			return nil, ec2ListFailure(err, "Describing every volume is not supported as the volumes can not be listed. Request these via VolumeId.N")
+		}
+		pvs = pvl.Items
+	}
+
+	byID := map[string]ec2Volume{}
+	for _, pv := range pvs {
+		vol := ec2VolumeOf(&pv, s.availabilityZone())
+		va, err := s.maya.attachmentsOf(pv.Name)
+		if err != nil {
+			return nil, err
+		}
+		ec2SetAttachments(&vol, va)
+		byID[vol.VolumeID] = vol
+	}
+
+	if len(ids) == 0 {
+		for id := range byID {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+	}
+
+	volumes := []ec2Volume{}
+	for _, id := range ids {
+		// The requested volumes must exist similar to EC2
+		vol, ok := byID[id]
+		if !ok {
+			return nil, newEC2Error(400, ec2ErrVolumeNotFound, "The volume '%s' does not exist.", id)
+		}
+		if ec2VolumeMatches(vol, filters) {
+			volumes = append(volumes, vol)
+		}
+	}
+
+	return &ec2DescribeVolumesResponse{
+		XMLNS:     ec2XMLNS,
+		RequestID: requestIDOf(req),
+		Volumes:   volumes,
+	}, nil
+}
+
+// ec2DeleteVolume deletes the volume of the VolumeId parameter
+func (s *HTTPServer) ec2DeleteVolume(req *http.Request) (out interface{}, err error) {
+	id := req.Form.Get("VolumeId")
+	if id == "" {
+		return nil, newEC2Error(400, ec2ErrMissingParameter, "The request must contain the parameter VolumeId")
+	}
+
+	name, err := s.ec2ResolveVolume(req, id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		s.auditRequest(req, audit.OpVolumeDelete, name, nil, err)
+	}()
+
+	if err := s.removeVolume(req, name); err != nil {
+		return nil, err
+	}
+
+	return &ec2DeleteVolumeResponse{
+		XMLNS:     ec2XMLNS,
+		RequestID: requestIDOf(req),
+		Return:    true,
+	}, nil
+}
+
+// ec2AttachVolume attaches the volume of the VolumeId parameter read-write
+// to the instance of the InstanceId parameter i.e. the node. The detach token
+// of the attachment is not part of the EC2 response. Hence a repeated attach
+// & a detach of the instance need the admin scope i.e. the admin token or a
+// signature by the EC2 access keys of the admin scope.
+func (s *HTTPServer) ec2AttachVolume(req *http.Request) (out interface{}, err error) {
+	form := req.Form
+
+	for _, param := range []string{"VolumeId", "InstanceId", "Device"} {
+		if form.Get(param) == "" {
+			return nil, newEC2Error(400, ec2ErrMissingParameter, "The request must contain the parameter %s", param)
+		}
+	}
+	id, instanceID, device := form.Get("VolumeId"), form.Get("InstanceId"), form.Get("Device")
+
+	name, err := s.ec2ResolveVolume(req, id)
+	if err != nil {
+		return nil, err
+	}
+
+	args := &api.AttachRequest{
+		NodeID:     instanceID,
+		AccessMode: api.AccessModeReadWrite,
+		Device:     device,
+	}
+	defer func() {
+		s.auditRequest(req, audit.OpVolumeAttach, name, args, err)
+	}()
+
+	va, err := s.attachVolume(req, name, args)
+	if err != nil {
+		return nil, err
+	}
+
+	attachment := ec2Attachment{VolumeID: id, InstanceID: instanceID, Device: device}
+	for _, a := range ec2AttachmentsOf(va) {
+		if a.InstanceID == instanceID {
+			attachment = a
+		}
+	}
+
+	return &ec2AttachmentResponse{
+		XMLName:       xml.Name{Local: "AttachVolumeResponse"},
+		XMLNS:         ec2XMLNS,
+		RequestID:     requestIDOf(req),
+		ec2Attachment: attachment,
+	}, nil
+}
+
+// ec2DetachVolume detaches the volume of the VolumeId parameter from the
+// instance of the InstanceId parameter. The volume is detached from its only
+// instance if InstanceId is not set. A forced detach fences the instance as
+// is the case for the detaches via the API. Either detach needs the admin
+// scope as the instance has no detach token here. The EBS volume plugins get
+// it via the EC2 access keys of the admin scope.
+func (s *HTTPServer) ec2DetachVolume(req *http.Request) (out interface{}, err error) {
+	form := req.Form
+
+	id := form.Get("VolumeId")
+	if id == "" {
+		return nil, newEC2Error(400, ec2ErrMissingParameter, "The request must contain the parameter VolumeId")
+	}
+
+	force := false
+	if v := form.Get("Force"); v != "" {
+		if force, err = strconv.ParseBool(v); err != nil {
+			return nil, newEC2Error(400, ec2ErrInvalidParameter, "Invalid Force: %s", v)
+		}
+	}
+
+	name, err := s.ec2ResolveVolume(req, id)
+	if err != nil {
+		return nil, err
+	}
+
+	va, err := s.maya.attachmentsOf(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var attachment *ec2Attachment
+	instanceID := form.Get("InstanceId")
+	for _, a := range ec2AttachmentsOf(va) {
+		if a.InstanceID == instanceID || (instanceID == "" && len(va.Attachments) == 1) {
+			a := a
+			attachment = &a
+		}
+	}
+	if attachment == nil {
+		// EC2 fails the detach of a volume that is not attached
+		return nil, newEC2Error(400, ec2ErrIncorrectState, "Volume '%s' is in the 'available' state.", id)
+	}
+
+	args := &api.DetachRequest{NodeID: attachment.InstanceID, Force: force}
+	defer func() {
+		s.auditRequest(req, audit.OpVolumeDetach, name, args, err)
+	}()
+
+	if _, err := s.detachVolume(req, name, args); err != nil {
+		return nil, err
+	}
+	attachment.Status = "detached"
+
+	return &ec2AttachmentResponse{
+		XMLName:       xml.Name{Local: "DetachVolumeResponse"},
+		XMLNS:         ec2XMLNS,
+		RequestID:     requestIDOf(req),
+		ec2Attachment: *attachment,
+	}, nil
+}
+
+// ec2ResolveVolume returns the name of the volume of the EC2 volume id
+func (s *HTTPServer) ec2ResolveVolume(req *http.Request, id string) (string, error) {
+	pv, err := s.ec2ReadVolume(req, id)
+	if err != nil {
+		return "", err
+	}
+	return pv.Name, nil
+}
+
+// ec2ReadVolume reads the volume of the EC2 volume id. The id is resolved via
+// the state, else via a listing of the volumes. An id resolved via a listing
+// is saved in the state so that it is not listed again.
+func (s *HTTPServer) ec2ReadVolume(req *http.Request, id string) (*v1.PersistentVolume, error) {
+	var name string
+	ok, err := s.maya.state.Get(ec2VolumesBucket, id, &name)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		pv, err := s.readVolume(req, name)
+		if errorKind(err) == api.ErrorKindNotFound {
+			return nil, newEC2Error(400, ec2ErrVolumeNotFound, "The volume '%s' does not exist.", id)
+		}
+		return pv, err
+	}
+
+	pvl, err := s.listVolumes(req)
+	if err != nil {
+		return nil, ec2ListFailure(err, fmt.Sprintf("The volume '%s' is not known & the volumes can not be listed to resolve it", id))
+	}
+
+	for _, pv := range pvl.Items {
+		if ec2VolumeID(pv.Name) == id {
+			s.putEC2VolumeID(req, pv.Name)
+			pv := pv
+			return &pv, nil
+		}
+	}
+	return nil, newEC2Error(400, ec2ErrVolumeNotFound, "The volume '%s' does not exist.", id)
+}
+
+// ec2ListFailure returns the EC2 error of a failed listing of the volumes.
+// The listing is reported as unsupported unless it failed for a while only.
+func ec2ListFailure(err error, msg string) error {
+	switch errorKind(err) {
+	case api.ErrorKindUnavailable, api.ErrorKindTimeout, api.ErrorKindUnreachable:
+		return err
+	}
+	return newEC2Error(400, ec2ErrUnsupportedOperation, "%s: %v", msg, err)
+}
+
+// putEC2VolumeID saves the EC2 volume id of the named volume in the state.
+// The failures are logged only as the id is resolved via a listing then.
+func (s *HTTPServer) putEC2VolumeID(req *http.Request, name string) {
+	if err := s.maya.state.Put(ec2VolumesBucket, ec2VolumeID(name), name); err != nil {
+		s.requestLogger(req).With("volume", name).Printf("[WARN] ec2: Failed to save the EC2 volume id of the VSM: %v", err)
+	}
+}
+
+// ec2VolumeID returns the stable EC2 volume id of the named volume
+func ec2VolumeID(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return ec2VolumeIDPrefix + hex.EncodeToString(sum[:])[:17]
+}
+
+// ec2VolumeOf describes the volume of the availability zone as EC2 does
+func ec2VolumeOf(pv *v1.PersistentVolume, zone string) ec2Volume {
+	createTime := pv.CreationTimestamp.Time
+	if createTime.IsZero() {
+		createTime = time.Now()
+	}
+
+	var tags []ec2Tag
+	for _, key := range ec2NameTags {
+		tags = append(tags, ec2Tag{Key: key, Value: pv.Name})
+	}
+
+	return ec2Volume{
+		VolumeID:         ec2VolumeID(pv.Name),
+		Size:             ec2VolumeSize(pv.Annotations[string(v1.VolumeSizeAPILbl)]),
+		AvailabilityZone: zone,
+		Status:           ec2VolumeState(api.VolumeStatus(pv.Annotations)),
+		CreateTime:       createTime.UTC().Format(ec2TimeFormat),
+		VolumeType:       ec2DefaultVolumeType,
+		Tags:             tags,
+	}
+}
+
+// ec2SetAttachments sets the attachments of the volume. An available volume
+// that is attached is in use.
+func ec2SetAttachments(vol *ec2Volume, va *api.VolumeAttachments) {
+	vol.Attachments = ec2AttachmentsOf(va)
+	if len(vol.Attachments) != 0 && vol.Status == "available" {
+		vol.Status = "in-use"
+	}
+}
+
+// ec2AttachmentsOf describes the attachments of the volume as EC2 does
+func ec2AttachmentsOf(va *api.VolumeAttachments) []ec2Attachment {
+	var attachments []ec2Attachment
+	for _, a := range va.Attachments {
+		attachments = append(attachments, ec2Attachment{
+			VolumeID:   ec2VolumeID(va.Volume),
+			InstanceID: a.NodeID,
+			Device:     a.Device,
+			Status:     "attached",
+			AttachTime: a.AttachTime.UTC().Format(ec2TimeFormat),
+		})
+	}
+	return attachments
+}
+
+// ec2VolumeState returns the EC2 state of the volume of the given status
+func ec2VolumeState(status string) string {
+	switch status {
+	case api.VolumeStatusRunning, api.VolumeStatusDegraded:
+		return "available"
+	case api.VolumeStatusFailed:
+		return "error"
+	default:
+		return "creating"
+	}
+}
+
+// ec2VolumeSize returns the size in GiB of the volume size e.g. 5G. A size
+// that is not in G or T units is reported as 0.
+func ec2VolumeSize(size string) int {
+	size = strings.TrimSuffix(strings.TrimSpace(size), "i")
+
+	multiplier := 1
+	switch {
+	case strings.HasSuffix(size, "G"):
+		size = strings.TrimSuffix(size, "G")
+	case strings.HasSuffix(size, "T"):
+		size = strings.TrimSuffix(size, "T")
+		multiplier = 1024
+	default:
+		return 0
+	}
+
+	n, err := strconv.Atoi(size)
+	if err != nil {
+		return 0
+	}
+	return n * multiplier
+}
+
+// ec2NewVolumeName returns the name of the volume to be created. The name
+// tags take precedence over the client token.
+func ec2NewVolumeName(tags map[string]string, clientToken string) (string, error) {
+	for _, key := range ec2NameTags {
+		if name := tags[key]; name != "" {
+			return name, nil
+		}
+	}
+
+	if clientToken != "" {
+		sum := sha256.Sum256([]byte(clientToken))
+		return "ebs-" + hex.EncodeToString(sum[:])[:12], nil
+	}
+
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "ebs-" + hex.EncodeToString(b), nil
+}
+
+// ec2VolumeTags returns the tags of the TagSpecification.N parameters whose
+// resource type is volume
+func ec2VolumeTags(form url.Values) map[string]string {
+	tags := map[string]string{}
+	for n := 1; ; n++ {
+		prefix := fmt.Sprintf("TagSpecification.%d.", n)
+		resourceType, ok := form[prefix+"ResourceType"]
+		if !ok {
+			return tags
+		}
+		if len(resourceType) != 0 && resourceType[0] != "volume" {
+			continue
+		}
+
+		for m := 1; ; m++ {
+			key := form.Get(fmt.Sprintf("%sTag.%d.Key", prefix, m))
+			if key == "" {
+				break
+			}
+			tags[key] = form.Get(fmt.Sprintf("%sTag.%d.Value", prefix, m))
+		}
+	}
+}
+
+func ec2SortedTags(tags map[string]string) []ec2Tag {
+	var sorted []ec2Tag
+	for key, value := range tags {
+		sorted = append(sorted, ec2Tag{Key: key, Value: value})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Key < sorted[j].Key
+	})
+	return sorted
+}
+
+// ec2IndexedParams returns the values of the prefix.1, prefix.2 ...
+// parameters
+func ec2IndexedParams(form url.Values, prefix string) []string {
+	var values []string
+	for n := 1; ; n++ {
+		v, ok := form[fmt.Sprintf("%s.%d", prefix, n)]
+		if !ok || len(v) == 0 {
+			return values
+		}
+		values = append(values, v[0])
+	}
+}
+
+// ec2VolumeFilters returns the values of the Filter.N parameters by their
+// names. A filter that is not supported is rejected.
+func ec2VolumeFilters(form url.Values) (map[string][]string, error) {
+	filters := map[string][]string{}
+	for n := 1; ; n++ {
+		name := form.Get(fmt.Sprintf("Filter.%d.Name", n))
+		if name == "" {
+			return filters, nil
+		}
+
+		switch {
+		case name == "volume-id", name == "status", name == "size",
+			name == "availability-zone", name == "volume-type",
+			name == "attachment.instance-id", strings.HasPrefix(name, "tag:"):
+		default:
+			return nil, newEC2Error(400, ec2ErrInvalidParameter, "The filter '%s' is not supported", name)
+		}
+
+		filters[name] = append(filters[name], ec2IndexedParams(form, fmt.Sprintf("Filter.%d.Value", n))...)
+	}
+}
+
+// ec2VolumeMatches verifies if the volume matches every filter. A filter
+// matches if the volume has any of its values.
+func ec2VolumeMatches(vol ec2Volume, filters map[string][]string) bool {
+	for name, values := range filters {
+		var actual []string
+		switch {
+		case name == "volume-id":
+			actual = []string{vol.VolumeID}
+		case name == "status":
+			actual = []string{vol.Status}
+		case name == "size":
+			actual = []string{strconv.Itoa(vol.Size)}
+		case name == "availability-zone":
+			actual = []string{vol.AvailabilityZone}
+		case name == "volume-type":
+			actual = []string{vol.VolumeType}
+		case name == "attachment.instance-id":
+			for _, a := range vol.Attachments {
+				actual = append(actual, a.InstanceID)
+			}
+		case strings.HasPrefix(name, "tag:"):
+			key := strings.TrimPrefix(name, "tag:")
+			for _, tag := range vol.Tags {
+				if tag.Key == key {
+					actual = append(actual, tag.Value)
+				}
+			}
+		}
+
+		if !ec2AnyOf(actual, values) {
+			return false
+		}
+	}
+	return true
+}
+
+func ec2AnyOf(actual, values []string) bool {
+	for _, a := range actual {
+		for _, v := range values {
+			if a == v {
+				return true
+			}
+		}
+	}
+	return false
+}
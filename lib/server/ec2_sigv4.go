@@ -0,0 +1,251 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// sigV4Algorithm is the only signing algorithm of the EC2 requests that
+	// is verified
+	sigV4Algorithm = "AWS4-HMAC-SHA256"
+
+	// sigV4TimeFormat is the format of the X-Amz-Date header
+	sigV4TimeFormat = "20060102T150405Z"
+
+	// sigV4MaxSkew is the max difference between the time of signing & the
+	// time of verifying a request. AWS rejects the requests beyond it.
+	sigV4MaxSkew = 15 * time.Minute
+
+	// ec2MaxBodySize is the max size of the body of an EC2 request. It is
+	// the limit by which net/http parses a form.
+	ec2MaxBodySize = 10 << 20
+)
+
+// The codes of the EC2 errors of authentication
+const (
+	ec2ErrAuthFailure    = "AuthFailure"
+	ec2ErrRequestExpired = "RequestExpired"
+)
+
+// ec2AdminKey is the key of the context of an EC2 request that is signed by
+// the access keys of the admin scope
+type ec2AdminKey struct{}
+
+// ec2AdminSigned verifies if the EC2 request was signed by the access keys of
+// the admin scope
+func ec2AdminSigned(req *http.Request) bool {
+	signed, _ := req.Context().Value(ec2AdminKey{}).(bool)
+	return signed
+}
+
+// sigV4Auth is the parsed Authorization header of a SigV4 signed request
+type sigV4Auth struct {
+	accessKeyID   string
+	date          string
+	region        string
+	service       string
+	signedHeaders []string
+	signature     string
+}
+
+// ec2Authenticate verifies the AWS Signature Version 4 of the EC2 request if
+// it is signed by the access key id of the admin scope. The returned request
+// is then authorized as the admin. The requests that are not signed, or are
+// signed by other access keys, are served anonymously as before.
+func (s *HTTPServer) ec2Authenticate(req *http.Request) (*http.Request, error) {
+	conf := s.maya.Config()
+	if conf.EC2AccessKeyID == "" {
+		return req, nil
+	}
+
+	header := req.Header.Get("Authorization")
+	if !strings.HasPrefix(header, sigV4Algorithm+" ") {
+		return req, nil
+	}
+
+	auth, err := parseSigV4Auth(header)
+	if err != nil {
+		return nil, newEC2Error(401, ec2ErrAuthFailure, "%v", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(auth.accessKeyID), []byte(conf.EC2AccessKeyID)) != 1 {
+		return req, nil
+	}
+
+	signedAt, err := time.Parse(sigV4TimeFormat, req.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return nil, newEC2Error(401, ec2ErrAuthFailure, "The request must contain a valid X-Amz-Date header")
+	}
+	if skew := time.Since(signedAt); skew > sigV4MaxSkew || skew < -sigV4MaxSkew {
+		return nil, newEC2Error(401, ec2ErrRequestExpired, "The request was signed at %s which is beyond the allowed skew of %s", signedAt.Format(sigV4TimeFormat), sigV4MaxSkew)
+	}
+	if auth.date != signedAt.Format("20060102") || auth.service != "ec2" {
+		return nil, newEC2Error(401, ec2ErrAuthFailure, "Invalid credential scope %s/%s/%s", auth.date, auth.region, auth.service)
+	}
+
+	// The body is read to be hashed & is restored to be parsed as the form
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, ec2MaxBodySize+1))
+	if err != nil {
+		return nil, newEC2Error(400, ec2ErrInvalidParameter, "Failed to read the request: %v", err)
+	}
+	if len(body) > ec2MaxBodySize {
+		return nil, newEC2Error(400, ec2ErrInvalidParameter, "The request is larger than %d bytes", ec2MaxBodySize)
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	expected := sigV4Signature(conf.EC2SecretAccessKey, auth, sigV4CanonicalRequest(req, auth.signedHeaders, body), req.Header.Get("X-Amz-Date"))
+	if !hmac.Equal([]byte(expected), []byte(auth.signature)) {
+		return nil, newEC2Error(401, ec2ErrAuthFailure, "The request signature does not match the signature of access key id %s", auth.accessKeyID)
+	}
+
+	return req.WithContext(context.WithValue(req.Context(), ec2AdminKey{}, true)), nil
+}
+
+// parseSigV4Auth parses the Authorization header of a SigV4 signed request
+// e.g. AWS4-HMAC-SHA256 Credential=AKID/20170101/us-east-1/ec2/aws4_request,
+// SignedHeaders=host;x-amz-date, Signature=...
+func parseSigV4Auth(header string) (*sigV4Auth, error) {
+	auth := &sigV4Auth{}
+	for _, part := range strings.Split(strings.TrimPrefix(header, sigV4Algorithm+" "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Invalid Authorization header")
+		}
+
+		switch kv[0] {
+		case "Credential":
+			scope := strings.Split(kv[1], "/")
+			if len(scope) != 5 || scope[4] != "aws4_request" {
+				return nil, fmt.Errorf("Invalid credential %s", kv[1])
+			}
+			auth.accessKeyID, auth.date, auth.region, auth.service = scope[0], scope[1], scope[2], scope[3]
+		case "SignedHeaders":
+			auth.signedHeaders = strings.Split(kv[1], ";")
+		case "Signature":
+			auth.signature = kv[1]
+		}
+	}
+
+	if auth.accessKeyID == "" || len(auth.signedHeaders) == 0 || auth.signature == "" {
+		return nil, fmt.Errorf("The Authorization header must contain the Credential, SignedHeaders & Signature")
+	}
+	return auth, nil
+}
+
+// sigV4CanonicalRequest returns the canonical form of the request that is
+// signed as per SigV4
+func sigV4CanonicalRequest(req *http.Request, signedHeaders []string, body []byte) string {
+	var headers []string
+	for _, name := range signedHeaders {
+		var raw []string
+		switch name {
+		case "host":
+			raw = []string{req.Host}
+		case "content-length":
+			raw = []string{strconv.FormatInt(req.ContentLength, 10)}
+		default:
+			raw = req.Header[http.CanonicalHeaderKey(name)]
+		}
+
+		var values []string
+		for _, v := range raw {
+			values = append(values, strings.Join(strings.Fields(v), " "))
+		}
+		headers = append(headers, name+":"+strings.Join(values, ","))
+	}
+
+	payload := sha256.Sum256(body)
+	return strings.Join([]string{
+		req.Method,
+		sigV4URIPath(req.URL.Path),
+		sigV4Query(req.URL.Query()),
+		strings.Join(headers, "\n") + "\n",
+		strings.Join(signedHeaders, ";"),
+		hex.EncodeToString(payload[:]),
+	}, "\n")
+}
+
+// sigV4Signature returns the SigV4 signature of the canonical request by the
+// secret access key
+func sigV4Signature(secret string, auth *sigV4Auth, canonicalRequest, amzDate string) string {
+	scope := strings.Join([]string{auth.date, auth.region, auth.service, "aws4_request"}, "/")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{sigV4Algorithm, amzDate, scope, hex.EncodeToString(hash[:])}, "\n")
+
+	key := []byte("AWS4" + secret)
+	for _, v := range []string{auth.date, auth.region, auth.service, "aws4_request"} {
+		key = hmacSHA256(key, v)
+	}
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// sigV4URIPath encodes every segment of the path as per SigV4
+func sigV4URIPath(path string) string {
+	if path == "" {
+		return "/"
+	}
+
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		segments[i] = sigV4Escape(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+// sigV4Query returns the query sorted by the keys & then by the values with
+// both encoded as per SigV4
+func sigV4Query(query url.Values) string {
+	var params [][2]string
+	for k, vs := range query {
+		for _, v := range vs {
+			params = append(params, [2]string{sigV4Escape(k), sigV4Escape(v)})
+		}
+	}
+	sort.Slice(params, func(i, j int) bool {
+		if params[i][0] != params[j][0] {
+			return params[i][0] < params[j][0]
+		}
+		return params[i][1] < params[j][1]
+	})
+
+	pairs := make([]string, len(params))
+	for i, p := range params {
+		pairs[i] = p[0] + "=" + p[1]
+	}
+	return strings.Join(pairs, "&")
+}
+
+// sigV4Escape percent encodes every byte except the unreserved characters of
+// RFC 3986
+func sigV4Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
@@ -0,0 +1,441 @@
+package server
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openebs/maya/types/v1"
+	"github.com/openebs/mayaserver/lib/config"
+)
+
+// ec2Call runs the EC2 action against the test server & decodes the XML
+// response into out
+func ec2Call(t *testing.T, s *TestServer, params url.Values, out interface{}) int {
+	return ec2CallAs(t, s, "", params, out)
+}
+
+// ec2CallAs is ec2Call authorized by the token
+func ec2CallAs(t *testing.T, s *TestServer, token string, params url.Values, out interface{}) int {
+	req, err := http.NewRequest("POST", "http://"+s.Server.addr+"/ec2/", strings.NewReader(params.Encode()))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/xml") {
+		t.Fatalf("bad content type: %s", ct)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := xml.Unmarshal(body, out); err != nil {
+		t.Fatalf("err: %v %s", err, body)
+	}
+	return resp.StatusCode
+}
+
+func TestEC2Volumes(t *testing.T) {
+	s, _, cleanup := makeAPIClientTestServer(t)
+	defer cleanup()
+
+	// Create a volume named after its CSI name tag
+	var created ec2CreateVolumeResponse
+	code := ec2Call(t, s, url.Values{
+		"Action":                          {"CreateVolume"},
+		"Size":                            {"5"},
+		"AvailabilityZone":                {AnyZone},
+		"TagSpecification.1.ResourceType": {"volume"},
+		"TagSpecification.1.Tag.1.Key":    {"CSIVolumeName"},
+		"TagSpecification.1.Tag.1.Value":  {"pvc-1"},
+		"TagSpecification.1.Tag.2.Key":    {"team"},
+		"TagSpecification.1.Tag.2.Value":  {"storage"},
+	}, &created)
+	if code != 200 {
+		t.Fatalf("bad code: %d", code)
+	}
+	if created.VolumeID != ec2VolumeID("pvc-1") || !strings.HasPrefix(created.VolumeID, "vol-") {
+		t.Fatalf("bad volume id: %s", created.VolumeID)
+	}
+	if created.Size != 5 || created.Status != "available" || len(created.Tags) != 2 {
+		t.Fatalf("bad volume: %#v", created.ec2Volume)
+	}
+	currentFakeOrchestrator.l.Lock()
+	pv := currentFakeOrchestrator.volumes["pvc-1"]
+	currentFakeOrchestrator.l.Unlock()
+	if pv == nil || pv.Annotations[string(v1.VolumeSizeAPILbl)] != "5G" {
+		t.Fatalf("bad provisioned volume: %#v", pv)
+	}
+
+	// Describe the volume by its id & by its name tag
+	var described ec2DescribeVolumesResponse
+	code = ec2Call(t, s, url.Values{
+		"Action":     {"DescribeVolumes"},
+		"VolumeId.1": {created.VolumeID},
+	}, &described)
+	if code != 200 || len(described.Volumes) != 1 || described.Volumes[0].Size != 5 {
+		t.Fatalf("bad describe: %d %#v", code, described)
+	}
+
+	described = ec2DescribeVolumesResponse{}
+	ec2Call(t, s, url.Values{
+		"Action":           {"DescribeVolumes"},
+		"Filter.1.Name":    {"tag:CSIVolumeName"},
+		"Filter.1.Value.1": {"pvc-1"},
+	}, &described)
+	if len(described.Volumes) != 1 || described.Volumes[0].VolumeID != created.VolumeID {
+		t.Fatalf("bad describe: %#v", described)
+	}
+
+	described = ec2DescribeVolumesResponse{}
+	ec2Call(t, s, url.Values{
+		"Action":           {"DescribeVolumes"},
+		"Filter.1.Name":    {"tag:CSIVolumeName"},
+		"Filter.1.Value.1": {"pvc-2"},
+	}, &described)
+	if len(described.Volumes) != 0 {
+		t.Fatalf("expected no volumes: %#v", described)
+	}
+
+	// Delete the volume by its id
+	var deleted ec2DeleteVolumeResponse
+	code = ec2Call(t, s, url.Values{
+		"Action":   {"DeleteVolume"},
+		"VolumeId": {created.VolumeID},
+	}, &deleted)
+	if code != 200 || !deleted.Return {
+		t.Fatalf("bad delete: %d %#v", code, deleted)
+	}
+
+	// The deleted volume does not exist anymore
+	var failed ec2ErrorResponse
+	code = ec2Call(t, s, url.Values{
+		"Action":     {"DescribeVolumes"},
+		"VolumeId.1": {created.VolumeID},
+	}, &failed)
+	if code != 400 || len(failed.Errors) != 1 || failed.Errors[0].Code != ec2ErrVolumeNotFound {
+		t.Fatalf("bad error: %d %#v", code, failed)
+	}
+}
+
+func TestEC2Errors(t *testing.T) {
+	s, _, cleanup := makeAPIClientTestServer(t)
+	defer cleanup()
+
+	cases := []struct {
+		params url.Values
+		code   string
+	}{
+		{url.Values{}, ec2ErrMissingAction},
+		{url.Values{"Action": {"RunInstances"}}, ec2ErrInvalidAction},
+		{url.Values{"Action": {"CreateVolume"}}, ec2ErrMissingParameter},
+		{url.Values{"Action": {"CreateVolume"}, "Size": {"-1"}}, ec2ErrInvalidParameter},
+		{url.Values{"Action": {"CreateVolume"}, "Size": {"1"}, "SnapshotId": {"snap-1"}}, ec2ErrUnsupportedOperation},
+		{url.Values{"Action": {"DeleteVolume"}, "VolumeId": {"vol-missing"}}, ec2ErrVolumeNotFound},
+		{url.Values{"Action": {"DescribeVolumes"}, "Filter.1.Name": {"encrypted"}}, ec2ErrInvalidParameter},
+		{url.Values{"Action": {"AttachVolume"}}, ec2ErrMissingParameter},
+		{url.Values{"Action": {"CreateSnapshot"}}, ec2ErrUnsupportedOperation},
+		{url.Values{"Action": {"DescribeSnapshots"}}, ec2ErrUnsupportedOperation},
+	}
+	for _, c := range cases {
+		var failed ec2ErrorResponse
+		if code := ec2Call(t, s, c.params, &failed); code != 400 {
+			t.Fatalf("bad code for %v: %d", c.params, code)
+		}
+		if len(failed.Errors) != 1 || failed.Errors[0].Code != c.code {
+			t.Fatalf("expected %s for %v, got: %#v", c.code, c.params, failed)
+		}
+	}
+}
+
+func TestEC2VolumeSize(t *testing.T) {
+	cases := map[string]int{
+		"5G":   5,
+		"10Gi": 10,
+		"2T":   2048,
+		"512M": 0,
+		"":     0,
+	}
+	for size, expected := range cases {
+		if actual := ec2VolumeSize(size); actual != expected {
+			t.Fatalf("bad size of %s: %d", size, actual)
+		}
+	}
+}
+
+func TestEC2Attachments(t *testing.T) {
+	s, _, cleanup := makeAPIClientTestServerWithConfig(t, func(mc *config.MayaConfig) {
+		mc.AdminToken = testAdminToken
+	})
+	defer cleanup()
+
+	var created ec2CreateVolumeResponse
+	ec2Call(t, s, url.Values{
+		"Action":                          {"CreateVolume"},
+		"Size":                            {"1"},
+		"TagSpecification.1.ResourceType": {"volume"},
+		"TagSpecification.1.Tag.1.Key":    {"Name"},
+		"TagSpecification.1.Tag.1.Value":  {"vol1"},
+	}, &created)
+
+	var attached ec2AttachmentResponse
+	code := ec2Call(t, s, url.Values{
+		"Action":     {"AttachVolume"},
+		"VolumeId":   {created.VolumeID},
+		"InstanceId": {"i-1"},
+		"Device":     {"/dev/xvdba"},
+	}, &attached)
+	if code != 200 || attached.XMLName.Local != "AttachVolumeResponse" ||
+		attached.Status != "attached" || attached.Device != "/dev/xvdba" || attached.InstanceID != "i-1" {
+		t.Fatalf("bad attach: %d %#v", code, attached)
+	}
+
+	// The attached volume is in use
+	var described ec2DescribeVolumesResponse
+	ec2Call(t, s, url.Values{
+		"Action":           {"DescribeVolumes"},
+		"Filter.1.Name":    {"attachment.instance-id"},
+		"Filter.1.Value.1": {"i-1"},
+	}, &described)
+	if len(described.Volumes) != 1 || described.Volumes[0].Status != "in-use" ||
+		len(described.Volumes[0].Attachments) != 1 || described.Volumes[0].Attachments[0].Device != "/dev/xvdba" {
+		t.Fatalf("bad describe: %#v", described)
+	}
+
+	// The volume is neither attached to another instance nor deleted
+	for _, params := range []url.Values{
+		{"Action": {"AttachVolume"}, "VolumeId": {created.VolumeID}, "InstanceId": {"i-2"}, "Device": {"/dev/xvdba"}},
+		{"Action": {"DeleteVolume"}, "VolumeId": {created.VolumeID}},
+	} {
+		var failed ec2ErrorResponse
+		if code := ec2Call(t, s, params, &failed); code != 400 || failed.Errors[0].Code != ec2ErrVolumeInUse {
+			t.Fatalf("bad error: %d %#v", code, failed)
+		}
+	}
+
+	// The volume is detached via the admin token only
+	detach := url.Values{
+		"Action":   {"DetachVolume"},
+		"VolumeId": {created.VolumeID},
+	}
+	for _, token := range []string{"", "bad"} {
+		var failed ec2ErrorResponse
+		if code := ec2CallAs(t, s, token, detach, &failed); code != 403 || failed.Errors[0].Code != ec2ErrUnauthorized {
+			t.Fatalf("bad error for %q: %d %#v", token, code, failed)
+		}
+	}
+
+	var detached ec2AttachmentResponse
+	code = ec2CallAs(t, s, testAdminToken, detach, &detached)
+	if code != 200 || detached.XMLName.Local != "DetachVolumeResponse" ||
+		detached.Status != "detached" || detached.InstanceID != "i-1" {
+		t.Fatalf("bad detach: %d %#v", code, detached)
+	}
+
+	var failed ec2ErrorResponse
+	code = ec2Call(t, s, url.Values{
+		"Action":   {"DetachVolume"},
+		"VolumeId": {created.VolumeID},
+	}, &failed)
+	if code != 400 || failed.Errors[0].Code != ec2ErrIncorrectState {
+		t.Fatalf("bad error: %d %#v", code, failed)
+	}
+
+	var deleted ec2DeleteVolumeResponse
+	if code := ec2Call(t, s, url.Values{"Action": {"DeleteVolume"}, "VolumeId": {created.VolumeID}}, &deleted); code != 200 {
+		t.Fatalf("bad delete: %d %#v", code, deleted)
+	}
+}
+
+// ec2CallSigned is ec2Call signed by the access keys via SigV4 at the time
+func ec2CallSigned(t *testing.T, s *TestServer, accessKeyID, secret string, at time.Time, params url.Values, out interface{}) int {
+	body := params.Encode()
+	req, err := http.NewRequest("POST", "http://"+s.Server.addr+"/ec2/", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Amz-Date", at.UTC().Format(sigV4TimeFormat))
+
+	auth := &sigV4Auth{
+		accessKeyID:   accessKeyID,
+		date:          at.UTC().Format("20060102"),
+		region:        "us-east-1",
+		service:       "ec2",
+		signedHeaders: []string{"content-type", "host", "x-amz-date"},
+	}
+	signature := sigV4Signature(secret, auth, sigV4CanonicalRequest(req, auth.signedHeaders, []byte(body)), req.Header.Get("X-Amz-Date"))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s/%s/%s/aws4_request, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, accessKeyID, auth.date, auth.region, auth.service, strings.Join(auth.signedHeaders, ";"), signature))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := xml.Unmarshal(b, out); err != nil {
+		t.Fatalf("err: %v %s", err, b)
+	}
+	return resp.StatusCode
+}
+
+func TestSigV4Signature(t *testing.T) {
+	// The get-vanilla case of the AWS SigV4 test suite
+	req, err := http.NewRequest("GET", "http://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req.Header.Set("X-Amz-Date", "20150830T123600Z")
+
+	auth, err := parseSigV4Auth("AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	signature := sigV4Signature("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", auth,
+		sigV4CanonicalRequest(req, auth.signedHeaders, nil), "20150830T123600Z")
+	if signature != auth.signature {
+		t.Fatalf("bad signature: %s", signature)
+	}
+
+	if q := sigV4Query(url.Values{"b": {"2"}, "a-b": {"1"}, "a": {"z", "y x"}}); q != "a=y%20x&a=z&a-b=1&b=2" {
+		t.Fatalf("bad query: %s", q)
+	}
+}
+
+func TestEC2SignedDetach(t *testing.T) {
+	const accessKeyID, secret = "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	s, _, cleanup := makeAPIClientTestServerWithConfig(t, func(mc *config.MayaConfig) {
+		mc.EC2AccessKeyID = accessKeyID
+		mc.EC2SecretAccessKey = secret
+	})
+	defer cleanup()
+
+	var created ec2CreateVolumeResponse
+	ec2Call(t, s, url.Values{"Action": {"CreateVolume"}, "Size": {"1"}, "ClientToken": {"tok1"}}, &created)
+
+	// The EBS volume plugins sign every request. The other access keys are
+	// served anonymously.
+	var attached ec2AttachmentResponse
+	attach := url.Values{
+		"Action":     {"AttachVolume"},
+		"VolumeId":   {created.VolumeID},
+		"InstanceId": {"i-1"},
+		"Device":     {"/dev/xvdf"},
+	}
+	if code := ec2CallSigned(t, s, "AKIDOTHER", secret, time.Now(), attach, &attached); code != 200 {
+		t.Fatalf("bad code: %d", code)
+	}
+
+	detach := url.Values{"Action": {"DetachVolume"}, "VolumeId": {created.VolumeID}}
+	var failed ec2ErrorResponse
+	if code := ec2CallSigned(t, s, "AKIDOTHER", secret, time.Now(), detach, &failed); code != 403 || failed.Errors[0].Code != ec2ErrUnauthorized {
+		t.Fatalf("expected unauthorized, got: %d %v", code, failed.Errors)
+	}
+
+	// The signatures of the admin access key id are verified
+	failed = ec2ErrorResponse{}
+	if code := ec2CallSigned(t, s, accessKeyID, "not-the-secret", time.Now(), detach, &failed); code != 401 || failed.Errors[0].Code != ec2ErrAuthFailure {
+		t.Fatalf("expected auth failure, got: %d %v", code, failed.Errors)
+	}
+	failed = ec2ErrorResponse{}
+	if code := ec2CallSigned(t, s, accessKeyID, secret, time.Now().Add(-time.Hour), detach, &failed); code != 401 || failed.Errors[0].Code != ec2ErrRequestExpired {
+		t.Fatalf("expected request expired, got: %d %v", code, failed.Errors)
+	}
+
+	// A repeated attach & a detach are authorized as the admin
+	if code := ec2CallSigned(t, s, accessKeyID, secret, time.Now(), attach, &attached); code != 200 {
+		t.Fatalf("bad code: %d", code)
+	}
+	var detached ec2AttachmentResponse
+	if code := ec2CallSigned(t, s, accessKeyID, secret, time.Now(), detach, &detached); code != 200 || detached.Status != "detached" {
+		t.Fatalf("bad detach: %d %#v", code, detached)
+	}
+}
+
+func TestEC2NoLister(t *testing.T) {
+	s, _, cleanup := makeAPIClientTestServer(t)
+	defer cleanup()
+
+	var created ec2CreateVolumeResponse
+	ec2Call(t, s, url.Values{"Action": {"CreateVolume"}, "Size": {"1"}, "ClientToken": {"tok1"}}, &created)
+
+	// A volume created by an earlier release is resolved via a listing once
+	currentFakeOrchestrator.l.Lock()
+	currentFakeOrchestrator.volumes["vol2"] = &v1.PersistentVolume{}
+	currentFakeOrchestrator.volumes["vol2"].Name = "vol2"
+	currentFakeOrchestrator.l.Unlock()
+
+	var described ec2DescribeVolumesResponse
+	if code := ec2Call(t, s, url.Values{"Action": {"DescribeVolumes"}, "VolumeId.1": {ec2VolumeID("vol2")}}, &described); code != 200 {
+		t.Fatalf("bad code: %d", code)
+	}
+
+	currentFakeOrchestrator.l.Lock()
+	currentFakeOrchestrator.listErr = fmt.Errorf("ListStorage is not implemented")
+	currentFakeOrchestrator.l.Unlock()
+
+	// The known volume ids are resolved without a listing
+	described = ec2DescribeVolumesResponse{}
+	code := ec2Call(t, s, url.Values{
+		"Action":     {"DescribeVolumes"},
+		"VolumeId.1": {created.VolumeID},
+		"VolumeId.2": {ec2VolumeID("vol2")},
+	}, &described)
+	if code != 200 || len(described.Volumes) != 2 {
+		t.Fatalf("bad describe: %d %#v", code, described)
+	}
+
+	var attached ec2AttachmentResponse
+	code = ec2Call(t, s, url.Values{
+		"Action":     {"AttachVolume"},
+		"VolumeId":   {created.VolumeID},
+		"InstanceId": {"i-1"},
+		"Device":     {"/dev/xvdf"},
+	}, &attached)
+	if code != 200 || attached.Status != "attached" {
+		t.Fatalf("bad attach: %d %#v", code, attached)
+	}
+
+	// The rest need a listing & are not supported
+	for _, params := range []url.Values{
+		{"Action": {"DescribeVolumes"}},
+		{"Action": {"DeleteVolume"}, "VolumeId": {ec2VolumeID("vol3")}},
+	} {
+		var failed ec2ErrorResponse
+		if code := ec2Call(t, s, params, &failed); code != 400 || failed.Errors[0].Code != ec2ErrUnsupportedOperation {
+			t.Fatalf("expected unsupported operation, got: %d %v", code, failed.Errors)
+		}
+	}
+
+	// The ids of the deleted volumes are not resolved
+	var deleted ec2DeleteVolumeResponse
+	if code := ec2Call(t, s, url.Values{"Action": {"DeleteVolume"}, "VolumeId": {ec2VolumeID("vol2")}}, &deleted); code != 200 {
+		t.Fatalf("bad code: %d", code)
+	}
+	if keys := s.Maya.state.Keys(ec2VolumesBucket); len(keys) != 1 || keys[0] != created.VolumeID {
+		t.Fatalf("bad state: %v", keys)
+	}
+}
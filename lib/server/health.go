@@ -0,0 +1,310 @@
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/openebs/maya/types/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// HealthPassing is the status of a health check that succeeded
+	HealthPassing = "passing"
+
+	// HealthWarning is the status of a non critical health check that failed
+	HealthWarning = "warning"
+
+	// HealthCritical is the status of a critical health check that failed
+	HealthCritical = "critical"
+
+	// defaultHealthCheckTimeout is the duration a health check is allowed to
+	// run if the check does not specify its own timeout
+	defaultHealthCheckTimeout = 5 * time.Second
+
+	// defaultHealthCheckTTL is the duration for which the result of a health
+	// check is cached
+	defaultHealthCheckTTL = 10 * time.Second
+)
+
+// HealthCheck is a named check that verifies if maya api server is able to
+// reach one of its dependencies e.g. an orchestrator.
+type HealthCheck struct {
+	// Name of the health check e.g. orchprovider.kubernetes
+	Name string
+
+	// Critical flags if a failure of this check makes maya api server unready
+	Critical bool
+
+	// Timeout is the duration this check is allowed to run
+	Timeout time.Duration
+
+	// Check verifies the dependency & returns an error if it is not healthy
+	Check func(timeout time.Duration) (string, error)
+}
+
+// HealthCheckResult is the outcome of running a health check
+type HealthCheckResult struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Critical  bool      `json:"critical"`
+	Output    string    `json:"output,omitempty"`
+	Latency   string    `json:"latency"`
+	CheckedAt time.Time `json:"checkedAt"`
+	Cached    bool      `json:"cached"`
+}
+
+// HealthReport is the aggregated outcome of all the registered health checks
+type HealthReport struct {
+	Status string              `json:"status"`
+	Checks []HealthCheckResult `json:"checks"`
+}
+
+// healthChecker runs the registered health checks. The result of a check is
+// cached for a ttl, so that frequent probes do not overwhelm the
+// dependencies.
+type healthChecker struct {
+	sync.Mutex
+	ttl    time.Duration
+	checks map[string]*cachedHealthCheck
+
+	// track registers a run of a check as an operation in flight, if set.
+	// A check that times out keeps running in the background & a graceful
+	// exit waits for it.
+	track func(desc string) (func(), bool)
+}
+
+// cachedHealthCheck holds a health check along with its last result
+type cachedHealthCheck struct {
+	sync.Mutex
+	check HealthCheck
+	last  *HealthCheckResult
+}
+
+func newHealthChecker(ttl time.Duration) *healthChecker {
+	return &healthChecker{
+		ttl:    ttl,
+		checks: make(map[string]*cachedHealthCheck),
+	}
+}
+
+// register adds a health check. A check with the same name is replaced.
+func (h *healthChecker) register(check HealthCheck) {
+	if check.Timeout <= 0 {
+		check.Timeout = defaultHealthCheckTimeout
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	h.checks[check.Name] = &cachedHealthCheck{check: check}
+}
+
+// run executes all the registered health checks concurrently & returns the
+// aggregated report
+func (h *healthChecker) run() *HealthReport {
+	h.Lock()
+	checks := make([]*cachedHealthCheck, 0, len(h.checks))
+	for _, c := range h.checks {
+		checks = append(checks, c)
+	}
+	h.Unlock()
+
+	results := make([]HealthCheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *cachedHealthCheck) {
+			defer wg.Done()
+			results[i] = c.result(h.ttl, h.track)
+		}(i, c)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+
+	report := &HealthReport{
+		Status: HealthPassing,
+		Checks: results,
+	}
+	for _, r := range results {
+		if r.Status == HealthCritical {
+			report.Status = HealthCritical
+			break
+		}
+		if r.Status == HealthWarning {
+			report.Status = HealthWarning
+		}
+	}
+
+	return report
+}
+
+// result returns the cached result of the check if it is still fresh,
+// otherwise the check is run again. The run is registered via track if set.
+func (c *cachedHealthCheck) result(ttl time.Duration, track func(desc string) (func(), bool)) HealthCheckResult {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.last != nil && time.Since(c.last.CheckedAt) < ttl {
+		cached := *c.last
+		cached.Cached = true
+		return cached
+	}
+
+	type outcome struct {
+		output string
+		err    error
+	}
+	outCh := make(chan outcome, 1)
+
+	// The check is not run once a graceful exit is waiting for the
+	// operations in flight
+	done, ok := func() {}, true
+	if track != nil {
+		done, ok = track("health: check " + c.check.Name)
+	}
+
+	start := time.Now()
+	if ok {
+		go func() {
+			defer done()
+
+			output, err := c.check.Check(c.check.Timeout)
+			outCh <- outcome{output, err}
+		}()
+	} else {
+		outCh <- outcome{err: fmt.Errorf("maya api server is exiting")}
+	}
+
+	var out outcome
+	select {
+	case out = <-outCh:
+	case <-time.After(c.check.Timeout):
+		out.err = fmt.Errorf("timed out after %v", c.check.Timeout)
+	}
+
+	res := &HealthCheckResult{
+		Name:      c.check.Name,
+		Status:    HealthPassing,
+		Critical:  c.check.Critical,
+		Output:    out.output,
+		Latency:   time.Since(start).String(),
+		CheckedAt: time.Now(),
+	}
+	if out.err != nil {
+		res.Output = out.err.Error()
+		res.Status = HealthWarning
+		if c.check.Critical {
+			res.Status = HealthCritical
+		}
+	}
+	c.last = res
+
+	return *res
+}
+
+// registerHealthChecks registers the health checks of the dependencies of
+// maya api server i.e. its orchestrators & its state
+func (ms *MayaApiServer) registerHealthChecks() {
+	// The orchestrator that maya api server is configured to work with is
+	// critical. Other orchestrators are reported but do not affect readiness.
+	defOrch := ms.Config().ServiceProvider
+	if defOrch == "" {
+		defOrch = v1.DefaultOrchestratorName()
+	}
+
+	ms.health.register(HealthCheck{
+		Name:     "orchprovider." + string(v1.K8sOrchestrator),
+		Critical: defOrch == string(v1.K8sOrchestrator),
+		Check:    checkK8sReachable,
+	})
+
+	ms.health.register(HealthCheck{
+		Name:     "orchprovider." + string(v1.NomadOrchestrator),
+		Critical: defOrch == string(v1.NomadOrchestrator),
+		Check:    checkNomadReachable,
+	})
+
+	ms.health.register(HealthCheck{
+		Name:     "state",
+		Critical: true,
+		Check: func(timeout time.Duration) (string, error) {
+			return checkDataDirWritable(ms.Config().DataDir)
+		},
+	})
+}
+
+// checkK8sReachable verifies if the Kubernetes API server is reachable. It
+// uses the in-cluster configuration similar to the K8s orchestrator.
+func checkK8sReachable(timeout time.Duration) (string, error) {
+	conf, err := rest.InClusterConfig()
+	if err != nil {
+		return "", err
+	}
+	conf.Timeout = timeout
+
+	cs, err := kubernetes.NewForConfig(conf)
+	if err != nil {
+		return "", err
+	}
+
+	ver, err := cs.Discovery().ServerVersion()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Kubernetes %s reachable at %s", ver.GitVersion, conf.Host), nil
+}
+
+// checkNomadReachable verifies if the Nomad agent is reachable. The address
+// & region are derived similar to the Nomad orchestrator.
+func checkNomadReachable(timeout time.Duration) (string, error) {
+	profileMap := map[string]string{
+		string(v1.OrchestratorNameLbl): string(v1.NomadOrchestrator),
+	}
+
+	conf := api.DefaultConfig()
+	conf.Region = v1.GetOrchestratorRegion(profileMap)
+	conf.Address = v1.GetOrchestratorAddress(profileMap)
+	conf.HttpClient.Timeout = timeout
+
+	client, err := api.NewClient(conf)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := client.Agent().Self(); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Nomad agent reachable at %s", conf.Address), nil
+}
+
+// checkDataDirWritable verifies if maya api server can persist its state in
+// the data directory
+func checkDataDirWritable(dataDir string) (string, error) {
+	if dataDir == "" {
+		return "No data directory configured", nil
+	}
+
+	f, err := ioutil.TempFile(dataDir, ".health")
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+
+	if err := os.Remove(f.Name()); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Data directory %s is writable", dataDir), nil
+}
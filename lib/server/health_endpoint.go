@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// HealthSpecificRequest is a http handler implementation. It deals with
+// liveness & readiness probes of maya api server.
+func (s *HTTPServer) HealthSpecificRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+
+	path := strings.TrimPrefix(req.URL.Path, "/v1/health")
+
+	// Is req valid ?
+	if path == req.URL.Path {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+
+	if req.Method != "GET" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+
+	switch path {
+	case "/live":
+		return s.healthLive(resp, req)
+	case "/ready":
+		return s.healthReady(resp, req)
+	default:
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+}
+
+// healthLive reports that maya api server process is up & serving requests.
+// It does not verify any dependencies.
+func (s *HTTPServer) healthLive(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	return &HealthReport{
+		Status: HealthPassing,
+		Checks: []HealthCheckResult{},
+	}, nil
+}
+
+// healthReady runs the registered health checks & reports if maya api server
+// is ready to serve volume requests. A failed critical check results in a
+// 503 along with the detailed report.
+func (s *HTTPServer) healthReady(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	report := s.maya.health.run()
+
+	if report.Status == HealthCritical {
+		return CodedResponse(503, report), nil
+	}
+
+	return report, nil
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthLive(t *testing.T) {
+	s := makeHTTPTestServer(t, nil)
+	defer s.Cleanup()
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/health/live", nil)
+
+	s.Server.wrap(RequestCounter, RequestDuration, s.Server.HealthSpecificRequest)(resp, req)
+
+	if resp.Code != 200 {
+		t.Fatalf("err http resp code, expected: 200, got: %v", resp.Code)
+	}
+
+	var report HealthReport
+	if err := json.Unmarshal(resp.Body.Bytes(), &report); err != nil {
+		t.Fatalf("err decoding response: %v", err)
+	}
+
+	if report.Status != HealthPassing {
+		t.Fatalf("expected status: %s, got: %s", HealthPassing, report.Status)
+	}
+}
+
+func TestInvalidReqHealth(t *testing.T) {
+	s := makeHTTPTestServer(t, nil)
+	defer s.Cleanup()
+
+	cases := []struct {
+		method string
+		path   string
+	}{
+		{"POST", "/v1/health/live"},
+		{"GET", "/v1/health/unknown"},
+		{"GET", "/health/live"},
+	}
+
+	for _, tc := range cases {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest(tc.method, tc.path, nil)
+
+		out, err := s.Server.HealthSpecificRequest(resp, req)
+		if err == nil || err.Error() != ErrInvalidMethod {
+			t.Fatalf("%s %s: expected: %v, got: %v", tc.method, tc.path, ErrInvalidMethod, err)
+		}
+
+		if out != nil {
+			t.Fatalf("Service must not return any value, for invalid request")
+		}
+	}
+}
+
+func TestHealthReady(t *testing.T) {
+	cases := []struct {
+		name       string
+		critical   bool
+		err        error
+		code       int
+		status     string
+		checkState string
+	}{
+		{"passing", true, nil, 200, HealthPassing, HealthPassing},
+		{"failing non critical", false, fmt.Errorf("unreachable"), 200, HealthWarning, HealthWarning},
+		{"failing critical", true, fmt.Errorf("unreachable"), 503, HealthCritical, HealthCritical},
+	}
+
+	for _, tc := range cases {
+		s := makeHTTPTestServer(t, nil)
+
+		s.Maya.health = newHealthChecker(defaultHealthCheckTTL)
+		err := tc.err
+		s.Maya.health.register(HealthCheck{
+			Name:     "dummy",
+			Critical: tc.critical,
+			Check: func(timeout time.Duration) (string, error) {
+				return "ok", err
+			},
+		})
+
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/health/ready", nil)
+		s.Server.wrap(RequestCounter, RequestDuration, s.Server.HealthSpecificRequest)(resp, req)
+		s.Cleanup()
+
+		if resp.Code != tc.code {
+			t.Fatalf("%s: expected http code: %d, got: %d", tc.name, tc.code, resp.Code)
+		}
+
+		if contentType := resp.Header().Get("Content-Type"); contentType != "application/json" {
+			t.Fatalf("%s: Content-Type header was not 'application/json'", tc.name)
+		}
+
+		var report HealthReport
+		if err := json.Unmarshal(resp.Body.Bytes(), &report); err != nil {
+			t.Fatalf("%s: err decoding response: %v", tc.name, err)
+		}
+
+		if report.Status != tc.status {
+			t.Fatalf("%s: expected status: %s, got: %s", tc.name, tc.status, report.Status)
+		}
+
+		if len(report.Checks) != 1 || report.Checks[0].Status != tc.checkState {
+			t.Fatalf("%s: bad checks: %#v", tc.name, report.Checks)
+		}
+
+		if report.Checks[0].Latency == "" {
+			t.Fatalf("%s: expected latency of the check", tc.name)
+		}
+	}
+}
+
+func TestHealthCheckerCachesResults(t *testing.T) {
+	var runs int32
+	h := newHealthChecker(time.Minute)
+	h.register(HealthCheck{
+		Name: "counted",
+		Check: func(timeout time.Duration) (string, error) {
+			atomic.AddInt32(&runs, 1)
+			return "", nil
+		},
+	})
+
+	first := h.run()
+	second := h.run()
+
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Fatalf("expected the check to run once, ran: %d", n)
+	}
+
+	if first.Checks[0].Cached || !second.Checks[0].Cached {
+		t.Fatalf("expected only the second result to be cached: %#v %#v", first.Checks, second.Checks)
+	}
+}
+
+func TestHealthCheckerTimeout(t *testing.T) {
+	h := newHealthChecker(0)
+	h.register(HealthCheck{
+		Name:     "slow",
+		Critical: true,
+		Timeout:  50 * time.Millisecond,
+		Check: func(timeout time.Duration) (string, error) {
+			time.Sleep(time.Second)
+			return "", nil
+		},
+	})
+
+	start := time.Now()
+	report := h.run()
+
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Fatalf("check was not bound by its timeout, took: %v", elapsed)
+	}
+
+	if report.Status != HealthCritical {
+		t.Fatalf("expected status: %s, got: %s", HealthCritical, report.Status)
+	}
+
+	if !strings.Contains(report.Checks[0].Output, "timed out") {
+		t.Fatalf("expected timeout in output, got: %s", report.Checks[0].Output)
+	}
+}
@@ -3,13 +3,15 @@ package server
 // This is an adaptation of Hashicorp's Nomad library.
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	//	"github.com/NYTimes/gziphandler"
 	"github.com/ghodss/yaml"
+	"github.com/openebs/mayaserver/lib/api"
 	"github.com/openebs/mayaserver/lib/config"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/ugorji/go/codec"
 	"io"
 	"io/ioutil"
@@ -18,6 +20,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -33,65 +36,6 @@ var (
 	// structs. The pretty handle will add indents for easier human consumption.
 	jsonHandle       = &codec.JsonHandle{}
 	jsonHandlePretty = &codec.JsonHandle{Indent: 4}
-
-	// A histogram samples observations (usually things like request durations
-	// or response sizes) and counts them in configurable buckets. It also
-	// provides a sum of all observed values.
-
-	// Buckets : Holds different time intervals to query for
-	// response time of the Request (GET,POST) of a network
-	// service.
-	// Accepted Values : Time Intervals in seconds
-	// Default value :{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
-
-	// We need to have new variables to hold counter and duration for every
-	// endpoint (apis).
-
-	// These counters donot reset to zero if container restarts.i.e, it will
-	// be increasing from time to time based on how many times a service is
-	// requested.
-
-	// latestOpenEBSVolumeRequestDuration Collects the response time since a
-	// request has been made on /latest/volumes
-	latestOpenEBSVolumeRequestDuration = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "latest_openebs_volume_request_duration_seconds",
-			Help:    "Request response time of the /latest/volumes.",
-			Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, .5, 1, 2.5, 5, 10},
-		},
-		// code is http code and method is http method returned by
-		// endpoint "/latest/volumes"
-		[]string{"code", "method"},
-	)
-	// latestOpenEBSVolumeRequestCounter Count the no of request Since a
-	// request has been made on /latest/volumes
-	latestOpenEBSVolumeRequestCounter = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "latest_openebs_volume_requests_total",
-			Help: "Total number of /latest/volumes requests.",
-		},
-		[]string{"code", "method"},
-	)
-	// latestOpenEBSMetaDataRequestDuration Collects the response time since
-	// a request has been made on /latest/meta-data
-	latestOpenEBSMetaDataRequestDuration = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "latest_openebs_meta_data_request_duration_seconds",
-			Help:    "Request response time of the /latest/meta-data.",
-			Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.5, 1, 2.5, 5, 10},
-		},
-		// code is http code and method is http method returned by
-		// endpoint "/latest/meta-data"
-		[]string{"code", "method"},
-	)
-	// Count the no of request Since a request has been made on /latest/meta-data
-	latestOpenEBSMetaDataRequestCounter = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "latest_openebs_meta_data_requests_total",
-			Help: "Total number of /latest/meta-data requests.",
-		},
-		[]string{"code", "method"},
-	)
 )
 
 // HTTPServer is used to wrap maya api server and expose it over an HTTP interface
@@ -102,24 +46,41 @@ type HTTPServer struct {
 	maya *MayaApiServer
 
 	mux      *http.ServeMux
+	server   *http.Server
 	listener net.Listener
 	logger   *log.Logger
 	addr     string
-}
 
-// init registers Prometheus metrics.It's good to register these varibles here
-// otherwise you need to register it before you are going to use it. So you will
-// have to register it everytime unnecessarily, instead initialize it once and
-// use anywhere at anytime through the code.
-func init() {
-	prometheus.MustRegister(latestOpenEBSVolumeRequestDuration)
-	prometheus.MustRegister(latestOpenEBSVolumeRequestCounter)
-	prometheus.MustRegister(latestOpenEBSMetaDataRequestDuration)
-	prometheus.MustRegister(latestOpenEBSMetaDataRequestCounter)
+	// serveCh is closed once the server stops serving requests
+	serveCh chan struct{}
+
+	// stopCh is closed on shutdown to release the blocking queries
+	stopCh   chan struct{}
+	stopOnce sync.Once
+
+	// shutdownOnce makes only the first shutdown drain the requests
+	shutdownOnce sync.Once
+
+	// enableDebug serves the debug endpoints i.e. /v1/agent/debug/
+	enableDebug bool
+
+	// metaTokens issues the IMDSv2 session tokens of the meta data service
+	metaTokens *metaDataTokens
+
+	// accessLog logs the requests served by this server. It is nil if the
+	// access log is disabled. It is replaced on reload.
+	accessLogLock sync.RWMutex
+	accessLog     *accessLogger
 }
 
 // NewHTTPServer starts new HTTP server over Maya server
 func NewHTTPServer(maya *MayaApiServer, config *config.MayaConfig, logOutput io.Writer) (*HTTPServer, error) {
+	// The meta data tokens are signed by a key generated at start
+	metaTokens, err := newMetaDataTokens()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate the meta data token key: %v", err)
+	}
+
 	// Start the listener
 	lnAddr, err := net.ResolveTCPAddr("tcp", config.NormalizedAddrs.HTTP)
 	if err != nil {
@@ -147,19 +108,36 @@ func NewHTTPServer(maya *MayaApiServer, config *config.MayaConfig, logOutput io.
 	//	ln = tls.NewListener(tcpKeepAliveListener{ln.(*net.TCPListener)}, tlsConfig)
 	//}
 
+	// Open the access log if enabled
+	var accessLog *accessLogger
+	if config.AccessLogFile != "" {
+		accessLog, err = newAccessLogger(config.AccessLogFile, config.AccessLogFormat)
+		if err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+
 	// Create the mux
 	mux := http.NewServeMux()
 
 	// Create the server
 	srv := &HTTPServer{
-		maya:     maya,
-		mux:      mux,
-		listener: ln,
-		logger:   maya.logger,
-		addr:     ln.Addr().String(),
+		maya:       maya,
+		mux:        mux,
+		listener:   ln,
+		logger:     maya.logger,
+		addr:       ln.Addr().String(),
+		serveCh:    make(chan struct{}),
+		stopCh:     make(chan struct{}),
+		accessLog:  accessLog,
+		metaTokens: metaTokens,
 	}
 	srv.registerHandlers(config.ServiceProvider, config.EnableDebug)
 
+	// The access log can be changed on reload
+	maya.RegisterReloadable("access log", []string{"access_log_file", "access_log_format"}, srv.reloadAccessLog)
+
 	// Start the server
 
 	// GzipHandler causing some issues if any request made from browser
@@ -167,11 +145,25 @@ func NewHTTPServer(maya *MayaApiServer, config *config.MayaConfig, logOutput io.
 	// we are not using GzipHandler.This issue may be related to GzipHandler
 	// GzipHandler may be used later.
 	//	go http.Serve(ln, gziphandler.GzipHandler(mux))
-	go http.Serve(ln, mux)
+	srv.server = &http.Server{
+		Handler:  srv.withAccessLog(mux),
+		ErrorLog: maya.logger,
+	}
+	go srv.serve()
 
 	return srv, nil
 }
 
+// serve accepts requests till the server is shutdown
+func (s *HTTPServer) serve() {
+	defer close(s.serveCh)
+
+	err := s.server.Serve(s.listener)
+	if err != nil && err != http.ErrServerClosed {
+		s.logger.Printf("[ERR] http: Error serving requests: %v", err)
+	}
+}
+
 // tcpKeepAliveListener sets TCP keep-alive timeouts on accepted
 // connections. It's used by NewHttpServer so
 // dead TCP connections eventually go away.
@@ -189,33 +181,97 @@ func (ln tcpKeepAliveListener) Accept() (c net.Conn, err error) {
 	return tc, nil
 }
 
-// Shutdown is used to shutdown the HTTP server
+// Shutdown is used to shutdown the HTTP server. It stops accepting new
+// requests & waits for the in-flight requests to complete within the drain
+// timeout. Requests that are still in flight after this are cut off.
 func (s *HTTPServer) Shutdown() {
-	if s != nil {
-		s.logger.Printf("[DEBUG] http: Shutting down http server")
-		s.listener.Close()
+	if s == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.maya.Config().DrainTimeout)
+	defer cancel()
+
+	s.ShutdownContext(ctx)
+}
+
+// ShutdownContext is Shutdown bound by the context instead of the drain
+// timeout. This lets a graceful exit bound the drain & the rest of the exit
+// by a single deadline. Only the first shutdown drains the requests. The
+// later ones wait for it to complete, hence are bound by its deadline.
+func (s *HTTPServer) ShutdownContext(ctx context.Context) {
+	if s == nil {
+		return
 	}
+
+	s.shutdownOnce.Do(func() { s.shutdown(ctx) })
+}
+
+// shutdown stops accepting new requests & waits for the ones in flight till
+// the context is done. The requests still in flight are cut off then.
+func (s *HTTPServer) shutdown(ctx context.Context) {
+	s.logger.Printf("[DEBUG] http: Shutting down http server")
+
+	// The blocking queries would otherwise hold up the drain
+	s.stopOnce.Do(func() { close(s.stopCh) })
+
+	if err := s.server.Shutdown(ctx); err != nil {
+		pending := s.maya.work.inFlight()
+		s.logger.Printf("[WARN] http: %d operation(s) still in flight at the deadline: %s",
+			len(pending), strings.Join(pending, ", "))
+
+		s.server.Close()
+	}
+
+	<-s.serveCh
+
+	s.accessLogLock.Lock()
+	if s.accessLog != nil {
+		s.accessLog.Close()
+		s.accessLog = nil
+	}
+	s.accessLogLock.Unlock()
 }
 
 // registerHandlers is used to attach handlers to the mux
 func (s *HTTPServer) registerHandlers(serviceProvider string, enableDebug bool) {
+	s.enableDebug = enableDebug
 
 	// NOTE - The curried func (due to wrap) is set as mux handler
 	// NOTE - The original handler is passed as a func to the wrap method
 
 	// NOTE - For every endpoint you need to create a Counter and a Duration
 	//        variable to capture the response. These variables will store
-	//        the response time and no of times they are requested.
+	//        the response time and no of times they are requested. These
+	//        are part of serverMetrics & registered against the server's
+	//        own registry.
+
+	// NOTE - An endpoint is added to the route registry i.e. s.routes. The
+	//        OpenAPI document is generated from the same registry.
 
-	s.mux.HandleFunc("/latest/meta-data/", s.wrap(latestOpenEBSMetaDataRequestCounter,
-		latestOpenEBSMetaDataRequestDuration, s.MetaSpecificRequest))
+	// NOTE - The debug routes e.g. pprof are mounted only if enable_debug
+	//        is set & are served to the callers of the admin scope only.
 
-	// Request w.r.t to a single VSM entity is handled here
-	s.mux.HandleFunc("/latest/volumes/", s.wrap(latestOpenEBSVolumeRequestCounter,
-		latestOpenEBSVolumeRequestDuration, s.VSMSpecificRequest))
-	// request for metrics is handled here. It displays metrics related to
-	// garbage collection, process, cpu...etc, and the custom metrics created.
-	s.mux.Handle("/metrics", promhttp.Handler())
+	if enableDebug {
+		publishRuntimeStats()
+	}
+
+	for _, r := range s.routes() {
+		if r.debug && !enableDebug {
+			continue
+		}
+
+		if r.rawHandler != nil {
+			h := r.rawHandler
+			if r.debug {
+				h = s.requireAdmin(h)
+			}
+			s.mux.Handle(r.pattern, s.trackRaw(h))
+			continue
+		}
+
+		s.mux.HandleFunc(r.pattern, s.wrap(r.counter, r.duration, r.handler))
+	}
 }
 
 // HTTPCodedError is used to provide the HTTP error code
@@ -241,18 +297,115 @@ func (e *codedError) Code() int {
 	return e.code
 }
 
+// errorKind classifies the error sent in response to a request. It is sent
+// in the X-Maya-Error-Kind header so that the clients need not parse the
+// error message. The errors of the orchestrators are classified the same way
+// as in the metrics.
+func errorKind(err error) api.ErrorKind {
+	if cErr, ok := err.(HTTPCodedError); ok {
+		return api.KindOfCode(cErr.Code())
+	}
+
+	switch classifyOutcome(err) {
+	case outcomeNotFound:
+		return api.ErrorKindNotFound
+	case outcomeConflict:
+		return api.ErrorKindConflict
+	case outcomeUnauthorized:
+		return api.ErrorKindUnauthorized
+	case outcomeTimeout:
+		return api.ErrorKindTimeout
+	case outcomeUnreachable:
+		return api.ErrorKindUnreachable
+	default:
+		return api.ErrorKindInternal
+	}
+}
+
+// CodedResponse is used to send a response with a HTTP code other than the
+// default i.e. 200. The response is encoded as JSON similar to other
+// responses.
+func CodedResponse(c int, obj interface{}) interface{} {
+	return &codedResponse{obj, c}
+}
+
+type codedResponse struct {
+	obj  interface{}
+	code int
+}
+
+// TextResponse is used to send the text as is i.e. as text/plain instead of
+// encoding it as JSON
+func TextResponse(text string) interface{} {
+	return textResponse(text)
+}
+
+type textResponse string
+
+// XMLResponse is used to send the object encoded as XML instead of JSON
+func XMLResponse(obj interface{}) interface{} {
+	return &xmlResponse{obj}
+}
+
+type xmlResponse struct {
+	obj interface{}
+}
+
+// trackRaw lets a graceful exit know about the requests of the raw handler
+// e.g. /metrics & /debug/pprof/profile as wrap does for the other handlers.
+// The requests are refused once the graceful exit is waiting for the
+// requests in flight.
+func (s *HTTPServer) trackRaw(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		req, reqID := withRequestID(resp, req)
+
+		done, ok := s.maya.trackWork(fmt.Sprintf("http: %s %s (request-id: %s)", req.Method, req.URL, reqID))
+		if !ok {
+			http.Error(resp, "maya api server is exiting", 503)
+			return
+		}
+		defer done()
+
+		h.ServeHTTP(resp, req)
+	})
+}
+
+// refuseExiting is the handler of the requests that arrive once a graceful
+// exit is waiting for the requests in flight
+func refuseExiting(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	return nil, CodedError(503, "maya api server is exiting")
+}
+
 // wrap is a convenient method used to wrap the handler function &
 // return this handler curried with common logic.
 func (s *HTTPServer) wrap(RequestCounter *prometheus.CounterVec, RequestDuration *prometheus.HistogramVec, handler func(resp http.ResponseWriter, req *http.Request) (interface{}, error)) func(resp http.ResponseWriter, req *http.Request) {
-	var code int
 	// curry the handler
 	f := func(resp http.ResponseWriter, req *http.Request) {
+		var code int
+
+		// Reuse the request id assigned while serving, else assign one
+		req, reqID := withRequestID(resp, req)
+		logger := s.requestLogger(req)
+
+		// Trace this request as a continuation of the client's trace if any
+		req, span := s.traceRequest(req)
+
 		// some book keeping stuff
-		setHeaders(resp, s.maya.config.HTTPAPIResponseHeaders)
+		setHeaders(resp, s.maya.Config().HTTPAPIResponseHeaders)
 		reqURL := req.URL.String()
 		start := time.Now()
+
+		// Let a graceful exit know about this request. The request is
+		// refused if the graceful exit is waiting for the requests already.
+		done, ok := s.maya.trackWork(fmt.Sprintf("http: %s %s (request-id: %s)", req.Method, reqURL, reqID))
+		if ok {
+			defer done()
+		} else {
+			handler = refuseExiting
+		}
+
 		defer func() {
-			s.logger.Printf("[DEBUG] http: Request %v (%v)", reqURL, time.Now().Sub(start))
+			logger.Printf("[DEBUG] http: Request %v (%v)", reqURL, time.Now().Sub(start))
 		}()
 
 		// It captures the no of requests and duration of request coming on "/latest/volumes" endpoint.
@@ -270,19 +423,24 @@ func (s *HTTPServer) wrap(RequestCounter *prometheus.CounterVec, RequestDuration
 			RequestCounter.WithLabelValues(strconv.Itoa(code), req.Method).Inc()
 		}()
 
-		s.logger.Printf("[DEBUG] http: Request %v (%v)", reqURL, req.Method)
+		logger.Printf("[DEBUG] http: Request %v (%v)", reqURL, req.Method)
 		// Original handler is invoked
 		obj, err := handler(resp, req)
 
+		defer func() {
+			finishRequestSpan(span, code, err)
+		}()
+
 		// Check for an error & set it as an http error
 		// Below err block for re-usability
 	HAS_ERR:
 		if err != nil {
-			s.logger.Printf("[ERR] http: Request %v %v, error: %v", req.Method, reqURL, err)
+			logger.Printf("[ERR] http: Request %v %v, error: %v", req.Method, reqURL, err)
 			code = 500
 			if http, ok := err.(HTTPCodedError); ok {
 				code = http.Code()
 			}
+			resp.Header().Set(api.HeaderErrorKind, string(errorKind(err)))
 			resp.WriteHeader(code)
 			resp.Write([]byte(err.Error()))
 			return
@@ -295,6 +453,37 @@ func (s *HTTPServer) wrap(RequestCounter *prometheus.CounterVec, RequestDuration
 			}
 		}
 
+		// Unwrap the response that has its own HTTP code
+		if coded, ok := obj.(*codedResponse); ok {
+			code = coded.code
+			obj = coded.obj
+		}
+
+		// Send the text response as is
+		if text, ok := obj.(textResponse); ok {
+			resp.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			if code != 0 {
+				resp.WriteHeader(code)
+			}
+			resp.Write([]byte(text))
+			return
+		}
+
+		// Encode the XML response as is done for JSON
+		if x, ok := obj.(*xmlResponse); ok {
+			var buf bytes.Buffer
+			buf.WriteString(xml.Header)
+			if err = xml.NewEncoder(&buf).Encode(x.obj); err != nil {
+				goto HAS_ERR
+			}
+			resp.Header().Set("Content-Type", "text/xml; charset=utf-8")
+			if code != 0 {
+				resp.WriteHeader(code)
+			}
+			resp.Write(buf.Bytes())
+			return
+		}
+
 		// Transform the response structure to its JSON equivalent
 		if obj != nil {
 			var buf bytes.Buffer
@@ -315,6 +504,9 @@ func (s *HTTPServer) wrap(RequestCounter *prometheus.CounterVec, RequestDuration
 			}
 			// no error, set the response as json
 			resp.Header().Set("Content-Type", "application/json")
+			if code != 0 {
+				resp.WriteHeader(code)
+			}
 			resp.Write(buf.Bytes())
 		}
 	}
@@ -389,30 +581,34 @@ func setHeaders(resp http.ResponseWriter, headers map[string]string) {
 	}
 }
 
-// parseWait is used to parse the ?wait and ?index query params
-// Returns true on error
-//func parseWait(resp http.ResponseWriter, req *http.Request, qo *structs.QueryOptions) bool {
-//	query := req.URL.Query()
-//	if wait := query.Get("wait"); wait != "" {
-//		dur, err := time.ParseDuration(wait)
-//		if err != nil {
-//			resp.WriteHeader(400)
-//			resp.Write([]byte("Invalid wait time"))
-//			return true
-//		}
-//		qo.MaxQueryTime = dur
-//	}
-//	if idx := query.Get("index"); idx != "" {
-//		index, err := strconv.ParseUint(idx, 10, 64)
-//		if err != nil {
-//			resp.WriteHeader(400)
-//			resp.Write([]byte("Invalid index"))
-//			return true
-//		}
-//		qo.MinQueryIndex = index
-//	}
-//	return false
-//}
+// parseWait is used to parse the ?wait and ?index query params of a
+// blocking query. The wait is capped at maxBlockingWait.
+func parseWait(req *http.Request) (uint64, time.Duration, error) {
+	query := req.URL.Query()
+
+	wait := defaultBlockingWait
+	if v := query.Get("wait"); v != "" {
+		dur, err := time.ParseDuration(v)
+		if err != nil || dur < 0 {
+			return 0, 0, fmt.Errorf("Invalid wait time")
+		}
+		wait = dur
+	}
+	if wait > maxBlockingWait {
+		wait = maxBlockingWait
+	}
+
+	var index uint64
+	if v := query.Get("index"); v != "" {
+		idx, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("Invalid index")
+		}
+		index = idx
+	}
+
+	return index, wait, nil
+}
 
 // parseConsistency is used to parse the ?stale query params.
 //func parseConsistency(req *http.Request, qo *structs.QueryOptions) {
@@ -435,7 +631,7 @@ func (s *HTTPServer) parseRegion(req *http.Request, r *string) {
 	if other := req.URL.Query().Get("region"); other != "" {
 		*r = other
 	} else if *r == "" {
-		*r = s.maya.config.Region
+		*r = s.maya.Config().Region
 	}
 }
 
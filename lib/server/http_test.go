@@ -2,8 +2,10 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/openebs/maya/types/v1"
 	"github.com/openebs/mayaserver/lib/config"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/ugorji/go/codec"
@@ -13,6 +15,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -168,6 +171,51 @@ func TestContentTypeIsJSON(t *testing.T) {
 	}
 }
 
+func TestRequestID(t *testing.T) {
+	s := makeHTTPTestServer(t, nil)
+	defer s.Cleanup()
+
+	cases := []struct {
+		sent  string
+		reuse bool
+	}{
+		{"", false},
+		{"abc-123", true},
+		{"has space", false},
+		{strings.Repeat("x", maxRequestIDLen+1), false},
+	}
+
+	for _, tc := range cases {
+		var seen string
+		handler := func(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+			pvc := &v1.PersistentVolumeClaim{}
+			labelRequestID(req, pvc)
+			seen = pvc.Labels[RequestIDLbl]
+			return "noop", nil
+		}
+
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/v1/kv/key", nil)
+		if tc.sent != "" {
+			req.Header.Set(RequestIDHeader, tc.sent)
+		}
+		s.Server.wrap(RequestCounter, RequestDuration, handler)(resp, req)
+
+		id := resp.Header().Get(RequestIDHeader)
+		if id == "" {
+			t.Fatalf("%q: expected the request id in response", tc.sent)
+		}
+
+		if tc.reuse != (id == tc.sent) {
+			t.Fatalf("%q: expected reuse: %v, got request id: %s", tc.sent, tc.reuse, id)
+		}
+
+		if seen != id {
+			t.Fatalf("%q: expected request id: %s to be labelled, got: %s", tc.sent, id, seen)
+		}
+	}
+}
+
 func TestPrettyPrint(t *testing.T) {
 	testPrettyPrint("pretty=1", true, t)
 }
@@ -231,6 +279,199 @@ func testPrettyPrint(pretty string, prettyFmt bool, t *testing.T) {
 	}
 }
 
+func TestShutdownDrainsInFlightRequest(t *testing.T) {
+	s := makeHTTPTestServer(t, nil)
+	defer s.Cleanup()
+
+	startedCh := make(chan struct{})
+	releaseCh := make(chan struct{})
+	handler := func(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+		close(startedCh)
+		<-releaseCh
+		return "done", nil
+	}
+	s.Server.mux.HandleFunc("/slow", s.Server.wrap(RequestCounter, RequestDuration, handler))
+
+	type result struct {
+		code int
+		body []byte
+		err  error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + s.Server.addr + "/slow")
+		if err != nil {
+			resultCh <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		resultCh <- result{code: resp.StatusCode, body: body, err: err}
+	}()
+
+	select {
+	case <-startedCh:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("slow request was never served")
+	}
+
+	shutdownCh := make(chan struct{})
+	go func() {
+		s.Server.Shutdown()
+		close(shutdownCh)
+	}()
+
+	// Shutdown waits for the in-flight request
+	select {
+	case <-shutdownCh:
+		t.Fatalf("shutdown completed before the in-flight request")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// New requests are refused once shutdown is underway
+	if _, err := http.Get("http://" + s.Server.addr + "/slow"); err == nil {
+		t.Fatalf("expected new request to be refused during shutdown")
+	}
+
+	close(releaseCh)
+
+	res := <-resultCh
+	if res.err != nil {
+		t.Fatalf("in-flight request failed: %v", res.err)
+	}
+	if res.code != 200 {
+		t.Fatalf("err http resp code, expected: 200, got: %v", res.code)
+	}
+	if string(res.body) != `"done"` {
+		t.Fatalf("bad:\nexpected:\t%q\n\nactual:\t\t%q", `"done"`, string(res.body))
+	}
+
+	select {
+	case <-shutdownCh:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("shutdown did not complete after the in-flight request")
+	}
+}
+
+func TestShutdownCutsOffAfterDrainTimeout(t *testing.T) {
+	s := makeHTTPTestServer(t, func(mc *config.MayaConfig) {
+		mc.DrainTimeout = 100 * time.Millisecond
+	})
+	defer s.Cleanup()
+
+	startedCh := make(chan struct{})
+	releaseCh := make(chan struct{})
+	defer close(releaseCh)
+	handler := func(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+		close(startedCh)
+		<-releaseCh
+		return "done", nil
+	}
+	s.Server.mux.HandleFunc("/stuck", s.Server.wrap(RequestCounter, RequestDuration, handler))
+
+	go http.Get("http://" + s.Server.addr + "/stuck")
+	<-startedCh
+
+	start := time.Now()
+	s.Server.Shutdown()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("shutdown was not bound by the drain timeout, took: %v", elapsed)
+	}
+
+	if pending := s.Maya.work.inFlight(); len(pending) != 1 {
+		t.Fatalf("expected 1 operation in flight, got: %v", pending)
+	}
+
+	if err := s.Maya.Leave(); err == nil {
+		t.Fatalf("expected leave to report the operation in flight")
+	}
+}
+
+func TestShutdownDrainsOnce(t *testing.T) {
+	s := makeHTTPTestServer(t, func(mc *config.MayaConfig) {
+		mc.DrainTimeout = time.Minute
+	})
+	defer s.Cleanup()
+
+	startedCh := make(chan struct{})
+	releaseCh := make(chan struct{})
+	defer close(releaseCh)
+	handler := func(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+		close(startedCh)
+		<-releaseCh
+		return "done", nil
+	}
+	s.Server.mux.HandleFunc("/stuck", s.Server.wrap(RequestCounter, RequestDuration, handler))
+
+	go http.Get("http://" + s.Server.addr + "/stuck")
+	<-startedCh
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	s.Server.ShutdownContext(ctx)
+
+	// A later shutdown does not drain again for the drain timeout
+	start := time.Now()
+	s.Server.Shutdown()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected no second drain, took: %v", elapsed)
+	}
+}
+
+func TestLeaveWaitsForRawHandlersAndHealthChecks(t *testing.T) {
+	s := makeHTTPTestServer(t, nil)
+	defer s.Cleanup()
+
+	startedCh := make(chan struct{})
+	releaseCh := make(chan struct{})
+	raw := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		close(startedCh)
+		<-releaseCh
+	})
+	s.Server.mux.Handle("/raw", s.Server.trackRaw(raw))
+
+	go http.Get("http://" + s.Server.addr + "/raw")
+	<-startedCh
+
+	// A check that times out keeps running in the background
+	checkCh := make(chan struct{})
+	s.Maya.health.register(HealthCheck{
+		Name:    "stuck",
+		Timeout: 10 * time.Millisecond,
+		Check: func(timeout time.Duration) (string, error) {
+			<-checkCh
+			return "", nil
+		},
+	})
+	s.Maya.health.run()
+
+	pending := s.Maya.work.inFlight()
+	if len(pending) != 2 || !strings.Contains(strings.Join(pending, ","), "GET /raw") ||
+		!strings.Contains(strings.Join(pending, ","), "health: check stuck") {
+		t.Fatalf("expected the raw request & the check in flight, got: %v", pending)
+	}
+
+	leaveCh := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		leaveCh <- s.Maya.LeaveContext(ctx)
+	}()
+
+	close(releaseCh)
+	select {
+	case <-leaveCh:
+		t.Fatalf("leave completed before the health check")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	close(checkCh)
+	if err := <-leaveCh; err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
 func TestParseRegion(t *testing.T) {
 
 	var region string
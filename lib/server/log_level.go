@@ -0,0 +1,74 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/openebs/mayaserver/lib/audit"
+	"github.com/openebs/mayaserver/lib/loghelper"
+)
+
+// LogLevels are the levels of the logs of maya api server
+type LogLevels struct {
+	// Default is the level of the components that do not have a level of
+	// their own
+	Default string `json:"default"`
+
+	// Components are the levels of the specific components e.g.
+	// orchprovider.k8s
+	Components map[string]string `json:"components"`
+}
+
+// LogLevelRequest changes the level of a component. The default level is
+// changed if the component is empty. The component inherits the level of
+// its parent if the level is empty.
+type LogLevelRequest struct {
+	Component string `json:"component"`
+	Level     string `json:"level"`
+}
+
+// SetLogLevels sets the filter whose levels are read & changed via the
+// log-level endpoint
+func (ms *MayaApiServer) SetLogLevels(f *loghelper.ComponentFilter) {
+	ms.logLevels = f
+}
+
+// agentLogLevel reads or changes the levels of the logs. The changes last
+// till the levels are reloaded from the config. Only the callers of the
+// admin scope may change the levels.
+func (s *HTTPServer) agentLogLevel(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	filter := s.maya.logLevels
+	if filter == nil {
+		return nil, CodedError(501, "Log levels are not supported")
+	}
+
+	switch req.Method {
+	case "GET":
+	case "PUT", "POST":
+		if err := s.requireAdminRequest(req); err != nil {
+			return nil, err
+		}
+
+		var args LogLevelRequest
+		if err := decodeBody(req, &args); err != nil {
+			return nil, CodedError(400, err.Error())
+		}
+
+		if err := filter.SetLevel(args.Component, args.Level); err != nil {
+			err = CodedError(400, err.Error())
+			s.auditRequest(req, audit.OpLogLevelSet, "", &args, err)
+			return nil, err
+		}
+		s.auditRequest(req, audit.OpLogLevelSet, "", &args, nil)
+
+		if args.Component == "" {
+			s.maya.log.Printf("[INFO] maya api server: Changed the default log level to %s", args.Level)
+		} else {
+			s.maya.log.Printf("[INFO] maya api server: Changed the log level of %s to %q", args.Component, args.Level)
+		}
+	default:
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+
+	level, components := filter.Levels()
+	return LogLevels{Default: level, Components: components}, nil
+}
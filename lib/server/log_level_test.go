@@ -0,0 +1,85 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openebs/mayaserver/lib/config"
+	"github.com/openebs/mayaserver/lib/loghelper"
+)
+
+func TestAgentLogLevel(t *testing.T) {
+	s := makeHTTPTestServer(t, func(mc *config.MayaConfig) {
+		mc.AdminToken = testAdminToken
+	})
+	defer s.Cleanup()
+
+	// Not supported without a filter
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/agent/log-level", nil)
+	if _, err := s.Server.AgentSpecificRequest(resp, req); err == nil {
+		t.Fatalf("expected error without a filter")
+	} else if cErr, ok := err.(HTTPCodedError); !ok || cErr.Code() != 501 {
+		t.Fatalf("expected 501, got: %v", err)
+	}
+
+	filter, err := loghelper.NewComponentFilter("INFO", ioutil.Discard)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	s.Maya.SetLogLevels(filter)
+
+	// Only the admin may change the levels
+	body := bytes.NewBufferString(`{"component": "orchprovider.k8s", "level": "TRACE"}`)
+	req, _ = http.NewRequest("PUT", "/v1/agent/log-level", body)
+	if _, err := s.Server.AgentSpecificRequest(httptest.NewRecorder(), req); err == nil {
+		t.Fatalf("expected error without the admin token")
+	} else if cErr, ok := err.(HTTPCodedError); !ok || cErr.Code() != 403 {
+		t.Fatalf("expected 403, got: %v", err)
+	}
+
+	// Change the level of a component
+	body = bytes.NewBufferString(`{"component": "orchprovider.k8s", "level": "TRACE"}`)
+	req, _ = http.NewRequest("PUT", "/v1/agent/log-level", body)
+	obj, err := s.Server.AgentSpecificRequest(httptest.NewRecorder(), asAdmin(req))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	levels := obj.(LogLevels)
+	if levels.Default != "INFO" || levels.Components["orchprovider.k8s"] != "TRACE" {
+		t.Fatalf("bad levels: %#v", levels)
+	}
+	if !filter.Check([]byte("[TRACE] orchprovider.k8s: Listing pods")) {
+		t.Fatalf("expected the level to be applied")
+	}
+
+	// Read the levels
+	req, _ = http.NewRequest("GET", "/v1/agent/log-level", nil)
+	obj, err = s.Server.AgentSpecificRequest(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if levels := obj.(LogLevels); len(levels.Components) != 1 {
+		t.Fatalf("bad levels: %#v", levels)
+	}
+
+	// Invalid levels are rejected
+	body = bytes.NewBufferString(`{"component": "http", "level": "CHATTY"}`)
+	req, _ = http.NewRequest("PUT", "/v1/agent/log-level", body)
+	if _, err := s.Server.AgentSpecificRequest(httptest.NewRecorder(), asAdmin(req)); err == nil {
+		t.Fatalf("expected error for invalid log level")
+	} else if cErr, ok := err.(HTTPCodedError); !ok || cErr.Code() != 400 {
+		t.Fatalf("expected 400, got: %v", err)
+	}
+
+	req, _ = http.NewRequest("DELETE", "/v1/agent/log-level", nil)
+	if _, err := s.Server.AgentSpecificRequest(httptest.NewRecorder(), req); err == nil {
+		t.Fatalf("expected error for DELETE")
+	} else if cErr, ok := err.(HTTPCodedError); !ok || cErr.Code() != 405 {
+		t.Fatalf("expected 405, got: %v", err)
+	}
+}
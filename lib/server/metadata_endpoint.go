@@ -1,19 +1,43 @@
 package server
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"sort"
 	"strings"
 )
 
 const (
 	// OpenEBS can be used as a persistence mechanism for
-	// any type of compute instance
+	// any type of compute instance. This is the instance id of the local
+	// node unless instance_id is set.
 	AnyInstance = "any-compute"
 
-	// TODO We shall see how to construct an Availability Zone
+	// AnyZone is the availability zone unless availability_zone is set
 	AnyZone = "any-zone"
+
+	// RootDevice is the device name of the root & the ami entries of the
+	// block device mapping
+	RootDevice = "/dev/sda1"
 )
 
+// MetaSpecificRequest serves an EC2 compatible meta data tree. A path that
+// ends with a slash or a directory of the tree is served as the listing of
+// the entries of the directory. The entries that are directories end with a
+// slash. Every other path is served as the text of its entry.
+//
+// The identity i.e. the instance id, the host name & the IPv4 address is of
+// the node that sends the request. A node is known by the address the request
+// comes from. Hence the nodes behind a NAT or a proxy share an identity. The
+// block device mapping lists the volumes attached to the instance id of the
+// node.
+//
+// The IMDSv2 session tokens are optional. A request with a token is served
+// only if the token is valid.
 func (s *HTTPServer) MetaSpecificRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
 
 	path := strings.TrimPrefix(req.URL.Path, "/latest/meta-data")
@@ -23,36 +47,195 @@ func (s *HTTPServer) MetaSpecificRequest(resp http.ResponseWriter, req *http.Req
 		return nil, CodedError(405, ErrInvalidMethod)
 	}
 
-	// We do an exact suffix comparision
-	switch {
+	if req.Method != "GET" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
 
-	case strings.Compare(path, "/instance-id") == 0:
-		return s.metaInstanceID(resp, req)
+	if err := s.verifyMetaDataToken(req); err != nil {
+		return nil, err
+	}
 
-	case strings.Compare(path, "/placement/availability-zone") == 0:
-		return s.metaAvailabilityZone(resp, req)
+	tree, err := s.metaDataTree(req)
+	if err != nil {
+		return nil, err
+	}
+	path = strings.TrimPrefix(path, "/")
 
-	default:
-		return nil, CodedError(405, ErrInvalidMethod)
+	// We do an exact comparision of the entries
+	if value, ok := tree[path]; ok {
+		return TextResponse(value), nil
+	}
+
+	entries := metaDataListing(tree, strings.TrimSuffix(path, "/"))
+	if len(entries) == 0 {
+		return nil, CodedError(404, fmt.Sprintf("Meta data entry '%s' not found", path))
 	}
+
+	return TextResponse(strings.Join(entries, "\n")), nil
 }
 
-// EBS demands a particular instance id to be returned during
-// aws session creation.
-func (s *HTTPServer) metaInstanceID(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+// metaDataTree returns the entries of the meta data tree of the node of the
+// request by their paths
+func (s *HTTPServer) metaDataTree(req *http.Request) (map[string]string, error) {
+	conf := s.maya.Config()
+
+	instanceID, hostname, ipv4 := s.metaDataIdentity(req)
+
+	tree := map[string]string{
+		"instance-id":                 instanceID,
+		"hostname":                    hostname,
+		"local-hostname":              hostname,
+		"local-ipv4":                  ipv4,
+		"placement/availability-zone": s.availabilityZone(),
+		"placement/region":            conf.Region,
+		"block-device-mapping/ami":    RootDevice,
+		"block-device-mapping/root":   RootDevice,
+	}
 
-	if req.Method != "GET" {
-		return nil, CodedError(405, ErrInvalidMethod)
+	devices, err := s.maya.attachedDevicesOf(instanceID)
+	if err != nil {
+		return nil, err
+	}
+	for i, device := range devices {
+		tree[fmt.Sprintf("block-device-mapping/ebs%d", i+1)] = device
+	}
+	return tree, nil
+}
+
+// metaDataIdentity returns the instance id, the host name & the IPv4 address
+// of the node of the request. The node on the host of maya api server is
+// known by instance_id, the node name & the advertised address. Every other
+// node is known by its address. Its instance id is derived from the address
+// so that it is the same across the requests & the restarts of maya api
+// server.
+func (s *HTTPServer) metaDataIdentity(req *http.Request) (string, string, string) {
+	ip := net.ParseIP(remoteHost(req))
+	if ip == nil || ip.IsLoopback() || isLocalIP(ip) {
+		conf := s.maya.Config()
+		hostname := conf.NodeName
+		if hostname == "" {
+			hostname, _ = os.Hostname()
+		}
+		return s.instanceID(), hostname, s.localIPv4()
 	}
 
-	return AnyInstance, nil
+	sum := sha256.Sum256([]byte(ip.String()))
+	return "i-" + hex.EncodeToString(sum[:])[:17], ip.String(), ip.String()
 }
 
-func (s *HTTPServer) metaAvailabilityZone(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+// isLocalIP verifies if the address is of this host
+func isLocalIP(ip net.IP) bool {
+	ifAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, ifAddr := range ifAddrs {
+		if ipNet, ok := ifAddr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
 
-	if req.Method != "GET" {
-		return nil, CodedError(405, ErrInvalidMethod)
+// instanceID returns the instance id of the local node as per the config
+func (s *HTTPServer) instanceID() string {
+	if id := s.maya.Config().InstanceID; id != "" {
+		return id
+	}
+	return AnyInstance
+}
+
+// attachedDevicesOf returns the devices of the volumes attached to the node
+// sorted by the names of the volumes. The attachments without a device are
+// skipped.
+func (ms *MayaApiServer) attachedDevicesOf(nodeID string) ([]string, error) {
+	names := ms.state.Keys(attachmentsBucket)
+	sort.Strings(names)
+
+	var devices []string
+	for _, name := range names {
+		va, err := ms.attachmentsOf(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range va.Attachments {
+			if a.NodeID == nodeID && a.Device != "" {
+				devices = append(devices, a.Device)
+			}
+		}
 	}
+	return devices, nil
+}
 
-	return AnyZone, nil
+// availabilityZone returns the availability zone as per the config
+func (s *HTTPServer) availabilityZone() string {
+	if zone := s.maya.Config().AvailabilityZone; zone != "" {
+		return zone
+	}
+	return AnyZone
+}
+
+// metaDataListing returns the sorted entries of the given directory of the
+// meta data tree. The root directory is an empty string.
+func metaDataListing(tree map[string]string, dir string) []string {
+	prefix := ""
+	if dir != "" {
+		prefix = dir + "/"
+	}
+
+	seen := map[string]bool{}
+	var entries []string
+	for path := range tree {
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+
+		entry := strings.TrimPrefix(path, prefix)
+		if idx := strings.Index(entry, "/"); idx >= 0 {
+			entry = entry[:idx+1]
+		}
+		if !seen[entry] {
+			seen[entry] = true
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.Strings(entries)
+	return entries
+}
+
+// localIPv4 returns the IPv4 address advertised by maya api server. The
+// first IPv4 address of this host that is not a loopback is returned if
+// maya api server binds to every address.
+func (s *HTTPServer) localIPv4() string {
+	conf := s.maya.Config()
+
+	addr := conf.BindAddr
+	if conf.AdvertiseAddrs != nil && conf.AdvertiseAddrs.HTTP != "" {
+		addr = conf.AdvertiseAddrs.HTTP
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			addr = host
+		}
+	}
+
+	ip := net.ParseIP(addr)
+	if ip != nil && !ip.IsUnspecified() {
+		return ip.String()
+	}
+	if ip == nil && addr != "" {
+		// A host name is advertised as is
+		return addr
+	}
+
+	ifAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+	for _, ifAddr := range ifAddrs {
+		ipNet, ok := ifAddr.(*net.IPNet)
+		if ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+			return ipNet.IP.String()
+		}
+	}
+	return ""
 }
@@ -2,11 +2,16 @@ package server
 
 import (
 	"bytes"
-	"github.com/ugorji/go/codec"
+	"encoding/base64"
+	"encoding/binary"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/openebs/mayaserver/lib/api"
+	"github.com/openebs/mayaserver/lib/config"
 )
 
 /*var (
@@ -209,9 +214,9 @@ func TestInvalidReqPathMetaViaWrap2(t *testing.T) {
 		t.Fatalf("err content type, expected: nil, got: %s", contentType)
 	}
 
-	// This should be an invalid path/method error
-	if resp.Code != 405 {
-		t.Fatalf("err http resp code, expected: 405, got: %v", resp.Code)
+	// This should be an unknown entry error
+	if resp.Code != 404 {
+		t.Fatalf("err http resp code, expected: 404, got: %v", resp.Code)
 	}
 
 	// actuals
@@ -221,8 +226,9 @@ func TestInvalidReqPathMetaViaWrap2(t *testing.T) {
 	}
 
 	// compare expectations with actuals
-	if !bytes.Equal([]byte(ErrInvalidMethod), actual) {
-		t.Fatalf("bad:\nexpected:\t%q\n\nactual:\t\t%q", ErrInvalidMethod, string(actual))
+	expected := "Meta data entry 'v1/placement/availability-zone' not found"
+	if !bytes.Equal([]byte(expected), actual) {
+		t.Fatalf("bad:\nexpected:\t%q\n\nactual:\t\t%q", expected, string(actual))
 	}
 }
 
@@ -249,18 +255,13 @@ func TestMetaAvailZoneViaWrap(t *testing.T) {
 
 	contentType := resp.Header().Get("Content-Type")
 
-	if contentType != "application/json" {
-		t.Fatalf("Content-Type header was not 'application/json'")
+	// The meta data is sent as text similar to EC2
+	if contentType != "text/plain; charset=utf-8" {
+		t.Fatalf("Content-Type header was not 'text/plain'")
 	}
 
 	// expectations
-	var expected bytes.Buffer
-	enc := codec.NewEncoder(&expected, jsonHandle)
-	err = enc.Encode(AnyZone)
-
-	if err != nil {
-		t.Fatalf("err while encoding: %v", err)
-	}
+	expected := bytes.NewBufferString(AnyZone)
 
 	// actuals
 	actual, err := ioutil.ReadAll(resp.Body)
@@ -342,18 +343,13 @@ func TestMetaInstanceIDViaWrap(t *testing.T) {
 
 	contentType := resp.Header().Get("Content-Type")
 
-	if contentType != "application/json" {
-		t.Fatalf("Content-Type header was not 'application/json'")
+	// The meta data is sent as text similar to EC2
+	if contentType != "text/plain; charset=utf-8" {
+		t.Fatalf("Content-Type header was not 'text/plain'")
 	}
 
 	// expectations
-	var expected bytes.Buffer
-	enc := codec.NewEncoder(&expected, jsonHandle)
-	err = enc.Encode(AnyInstance)
-
-	if err != nil {
-		t.Fatalf("err while encoding: %v", err)
-	}
+	expected := bytes.NewBufferString(AnyInstance)
 
 	// actuals
 	actual, err := ioutil.ReadAll(resp.Body)
@@ -411,3 +407,214 @@ func TestInvalidReqMetaInstanceIDViaWrap(t *testing.T) {
 		t.Fatalf("bad:\nexpected:\t%q\n\nactual:\t\t%q", ErrInvalidMethod, string(actual))
 	}
 }
+
+func TestMetaDataTree(t *testing.T) {
+	s := makeHTTPTestServer(t, func(mc *config.MayaConfig) {
+		mc.NodeName = "node-1"
+		mc.Region = "us-east-1"
+		mc.BindAddr = "127.0.0.1"
+		mc.InstanceID = "i-0123456789abcdef0"
+		mc.AvailabilityZone = "us-east-1a"
+	})
+	defer s.Cleanup()
+
+	cases := map[string]string{
+		"/latest/meta-data/":                            "block-device-mapping/\nhostname\ninstance-id\nlocal-hostname\nlocal-ipv4\nplacement/",
+		"/latest/meta-data/placement":                   "availability-zone\nregion",
+		"/latest/meta-data/placement/":                  "availability-zone\nregion",
+		"/latest/meta-data/placement/region":            "us-east-1",
+		"/latest/meta-data/placement/availability-zone": "us-east-1a",
+		"/latest/meta-data/instance-id":                 "i-0123456789abcdef0",
+		"/latest/meta-data/hostname":                    "node-1",
+		"/latest/meta-data/local-hostname":              "node-1",
+		"/latest/meta-data/local-ipv4":                  "127.0.0.1",
+		"/latest/meta-data/block-device-mapping/":       "ami\nroot",
+		"/latest/meta-data/block-device-mapping/root":   RootDevice,
+	}
+	for path, expected := range cases {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		s.Server.wrap(RequestCounter, RequestDuration, s.Server.MetaSpecificRequest)(resp, req)
+
+		if resp.Code != 200 {
+			t.Fatalf("bad code for %s: %d %s", path, resp.Code, resp.Body.String())
+		}
+		if actual := resp.Body.String(); actual != expected {
+			t.Fatalf("bad %s:\nexpected:\t%q\n\nactual:\t\t%q", path, expected, actual)
+		}
+	}
+
+	// Unknown entries
+	req, _ := http.NewRequest("GET", "/latest/meta-data/placement/rack", nil)
+	if _, err := s.Server.MetaSpecificRequest(httptest.NewRecorder(), req); err == nil {
+		t.Fatalf("expected error for an unknown entry")
+	} else if cErr, ok := err.(HTTPCodedError); !ok || cErr.Code() != 404 {
+		t.Fatalf("expected 404, got: %v", err)
+	}
+}
+
+func TestMetaDataNodeIdentity(t *testing.T) {
+	s := makeHTTPTestServer(t, func(mc *config.MayaConfig) {
+		mc.InstanceID = "i-0123456789abcdef0"
+	})
+	defer s.Cleanup()
+
+	get := func(remoteAddr, path string) string {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		s.Server.wrap(RequestCounter, RequestDuration, s.Server.MetaSpecificRequest)(resp, req)
+		if resp.Code != 200 {
+			t.Fatalf("bad code for %s: %d %s", path, resp.Code, resp.Body.String())
+		}
+		return resp.Body.String()
+	}
+
+	// The nodes get distinct instance ids derived from their addresses
+	node1 := get("10.0.0.7:4000", "/latest/meta-data/instance-id")
+	node2 := get("10.0.0.8:4000", "/latest/meta-data/instance-id")
+	if len(node1) != 19 || node1[:2] != "i-" || node1 == node2 {
+		t.Fatalf("bad instance ids: %s %s", node1, node2)
+	}
+	if id := get("10.0.0.7:5000", "/latest/meta-data/instance-id"); id != node1 {
+		t.Fatalf("expected the same instance id, got: %s %s", id, node1)
+	}
+	if ip := get("10.0.0.7:4000", "/latest/meta-data/local-ipv4"); ip != "10.0.0.7" {
+		t.Fatalf("bad local-ipv4: %s", ip)
+	}
+	if id := get("127.0.0.1:4000", "/latest/meta-data/instance-id"); id != "i-0123456789abcdef0" {
+		t.Fatalf("expected instance_id for the local node, got: %s", id)
+	}
+
+	// The block device mapping lists the volumes attached to the node
+	for name, device := range map[string]string{"vol2": "/dev/sdg", "vol1": "/dev/sdf"} {
+		va := &api.VolumeAttachments{Attachments: []api.Attachment{{NodeID: node1, Device: device}, {NodeID: node2, Device: "/dev/sdz"}}}
+		if err := s.Maya.state.Put(attachmentsBucket, name, va); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if list := get("10.0.0.7:4000", "/latest/meta-data/block-device-mapping/"); list != "ami\nebs1\nebs2\nroot" {
+		t.Fatalf("bad block device mapping: %q", list)
+	}
+	if device := get("10.0.0.7:4000", "/latest/meta-data/block-device-mapping/ebs2"); device != "/dev/sdg" {
+		t.Fatalf("bad device: %s", device)
+	}
+	if list := get("127.0.0.1:4000", "/latest/meta-data/block-device-mapping/"); list != "ami\nroot" {
+		t.Fatalf("bad block device mapping of the local node: %q", list)
+	}
+}
+
+func TestMetaDataToken(t *testing.T) {
+	s := makeHTTPTestServer(t, nil)
+	defer s.Cleanup()
+
+	// A session token is issued via PUT along with its ttl
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/latest/api/token", nil)
+	req.Header.Set(MetaDataTokenTTLHeader, "60")
+	s.Server.wrap(RequestCounter, RequestDuration, s.Server.MetaDataTokenRequest)(resp, req)
+
+	if resp.Code != 200 {
+		t.Fatalf("bad code: %d %s", resp.Code, resp.Body.String())
+	}
+	if ttl := resp.Header().Get(MetaDataTokenTTLHeader); ttl != "60" {
+		t.Fatalf("bad ttl: %s", ttl)
+	}
+	token := resp.Body.String()
+	if token == "" {
+		t.Fatalf("expected a token")
+	}
+
+	// The meta data is served with a valid token
+	req, _ = http.NewRequest("GET", "/latest/meta-data/instance-id", nil)
+	req.Header.Set(MetaDataTokenHeader, token)
+	if _, err := s.Server.MetaSpecificRequest(httptest.NewRecorder(), req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// An invalid token is rejected
+	req, _ = http.NewRequest("GET", "/latest/meta-data/instance-id", nil)
+	req.Header.Set(MetaDataTokenHeader, "bogus")
+	if _, err := s.Server.MetaSpecificRequest(httptest.NewRecorder(), req); err == nil {
+		t.Fatalf("expected error for an invalid token")
+	} else if cErr, ok := err.(HTTPCodedError); !ok || cErr.Code() != 401 {
+		t.Fatalf("expected 401, got: %v", err)
+	}
+
+	// The ttl is mandatory & limited to 6 hours
+	for _, ttl := range []string{"", "0", "21601", "ten"} {
+		req, _ = http.NewRequest("PUT", "/latest/api/token", nil)
+		req.Header.Set(MetaDataTokenTTLHeader, ttl)
+		if _, err := s.Server.MetaDataTokenRequest(httptest.NewRecorder(), req); err == nil {
+			t.Fatalf("expected error for ttl '%s'", ttl)
+		} else if cErr, ok := err.(HTTPCodedError); !ok || cErr.Code() != 400 {
+			t.Fatalf("expected 400 for ttl '%s', got: %v", ttl, err)
+		}
+	}
+
+	// Tokens are issued only via PUT
+	req, _ = http.NewRequest("GET", "/latest/api/token", nil)
+	if _, err := s.Server.MetaDataTokenRequest(httptest.NewRecorder(), req); err == nil {
+		t.Fatalf("expected error for GET")
+	}
+}
+
+func TestMetaDataTokensExpire(t *testing.T) {
+	tokens, err := newMetaDataTokens()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	expired, err := tokens.issue(-time.Second)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if tokens.valid(expired) {
+		t.Fatalf("expected the token to have expired")
+	}
+
+	token, err := tokens.issue(time.Minute)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !tokens.valid(token) {
+		t.Fatalf("expected the token to be valid")
+	}
+}
+
+func TestMetaDataTokensForged(t *testing.T) {
+	tokens, err := newMetaDataTokens()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	other, err := newMetaDataTokens()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// A token of another key is not valid
+	token, err := other.issue(time.Minute)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if tokens.valid(token) {
+		t.Fatalf("expected the token of another key to be invalid")
+	}
+
+	// The expiry of a token can not be extended
+	token, err = tokens.issue(-time.Second)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	b, _ := base64.RawURLEncoding.DecodeString(token)
+	binary.BigEndian.PutUint64(b, uint64(time.Now().Add(time.Hour).UnixNano()))
+	if tokens.valid(base64.RawURLEncoding.EncodeToString(b)) {
+		t.Fatalf("expected the tampered token to be invalid")
+	}
+
+	for _, bad := range []string{"", "not-a-token", "AAAA"} {
+		if tokens.valid(bad) {
+			t.Fatalf("expected %q to be invalid", bad)
+		}
+	}
+}
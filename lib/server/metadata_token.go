@@ -0,0 +1,113 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// MetaDataTokenHeader carries the IMDSv2 session token of a meta data
+	// request
+	MetaDataTokenHeader = "X-aws-ec2-metadata-token"
+
+	// MetaDataTokenTTLHeader carries the ttl in seconds of the session token
+	// that is requested & of the session token that is issued
+	MetaDataTokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+
+	// maxMetaDataTokenTTL is the max ttl in seconds of a session token i.e.
+	// 6 hours
+	maxMetaDataTokenTTL = 21600
+)
+
+// metaDataTokens issues & verifies the IMDSv2 session tokens. A token is
+// its expiry signed by a key of this server. Hence no token is retained &
+// any number of tokens can be issued. The tokens do not survive a restart
+// of the server as the key is generated at start.
+type metaDataTokens struct {
+	key []byte
+}
+
+func newMetaDataTokens() (*metaDataTokens, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return &metaDataTokens{key: key}, nil
+}
+
+// sign returns the signature of the expiry of a token
+func (t *metaDataTokens) sign(expiry []byte) []byte {
+	mac := hmac.New(sha256.New, t.key)
+	mac.Write(expiry)
+	return mac.Sum(nil)
+}
+
+// issue returns a new token that expires after the ttl. A nonce is part of
+// the token so that the tokens issued at the same time differ.
+func (t *metaDataTokens) issue(ttl time.Duration) (string, error) {
+	b := make([]byte, 16, 16+sha256.Size)
+	binary.BigEndian.PutUint64(b, uint64(time.Now().Add(ttl).UnixNano()))
+	if _, err := rand.Read(b[8:]); err != nil {
+		return "", err
+	}
+	b = append(b, t.sign(b)...)
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// valid verifies if the token was issued by this server & has not expired
+func (t *metaDataTokens) valid(token string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) != 16+sha256.Size {
+		return false
+	}
+	if !hmac.Equal(b[16:], t.sign(b[:16])) {
+		return false
+	}
+
+	exp := time.Unix(0, int64(binary.BigEndian.Uint64(b)))
+	return time.Now().Before(exp)
+}
+
+// MetaDataTokenRequest issues an IMDSv2 session token for the ttl requested
+// via the ttl header
+func (s *HTTPServer) MetaDataTokenRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if req.Method != "PUT" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+
+	v := req.Header.Get(MetaDataTokenTTLHeader)
+	ttl, err := strconv.Atoi(v)
+	if err != nil || ttl < 1 || ttl > maxMetaDataTokenTTL {
+		return nil, CodedError(400, fmt.Sprintf("Invalid %s: '%s'. Expected 1 to %d", MetaDataTokenTTLHeader, v, maxMetaDataTokenTTL))
+	}
+
+	token, err := s.metaTokens.issue(time.Duration(ttl) * time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Header().Set(MetaDataTokenTTLHeader, strconv.Itoa(ttl))
+	return TextResponse(token), nil
+}
+
+// verifyMetaDataToken verifies the session token of the meta data request
+// if any
+func (s *HTTPServer) verifyMetaDataToken(req *http.Request) error {
+	token := req.Header.Get(MetaDataTokenHeader)
+	if token == "" {
+		return nil
+	}
+
+	if !s.metaTokens.valid(token) {
+		return CodedError(401, "Invalid or expired meta data token")
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	k8sApiErrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Orchestrator operations i.e. the StorageOps invoked via the volume
+// provisioner
+const (
+	storageOpAdd    = "AddStorage"
+	storageOpDelete = "DeleteStorage"
+	storageOpRead   = "ReadStorage"
+	storageOpList   = "ListStorage"
+)
+
+// Outcome classes of an orchestrator operation
+const (
+	outcomeSuccess      = "success"
+	outcomeNotFound     = "not_found"
+	outcomeConflict     = "conflict"
+	outcomeUnauthorized = "unauthorized"
+	outcomeTimeout      = "timeout"
+	outcomeUnreachable  = "unreachable"
+	outcomeError        = "error"
+)
+
+// Stages of resolving a volume provisioner & its profile
+const (
+	profileStageProvisioner = "provisioner"
+	profileStageProfile     = "profile"
+)
+
+// serverMetrics holds the Prometheus metrics of a maya api server. These are
+// registered against a registry owned by the server rather than the global
+// registry. Hence multiple servers e.g. in tests do not clash.
+type serverMetrics struct {
+	registry *prometheus.Registry
+
+	// A histogram samples observations (usually things like request durations
+	// or response sizes) and counts them in configurable buckets. It also
+	// provides a sum of all observed values.
+
+	// Buckets : Holds different time intervals to query for
+	// response time of the Request (GET,POST) of a network
+	// service.
+	// Accepted Values : Time Intervals in seconds
+	// Default value :{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	// We need to have new variables to hold counter and duration for every
+	// endpoint (apis).
+
+	// These counters donot reset to zero if container restarts.i.e, it will
+	// be increasing from time to time based on how many times a service is
+	// requested.
+
+	// volumeRequestDuration Collects the response time since a request has
+	// been made on /latest/volumes
+	volumeRequestDuration *prometheus.HistogramVec
+	// volumeRequestCounter Count the no of request Since a request has been
+	// made on /latest/volumes
+	volumeRequestCounter *prometheus.CounterVec
+
+	// metaDataRequestDuration Collects the response time since a request has
+	// been made on /latest/meta-data
+	metaDataRequestDuration *prometheus.HistogramVec
+	// metaDataRequestCounter Count the no of request Since a request has been
+	// made on /latest/meta-data
+	metaDataRequestCounter *prometheus.CounterVec
+
+	// healthRequestDuration Collects the response time since a request has
+	// been made on /v1/health
+	healthRequestDuration *prometheus.HistogramVec
+	// healthRequestCounter Count the no of request Since a request has been
+	// made on /v1/health
+	healthRequestCounter *prometheus.CounterVec
+
+	// openAPIRequestDuration Collects the response time since a request has
+	// been made on /v1/openapi.json
+	openAPIRequestDuration *prometheus.HistogramVec
+	// openAPIRequestCounter Count the no of request Since a request has been
+	// made on /v1/openapi.json
+	openAPIRequestCounter *prometheus.CounterVec
+
+	// agentRequestDuration Collects the response time since a request has
+	// been made on /v1/agent
+	agentRequestDuration *prometheus.HistogramVec
+	// agentRequestCounter Count the no of request Since a request has been
+	// made on /v1/agent
+	agentRequestCounter *prometheus.CounterVec
+
+	// auditRequestDuration Collects the response time since a request has
+	// been made on /v1/audit
+	auditRequestDuration *prometheus.HistogramVec
+	// auditRequestCounter Count the no of request Since a request has been
+	// made on /v1/audit
+	auditRequestCounter *prometheus.CounterVec
+
+	// ec2RequestDuration Collects the response time since a request has
+	// been made on /ec2
+	ec2RequestDuration *prometheus.HistogramVec
+	// ec2RequestCounter Count the no of request Since a request has been
+	// made on /ec2
+	ec2RequestCounter *prometheus.CounterVec
+
+	// profileRequestDuration Collects the response time since a request has
+	// been made on /v1/profiles
+	profileRequestDuration *prometheus.HistogramVec
+	// profileRequestCounter Count the no of request Since a request has been
+	// made on /v1/profiles
+	profileRequestCounter *prometheus.CounterVec
+
+	// orchestratorCallDuration Collects the time taken by the orchestrator
+	// operations
+	orchestratorCallDuration *prometheus.HistogramVec
+	// orchestratorCallCounter Count the no of orchestrator operations by
+	// their outcome
+	orchestratorCallCounter *prometheus.CounterVec
+
+	// profileFailureCounter Count the no of failures to resolve the volume
+	// provisioner & its profile
+	profileFailureCounter *prometheus.CounterVec
+}
+
+// newRequestDuration returns the response time histogram of an endpoint
+func newRequestDuration(name, endpoint string) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    name,
+			Help:    "Request response time of the " + endpoint + ".",
+			Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.5, 1, 2.5, 5, 10},
+		},
+		// code is http code and method is http method returned by the
+		// endpoint
+		[]string{"code", "method"},
+	)
+}
+
+// newRequestCounter returns the request counter of an endpoint
+func newRequestCounter(name, endpoint string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: name,
+			Help: "Total number of " + endpoint + " requests.",
+		},
+		[]string{"code", "method"},
+	)
+}
+
+// newServerMetrics creates the metrics & registers them against a new
+// registry. Metrics related to garbage collection, process, cpu...etc are
+// registered as well.
+func newServerMetrics() *serverMetrics {
+	m := &serverMetrics{
+		registry: prometheus.NewRegistry(),
+
+		volumeRequestDuration:   newRequestDuration("latest_openebs_volume_request_duration_seconds", "/latest/volumes"),
+		volumeRequestCounter:    newRequestCounter("latest_openebs_volume_requests_total", "/latest/volumes"),
+		metaDataRequestDuration: newRequestDuration("latest_openebs_meta_data_request_duration_seconds", "/latest/meta-data"),
+		metaDataRequestCounter:  newRequestCounter("latest_openebs_meta_data_requests_total", "/latest/meta-data"),
+		healthRequestDuration:   newRequestDuration("v1_health_request_duration_seconds", "/v1/health"),
+		healthRequestCounter:    newRequestCounter("v1_health_requests_total", "/v1/health"),
+		openAPIRequestDuration:  newRequestDuration("v1_openapi_request_duration_seconds", "/v1/openapi.json"),
+		openAPIRequestCounter:   newRequestCounter("v1_openapi_requests_total", "/v1/openapi.json"),
+		agentRequestDuration:    newRequestDuration("v1_agent_request_duration_seconds", "/v1/agent"),
+		agentRequestCounter:     newRequestCounter("v1_agent_requests_total", "/v1/agent"),
+		auditRequestDuration:    newRequestDuration("v1_audit_request_duration_seconds", "/v1/audit"),
+		auditRequestCounter:     newRequestCounter("v1_audit_requests_total", "/v1/audit"),
+		ec2RequestDuration:      newRequestDuration("ec2_openebs_request_duration_seconds", "/ec2"),
+		ec2RequestCounter:       newRequestCounter("ec2_openebs_requests_total", "/ec2"),
+		profileRequestDuration:  newRequestDuration("v1_profiles_request_duration_seconds", "/v1/profiles"),
+		profileRequestCounter:   newRequestCounter("v1_profiles_requests_total", "/v1/profiles"),
+
+		orchestratorCallDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "openebs_orchestrator_call_duration_seconds",
+				Help:    "Time taken by the orchestrator operations.",
+				Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+			},
+			[]string{"orchestrator", "operation", "outcome"},
+		),
+		orchestratorCallCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "openebs_orchestrator_calls_total",
+				Help: "Total number of orchestrator operations.",
+			},
+			[]string{"orchestrator", "operation", "outcome"},
+		),
+		profileFailureCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "openebs_provisioner_profile_failures_total",
+				Help: "Total number of failures to resolve the volume provisioner or its profile.",
+			},
+			[]string{"stage"},
+		),
+	}
+
+	m.registry.MustRegister(
+		prometheus.NewProcessCollector(os.Getpid(), ""),
+		prometheus.NewGoCollector(),
+		m.volumeRequestDuration,
+		m.volumeRequestCounter,
+		m.metaDataRequestDuration,
+		m.metaDataRequestCounter,
+		m.healthRequestDuration,
+		m.healthRequestCounter,
+		m.openAPIRequestDuration,
+		m.openAPIRequestCounter,
+		m.agentRequestDuration,
+		m.agentRequestCounter,
+		m.auditRequestDuration,
+		m.auditRequestCounter,
+		m.ec2RequestDuration,
+		m.ec2RequestCounter,
+		m.profileRequestDuration,
+		m.profileRequestCounter,
+		m.orchestratorCallDuration,
+		m.orchestratorCallCounter,
+		m.profileFailureCounter,
+	)
+
+	return m
+}
+
+// observeStorageOp records the duration & outcome of an orchestrator
+// operation
+func (m *serverMetrics) observeStorageOp(orchestrator, op, outcome string, start time.Time) {
+	m.orchestratorCallDuration.WithLabelValues(orchestrator, op, outcome).Observe(time.Since(start).Seconds())
+	m.orchestratorCallCounter.WithLabelValues(orchestrator, op, outcome).Inc()
+}
+
+// classifyOutcome classifies the error of an orchestrator operation. The
+// classes are coarse so as to keep the cardinality of the metrics low.
+func classifyOutcome(err error) string {
+	if err == nil {
+		return outcomeSuccess
+	}
+
+	switch {
+	case k8sApiErrors.IsNotFound(err):
+		return outcomeNotFound
+	case k8sApiErrors.IsAlreadyExists(err), k8sApiErrors.IsConflict(err):
+		return outcomeConflict
+	case k8sApiErrors.IsUnauthorized(err), k8sApiErrors.IsForbidden(err):
+		return outcomeUnauthorized
+	case k8sApiErrors.IsTimeout(err), k8sApiErrors.IsServerTimeout(err):
+		return outcomeTimeout
+	}
+
+	if uErr, ok := err.(*url.Error); ok {
+		err = uErr.Err
+	}
+
+	if nErr, ok := err.(net.Error); ok && nErr.Timeout() {
+		return outcomeTimeout
+	}
+
+	if _, ok := err.(*net.OpError); ok {
+		return outcomeUnreachable
+	}
+
+	// The orchestrators wrap most of the errors as plain errors
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "not found"):
+		return outcomeNotFound
+	case strings.Contains(msg, "already exists"):
+		return outcomeConflict
+	case strings.Contains(msg, "timeout"), strings.Contains(msg, "timed out"):
+		return outcomeTimeout
+	case strings.Contains(msg, "connection refused"), strings.Contains(msg, "no such host"):
+		return outcomeUnreachable
+	default:
+		return outcomeError
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/openebs/maya/types/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	k8sApiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// findMetric returns the metric of the family with the given label values
+func findMetric(t *testing.T, reg *prometheus.Registry, name string, labels map[string]string) *dto.Metric {
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+	next:
+		for _, m := range mf.GetMetric() {
+			got := map[string]string{}
+			for _, lp := range m.GetLabel() {
+				got[lp.GetName()] = lp.GetValue()
+			}
+			for k, v := range labels {
+				if got[k] != v {
+					continue next
+				}
+			}
+			return m
+		}
+	}
+
+	return nil
+}
+
+func TestServerMetricsPerServer(t *testing.T) {
+	// Metrics were registered globally & hence a second server would panic
+	s1 := makeHTTPTestServer(t, nil)
+	defer s1.Cleanup()
+	s2 := makeHTTPTestServer(t, nil)
+	defer s2.Cleanup()
+
+	if s1.Maya.metrics.registry == s2.Maya.metrics.registry {
+		t.Fatalf("expected a registry per server")
+	}
+
+	s1.Maya.metrics.profileFailureCounter.WithLabelValues(profileStageProfile).Inc()
+
+	labels := map[string]string{"stage": profileStageProfile}
+	if m := findMetric(t, s1.Maya.metrics.registry, "openebs_provisioner_profile_failures_total", labels); m.GetCounter().GetValue() != 1 {
+		t.Fatalf("expected 1 profile failure, got: %v", m)
+	}
+	if m := findMetric(t, s2.Maya.metrics.registry, "openebs_provisioner_profile_failures_total", labels); m != nil {
+		t.Fatalf("expected no profile failures in the other server, got: %v", m)
+	}
+}
+
+func TestStorageCall(t *testing.T) {
+	s := makeHTTPTestServer(t, nil)
+	defer s.Cleanup()
+
+	pvc := &v1.PersistentVolumeClaim{}
+	pvc.Name = "vol1"
+	pvc.Labels = map[string]string{
+		string(v1.OrchestratorNameLbl): string(v1.K8sOrchestrator),
+	}
+
+	req, _ := http.NewRequest("GET", "/latest/volumes/info/vol1", nil)
+
+	s.Server.startStorageCall(req, pvc, storageOpRead).done(nil, true)
+	s.Server.startStorageCall(req, pvc, storageOpRead).done(nil, false)
+	s.Server.startStorageCall(req, pvc, storageOpRead).done(errors.New("dial tcp: connection refused"), false)
+
+	reg := s.Maya.metrics.registry
+	for outcome, expected := range map[string]float64{
+		outcomeSuccess:     1,
+		outcomeNotFound:    1,
+		outcomeUnreachable: 1,
+	} {
+		labels := map[string]string{
+			"orchestrator": string(v1.K8sOrchestrator),
+			"operation":    storageOpRead,
+			"outcome":      outcome,
+		}
+
+		m := findMetric(t, reg, "openebs_orchestrator_calls_total", labels)
+		if m.GetCounter().GetValue() != expected {
+			t.Fatalf("%s: expected %v calls, got: %v", outcome, expected, m)
+		}
+
+		m = findMetric(t, reg, "openebs_orchestrator_call_duration_seconds", labels)
+		if m.GetHistogram().GetSampleCount() != uint64(expected) {
+			t.Fatalf("%s: expected %v observations, got: %v", outcome, expected, m)
+		}
+	}
+}
+
+func TestClassifyOutcome(t *testing.T) {
+	gr := schema.GroupResource{Resource: "pods"}
+
+	cases := []struct {
+		err      error
+		expected string
+	}{
+		{nil, outcomeSuccess},
+		{k8sApiErrors.NewNotFound(gr, "vol1"), outcomeNotFound},
+		{k8sApiErrors.NewAlreadyExists(gr, "vol1"), outcomeConflict},
+		{k8sApiErrors.NewForbidden(gr, "vol1", errors.New("denied")), outcomeUnauthorized},
+		{k8sApiErrors.NewServerTimeout(gr, "create", 1), outcomeTimeout},
+		{&url.Error{Op: "Get", URL: "http://10.0.0.1", Err: &net.OpError{Op: "dial", Err: errors.New("refused")}}, outcomeUnreachable},
+		{errors.New("Volume 'vol1' not found"), outcomeNotFound},
+		{errors.New("i/o timeout"), outcomeTimeout},
+		{errors.New("something went wrong"), outcomeError},
+	}
+
+	for _, c := range cases {
+		if got := classifyOutcome(c.err); got != c.expected {
+			t.Fatalf("%v: expected: %s, got: %s", c.err, c.expected, got)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/hashicorp/logutils"
+	"github.com/openebs/mayaserver/lib/loghelper"
+)
+
+// monitorBufferSize is the no. of log lines buffered per log monitor. It
+// matches the no. of lines replayed from the log registrar so that the
+// replay does not drop any line.
+const monitorBufferSize = 512
+
+// SetLogRegistrar sets the log registrar whose logs are streamed to the log
+// monitors
+func (ms *MayaApiServer) SetLogRegistrar(r *loghelper.LogRegistrar) {
+	ms.logRegistrar = r
+}
+
+// logMonitor is a log handler that streams the log lines of the given level
+// & above to a client. Lines are dropped rather than blocking the loggers
+// if the client is slow to consume them.
+type logMonitor struct {
+	filter *logutils.LevelFilter
+	logCh  chan string
+
+	// dropped is the no. of lines dropped since it was last reported
+	dropped uint64
+}
+
+// newLogMonitor returns a log monitor of the given level
+func newLogMonitor(level string) (*logMonitor, error) {
+	filter := loghelper.LevelFilter()
+	filter.MinLevel = logutils.LogLevel(strings.ToUpper(level))
+	if !loghelper.ValidateLevelFilter(filter.MinLevel, filter) {
+		return nil, fmt.Errorf("Invalid log level: %s. Valid log levels are: %v",
+			filter.MinLevel, filter.Levels)
+	}
+
+	return &logMonitor{
+		filter: filter,
+		logCh:  make(chan string, monitorBufferSize),
+	}, nil
+}
+
+// HandleLog queues the log line if it is of the monitored level. It never
+// blocks as it is invoked by the log registrar while the loggers wait.
+func (m *logMonitor) HandleLog(line string) {
+	if !m.filter.Check([]byte(line)) {
+		return
+	}
+
+	select {
+	case m.logCh <- line:
+	default:
+		atomic.AddUint64(&m.dropped, 1)
+	}
+}
+
+// takeDropped returns the no. of lines dropped since the last call
+func (m *logMonitor) takeDropped() uint64 {
+	return atomic.SwapUint64(&m.dropped, 0)
+}
+
+// agentMonitor streams the logs of maya api server till the client goes
+// away or the server is shutdown. The recent logs are replayed first. Only
+// the callers of the admin scope may stream the logs.
+func (s *HTTPServer) agentMonitor(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if req.Method != "GET" {
+		return nil, CodedError(405, ErrGetMethodRequired)
+	}
+
+	if err := s.requireAdminRequest(req); err != nil {
+		return nil, err
+	}
+
+	registrar := s.maya.logRegistrar
+	if registrar == nil {
+		return nil, CodedError(501, "Log monitoring is not supported")
+	}
+
+	level := req.URL.Query().Get("log_level")
+	if level == "" {
+		level = "INFO"
+	}
+
+	monitor, err := newLogMonitor(level)
+	if err != nil {
+		return nil, CodedError(400, err.Error())
+	}
+
+	registrar.RegisterHandler(monitor)
+	defer registrar.DeregisterHandler(monitor)
+
+	resp.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	resp.WriteHeader(200)
+
+	flusher, _ := resp.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	flush()
+
+	for {
+		select {
+		case line := <-monitor.logCh:
+			if n := monitor.takeDropped(); n > 0 {
+				fmt.Fprintf(resp, "[WARN] monitor: dropped %d log line(s) as the client is slow\n", n)
+			}
+
+			// JSON lines are streamed without their level prefix
+			if _, err := fmt.Fprintf(resp, "%s\n", loghelper.TrimJSONLevel([]byte(line))); err != nil {
+				return nil, nil
+			}
+
+			// Flush once the queued lines are written
+			if len(monitor.logCh) == 0 {
+				flush()
+			}
+		case <-req.Context().Done():
+			return nil, nil
+		case <-s.serveCh:
+			return nil, nil
+		}
+	}
+}
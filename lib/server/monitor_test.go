@@ -0,0 +1,103 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openebs/mayaserver/lib/config"
+	"github.com/openebs/mayaserver/lib/loghelper"
+)
+
+func TestLogMonitor(t *testing.T) {
+	if _, err := newLogMonitor("CHATTY"); err == nil {
+		t.Fatalf("expected error for invalid log level")
+	}
+
+	m, err := newLogMonitor("warn")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	m.HandleLog("[DEBUG] filtered")
+	m.HandleLog("[WARN] kept")
+	if len(m.logCh) != 1 || <-m.logCh != "[WARN] kept" {
+		t.Fatalf("expected only the lines of the monitored level")
+	}
+
+	// A slow client drops the lines rather than blocking the loggers
+	for i := 0; i < monitorBufferSize+3; i++ {
+		m.HandleLog(fmt.Sprintf("[ERR] line %d", i))
+	}
+	if n := m.takeDropped(); n != 3 {
+		t.Fatalf("expected 3 dropped lines, got: %d", n)
+	}
+	if n := m.takeDropped(); n != 0 {
+		t.Fatalf("expected dropped lines to be reset, got: %d", n)
+	}
+}
+
+func TestAgentMonitor(t *testing.T) {
+	s := makeHTTPTestServer(t, func(mc *config.MayaConfig) {
+		mc.AdminToken = testAdminToken
+	})
+	defer s.Cleanup()
+
+	// Only the admin may stream the logs
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/agent/monitor", nil)
+	if _, err := s.Server.AgentSpecificRequest(resp, req); err == nil {
+		t.Fatalf("expected error without the admin token")
+	} else if cErr, ok := err.(HTTPCodedError); !ok || cErr.Code() != 403 {
+		t.Fatalf("expected 403, got: %v", err)
+	}
+
+	// Not supported without a log registrar
+	resp = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/v1/agent/monitor", nil)
+	if _, err := s.Server.AgentSpecificRequest(resp, asAdmin(req)); err == nil {
+		t.Fatalf("expected error without a log registrar")
+	} else if cErr, ok := err.(HTTPCodedError); !ok || cErr.Code() != 501 {
+		t.Fatalf("expected 501, got: %v", err)
+	}
+
+	registrar := loghelper.NewLogRegistrar(16)
+	s.Maya.SetLogRegistrar(registrar)
+	registrar.Write([]byte("[DEBUG] old debug\n"))
+	registrar.Write([]byte("[WARN] old warn\n"))
+
+	resp = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/v1/agent/monitor?log_level=CHATTY", nil)
+	if _, err := s.Server.AgentSpecificRequest(resp, asAdmin(req)); err == nil {
+		t.Fatalf("expected error for invalid log level")
+	} else if cErr, ok := err.(HTTPCodedError); !ok || cErr.Code() != 400 {
+		t.Fatalf("expected 400, got: %v", err)
+	}
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("http://%s/v1/agent/monitor?log_level=WARN", s.Server.addr), nil)
+	httpResp, err := http.DefaultClient.Do(asAdmin(req))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != 200 {
+		t.Fatalf("expected 200, got: %d", httpResp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(httpResp.Body)
+
+	// The recent logs are replayed first
+	if !scanner.Scan() || scanner.Text() != "[WARN] old warn" {
+		t.Fatalf("expected the replayed log, got: %q %v", scanner.Text(), scanner.Err())
+	}
+
+	// Followed by the new logs
+	registrar.Write([]byte("[INFO] new info\n"))
+	registrar.Write([]byte("[ERR] new err\n"))
+	if !scanner.Scan() || scanner.Text() != "[ERR] new err" {
+		t.Fatalf("expected the new log, got: %q %v", scanner.Text(), scanner.Err())
+	}
+}
@@ -0,0 +1,299 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-openapi/spec"
+	"github.com/openebs/maya/types/v1"
+)
+
+// errorDefinition is the name of the OpenAPI definition of an error response
+const errorDefinition = "Error"
+
+var (
+	// pathParamRegex matches the path parameters of an OpenAPI path
+	pathParamRegex = regexp.MustCompile(`{([^}]+)}`)
+
+	// Types that marshal themselves to JSON strings
+	timeType     = reflect.TypeOf(time.Time{})
+	v1TimeType   = reflect.TypeOf(v1.Time{})
+	quantityType = reflect.TypeOf(v1.Quantity{})
+
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// OpenAPIRequest is a http handler implementation. It serves the OpenAPI
+// document of maya api server.
+func (s *HTTPServer) OpenAPIRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+
+	if req.Method != "GET" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+
+	return s.openAPISpec(), nil
+}
+
+// openAPISpec generates the OpenAPI 2.0 document from the route registry.
+// The schemas are derived from the request & response types of the routes.
+func (s *HTTPServer) openAPISpec() *spec.Swagger {
+	defs := spec.Definitions{
+		errorDefinition: *spec.StringProperty().WithDescription(
+			"Error message sent as text/plain along with the HTTP error code"),
+	}
+	sb := &schemaBuilder{defs: defs}
+
+	paths := &spec.Paths{Paths: map[string]spec.PathItem{}}
+	for _, r := range s.routes() {
+		for _, op := range r.ops {
+			item := paths.Paths[op.path]
+			setOperation(&item, op.method, sb.operation(op))
+			paths.Paths[op.path] = item
+		}
+	}
+
+	return &spec.Swagger{
+		SwaggerProps: spec.SwaggerProps{
+			Swagger:  "2.0",
+			Consumes: []string{"application/json", "application/yaml"},
+			Produces: []string{"application/json"},
+			Info: &spec.Info{
+				InfoProps: spec.InfoProps{
+					Title:       "Maya API Server",
+					Description: "API to manage OpenEBS volumes",
+					Version:     s.maya.Config().Version + s.maya.Config().VersionPrerelease,
+				},
+			},
+			Paths:       paths,
+			Definitions: defs,
+		},
+	}
+}
+
+// setOperation sets the operation against the HTTP method of the path item
+func setOperation(item *spec.PathItem, method string, op *spec.Operation) {
+	switch method {
+	case "GET":
+		item.Get = op
+	case "PUT":
+		item.Put = op
+	case "POST":
+		item.Post = op
+	case "DELETE":
+		item.Delete = op
+	case "HEAD":
+		item.Head = op
+	case "PATCH":
+		item.Patch = op
+	case "OPTIONS":
+		item.Options = op
+	}
+}
+
+// operationOf returns the operation set against the HTTP method of the path
+// item
+func operationOf(item spec.PathItem, method string) *spec.Operation {
+	switch method {
+	case "GET":
+		return item.Get
+	case "PUT":
+		return item.Put
+	case "POST":
+		return item.Post
+	case "DELETE":
+		return item.Delete
+	case "HEAD":
+		return item.Head
+	case "PATCH":
+		return item.Patch
+	case "OPTIONS":
+		return item.Options
+	default:
+		return nil
+	}
+}
+
+// schemaBuilder derives OpenAPI schemas from go types. Named structs are
+// added as definitions & referred to from the schemas.
+type schemaBuilder struct {
+	defs spec.Definitions
+}
+
+// operation builds the OpenAPI operation of a route operation
+func (sb *schemaBuilder) operation(rop routeOp) *spec.Operation {
+	op := spec.NewOperation(rop.id).WithSummary(rop.summary)
+
+	for _, m := range pathParamRegex.FindAllStringSubmatch(rop.path, -1) {
+		op.AddParam(spec.PathParam(m[1]).Typed("string", ""))
+	}
+
+	if rop.request != nil {
+		schema := sb.schemaOf(reflect.TypeOf(rop.request))
+		op.AddParam(spec.BodyParam("body", &schema).AsRequired())
+	}
+
+	if rop.produces != "" {
+		op.WithProduces(rop.produces)
+	}
+
+	var schema *spec.Schema
+	if rop.response != nil {
+		sch := sb.schemaOf(reflect.TypeOf(rop.response))
+		schema = &sch
+	}
+	op.RespondsWith(200, &spec.Response{
+		ResponseProps: spec.ResponseProps{
+			Description: "Success",
+			Schema:      schema,
+		},
+	})
+	for _, code := range rop.codes {
+		op.RespondsWith(code, &spec.Response{
+			ResponseProps: spec.ResponseProps{
+				Description: http.StatusText(code),
+				Schema:      schema,
+			},
+		})
+	}
+
+	op.WithDefaultResponse(&spec.Response{
+		ResponseProps: spec.ResponseProps{
+			Description: "Error",
+			Schema:      spec.RefSchema("#/definitions/" + errorDefinition),
+		},
+	})
+
+	return op
+}
+
+// schemaOf returns the schema of the given type
+func (sb *schemaBuilder) schemaOf(t reflect.Type) spec.Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType, v1TimeType:
+		return *spec.DateTimeProperty()
+	case quantityType:
+		return *spec.StringProperty()
+	}
+
+	// The JSON form of a type with its own marshaler can not be derived
+	if t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType) {
+		return spec.Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return *spec.BooleanProperty()
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return *spec.Int32Property()
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return *spec.Int64Property()
+	case reflect.Float32:
+		return *spec.Float32Property()
+	case reflect.Float64:
+		return *spec.Float64Property()
+	case reflect.String:
+		return *spec.StringProperty()
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return *spec.StrFmtProperty("byte")
+		}
+		return *spec.ArrayProperty(ptrTo(sb.schemaOf(t.Elem())))
+	case reflect.Map:
+		return *spec.MapProperty(ptrTo(sb.schemaOf(t.Elem())))
+	case reflect.Struct:
+		return sb.structSchema(t)
+	default:
+		return spec.Schema{}
+	}
+}
+
+// ptrTo returns a pointer to a copy of the schema
+func ptrTo(schema spec.Schema) *spec.Schema {
+	return &schema
+}
+
+// structSchema returns the schema of a struct. Named structs are added as
+// definitions & a reference to the definition is returned.
+func (sb *schemaBuilder) structSchema(t reflect.Type) spec.Schema {
+	name := definitionName(t)
+	if name == "" {
+		return sb.objectSchema(t)
+	}
+
+	if _, found := sb.defs[name]; !found {
+		// A placeholder takes care of recursive types
+		sb.defs[name] = spec.Schema{}
+		sb.defs[name] = sb.objectSchema(t)
+	}
+
+	return *spec.RefSchema("#/definitions/" + name)
+}
+
+// objectSchema returns the object schema with the JSON properties of the
+// struct
+func (sb *schemaBuilder) objectSchema(t reflect.Type) spec.Schema {
+	schema := spec.Schema{}
+	schema.Typed("object", "")
+	schema.Properties = map[string]spec.Schema{}
+
+	sb.addProperties(&schema, t)
+
+	return schema
+}
+
+// addProperties adds the JSON properties of the struct fields to the schema.
+// The properties of inlined & anonymous structs are flattened.
+func (sb *schemaBuilder) addProperties(schema *spec.Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			// unexported field
+			continue
+		}
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		inline := strings.Contains(tag, ",inline")
+
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		if (inline || (f.Anonymous && name == "")) && ft.Kind() == reflect.Struct {
+			sb.addProperties(schema, ft)
+			continue
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		schema.Properties[name] = sb.schemaOf(f.Type)
+	}
+}
+
+// definitionName returns the name of the definition of a named type e.g.
+// v1.PersistentVolume
+func definitionName(t reflect.Type) string {
+	if t.Name() == "" {
+		return ""
+	}
+
+	return path.Base(t.PkgPath()) + "." + t.Name()
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-openapi/spec"
+)
+
+func TestOpenAPISpecCoversRoutes(t *testing.T) {
+	s := makeHTTPTestServer(t, nil)
+	defer s.Cleanup()
+
+	sw := s.Server.openAPISpec()
+
+	for _, r := range s.Server.routes() {
+		if len(r.ops) == 0 {
+			t.Fatalf("route '%s' is not documented in the OpenAPI spec", r.pattern)
+		}
+
+		for _, op := range r.ops {
+			// The documented path must be served by this route
+			if !strings.HasPrefix(op.path, r.pattern) {
+				t.Fatalf("path '%s' is not served by route '%s'", op.path, r.pattern)
+			}
+
+			item, ok := sw.Paths.Paths[op.path]
+			if !ok {
+				t.Fatalf("path '%s' of route '%s' is missing from the OpenAPI spec", op.path, r.pattern)
+			}
+
+			specOp := operationOf(item, op.method)
+			if specOp == nil {
+				t.Fatalf("'%s %s' is missing from the OpenAPI spec", op.method, op.path)
+			}
+
+			if specOp.ID != op.id {
+				t.Fatalf("expected operation id: %s, got: %s", op.id, specOp.ID)
+			}
+
+			if specOp.Responses == nil || specOp.Responses.Default == nil {
+				t.Fatalf("'%s %s' does not document the error response", op.method, op.path)
+			}
+		}
+	}
+}
+
+func TestOpenAPISpecVolumeSchemas(t *testing.T) {
+	s := makeHTTPTestServer(t, nil)
+	defer s.Cleanup()
+
+	sw := s.Server.openAPISpec()
+
+	add := sw.Paths.Paths["/latest/volumes/"].Post
+	if add == nil {
+		t.Fatalf("volume add operation is missing")
+	}
+
+	if len(add.Parameters) != 1 || add.Parameters[0].In != "body" {
+		t.Fatalf("expected a body parameter, got: %#v", add.Parameters)
+	}
+
+	if ref := add.Parameters[0].Schema.Ref.String(); ref != "#/definitions/v1.PersistentVolumeClaim" {
+		t.Fatalf("expected claim schema, got: %s", ref)
+	}
+
+	resp := add.Responses.StatusCodeResponses[200]
+	if ref := resp.Schema.Ref.String(); ref != "#/definitions/v1.PersistentVolume" {
+		t.Fatalf("expected volume schema, got: %s", ref)
+	}
+
+	pv, ok := sw.Definitions["v1.PersistentVolume"]
+	if !ok {
+		t.Fatalf("volume definition is missing")
+	}
+
+	// Inlined type meta is flattened alongside the other properties
+	for _, p := range []string{"kind", "apiVersion", "metadata", "spec", "status"} {
+		if _, ok := pv.Properties[p]; !ok {
+			t.Fatalf("property '%s' is missing from volume definition", p)
+		}
+	}
+
+	meta := sw.Definitions["v1.ObjectMeta"]
+	if !meta.Properties["creationTimestamp"].Type.Contains("string") {
+		t.Fatalf("expected creationTimestamp as string, got: %#v", meta.Properties["creationTimestamp"])
+	}
+
+	if _, ok := sw.Definitions[errorDefinition]; !ok {
+		t.Fatalf("error definition is missing")
+	}
+}
+
+func TestOpenAPIRequestViaWrap(t *testing.T) {
+	s := makeHTTPTestServer(t, nil)
+	defer s.Cleanup()
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/openapi.json", nil)
+
+	s.Server.wrap(RequestCounter, RequestDuration, s.Server.OpenAPIRequest)(resp, req)
+
+	if resp.Code != 200 {
+		t.Fatalf("err http resp code, expected: 200, got: %v", resp.Code)
+	}
+
+	var sw spec.Swagger
+	if err := json.Unmarshal(resp.Body.Bytes(), &sw); err != nil {
+		t.Fatalf("err decoding OpenAPI spec: %v", err)
+	}
+
+	if sw.Swagger != "2.0" {
+		t.Fatalf("expected swagger version 2.0, got: %s", sw.Swagger)
+	}
+
+	if _, ok := sw.Paths.Paths["/latest/volumes/info/{name}"]; !ok {
+		t.Fatalf("volume read is missing from the served spec")
+	}
+}
@@ -0,0 +1,352 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openebs/maya/types/v1"
+	"github.com/openebs/mayaserver/lib/api"
+	"github.com/openebs/mayaserver/lib/audit"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// profilesBucket is the bucket of the state that has the storage profiles by
+// their names
+const profilesBucket = "profiles"
+
+// ProfileRequest serves the requests w.r.t the storage profiles i.e.
+// /v1/profiles/ & /v1/profiles/{name}
+func (s *HTTPServer) ProfileRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	name := strings.TrimPrefix(req.URL.Path, "/v1/profiles/")
+
+	if name == "" {
+		if req.Method != "GET" {
+			return nil, CodedError(405, ErrInvalidMethod)
+		}
+		return s.profileList(resp, req)
+	}
+
+	switch req.Method {
+	case "GET":
+		return s.profileRead(resp, req, name)
+	case "PUT", "POST":
+		return s.profilePut(resp, req, name)
+	case "DELETE":
+		return s.profileDelete(resp, req, name)
+	default:
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+}
+
+// profileList lists the storage profiles sorted by their names
+func (s *HTTPServer) profileList(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	if err := s.blockingQuery(resp, req, s.maya.profileIndex); err != nil {
+		return nil, err
+	}
+
+	profiles := []*api.StorageProfile{}
+	for _, name := range s.maya.state.Keys(profilesBucket) {
+		profile, err := s.maya.profileOf(name)
+		if err != nil {
+			return nil, err
+		}
+		if profile != nil {
+			profiles = append(profiles, profile)
+		}
+	}
+	return profiles, nil
+}
+
+// profileRead returns the named storage profile
+func (s *HTTPServer) profileRead(resp http.ResponseWriter, req *http.Request, name string) (interface{}, error) {
+	if err := s.blockingQuery(resp, req, s.maya.profileIndex); err != nil {
+		return nil, err
+	}
+
+	profile, err := s.maya.profileOf(name)
+	if err != nil {
+		return nil, err
+	}
+	if profile == nil {
+		return nil, CodedError(404, fmt.Sprintf("Storage profile '%s' not found", name))
+	}
+	return profile, nil
+}
+
+// profilePut creates the storage profile or replaces the profile of the same
+// name. The volumes created from the replaced profile are not affected. Only
+// the callers of the admin scope may save a profile. Every request whose spec
+// could be decoded is audited along with its outcome.
+func (s *HTTPServer) profilePut(resp http.ResponseWriter, req *http.Request, name string) (out interface{}, err error) {
+	var profile api.StorageProfile
+	if err := decodeBody(req, &profile); err != nil {
+		return nil, CodedError(400, err.Error())
+	}
+
+	defer func() {
+		s.auditRequest(req, audit.OpProfilePut, "", &profile, err)
+	}()
+
+	if err := s.requireAdminRequest(req); err != nil {
+		return nil, err
+	}
+
+	if profile.Name == "" {
+		profile.Name = name
+	}
+	if profile.Name != name {
+		return nil, CodedError(400, fmt.Sprintf("Storage profile name '%s' does not match '%s'", profile.Name, name))
+	}
+	if err := validateProfile(&profile); err != nil {
+		return nil, CodedError(400, err.Error())
+	}
+
+	profile.ModifyTime = time.Now().UTC()
+	if err := s.maya.state.Put(profilesBucket, name, &profile); err != nil {
+		return nil, err
+	}
+
+	// Release the blocking queries of the profiles
+	s.maya.profileIndex.bump()
+
+	s.requestLogger(req).Printf("[INFO] profile: Saved storage profile '%s'", name)
+
+	return &profile, nil
+}
+
+// profileDelete deletes the named storage profile. The volumes created from
+// the profile are not affected. Only the callers of the admin scope may
+// delete a profile. Every request is audited along with its outcome.
+func (s *HTTPServer) profileDelete(resp http.ResponseWriter, req *http.Request, name string) (out interface{}, err error) {
+	defer func() {
+		s.auditRequest(req, audit.OpProfileDelete, "", map[string]string{"name": name}, err)
+	}()
+
+	if err := s.requireAdminRequest(req); err != nil {
+		return nil, err
+	}
+
+	ok, err := s.maya.state.Delete(profilesBucket, name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, CodedError(404, fmt.Sprintf("Storage profile '%s' not found", name))
+	}
+
+	// Release the blocking queries of the profiles
+	s.maya.profileIndex.bump()
+
+	s.requestLogger(req).Printf("[INFO] profile: Deleted storage profile '%s'", name)
+
+	return fmt.Sprintf("Storage profile '%s' deleted successfully", name), nil
+}
+
+// profileOf returns the named storage profile as per the state. It returns
+// nil if there is no such profile.
+func (ms *MayaApiServer) profileOf(name string) (*api.StorageProfile, error) {
+	profile := &api.StorageProfile{}
+	ok, err := ms.state.Get(profilesBucket, name, profile)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// validateProfile verifies that the limits of the profile are consistent &
+// that its defaults are within its limits
+func validateProfile(p *api.StorageProfile) error {
+	if strings.ContainsAny(p.Name, "/ ") {
+		return fmt.Errorf("Invalid storage profile name '%s'", p.Name)
+	}
+
+	if p.ReplicaCount < 0 || p.MinReplicaCount < 0 || p.MaxReplicaCount < 0 || p.ControllerCount < 0 {
+		return fmt.Errorf("Replica & controller counts of storage profile '%s' must not be negative", p.Name)
+	}
+	if p.MaxReplicaCount > 0 && p.MinReplicaCount > p.MaxReplicaCount {
+		return fmt.Errorf("Min replica count %d of storage profile '%s' exceeds its max replica count %d", p.MinReplicaCount, p.Name, p.MaxReplicaCount)
+	}
+	if p.ReplicaCount > 0 {
+		if err := checkReplicaCount(p, p.ReplicaCount); err != nil {
+			return err
+		}
+	}
+
+	min, err := parseStorageSize(p.MinStorageSize)
+	if err != nil {
+		return err
+	}
+	max, err := parseStorageSize(p.MaxStorageSize)
+	if err != nil {
+		return err
+	}
+	if min != nil && max != nil && min.Cmp(*max) > 0 {
+		return fmt.Errorf("Min storage size %s of storage profile '%s' exceeds its max storage size %s", p.MinStorageSize, p.Name, p.MaxStorageSize)
+	}
+	if p.StorageSize != "" {
+		if err := checkStorageSize(p, p.StorageSize); err != nil {
+			return err
+		}
+	}
+
+	for _, d := range profileAllowed(p, p.ReplicaImage, p.ControllerImage, p.Orchestrator, p.Namespace) {
+		if err := checkAllowed(p, d.lbl, d.value, d.allowed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseStorageSize parses the storage size e.g. 5G. It returns nil if the
+// size is not set.
+func parseStorageSize(size string) (*resource.Quantity, error) {
+	if size == "" {
+		return nil, nil
+	}
+	q, err := resource.ParseQuantity(size)
+	if err != nil || q.Sign() <= 0 {
+		return nil, fmt.Errorf("Invalid storage size '%s'", size)
+	}
+	return &q, nil
+}
+
+// checkReplicaCount verifies that the replica count is within the limits of
+// the profile
+func checkReplicaCount(p *api.StorageProfile, count int) error {
+	if count < 1 ||
+		(p.MinReplicaCount > 0 && count < p.MinReplicaCount) ||
+		(p.MaxReplicaCount > 0 && count > p.MaxReplicaCount) {
+		return fmt.Errorf("Replica count %d is not within the limits [%d, %d] of storage profile '%s'", count, p.MinReplicaCount, p.MaxReplicaCount, p.Name)
+	}
+	return nil
+}
+
+// checkStorageSize verifies that the storage size is within the limits of
+// the profile
+func checkStorageSize(p *api.StorageProfile, size string) error {
+	q, err := parseStorageSize(size)
+	if err != nil {
+		return err
+	}
+	min, _ := parseStorageSize(p.MinStorageSize)
+	max, _ := parseStorageSize(p.MaxStorageSize)
+
+	if (min != nil && q.Cmp(*min) < 0) || (max != nil && q.Cmp(*max) > 0) {
+		return fmt.Errorf("Storage size %s is not within the limits [%s, %s] of storage profile '%s'", size, p.MinStorageSize, p.MaxStorageSize, p.Name)
+	}
+	return nil
+}
+
+// allowedLabel is a label of a claim along with the values the storage
+// profile allows for it
+type allowedLabel struct {
+	lbl     string
+	value   string
+	allowed []string
+}
+
+// profileAllowed pairs the replica image, the controller image, the
+// orchestrator & the namespace with the allow-lists of the profile
+func profileAllowed(p *api.StorageProfile, replicaImage, ctrlImage, orchestrator, ns string) []allowedLabel {
+	return []allowedLabel{
+		{string(v1.PVPReplicaImageLbl), replicaImage, p.AllowedImages},
+		{string(v1.PVPControllerImageLbl), ctrlImage, p.AllowedImages},
+		{string(v1.OrchestratorNameLbl), orchestrator, p.AllowedOrchestrators},
+		{string(v1.OrchNSLbl), ns, p.AllowedNamespaces},
+	}
+}
+
+// checkAllowed verifies that the value is in the allow-list of the profile.
+// An empty allow-list or an unset value is not restricted.
+func checkAllowed(p *api.StorageProfile, lbl, value string, allowed []string) error {
+	if value == "" || len(allowed) == 0 {
+		return nil
+	}
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s '%s' is not allowed by storage profile '%s'. Allowed: %s", lbl, value, p.Name, strings.Join(allowed, ", "))
+}
+
+// applyStorageProfile sets the labels of the claim that are not set by the
+// claim from the storage profile the claim refers to. The replica count &
+// the storage size of the claim must be within the limits of the profile. The
+// images, the orchestrator & the namespace of the claim must be in the
+// allow-lists of the profile if the profile sets them. A claim that does not
+// refer to a profile is left as is.
+//
+// The profile name label is removed from the claim once the profile is
+// applied as the volume provisioner does not resolve the profiles by name.
+func (s *HTTPServer) applyStorageProfile(pvc *v1.PersistentVolumeClaim) error {
+	name := strings.TrimSpace(pvc.Labels[string(v1.PVPProfileNameLbl)])
+	if name == "" {
+		return nil
+	}
+
+	profile, err := s.maya.profileOf(name)
+	if err != nil {
+		return err
+	}
+	if profile == nil {
+		return CodedError(400, fmt.Sprintf("Storage profile '%s' of VSM '%s' not found", name, pvc.Name))
+	}
+
+	count := func(n int) string {
+		if n == 0 {
+			return ""
+		}
+		return strconv.Itoa(n)
+	}
+
+	defaults := []struct {
+		lbl   string
+		value string
+	}{
+		{string(v1.PVPReplicaCountLbl), count(profile.ReplicaCount)},
+		{string(v1.PVPControllerCountLbl), count(profile.ControllerCount)},
+		{string(v1.PVPReplicaImageLbl), profile.ReplicaImage},
+		{string(v1.PVPControllerImageLbl), profile.ControllerImage},
+		{string(v1.PVPStorageSizeLbl), profile.StorageSize},
+		{string(v1.PVPReplicaTopologyKeyLbl), profile.ReplicaTopologyKey},
+		{string(v1.OrchestratorNameLbl), profile.Orchestrator},
+		{string(v1.OrchNSLbl), profile.Namespace},
+	}
+	for _, d := range defaults {
+		if d.value == "" || strings.TrimSpace(pvc.Labels[d.lbl]) != "" {
+			continue
+		}
+		pvc.Labels[d.lbl] = d.value
+	}
+	delete(pvc.Labels, string(v1.PVPProfileNameLbl))
+
+	if v := strings.TrimSpace(pvc.Labels[string(v1.PVPReplicaCountLbl)]); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return CodedError(400, fmt.Sprintf("Invalid %s '%s'", v1.PVPReplicaCountLbl, v))
+		}
+		if err := checkReplicaCount(profile, n); err != nil {
+			return CodedError(400, err.Error())
+		}
+	}
+	if v := strings.TrimSpace(pvc.Labels[string(v1.PVPStorageSizeLbl)]); v != "" {
+		if err := checkStorageSize(profile, v); err != nil {
+			return CodedError(400, err.Error())
+		}
+	}
+
+	lbl := func(l string) string { return strings.TrimSpace(pvc.Labels[l]) }
+	allowed := profileAllowed(profile,
+		lbl(string(v1.PVPReplicaImageLbl)), lbl(string(v1.PVPControllerImageLbl)),
+		lbl(string(v1.OrchestratorNameLbl)), lbl(string(v1.OrchNSLbl)))
+	for _, a := range allowed {
+		if err := checkAllowed(profile, a.lbl, a.value, a.allowed); err != nil {
+			return CodedError(400, err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/openebs/maya/types/v1"
+	"github.com/openebs/mayaserver/lib/api"
+	"github.com/openebs/mayaserver/lib/audit"
+	"github.com/openebs/mayaserver/lib/config"
+)
+
+func TestStorageProfiles(t *testing.T) {
+	s, client, cleanup := makeAPIClientTestServerWithConfig(t, func(mc *config.MayaConfig) {
+		mc.AdminToken = testAdminToken
+	})
+	defer cleanup()
+
+	admin, err := api.NewClient(&api.Config{
+		Address: "http://" + s.Server.addr,
+		Token:   testAdminToken,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	profiles := admin.Profiles()
+
+	gold := &api.StorageProfile{
+		Name:            "gold",
+		ReplicaCount:    3,
+		MinReplicaCount: 2,
+		MaxReplicaCount: 5,
+		ReplicaImage:    "openebs/jiva:gold",
+		StorageSize:     "5G",
+		MinStorageSize:  "1G",
+		MaxStorageSize:  "10G",
+		Namespace:       "gold",
+	}
+	// Only the admin may save or delete a profile
+	if _, err := client.Profiles().Put(gold, nil); api.KindOf(err) != api.ErrorKindUnauthorized {
+		t.Fatalf("expected unauthorized, got: %v", err)
+	}
+
+	out, err := profiles.Put(gold, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out.Name != "gold" || out.ReplicaCount != 3 || out.ModifyTime.IsZero() {
+		t.Fatalf("bad profile: %#v", out)
+	}
+
+	if _, err := profiles.Put(&api.StorageProfile{Name: "silver"}, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	list, _, err := profiles.List(nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(list) != 2 || list[0].Name != "gold" || list[1].Name != "silver" {
+		t.Fatalf("bad profiles: %#v", list)
+	}
+
+	info, _, err := profiles.Info("gold", nil)
+	if err != nil || info.MaxStorageSize != "10G" {
+		t.Fatalf("bad profile: %#v %v", info, err)
+	}
+
+	// A claim inherits the settings of its profile
+	pvc := &v1.PersistentVolumeClaim{}
+	pvc.Name = "vol1"
+	pvc.Labels = map[string]string{string(v1.PVPProfileNameLbl): "gold"}
+	pv, err := client.Volumes().Create(pvc, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if size := pv.Annotations[string(v1.VolumeSizeAPILbl)]; size != "5G" {
+		t.Fatalf("expected the size of the profile, got: %s", size)
+	}
+
+	// A claim overrides its profile within the limits of the profile
+	pvc.Name = "vol2"
+	pvc.Labels[string(v1.PVPStorageSizeLbl)] = "8G"
+	pv, err = client.Volumes().Create(pvc, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if size := pv.Annotations[string(v1.VolumeSizeAPILbl)]; size != "8G" {
+		t.Fatalf("expected the size of the claim, got: %s", size)
+	}
+
+	pvc.Name = "vol3"
+	pvc.Labels[string(v1.PVPStorageSizeLbl)] = "20G"
+	if _, err := client.Volumes().Create(pvc, nil); api.KindOf(err) != api.ErrorKindInvalid {
+		t.Fatalf("expected invalid, got: %v", err)
+	}
+
+	pvc.Labels = map[string]string{string(v1.PVPProfileNameLbl): "bronze"}
+	if _, err := client.Volumes().Create(pvc, nil); api.KindOf(err) != api.ErrorKindInvalid {
+		t.Fatalf("expected invalid, got: %v", err)
+	}
+
+	if err := client.Profiles().Delete("silver", nil); api.KindOf(err) != api.ErrorKindUnauthorized {
+		t.Fatalf("expected unauthorized, got: %v", err)
+	}
+	if err := profiles.Delete("silver", nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := profiles.Delete("silver", nil); api.KindOf(err) != api.ErrorKindNotFound {
+		t.Fatalf("expected not found, got: %v", err)
+	}
+	if _, _, err := profiles.Info("silver", nil); api.KindOf(err) != api.ErrorKindNotFound {
+		t.Fatalf("expected not found, got: %v", err)
+	}
+
+	// The changes to the profiles are audited
+	records, err := s.Maya.audit.Query(audit.Query{})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	ops := map[string]int{}
+	for _, r := range records {
+		ops[r.Operation]++
+	}
+	if ops[audit.OpProfilePut] != 3 || ops[audit.OpProfileDelete] != 3 {
+		t.Fatalf("bad audit records: %v", ops)
+	}
+}
+
+func TestApplyStorageProfile(t *testing.T) {
+	s := makeHTTPTestServerNoLogs(t, nil)
+	defer s.Cleanup()
+
+	profile := &api.StorageProfile{
+		Name:               "gold",
+		ReplicaCount:       3,
+		MaxReplicaCount:    3,
+		ControllerImage:    "openebs/jiva:ctrl",
+		ReplicaTopologyKey: "kubernetes.io/hostname",
+		Orchestrator:       "kubernetes",
+		Namespace:          "gold",
+	}
+	if err := s.Maya.state.Put(profilesBucket, profile.Name, profile); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pvc := &v1.PersistentVolumeClaim{}
+	pvc.Name = "vol1"
+	pvc.Labels = map[string]string{
+		string(v1.PVPProfileNameLbl):  "gold",
+		string(v1.PVPReplicaCountLbl): "2",
+		string(v1.OrchNSLbl):          "team",
+	}
+	if err := s.Server.applyStorageProfile(pvc); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	expected := map[string]string{
+		string(v1.PVPReplicaCountLbl):       "2",
+		string(v1.PVPControllerImageLbl):    "openebs/jiva:ctrl",
+		string(v1.PVPReplicaTopologyKeyLbl): "kubernetes.io/hostname",
+		string(v1.OrchestratorNameLbl):      "kubernetes",
+		string(v1.OrchNSLbl):                "team",
+	}
+	if len(pvc.Labels) != len(expected) {
+		t.Fatalf("bad labels: %v", pvc.Labels)
+	}
+	for k, v := range expected {
+		if pvc.Labels[k] != v {
+			t.Fatalf("bad label %s: %s", k, pvc.Labels[k])
+		}
+	}
+
+	for _, count := range []string{"4", "0", "three"} {
+		pvc.Labels[string(v1.PVPProfileNameLbl)] = "gold"
+		pvc.Labels[string(v1.PVPReplicaCountLbl)] = count
+		if err := s.Server.applyStorageProfile(pvc); err == nil {
+			t.Fatalf("expected an error for replica count %s", count)
+		}
+	}
+
+	// The images, the orchestrator & the namespace are limited by the
+	// allow-lists of the profile
+	profile.AllowedImages = []string{"openebs/jiva:ctrl", "openebs/jiva:0.3"}
+	profile.AllowedNamespaces = []string{"gold", "team"}
+	if err := s.Maya.state.Put(profilesBucket, profile.Name, profile); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	claim := func(lbls ...string) *v1.PersistentVolumeClaim {
+		pvc := &v1.PersistentVolumeClaim{}
+		pvc.Name = "vol2"
+		pvc.Labels = map[string]string{string(v1.PVPProfileNameLbl): "gold"}
+		for i := 0; i < len(lbls); i += 2 {
+			pvc.Labels[lbls[i]] = lbls[i+1]
+		}
+		return pvc
+	}
+	if err := s.Server.applyStorageProfile(claim(string(v1.PVPReplicaImageLbl), "openebs/jiva:0.3", string(v1.OrchNSLbl), "team")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for _, pvc := range []*v1.PersistentVolumeClaim{
+		claim(string(v1.PVPReplicaImageLbl), "evil/jiva:latest"),
+		claim(string(v1.PVPControllerImageLbl), "evil/jiva:latest"),
+		claim(string(v1.OrchNSLbl), "kube-system"),
+	} {
+		if err := s.Server.applyStorageProfile(pvc); err == nil {
+			t.Fatalf("expected an error for labels %v", pvc.Labels)
+		}
+	}
+
+	// A claim without a profile is left as is
+	pvc.Labels = map[string]string{string(v1.PVPReplicaCountLbl): "9"}
+	if err := s.Server.applyStorageProfile(pvc); err != nil || len(pvc.Labels) != 1 {
+		t.Fatalf("bad labels: %v %v", pvc.Labels, err)
+	}
+}
+
+func TestValidateProfile(t *testing.T) {
+	invalid := []*api.StorageProfile{
+		{Name: "a/b"},
+		{Name: "gold", ReplicaCount: -1},
+		{Name: "gold", MinReplicaCount: 3, MaxReplicaCount: 2},
+		{Name: "gold", ReplicaCount: 4, MaxReplicaCount: 3},
+		{Name: "gold", StorageSize: "5GB"},
+		{Name: "gold", StorageSize: "0"},
+		{Name: "gold", MinStorageSize: "10G", MaxStorageSize: "5G"},
+		{Name: "gold", StorageSize: "20G", MaxStorageSize: "10G"},
+		{Name: "gold", StorageSize: "1G", MinStorageSize: "2Gi"},
+		{Name: "gold", ReplicaImage: "openebs/jiva:0.2", AllowedImages: []string{"openebs/jiva:0.3"}},
+		{Name: "gold", Namespace: "default", AllowedNamespaces: []string{"gold"}},
+	}
+	for _, p := range invalid {
+		if err := validateProfile(p); err == nil {
+			t.Fatalf("expected an error for %#v", p)
+		}
+	}
+
+	valid := []*api.StorageProfile{
+		{Name: "gold"},
+		{Name: "gold", ReplicaCount: 3, MinReplicaCount: 3, StorageSize: "5G", MaxStorageSize: "5G"},
+		{Name: "gold", MinStorageSize: "1Gi", MaxStorageSize: "1Ti"},
+		{Name: "gold", Orchestrator: "kubernetes", AllowedOrchestrators: []string{"kubernetes", "nomad"}},
+	}
+	for _, p := range valid {
+		if err := validateProfile(p); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/openebs/mayaserver/lib/config"
+)
+
+// ReloadFunc readies the settings of a component as per the new config
+// without applying them. The returned commit func applies the settings & is
+// invoked only if every component that is reloaded is ready. Hence a reload
+// either applies the settings of all the components or none.
+//
+// The commit func must not fail. The abort func releases what was readied
+// e.g. the files that were opened & is invoked instead of the commit func if
+// any other component is not ready. The abort func may be nil.
+type ReloadFunc func(old, new *config.MayaConfig) (commit, abort func(), err error)
+
+// ConfigLoader reads the config afresh e.g. from the config files, env vars
+// & CLI options
+type ConfigLoader func() (*config.MayaConfig, error)
+
+// ReloadResult reports the outcome of a config reload
+type ReloadResult struct {
+	// Applied are the keys of the settings that changed & were applied
+	Applied []string `json:"applied"`
+
+	// RestartRequired are the keys of the settings that changed but can be
+	// applied only by restarting maya api server e.g. bind_addr
+	RestartRequired []string `json:"restart_required"`
+}
+
+// reloadable is a component registered for reloads
+type reloadable struct {
+	name   string
+	keys   []string
+	reload ReloadFunc
+}
+
+// reloader applies a new config to the components that registered for
+// reloads. Settings that are not owned by any component need a restart.
+type reloader struct {
+	// l serializes the reloads
+	l sync.Mutex
+
+	loader ConfigLoader
+
+	rl          sync.RWMutex
+	reloadables []reloadable
+}
+
+// liveConfigKeys are the settings that are read from the current config each
+// time they are used. Hence these take effect without any action.
+var liveConfigKeys = []string{
+	"region",
+	"datacenter",
+	"name",
+	"drain_timeout",
+	"leave_on_interrupt",
+	"leave_on_terminate",
+	"http_api_response_headers",
+	"chap_access_token",
+	"admin_token",
+	"ec2_access_key_id",
+	"ec2_secret_access_key",
+	"instance_id",
+	"availability_zone",
+}
+
+// Config returns the current config of maya api server. The returned config
+// must not be modified as it is shared. A reload replaces the config rather
+// than updating it.
+func (ms *MayaApiServer) Config() *config.MayaConfig {
+	ms.configLock.RLock()
+	defer ms.configLock.RUnlock()
+
+	return ms.config
+}
+
+// RegisterReloadable registers a component whose settings of the given keys
+// can be changed without a restart. The keys are the keys of the config
+// file e.g. log_level or ports.http.
+func (ms *MayaApiServer) RegisterReloadable(name string, keys []string, reload ReloadFunc) {
+	ms.reloader.rl.Lock()
+	defer ms.reloader.rl.Unlock()
+
+	ms.reloader.reloadables = append(ms.reloader.reloadables, reloadable{
+		name:   name,
+		keys:   keys,
+		reload: reload,
+	})
+}
+
+// SetConfigLoader sets the loader used by Reload to read the config afresh
+func (ms *MayaApiServer) SetConfigLoader(loader ConfigLoader) {
+	ms.reloader.l.Lock()
+	defer ms.reloader.l.Unlock()
+
+	ms.reloader.loader = loader
+}
+
+// Reload reads the config afresh via the config loader & applies it
+func (ms *MayaApiServer) Reload() (*ReloadResult, error) {
+	ms.reloader.l.Lock()
+	loader := ms.reloader.loader
+	ms.reloader.l.Unlock()
+
+	if loader == nil {
+		return nil, fmt.Errorf("reload is not supported: config loader is not set")
+	}
+
+	newConf, err := loader()
+	if err != nil {
+		return nil, err
+	}
+
+	return ms.ApplyConfig(newConf)
+}
+
+// ApplyConfig applies the new config to the components registered for
+// reloads & then replaces the current config. The settings that need a
+// restart are reported & retain their current values.
+func (ms *MayaApiServer) ApplyConfig(newConf *config.MayaConfig) (*ReloadResult, error) {
+	if err := newConf.Validate(); err != nil {
+		return nil, err
+	}
+
+	ms.reloader.l.Lock()
+	defer ms.reloader.l.Unlock()
+
+	old := ms.Config()
+	changed := config.ChangedKeys(old, newConf)
+
+	ms.reloader.rl.RLock()
+	reloadables := append([]reloadable{}, ms.reloader.reloadables...)
+	ms.reloader.rl.RUnlock()
+
+	owned := map[string]bool{}
+	for _, key := range liveConfigKeys {
+		owned[key] = true
+	}
+
+	// Ready the components whose settings changed
+	var commits, aborts []func()
+	var names []string
+	var mErr multierror.Error
+	for _, r := range reloadables {
+		for _, key := range r.keys {
+			owned[key] = true
+		}
+
+		if !containsAny(changed, r.keys) {
+			continue
+		}
+
+		commit, abort, err := r.reload(old, newConf)
+		if err != nil {
+			mErr.Errors = append(mErr.Errors, fmt.Errorf("%s: %v", r.name, err))
+			continue
+		}
+		commits = append(commits, commit)
+		if abort != nil {
+			aborts = append(aborts, abort)
+		}
+		names = append(names, r.name)
+	}
+
+	if err := mErr.ErrorOrNil(); err != nil {
+		// Release what the components that were ready have readied
+		for _, abort := range aborts {
+			abort()
+		}
+		return nil, err
+	}
+
+	result := &ReloadResult{
+		Applied:         []string{},
+		RestartRequired: []string{},
+	}
+	for _, key := range changed {
+		if owned[key] {
+			result.Applied = append(result.Applied, key)
+		} else {
+			result.RestartRequired = append(result.RestartRequired, key)
+		}
+	}
+
+	// Apply the settings & replace the config. The addresses the server is
+	// bound to & the version info are not changed by a reload.
+	for _, commit := range commits {
+		commit()
+	}
+
+	current := newConf.Retain(old, result.RestartRequired)
+	current.NormalizedAddrs = old.NormalizedAddrs
+	current.Revision = old.Revision
+	current.Version = old.Version
+	current.VersionPrerelease = old.VersionPrerelease
+
+	ms.configLock.Lock()
+	ms.config = current
+	ms.configLock.Unlock()
+
+	if len(names) > 0 {
+		sort.Strings(names)
+		ms.logger.Printf("[INFO] maya api server: reloaded %s", strings.Join(names, ", "))
+	}
+	if len(result.Applied) > 0 {
+		ms.logger.Printf("[INFO] maya api server: applied %s", strings.Join(result.Applied, ", "))
+	}
+	if len(result.RestartRequired) > 0 {
+		ms.logger.Printf("[WARN] maya api server: restart required to apply %s",
+			strings.Join(result.RestartRequired, ", "))
+	}
+
+	return result, nil
+}
+
+// containsAny returns true if any of the keys is in the list
+func containsAny(list []string, keys []string) bool {
+	for _, k := range keys {
+		for _, l := range list {
+			if k == l {
+				return true
+			}
+		}
+	}
+	return false
+}
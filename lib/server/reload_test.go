@@ -0,0 +1,174 @@
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openebs/mayaserver/lib/config"
+)
+
+func TestApplyConfig(t *testing.T) {
+	s := makeHTTPTestServer(t, nil)
+	defer s.Cleanup()
+
+	dir := tmpDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.log")
+
+	var reloaded []string
+	s.Maya.RegisterReloadable("fake", []string{"enable_syslog"}, func(old, new *config.MayaConfig) (func(), func(), error) {
+		return func() { reloaded = append(reloaded, "fake") }, nil, nil
+	})
+
+	old := s.Maya.Config()
+	newConf := old.Copy()
+	newConf.Region = "BANG-EAST"
+	newConf.AccessLogFile = path
+	newConf.HTTPAPIResponseHeaders = map[string]string{"foo": "bar"}
+	newConf.Ports.HTTP = old.Ports.HTTP + 1
+
+	result, err := s.Maya.ApplyConfig(newConf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	expected := &ReloadResult{
+		Applied:         []string{"access_log_file", "http_api_response_headers", "region"},
+		RestartRequired: []string{"ports.http"},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("expected: %#v, got: %#v", expected, result)
+	}
+
+	// Components whose settings did not change are not reloaded
+	if len(reloaded) != 0 {
+		t.Fatalf("expected no reload of unchanged settings, got: %v", reloaded)
+	}
+
+	current := s.Maya.Config()
+	if current.Region != "BANG-EAST" || current.Ports.HTTP != old.Ports.HTTP {
+		t.Fatalf("expected new region & old port, got: %s %d", current.Region, current.Ports.HTTP)
+	}
+
+	// The new settings are in effect for the next request
+	req, _ := http.NewRequest("GET", fmt.Sprintf("http://%s/latest/meta-data/instance-id", s.Server.addr), nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.Header.Get("foo") != "bar" {
+		t.Fatalf("expected reloaded response headers, got: %v", resp.Header)
+	}
+
+	out, err := ioutil.ReadFile(path)
+	if err != nil || !strings.Contains(string(out), "/latest/meta-data/instance-id") {
+		t.Fatalf("expected request in the reloaded access log, got: %s %v", out, err)
+	}
+}
+
+func TestApplyConfigIsAtomic(t *testing.T) {
+	s := makeHTTPTestServer(t, nil)
+	defer s.Cleanup()
+
+	committed, aborted := false, false
+	s.Maya.RegisterReloadable("ok", []string{"enable_syslog"}, func(old, new *config.MayaConfig) (func(), func(), error) {
+		return func() { committed = true }, func() { aborted = true }, nil
+	})
+	s.Maya.RegisterReloadable("broken", []string{"syslog_facility"}, func(old, new *config.MayaConfig) (func(), func(), error) {
+		return nil, nil, fmt.Errorf("broken")
+	})
+
+	old := s.Maya.Config()
+	newConf := old.Copy()
+	newConf.EnableSyslog = true
+	newConf.SyslogFacility = "LOCAL5"
+	newConf.Region = "BANG-EAST"
+
+	if _, err := s.Maya.ApplyConfig(newConf); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Fatalf("expected error of the broken component, got: %v", err)
+	}
+
+	if committed || s.Maya.Config() != old {
+		t.Fatalf("expected no settings to be applied")
+	}
+
+	// What was readied is released
+	if !aborted {
+		t.Fatalf("expected the ready component to be aborted")
+	}
+
+	// An invalid config is rejected before any component is reloaded
+	newConf = old.Copy()
+	newConf.LogLevel = "CHATTY"
+	if _, err := s.Maya.ApplyConfig(newConf); err == nil {
+		t.Fatalf("expected invalid config to be rejected")
+	}
+}
+
+func TestAgentReload(t *testing.T) {
+	s := makeHTTPTestServer(t, func(mc *config.MayaConfig) {
+		mc.AdminToken = testAdminToken
+	})
+	defer s.Cleanup()
+
+	reload := func(method string) (*httptest.ResponseRecorder, interface{}, error) {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/v1/agent/reload", nil)
+		obj, err := s.Server.AgentSpecificRequest(resp, asAdmin(req))
+		return resp, obj, err
+	}
+
+	// Only the admin may reload
+	req, _ := http.NewRequest("PUT", "/v1/agent/reload", nil)
+	if _, err := s.Server.AgentSpecificRequest(httptest.NewRecorder(), req); err == nil {
+		t.Fatalf("expected error without the admin token")
+	} else if cErr, ok := err.(HTTPCodedError); !ok || cErr.Code() != 403 {
+		t.Fatalf("expected 403, got: %v", err)
+	}
+
+	// Reload is not possible without a config loader
+	if _, _, err := reload("PUT"); err == nil {
+		t.Fatalf("expected error without a config loader")
+	}
+
+	var loadErr error
+	s.Maya.SetConfigLoader(func() (*config.MayaConfig, error) {
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		newConf := s.Maya.Config().Copy()
+		newConf.Datacenter = "dc9"
+		return newConf, nil
+	})
+
+	_, obj, err := reload("PUT")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	result := obj.(*ReloadResult)
+	if !reflect.DeepEqual(result.Applied, []string{"datacenter"}) || s.Maya.Config().Datacenter != "dc9" {
+		t.Fatalf("expected datacenter to be reloaded, got: %#v", result)
+	}
+
+	if _, _, err := reload("GET"); err == nil {
+		t.Fatalf("expected error for GET")
+	} else if cErr, ok := err.(HTTPCodedError); !ok || cErr.Code() != 405 {
+		t.Fatalf("expected 405, got: %v", err)
+	}
+
+	loadErr = config.ValidationErrors{{Key: "log_level", Msg: "invalid log level"}}
+	if _, _, err := reload("POST"); err == nil {
+		t.Fatalf("expected error for invalid config")
+	} else if cErr, ok := err.(HTTPCodedError); !ok || cErr.Code() != 400 {
+		t.Fatalf("expected 400, got: %v", err)
+	}
+}
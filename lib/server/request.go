@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/openebs/maya/types/v1"
+	"github.com/openebs/mayaserver/lib/loghelper"
+	"github.com/pborman/uuid"
+)
+
+const (
+	// RequestIDHeader is the HTTP header that carries the id of a request. The
+	// id sent by a client is reused, else a new one is generated. The id is
+	// sent back in the response.
+	RequestIDHeader = "X-Request-ID"
+
+	// RequestIDLbl is the label that passes the request id along with the
+	// claim to the volume provisioner & orchestrator
+	RequestIDLbl = "mapi.openebs.io/request-id"
+
+	// maxRequestIDLen is the max length of a request id sent by a client
+	maxRequestIDLen = 128
+)
+
+// requestIDKey is the context key against which the request id is stored
+type requestIDKey struct{}
+
+// withRequestID assigns an id to the request. The request id is set in the
+// response header as well as in the context of the returned request. A
+// request that already has an id is returned as is.
+func withRequestID(resp http.ResponseWriter, req *http.Request) (*http.Request, string) {
+	if id, ok := req.Context().Value(requestIDKey{}).(string); ok {
+		return req, id
+	}
+
+	id := req.Header.Get(RequestIDHeader)
+	if !isValidRequestID(id) {
+		id = uuid.New()
+	}
+
+	resp.Header().Set(RequestIDHeader, id)
+
+	return req.WithContext(context.WithValue(req.Context(), requestIDKey{}, id)), id
+}
+
+// requestIDOf returns the id assigned to the request
+func requestIDOf(req *http.Request) string {
+	return contextRequestID(req.Context())
+}
+
+// contextRequestID returns the id of the request the context belongs to
+func contextRequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// isValidRequestID verifies if the request id sent by a client can be
+// reused. It should be printable ASCII without spaces so that it does not
+// garble the logs.
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// requestLogger returns the logger scoped to the request. Every log line
+// carries the request id as the request_id field.
+func (s *HTTPServer) requestLogger(req *http.Request) *loghelper.Logger {
+	return s.maya.contextLogger(req.Context())
+}
+
+// contextLogger returns the logger scoped to the request the context belongs
+// to if any
+func (ms *MayaApiServer) contextLogger(ctx context.Context) *loghelper.Logger {
+	id := contextRequestID(ctx)
+	if id == "" {
+		return ms.log
+	}
+
+	return ms.log.With("request_id", id)
+}
+
+// labelRequestID sets the request id as a label of the claim. This lets the
+// volume provisioner & orchestrator correlate their operations with the
+// request.
+func labelRequestID(req *http.Request, pvc *v1.PersistentVolumeClaim) {
+	labelContextRequestID(req.Context(), pvc)
+}
+
+// labelContextRequestID is labelRequestID for the request the context
+// belongs to if any
+func labelContextRequestID(ctx context.Context, pvc *v1.PersistentVolumeClaim) {
+	id := contextRequestID(ctx)
+	if id == "" {
+		return
+	}
+
+	if pvc.Labels == nil {
+		pvc.Labels = map[string]string{}
+	}
+	pvc.Labels[RequestIDLbl] = id
+}
+
+// bearerAuthorized verifies if the bearer token of the request is the given
+// token. No request is authorized if the token is not set.
+func bearerAuthorized(req *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	bearer := strings.TrimPrefix(auth, "Bearer ")
+
+	return subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1
+}
@@ -0,0 +1,653 @@
+package server
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/openebs/maya/types/v1"
+	"github.com/openebs/mayaserver/lib/api"
+	"github.com/openebs/mayaserver/lib/audit"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// route is an entry of maya api server's route registry. Every route is
+// mounted on the mux by registerHandlers, while the OpenAPI document is
+// generated from the operations documented against the routes.
+type route struct {
+	// pattern is the mux pattern of this route
+	pattern string
+
+	// handler is curried via wrap along with the counter & duration metrics
+	// of this route
+	handler  func(resp http.ResponseWriter, req *http.Request) (interface{}, error)
+	counter  *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+
+	// rawHandler is mounted as is i.e. without being curried via wrap
+	rawHandler http.Handler
+
+	// debug flags if this route is mounted only if enable_debug is set
+	debug bool
+
+	// ops documents the operations served by this route
+	ops []routeOp
+}
+
+// routeOp documents a single operation of a route
+type routeOp struct {
+	// id uniquely identifies this operation
+	id string
+
+	// method is the HTTP method of this operation
+	method string
+
+	// path is the OpenAPI path of this operation. Path parameters are
+	// enclosed in braces e.g. /latest/volumes/info/{name}
+	path string
+
+	summary string
+
+	// request is a sample of the request body. It is nil if the operation
+	// does not expect a body.
+	request interface{}
+
+	// response is a sample of the response body
+	response interface{}
+
+	// codes are the HTTP codes other than 200 that are sent along with the
+	// response body
+	codes []int
+
+	// produces is the media type of the response. It defaults to JSON.
+	produces string
+}
+
+// routes returns the route registry of maya api server
+func (s *HTTPServer) routes() []route {
+	return []route{
+		{
+			pattern:  "/latest/meta-data/",
+			handler:  s.MetaSpecificRequest,
+			counter:  s.maya.metrics.metaDataRequestCounter,
+			duration: s.maya.metrics.metaDataRequestDuration,
+			ops: []routeOp{
+				{
+					id:       "listMetaData",
+					method:   "GET",
+					path:     "/latest/meta-data/",
+					summary:  "List the entries of the meta data tree. The entries that are directories end with a slash. An unknown entry is not found",
+					response: "",
+					codes:    []int{401, 404},
+					produces: "text/plain",
+				},
+				{
+					id:       "readInstanceID",
+					method:   "GET",
+					path:     "/latest/meta-data/instance-id",
+					summary:  "Read the instance id of the calling node. It is instance_id for the node on the host of maya api server & is derived from the address of any other node",
+					response: "",
+					codes:    []int{401},
+					produces: "text/plain",
+				},
+				{
+					id:       "readHostname",
+					method:   "GET",
+					path:     "/latest/meta-data/hostname",
+					summary:  "Read the host name of the calling node i.e. the node name on the host of maya api server & the address of any other node",
+					response: "",
+					codes:    []int{401},
+					produces: "text/plain",
+				},
+				{
+					id:       "readLocalHostname",
+					method:   "GET",
+					path:     "/latest/meta-data/local-hostname",
+					summary:  "Read the local host name of the calling node i.e. the node name on the host of maya api server & the address of any other node",
+					response: "",
+					codes:    []int{401},
+					produces: "text/plain",
+				},
+				{
+					id:       "readLocalIPv4",
+					method:   "GET",
+					path:     "/latest/meta-data/local-ipv4",
+					summary:  "Read the IPv4 address of the calling node i.e. the address advertised by maya api server on its host",
+					response: "",
+					codes:    []int{401},
+					produces: "text/plain",
+				},
+				{
+					id:       "listPlacement",
+					method:   "GET",
+					path:     "/latest/meta-data/placement/",
+					summary:  "List the placement entries of this compute instance",
+					response: "",
+					codes:    []int{401},
+					produces: "text/plain",
+				},
+				{
+					id:       "readAvailabilityZone",
+					method:   "GET",
+					path:     "/latest/meta-data/placement/availability-zone",
+					summary:  "Read the availability zone of this compute instance i.e. availability_zone",
+					response: "",
+					codes:    []int{401},
+					produces: "text/plain",
+				},
+				{
+					id:       "readRegion",
+					method:   "GET",
+					path:     "/latest/meta-data/placement/region",
+					summary:  "Read the region of this compute instance i.e. the region of maya api server",
+					response: "",
+					codes:    []int{401},
+					produces: "text/plain",
+				},
+				{
+					id:       "listBlockDeviceMapping",
+					method:   "GET",
+					path:     "/latest/meta-data/block-device-mapping/",
+					summary:  "List the block device mapping of the calling node. The ebsN entries are the devices of the volumes attached to its instance id",
+					response: "",
+					codes:    []int{401},
+					produces: "text/plain",
+				},
+				{
+					id:       "readBlockDevice",
+					method:   "GET",
+					path:     "/latest/meta-data/block-device-mapping/{device}",
+					summary:  "Read the device name of the ami, the root device or a volume attached to the calling node i.e. ebsN",
+					response: "",
+					codes:    []int{401, 404},
+					produces: "text/plain",
+				},
+			},
+		},
+		{
+			// IMDSv2 session tokens of the meta data service are issued here
+			pattern:  "/latest/api/token",
+			handler:  s.MetaDataTokenRequest,
+			counter:  s.maya.metrics.metaDataRequestCounter,
+			duration: s.maya.metrics.metaDataRequestDuration,
+			ops: []routeOp{
+				{
+					id:       "issueMetaDataToken",
+					method:   "PUT",
+					path:     "/latest/api/token",
+					summary:  "Issue a session token of the meta data service for the ttl set in X-aws-ec2-metadata-token-ttl-seconds",
+					response: "",
+					codes:    []int{400},
+					produces: "text/plain",
+				},
+			},
+		},
+		{
+			// Request w.r.t to a single VSM entity is handled here
+			pattern:  "/latest/volumes/",
+			handler:  s.VSMSpecificRequest,
+			counter:  s.maya.metrics.volumeRequestCounter,
+			duration: s.maya.metrics.volumeRequestDuration,
+			ops: []routeOp{
+				{
+					id:       "addVolume",
+					method:   "POST",
+					path:     "/latest/volumes/",
+					summary:  "Create a volume from the claim in JSON or YAML",
+					request:  v1.PersistentVolumeClaim{},
+					response: v1.PersistentVolume{},
+				},
+				{
+					id:       "putVolume",
+					method:   "PUT",
+					path:     "/latest/volumes/",
+					summary:  "Create a volume from the claim in JSON or YAML",
+					request:  v1.PersistentVolumeClaim{},
+					response: v1.PersistentVolume{},
+				},
+				{
+					id:       "listVolumes",
+					method:   "GET",
+					path:     "/latest/volumes/",
+					summary:  "List the volumes",
+					response: v1.PersistentVolumeList{},
+				},
+				{
+					id:       "readVolume",
+					method:   "GET",
+					path:     "/latest/volumes/info/{name}",
+					summary:  "Read the details of a volume",
+					response: v1.PersistentVolume{},
+				},
+				{
+					id:       "deleteVolume",
+					method:   "GET",
+					path:     "/latest/volumes/delete/{name}",
+					summary:  "Delete a volume",
+					response: "",
+				},
+			},
+		},
+		{
+			// The attachments & the target of a single volume are handled
+			// here
+			pattern:  "/v1/volumes/",
+			handler:  s.VolumeRequest,
+			counter:  s.maya.metrics.volumeRequestCounter,
+			duration: s.maya.metrics.volumeRequestDuration,
+			ops: []routeOp{
+				{
+					id:       "attachVolume",
+					method:   "POST",
+					path:     "/v1/volumes/{name}/attach",
+					summary:  "Attach a volume to a node. A volume is attached read-write to a single node, or read-only to any number of nodes. The response carries the detach token of the attachment",
+					request:  api.AttachRequest{},
+					response: api.VolumeAttachments{},
+					codes:    []int{400, 403, 404, 409},
+				},
+				{
+					id:       "detachVolume",
+					method:   "POST",
+					path:     "/v1/volumes/{name}/detach",
+					summary:  "Detach a volume from a node. A normal detach needs the detach token of the attachment. A forced detach needs the admin token & bars the node from attaching the volume again till an admin lifts the fence via unfence. The node is not cut off the target",
+					request:  api.DetachRequest{},
+					response: api.VolumeAttachments{},
+					codes:    []int{400, 403},
+				},
+				{
+					id:       "readVolumeAttachments",
+					method:   "GET",
+					path:     "/v1/volumes/{name}/attachments",
+					summary:  "Read the attachments & the fenced nodes of a volume",
+					response: api.VolumeAttachments{},
+				},
+				{
+					id:       "readVolumeTarget",
+					method:   "GET",
+					path:     "/v1/volumes/{name}/target",
+					summary:  "Read the portals, IQN, LUN & CHAP requirement of the iSCSI target of a volume. The iscsiadm parameters are returned if iscsiadm is set. The CHAP credentials are returned if the bearer token is the CHAP access token. These are not enforced by the target",
+					response: api.VolumeTarget{},
+					codes:    []int{400, 404, 503},
+				},
+				{
+					id:       "rotateVolumeCHAP",
+					method:   "POST",
+					path:     "/v1/volumes/{name}/chap/rotate",
+					summary:  "Replace the CHAP credentials of a volume with new ones. The bearer token must be the CHAP access token",
+					response: api.VolumeTarget{},
+					codes:    []int{400, 403, 404, 503},
+				},
+			},
+		},
+		{
+			// The storage profiles i.e. the classes of volumes are handled
+			// here
+			pattern:  "/v1/profiles/",
+			handler:  s.ProfileRequest,
+			counter:  s.maya.metrics.profileRequestCounter,
+			duration: s.maya.metrics.profileRequestDuration,
+			ops: []routeOp{
+				{
+					id:       "listProfiles",
+					method:   "GET",
+					path:     "/v1/profiles/",
+					summary:  "List the storage profiles",
+					response: []api.StorageProfile{},
+				},
+				{
+					id:       "readProfile",
+					method:   "GET",
+					path:     "/v1/profiles/{name}",
+					summary:  "Read a storage profile",
+					response: api.StorageProfile{},
+					codes:    []int{404},
+				},
+				{
+					id:       "putProfile",
+					method:   "PUT",
+					path:     "/v1/profiles/{name}",
+					summary:  "Create or replace a storage profile. A claim refers to a profile via its profile-name label & inherits the settings it does not set. Its overrides must be within the limits & the allow-lists of the profile. Needs the admin token",
+					request:  api.StorageProfile{},
+					response: api.StorageProfile{},
+					codes:    []int{400, 403},
+				},
+				{
+					id:       "deleteProfile",
+					method:   "DELETE",
+					path:     "/v1/profiles/{name}",
+					summary:  "Delete a storage profile. The volumes created from the profile are not affected. Needs the admin token",
+					response: "",
+					codes:    []int{403, 404},
+				},
+			},
+		},
+		{
+			// Liveness & readiness probes are handled here
+			pattern:  "/v1/health/",
+			handler:  s.HealthSpecificRequest,
+			counter:  s.maya.metrics.healthRequestCounter,
+			duration: s.maya.metrics.healthRequestDuration,
+			ops: []routeOp{
+				{
+					id:       "readLiveness",
+					method:   "GET",
+					path:     "/v1/health/live",
+					summary:  "Check if maya api server is up",
+					response: HealthReport{},
+				},
+				{
+					id:       "readReadiness",
+					method:   "GET",
+					path:     "/v1/health/ready",
+					summary:  "Check if the dependencies of maya api server are healthy",
+					response: HealthReport{},
+					codes:    []int{503},
+				},
+			},
+		},
+		{
+			pattern:  "/v1/openapi.json",
+			handler:  s.OpenAPIRequest,
+			counter:  s.maya.metrics.openAPIRequestCounter,
+			duration: s.maya.metrics.openAPIRequestDuration,
+			ops: []routeOp{
+				{
+					id:       "readOpenAPI",
+					method:   "GET",
+					path:     "/v1/openapi.json",
+					summary:  "Read the OpenAPI document of maya api server",
+					response: map[string]interface{}{},
+				},
+			},
+		},
+		{
+			// Administration of maya api server is handled here
+			pattern:  "/v1/agent/",
+			handler:  s.AgentSpecificRequest,
+			counter:  s.maya.metrics.agentRequestCounter,
+			duration: s.maya.metrics.agentRequestDuration,
+			ops: []routeOp{
+				{
+					id:       "reloadConfig",
+					method:   "PUT",
+					path:     "/v1/agent/reload",
+					summary:  "Reload the config & apply the settings that do not need a restart. Served to the admin token",
+					response: ReloadResult{},
+					codes:    []int{400, 403},
+				},
+				{
+					id:       "monitorLogs",
+					method:   "GET",
+					path:     "/v1/agent/monitor",
+					summary:  "Stream the logs of the given log_level & above, starting with the recent logs. Served to the admin token",
+					response: "",
+					codes:    []int{400, 403},
+					produces: "text/plain",
+				},
+				{
+					id:       "readLogLevels",
+					method:   "GET",
+					path:     "/v1/agent/log-level",
+					summary:  "Read the default log level & the log levels of the components",
+					response: LogLevels{},
+				},
+				{
+					id:       "setLogLevel",
+					method:   "PUT",
+					path:     "/v1/agent/log-level",
+					summary:  "Change the log level of a component or the default log level till the next reload. Served to the admin token",
+					request:  LogLevelRequest{},
+					response: LogLevels{},
+					codes:    []int{400, 403},
+				},
+				{
+					id:       "readAgentSelf",
+					method:   "GET",
+					path:     "/v1/agent/self",
+					summary:  "Read the effective config, build, uptime, plugins & listeners of maya api server. Served to the admin token if enable_debug is set",
+					response: AgentSelf{},
+					codes:    []int{403, 501},
+				},
+				{
+					id:       "readDebugConfig",
+					method:   "GET",
+					path:     "/v1/agent/debug/config",
+					summary:  "Read the effective config with its secrets redacted. Served to the admin token if enable_debug is set",
+					response: map[string]interface{}{},
+					codes:    []int{403, 501},
+				},
+				{
+					id:       "readDebugVersion",
+					method:   "GET",
+					path:     "/v1/agent/debug/version",
+					summary:  "Read the version & the build of maya api server. Served to the admin token if enable_debug is set",
+					response: BuildInfo{},
+					codes:    []int{403, 501},
+				},
+				{
+					id:       "readDebugLogs",
+					method:   "GET",
+					path:     "/v1/agent/debug/logs",
+					summary:  "Read the recent logs. Served to the admin token if enable_debug is set",
+					response: []string{},
+					codes:    []int{403, 501},
+				},
+				{
+					id:       "readDebugVolumes",
+					method:   "GET",
+					path:     "/v1/agent/debug/volumes",
+					summary:  "Read the volumes along with their statuses. Served to the admin token if enable_debug is set",
+					response: VolumeInventory{},
+					codes:    []int{403, 501},
+				},
+				{
+					id:       "readDebugPlugins",
+					method:   "GET",
+					path:     "/v1/agent/debug/plugins",
+					summary:  "Read the registered provisioners & orchestrators. Served to the admin token if enable_debug is set",
+					response: PluginRegistry{},
+					codes:    []int{403, 501},
+				},
+				{
+					id:       "readDebugChecks",
+					method:   "GET",
+					path:     "/v1/agent/debug/checks",
+					summary:  "Run the health checks of the orchestrators & the state. Served to the admin token if enable_debug is set",
+					response: HealthReport{},
+					codes:    []int{403, 501},
+				},
+			},
+		},
+		{
+			// The audit trail of the operations that changed the state of
+			// maya api server is queried here
+			pattern:  "/v1/audit",
+			handler:  s.AuditRequest,
+			counter:  s.maya.metrics.auditRequestCounter,
+			duration: s.maya.metrics.auditRequestDuration,
+			ops: []routeOp{
+				{
+					id:       "queryAudit",
+					method:   "GET",
+					path:     "/v1/audit",
+					summary:  "Query the audit records by the since, until, volume, operation & limit parameters. Served to the admin token",
+					response: []audit.Record{},
+					codes:    []int{400, 403},
+				},
+			},
+		},
+		{
+			// The volume actions of the EC2 query API are handled here
+			pattern:  "/ec2/",
+			handler:  s.EC2Request,
+			counter:  s.maya.metrics.ec2RequestCounter,
+			duration: s.maya.metrics.ec2RequestDuration,
+			ops: []routeOp{
+				{
+					id:       "ec2QueryAction",
+					method:   "POST",
+					path:     "/ec2/",
+					summary:  "Run the EC2 action i.e. CreateVolume, DescribeVolumes, DeleteVolume, AttachVolume or DetachVolume set in the form encoded Action parameter. The snapshot actions are unsupported. The requests signed via SigV4 by the EC2 access keys of the admin scope are authorized as the admin",
+					response: "",
+					codes:    []int{400, 401, 403, 500, 503},
+					produces: "text/xml",
+				},
+				{
+					id:       "ec2QueryActionViaGet",
+					method:   "GET",
+					path:     "/ec2/",
+					summary:  "Run the EC2 action set in the Action query parameter",
+					response: "",
+					codes:    []int{400, 401, 403, 500, 503},
+					produces: "text/xml",
+				},
+			},
+		},
+		{
+			// request for metrics is handled here. It displays metrics related to
+			// garbage collection, process, cpu...etc, and the custom metrics created.
+			pattern:    "/metrics",
+			rawHandler: promhttp.HandlerFor(s.maya.metrics.registry, promhttp.HandlerOpts{}),
+			ops: []routeOp{
+				{
+					id:       "readMetrics",
+					method:   "GET",
+					path:     "/metrics",
+					summary:  "Read the metrics in Prometheus exposition format",
+					response: "",
+					produces: "text/plain",
+				},
+			},
+		},
+		{
+			// The runtime profiles are served here in pprof format
+			pattern:    "/debug/pprof/",
+			rawHandler: http.HandlerFunc(pprof.Index),
+			debug:      true,
+			ops: []routeOp{
+				{
+					id:       "readRuntimeProfile",
+					method:   "GET",
+					path:     "/debug/pprof/{profile}",
+					summary:  "Read the heap, goroutine, allocs or threadcreate profile in pprof format. Served to the admin token if enable_debug is set",
+					response: "",
+					codes:    []int{403, 404},
+					produces: "application/octet-stream",
+				},
+			},
+		},
+		{
+			pattern:    "/debug/pprof/block",
+			rawHandler: contentionProfile("block"),
+			debug:      true,
+			ops: []routeOp{
+				{
+					id:       "readBlockProfile",
+					method:   "GET",
+					path:     "/debug/pprof/block",
+					summary:  "Sample the blocking events for the given seconds & read them in pprof format. Served to the admin token if enable_debug is set",
+					response: "",
+					codes:    []int{403},
+					produces: "application/octet-stream",
+				},
+			},
+		},
+		{
+			pattern:    "/debug/pprof/mutex",
+			rawHandler: contentionProfile("mutex"),
+			debug:      true,
+			ops: []routeOp{
+				{
+					id:       "readMutexProfile",
+					method:   "GET",
+					path:     "/debug/pprof/mutex",
+					summary:  "Sample the mutex contentions for the given seconds & read them in pprof format. Served to the admin token if enable_debug is set",
+					response: "",
+					codes:    []int{403},
+					produces: "application/octet-stream",
+				},
+			},
+		},
+		{
+			pattern:    "/debug/pprof/profile",
+			rawHandler: http.HandlerFunc(pprof.Profile),
+			debug:      true,
+			ops: []routeOp{
+				{
+					id:       "readCPUProfile",
+					method:   "GET",
+					path:     "/debug/pprof/profile",
+					summary:  "Profile the CPU for the given seconds in pprof format. Served to the admin token if enable_debug is set",
+					response: "",
+					codes:    []int{403},
+					produces: "application/octet-stream",
+				},
+			},
+		},
+		{
+			pattern:    "/debug/pprof/trace",
+			rawHandler: http.HandlerFunc(pprof.Trace),
+			debug:      true,
+			ops: []routeOp{
+				{
+					id:       "readExecutionTrace",
+					method:   "GET",
+					path:     "/debug/pprof/trace",
+					summary:  "Trace the execution for the given seconds. Served to the admin token if enable_debug is set",
+					response: "",
+					codes:    []int{403},
+					produces: "application/octet-stream",
+				},
+			},
+		},
+		{
+			pattern:    "/debug/pprof/cmdline",
+			rawHandler: http.HandlerFunc(pprof.Cmdline),
+			debug:      true,
+			ops: []routeOp{
+				{
+					id:       "readCmdline",
+					method:   "GET",
+					path:     "/debug/pprof/cmdline",
+					summary:  "Read the command line of maya api server. Served to the admin token if enable_debug is set",
+					response: "",
+					codes:    []int{403},
+					produces: "text/plain",
+				},
+			},
+		},
+		{
+			pattern:    "/debug/pprof/symbol",
+			rawHandler: http.HandlerFunc(pprof.Symbol),
+			debug:      true,
+			ops: []routeOp{
+				{
+					id:       "lookupSymbols",
+					method:   "GET",
+					path:     "/debug/pprof/symbol",
+					summary:  "Look up the symbols of the program counters. Served to the admin token if enable_debug is set",
+					response: "",
+					codes:    []int{403},
+					produces: "text/plain",
+				},
+			},
+		},
+		{
+			// The runtime stats & the other expvars are served here
+			pattern:    "/debug/vars",
+			rawHandler: expvar.Handler(),
+			debug:      true,
+			ops: []routeOp{
+				{
+					id:       "readExpvars",
+					method:   "GET",
+					path:     "/debug/vars",
+					summary:  "Read the runtime stats, memstats & cmdline as expvars. Served to the admin token if enable_debug is set",
+					response: map[string]interface{}{},
+					codes:    []int{403},
+				},
+			},
+		},
+	}
+}
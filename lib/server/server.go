@@ -1,9 +1,14 @@
 package server
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"log"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/openebs/maya/orchprovider"
 	"github.com/openebs/maya/orchprovider/k8s/v1"
@@ -11,19 +16,77 @@ import (
 	"github.com/openebs/maya/types/v1"
 	"github.com/openebs/maya/volumes/provisioner"
 	"github.com/openebs/maya/volumes/provisioner/jiva"
+	"github.com/openebs/mayaserver/lib/audit"
 	"github.com/openebs/mayaserver/lib/config"
+	"github.com/openebs/mayaserver/lib/loghelper"
+	"github.com/openebs/mayaserver/lib/state"
+	"github.com/openebs/mayaserver/lib/tracing"
 )
 
 // MayaApiServer is a long running stateless daemon that runs
 // at openebs maya master(s)
 type MayaApiServer struct {
-	config    *config.MayaConfig
+	// config is the current config. It is replaced on reload & hence is
+	// accessed via Config.
+	configLock sync.RWMutex
+	config     *config.MayaConfig
+
+	// reloader applies a new config to the reloadable components
+	reloader *reloader
+
 	logger    *log.Logger
 	logOutput io.Writer
 
+	// log logs along with fields e.g. the volume. It logs as JSON if the
+	// log output is a loghelper.JSONWriter.
+	log *loghelper.Logger
+
+	// logRegistrar buffers the recent log lines & streams the new ones to
+	// the log monitors
+	logRegistrar *loghelper.LogRegistrar
+
+	// logLevels filters the logs as per the level of their component
+	logLevels *loghelper.ComponentFilter
+
+	// audit is the audit trail of the operations that change the state of
+	// maya api server. It is nil if auditing is disabled.
+	audit *audit.Log
+
+	// state persists the state of this server e.g. the attachments of the
+	// volumes. It is kept in memory only if there is no data directory.
+	state *state.Store
+
+	// cipher seals the secrets that are kept in the state
+	cipher *state.Cipher
+
+	// stateLock serializes the changes to the state of the volumes e.g. their
+	// attachments & CHAP credentials
+	stateLock sync.Mutex
+
+	// volumeIndex, profileIndex & auditIndex are waited on by the blocking
+	// queries of the volumes, the storage profiles & the audit log
+	volumeIndex  *watchIndex
+	profileIndex *watchIndex
+	auditIndex   *watchIndex
+
 	shutdown     bool
 	shutdownCh   chan struct{}
 	shutdownLock sync.Mutex
+
+	// work tracks the operations in flight against this server
+	work *workTracker
+
+	// health runs the health checks of this server's dependencies
+	health *healthChecker
+
+	// tracer traces the requests served by this server
+	tracer *tracing.Tracer
+
+	// metrics are the Prometheus metrics of this server
+	metrics *serverMetrics
+
+	// startTime is when this server was created
+	startTime time.Time
 }
 
 // NewMayaApiServer is used to create a new maya api server
@@ -33,14 +96,57 @@ func NewMayaApiServer(config *config.MayaConfig, logOutput io.Writer) (*MayaApiS
 	ms := &MayaApiServer{
 		config:     config,
 		logger:     log.New(logOutput, "", log.LstdFlags|log.Lmicroseconds),
+		log:        loghelper.NewLogger(logOutput),
 		logOutput:  logOutput,
 		shutdownCh: make(chan struct{}),
+		work:       newWorkTracker(),
+		health:     newHealthChecker(defaultHealthCheckTTL),
+		metrics:    newServerMetrics(),
+		reloader:   &reloader{},
+		startTime:  time.Now(),
+	}
+
+	// A graceful exit waits for the health checks that run in the background
+	ms.health.track = ms.trackWork
+
+	// Collect the per-volume metrics along with the other metrics
+	ms.metrics.registry.MustRegister(newVolumeCollector(ms))
+
+	tracer, err := newTracer(config, logOutput)
+	if err != nil {
+		return nil, err
+	}
+	ms.tracer = tracer
+	ms.RegisterReloadable("tracer", []string{"trace_collector_addr"}, ms.reloadTracer)
+
+	auditLog, err := openAuditLog(config, ms.log)
+	if err != nil {
+		return nil, err
+	}
+	ms.audit = auditLog
+
+	store, err := openState(config)
+	if err != nil {
+		return nil, err
 	}
+	ms.state = store
 
-	err := ms.BootstrapPlugins()
+	cipher, err := loadStateCipher(config, ms.log)
 	if err != nil {
 		return nil, err
 	}
+	ms.cipher = cipher
+
+	ms.volumeIndex = newWatchIndex()
+	ms.profileIndex = newWatchIndex()
+	ms.auditIndex = newWatchIndex()
+
+	err = ms.BootstrapPlugins()
+	if err != nil {
+		return nil, err
+	}
+
+	ms.registerHealthChecks()
 
 	return ms, nil
 }
@@ -121,6 +227,17 @@ func (ms *MayaApiServer) Shutdown() error {
 		return nil
 	}
 
+	// Export the spans that are yet to be exported
+	if err := ms.tracer.Shutdown(); err != nil {
+		ms.logger.Printf("[WARN] maya api server: failed to export pending spans: %v", err)
+	}
+
+	if ms.audit != nil {
+		if err := ms.audit.Close(); err != nil {
+			ms.logger.Printf("[WARN] maya api server: failed to close the audit log: %v", err)
+		}
+	}
+
 	ms.logger.Println("[INFO] maya api server: shutdown complete")
 	ms.shutdown = true
 
@@ -129,11 +246,122 @@ func (ms *MayaApiServer) Shutdown() error {
 	return nil
 }
 
-// Leave is used gracefully exit.
+// Leave is used gracefully exit. It waits for the operations in flight to
+// complete within the configured drain timeout.
 func (ms *MayaApiServer) Leave() error {
 
+	ctx, cancel := context.WithTimeout(context.Background(), ms.Config().DrainTimeout)
+	defer cancel()
+
+	return ms.LeaveContext(ctx)
+}
+
+// LeaveContext is Leave bound by the context instead of the drain timeout
+func (ms *MayaApiServer) LeaveContext(ctx context.Context) error {
+
 	ms.logger.Println("[INFO] maya api server: exiting gracefully")
 
-	// Nothing as of now
+	if !ms.work.wait(ctx) {
+		pending := ms.work.inFlight()
+		ms.logger.Printf("[WARN] maya api server: %d operation(s) still in flight at the deadline: %s",
+			len(pending), strings.Join(pending, ", "))
+
+		return fmt.Errorf("timed out waiting for %d operation(s) to complete", len(pending))
+	}
+
+	ms.logger.Println("[INFO] maya api server: all operations completed")
+
 	return nil
 }
+
+// trackWork registers an operation that is in flight against maya api
+// server. The returned func must be invoked once the operation completes.
+// It returns false if a graceful exit is underway & the operation must not
+// be started.
+func (ms *MayaApiServer) trackWork(desc string) (func(), bool) {
+	return ms.work.begin(desc)
+}
+
+// workTracker keeps account of the operations in flight. It lets a graceful
+// exit wait for these operations & report the ones that did not complete.
+// No operation is registered once the wait for these is underway.
+type workTracker struct {
+	sync.Mutex
+	nextID   uint64
+	pending  map[uint64]string
+	draining bool
+
+	// drainedCh is closed once draining is underway & no operation is
+	// pending
+	drainedCh chan struct{}
+}
+
+func newWorkTracker() *workTracker {
+	return &workTracker{
+		pending:   make(map[uint64]string),
+		drainedCh: make(chan struct{}),
+	}
+}
+
+// begin registers an operation & returns the func that marks it as done. It
+// returns false if draining is underway.
+func (w *workTracker) begin(desc string) (func(), bool) {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.draining {
+		return nil, false
+	}
+
+	w.nextID++
+	id := w.nextID
+	w.pending[id] = desc
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			w.Lock()
+			defer w.Unlock()
+
+			delete(w.pending, id)
+			if w.draining && len(w.pending) == 0 {
+				close(w.drainedCh)
+			}
+		})
+	}, true
+}
+
+// inFlight returns the sorted descriptions of pending operations
+func (w *workTracker) inFlight() []string {
+	w.Lock()
+	defer w.Unlock()
+
+	ops := make([]string, 0, len(w.pending))
+	for _, desc := range w.pending {
+		ops = append(ops, desc)
+	}
+	sort.Strings(ops)
+
+	return ops
+}
+
+// wait stops the registration of operations & blocks till all the pending
+// operations are done or till the context is done. It returns false if the
+// context is done first.
+func (w *workTracker) wait(ctx context.Context) bool {
+	w.Lock()
+	if !w.draining {
+		w.draining = true
+		if len(w.pending) == 0 {
+			close(w.drainedCh)
+		}
+	}
+	w.Unlock()
+
+	select {
+	case <-w.drainedCh:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -1,11 +1,13 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/openebs/mayaserver/lib/config"
 )
@@ -124,3 +126,63 @@ func TestMayaServerConfig(t *testing.T) {
 	}
 
 }
+
+func TestWorkTracker_RefusesWorkWhileDraining(t *testing.T) {
+	w := newWorkTracker()
+
+	done, ok := w.begin("op-1")
+	if !ok {
+		t.Fatalf("expected the operation to be registered")
+	}
+
+	waitCh := make(chan bool)
+	go func() {
+		waitCh <- w.wait(context.Background())
+	}()
+
+	// The wait refuses new operations once it is underway
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		w.Lock()
+		draining := w.draining
+		w.Unlock()
+		if draining {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("expected the wait to start draining")
+		}
+	}
+	if _, ok := w.begin("op-2"); ok {
+		t.Fatalf("expected the operation to be refused while draining")
+	}
+
+	done()
+	select {
+	case ok := <-waitCh:
+		if !ok {
+			t.Fatalf("expected the wait to complete")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("wait did not complete after the operation")
+	}
+
+	if pending := w.inFlight(); len(pending) != 0 {
+		t.Fatalf("expected no operation in flight, got: %v", pending)
+	}
+}
+
+func TestWorkTracker_WaitTimesOut(t *testing.T) {
+	w := newWorkTracker()
+	w.begin("stuck")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if w.wait(ctx) {
+		t.Fatalf("expected the wait to time out")
+	}
+
+	// A later wait reports the same operation
+	if pending := w.inFlight(); len(pending) != 1 || pending[0] != "stuck" {
+		t.Fatalf("expected the stuck operation in flight, got: %v", pending)
+	}
+}
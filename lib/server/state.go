@@ -0,0 +1,36 @@
+package server
+
+import (
+	"path/filepath"
+
+	"github.com/openebs/mayaserver/lib/config"
+	"github.com/openebs/mayaserver/lib/loghelper"
+	"github.com/openebs/mayaserver/lib/state"
+)
+
+// openState opens the state of maya api server within the data directory.
+// The state is kept in memory only if there is no data directory. Hence it
+// does not survive a restart.
+func openState(mc *config.MayaConfig) (*state.Store, error) {
+	if mc.DataDir == "" {
+		return state.Open("")
+	}
+
+	return state.Open(filepath.Join(mc.DataDir, state.FileName))
+}
+
+// loadStateCipher loads the cipher of the secrets of the state. Its key is
+// read from the state key file if set. It is kept along with the state within
+// the data directory otherwise.
+func loadStateCipher(mc *config.MayaConfig, logger *loghelper.Logger) (*state.Cipher, error) {
+	if mc.StateKeyFile != "" {
+		return state.LoadCipher(mc.StateKeyFile)
+	}
+	if mc.DataDir == "" {
+		return state.LoadCipher("")
+	}
+
+	logger.Printf("[WARN] state: Key of the secrets of the state is kept in the data directory. " +
+		"Set state_key_file to a path outside it so that a copy of the data directory does not disclose the secrets.")
+	return state.LoadCipher(filepath.Join(mc.DataDir, state.KeyFileName))
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/openebs/maya/types/v1"
+	"github.com/openebs/mayaserver/lib/api"
+)
+
+// volumeTarget returns the details of the iSCSI target of the volume so that
+// the initiators need not parse the annotations of the volume. The iscsiadm
+// parameters are returned if the iscsiadm query parameter is set. The CHAP
+// credentials are released only to the callers that are authorized via the
+// CHAP access token. These are not enforced by the target, hence CHAP is
+// reported as enabled but not required.
+func (s *HTTPServer) volumeTarget(resp http.ResponseWriter, req *http.Request, name string) (interface{}, error) {
+	if req.Method != "GET" {
+		return nil, CodedError(405, ErrInvalidMethod)
+	}
+
+	iscsiadm := false
+	if v := req.URL.Query().Get("iscsiadm"); v != "" {
+		var err error
+		if iscsiadm, err = strconv.ParseBool(v); err != nil {
+			return nil, CodedError(400, fmt.Sprintf("Invalid iscsiadm: '%s'", v))
+		}
+	}
+
+	if err := s.blockingQuery(resp, req, s.maya.volumeIndex); err != nil {
+		return nil, err
+	}
+
+	pv, err := s.readVolume(req, name)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := volumeTargetOf(pv)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := s.maya.chapCredentialsOf(name)
+	if err != nil {
+		return nil, err
+	}
+	if creds != nil {
+		target.CHAPEnabled = true
+		if s.chapAuthorized(req) {
+			target.CHAP = creds
+		}
+	}
+
+	if iscsiadm {
+		target.ISCSIAdm = iscsiadmParams(target)
+	}
+
+	return target, nil
+}
+
+// volumeTargetOf returns the iSCSI target of the volume as per the portals
+// & the IQN set by the orchestrator. The portals default to the controller
+// IPs & the IQN defaults to the one the orchestrators name the target by. A
+// volume without any portal is reported as unavailable as its controllers
+// are yet to be scheduled.
+func volumeTargetOf(pv *v1.PersistentVolume) (*api.VolumeTarget, error) {
+	portals := api.VolumeAnnotationList(pv.Annotations, v1.TargetPortalsAPILbl)
+	if len(portals) == 0 {
+		portals = api.VolumeAnnotationList(pv.Annotations, v1.ControllerIPsAPILbl)
+	}
+	if len(portals) == 0 {
+		return nil, CodedError(503, fmt.Sprintf("VSM '%s' has no target portals yet", pv.Name))
+	}
+
+	for i, portal := range portals {
+		if _, _, err := net.SplitHostPort(portal); err != nil {
+			portals[i] = net.JoinHostPort(portal, string(v1.JivaISCSIPortDef))
+		}
+	}
+
+	iqn := strings.TrimSpace(pv.Annotations[string(v1.IQNAPILbl)])
+	if iqn == "" {
+		iqn = v1.JivaIQN(pv.Name)
+	}
+
+	target := &api.VolumeTarget{
+		Volume: pv.Name,
+		Portal: portals[0],
+		IQN:    iqn,
+		LUN:    api.TargetLUN,
+	}
+	if len(portals) > 1 {
+		target.Portals = portals
+	}
+	return target, nil
+}
+
+// iscsiadmParams returns the iscsiadm arguments to discover the target via
+// its first portal & to log in to the target via every portal. The logins
+// are without CHAP as the target does not enforce it.
+func iscsiadmParams(target *api.VolumeTarget) *api.ISCSIAdmParams {
+	portals := target.Portals
+	if len(portals) == 0 {
+		portals = []string{target.Portal}
+	}
+
+	params := &api.ISCSIAdmParams{
+		Discovery: []string{"-m", "discovery", "-t", "sendtargets", "-p", target.Portal},
+	}
+	for _, portal := range portals {
+		params.Logins = append(params.Logins, []string{"-m", "node", "-T", target.IQN, "-p", portal, "--login"})
+	}
+	return params
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/openebs/maya/types/v1"
+	"github.com/openebs/mayaserver/lib/api"
+)
+
+func TestVolumeTarget(t *testing.T) {
+	_, client, cleanup := makeAPIClientTestServer(t)
+	defer cleanup()
+
+	volumes := client.Volumes()
+
+	pvc := &v1.PersistentVolumeClaim{}
+	pvc.Name = "vol1"
+	if _, err := volumes.Create(pvc, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	currentFakeOrchestrator.l.Lock()
+	currentFakeOrchestrator.volumes["vol1"].Annotations[string(v1.TargetPortalsAPILbl)] = "10.0.0.1:3260,10.0.0.2:3260"
+	currentFakeOrchestrator.l.Unlock()
+
+	target, _, err := volumes.Target("vol1", false, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := &api.VolumeTarget{
+		Volume:  "vol1",
+		Portal:  "10.0.0.1:3260",
+		IQN:     "iqn.2016-09.com.openebs.jiva:vol1",
+		LUN:     0,
+		Portals: []string{"10.0.0.1:3260", "10.0.0.2:3260"},
+	}
+	if !reflect.DeepEqual(target, expected) {
+		t.Fatalf("bad target: %#v", target)
+	}
+
+	// The iscsiadm parameters log in via every portal
+	target, _, err = volumes.Target("vol1", true, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if target.ISCSIAdm == nil || len(target.ISCSIAdm.Logins) != 2 {
+		t.Fatalf("bad iscsiadm parameters: %#v", target.ISCSIAdm)
+	}
+	discovery := []string{"-m", "discovery", "-t", "sendtargets", "-p", "10.0.0.1:3260"}
+	if !reflect.DeepEqual(target.ISCSIAdm.Discovery, discovery) {
+		t.Fatalf("bad discovery: %v", target.ISCSIAdm.Discovery)
+	}
+	login := []string{"-m", "node", "-T", expected.IQN, "-p", "10.0.0.2:3260", "--login"}
+	if !reflect.DeepEqual(target.ISCSIAdm.Logins[1], login) {
+		t.Fatalf("bad login: %v", target.ISCSIAdm.Logins[1])
+	}
+
+	if _, _, err := volumes.Target("missing", false, nil); api.KindOf(err) != api.ErrorKindNotFound {
+		t.Fatalf("expected not found, got: %v", err)
+	}
+}
+
+func TestVolumeTargetOf(t *testing.T) {
+	cases := []struct {
+		annotations map[string]string
+		portal      string
+		portals     []string
+		iqn         string
+	}{
+		{
+			annotations: map[string]string{string(v1.TargetPortalsAPILbl): "10.0.0.1:3260"},
+			portal:      "10.0.0.1:3260",
+			iqn:         v1.JivaIQN("vol1"),
+		},
+		{
+			// The IQN is the one set by the orchestrator
+			annotations: map[string]string{
+				string(v1.TargetPortalsAPILbl): "10.0.0.1:3260",
+				string(v1.IQNAPILbl):           "iqn.2017-01.com.example:vol1",
+			},
+			portal: "10.0.0.1:3260",
+			iqn:    "iqn.2017-01.com.example:vol1",
+		},
+		{
+			// The portals default to the controller IPs
+			annotations: map[string]string{string(v1.ControllerIPsAPILbl): "10.0.0.1, 10.0.0.2"},
+			portal:      "10.0.0.1:3260",
+			portals:     []string{"10.0.0.1:3260", "10.0.0.2:3260"},
+			iqn:         v1.JivaIQN("vol1"),
+		},
+		{
+			annotations: map[string]string{},
+		},
+	}
+
+	for _, c := range cases {
+		pv := &v1.PersistentVolume{}
+		pv.Name = "vol1"
+		pv.Annotations = c.annotations
+
+		target, err := volumeTargetOf(pv)
+		if c.portal == "" {
+			if errorKind(err) != api.ErrorKindUnavailable {
+				t.Fatalf("expected unavailable for %v, got: %v", c.annotations, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if target.Portal != c.portal || !reflect.DeepEqual(target.Portals, c.portals) || target.IQN != c.iqn {
+			t.Fatalf("bad target for %v: %#v", c.annotations, target)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/openebs/maya/types/v1"
+	"github.com/openebs/maya/volumes/provisioner"
+	"github.com/openebs/mayaserver/lib/config"
+	"github.com/openebs/mayaserver/lib/loghelper"
+	"github.com/openebs/mayaserver/lib/tracing"
+)
+
+// tracingServiceName is the name by which maya api server is reported to the
+// trace collector
+const tracingServiceName = "maya-apiserver"
+
+// newTracer returns the tracer of maya api server. The spans are exported to
+// the trace collector if one is configured.
+func newTracer(config *config.MayaConfig, logOutput io.Writer) (*tracing.Tracer, error) {
+	exporter, err := newSpanExporter(config, logOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	return tracing.NewTracer(tracingServiceName, exporter), nil
+}
+
+// newSpanExporter returns the exporter of the trace collector. It returns nil
+// if a trace collector is not configured.
+func newSpanExporter(config *config.MayaConfig, logOutput io.Writer) (tracing.Exporter, error) {
+	if config.TraceCollectorAddr == "" {
+		return nil, nil
+	}
+
+	exporter, err := tracing.NewOTLPExporter(config.TraceCollectorAddr, tracingServiceName, logOutput)
+	if err != nil {
+		return nil, err
+	}
+	return exporter, nil
+}
+
+// reloadTracer switches the tracer to the exporter of the new trace
+// collector. The spans pending with the previous exporter are flushed.
+func (ms *MayaApiServer) reloadTracer(old, new *config.MayaConfig) (func(), func(), error) {
+	exporter, err := newSpanExporter(new, ms.logOutput)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	commit := func() {
+		previous := ms.tracer.SetExporter(exporter)
+		if previous == nil {
+			return
+		}
+		if err := previous.Shutdown(); err != nil {
+			ms.logger.Printf("[WARN] maya api server: failed to export pending spans: %v", err)
+		}
+	}
+
+	abort := func() {
+		if exporter != nil {
+			exporter.Shutdown()
+		}
+	}
+
+	return commit, abort, nil
+}
+
+// traceRequest starts the server span of the request. The trace of the client
+// is continued if the request has a traceparent header. The returned request
+// carries the span in its context.
+func (s *HTTPServer) traceRequest(req *http.Request) (*http.Request, *tracing.Span) {
+	ctx := tracing.Extract(req.Context(), req.Header)
+	ctx, span := s.maya.tracer.Start(ctx, req.Method+" "+req.URL.Path, tracing.SpanKindServer)
+
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.target", req.URL.RequestURI())
+	span.SetAttribute("request.id", requestIDOf(req))
+
+	return req.WithContext(ctx), span
+}
+
+// finishRequestSpan finishes the server span of the request along with the
+// HTTP code of the response
+func finishRequestSpan(span *tracing.Span, code int, err error) {
+	if code == 0 {
+		code = http.StatusOK
+	}
+
+	span.SetAttribute("http.status_code", strconv.Itoa(code))
+	span.SetError(err)
+	span.Finish()
+}
+
+// startSpan starts a span as a child of the request's span
+func (s *HTTPServer) startSpan(req *http.Request, name string, kind tracing.SpanKind) *tracing.Span {
+	return s.maya.startSpan(req.Context(), name, kind)
+}
+
+// startSpan starts a span as a child of the span of the context
+func (ms *MayaApiServer) startSpan(ctx context.Context, name string, kind tracing.SpanKind) *tracing.Span {
+	_, span := ms.tracer.Start(ctx, name, kind)
+	return span
+}
+
+// finishSpan finishes the span. The span is marked as failed if there was an
+// error.
+func finishSpan(span *tracing.Span, err error) {
+	span.SetError(err)
+	span.Finish()
+}
+
+// volumeProvisioner returns the persistent volume provisioner of the claim
+// with its profile set
+func (s *HTTPServer) volumeProvisioner(req *http.Request, pvc *v1.PersistentVolumeClaim) (provisioner.VolumeInterface, error) {
+	return s.maya.volumeProvisioner(req.Context(), pvc)
+}
+
+// volumeProvisioner returns the persistent volume provisioner of the claim
+// with its profile set. Resolving the provisioner & its profile are traced
+// as separate spans. Failures of either are counted.
+func (ms *MayaApiServer) volumeProvisioner(ctx context.Context, pvc *v1.PersistentVolumeClaim) (provisioner.VolumeInterface, error) {
+	span := ms.startSpan(ctx, "provisioner.get", tracing.SpanKindInternal)
+	pvp, err := provisioner.GetVolumeProvisioner(pvc.Labels)
+	finishSpan(span, err)
+	if err != nil {
+		ms.metrics.profileFailureCounter.WithLabelValues(profileStageProvisioner).Inc()
+		return nil, err
+	}
+
+	// Set the volume provisioner profile to provisioner
+	span = ms.startSpan(ctx, "provisioner.profile", tracing.SpanKindInternal)
+	span.SetAttribute("provisioner.name", pvp.Name())
+	_, err = pvp.Profile(pvc)
+	finishSpan(span, err)
+	if err != nil {
+		ms.metrics.profileFailureCounter.WithLabelValues(profileStageProfile).Inc()
+		return nil, err
+	}
+
+	return pvp, nil
+}
+
+// storageCall traces & measures a single orchestrator operation invoked via
+// the volume provisioner
+type storageCall struct {
+	metrics      *serverMetrics
+	logger       *loghelper.Logger
+	span         *tracing.Span
+	orchestrator string
+	op           string
+	start        time.Time
+}
+
+// startStorageCall starts tracing & measuring the orchestrator operation
+// invoked for the claim of the request
+func (s *HTTPServer) startStorageCall(req *http.Request, pvc *v1.PersistentVolumeClaim, op string) *storageCall {
+	return s.maya.startStorageCall(req.Context(), pvc, op)
+}
+
+// startStorageCall starts tracing & measuring the orchestrator operation
+// invoked for the claim. The operation is traced as a single client span
+// from here i.e. the volume provisioner & the orchestrator are not traced
+// within.
+func (ms *MayaApiServer) startStorageCall(ctx context.Context, pvc *v1.PersistentVolumeClaim, op string) *storageCall {
+	orchestrator := string(v1.GetOrchestratorName(pvc.Labels))
+
+	span := ms.startSpan(ctx, "orchestrator."+op, tracing.SpanKindClient)
+	span.SetAttribute("orchestrator.name", orchestrator)
+	if pvc.Name != "" {
+		span.SetAttribute("volume.name", pvc.Name)
+	}
+
+	logger := ms.contextLogger(ctx).With("orchestrator", orchestrator)
+	if pvc.Name != "" {
+		logger = logger.With("volume", pvc.Name)
+	}
+
+	return &storageCall{
+		metrics:      ms.metrics,
+		logger:       logger,
+		span:         span,
+		orchestrator: orchestrator,
+		op:           op,
+		start:        time.Now(),
+	}
+}
+
+// done finishes the orchestrator operation. An operation that did not fail
+// but did not find the volume either is classified as not found.
+func (c *storageCall) done(err error, found bool) {
+	outcome := classifyOutcome(err)
+	if err == nil && !found {
+		outcome = outcomeNotFound
+	}
+
+	c.span.SetAttribute("outcome", outcome)
+	finishSpan(c.span, err)
+
+	c.metrics.observeStorageOp(c.orchestrator, c.op, outcome, c.start)
+
+	c.logger.With("outcome", outcome).Printf("[DEBUG] %s: %s took %v",
+		orchestratorComponent(c.orchestrator), c.op, time.Since(c.start))
+}
+
+// orchestratorComponent returns the log component of the orchestrator so
+// that its logs can be leveled independently e.g. orchprovider.k8s
+func orchestratorComponent(orchestrator string) string {
+	switch orchestrator {
+	case string(v1.K8sOrchestrator):
+		return "orchprovider.k8s"
+	case string(v1.NomadOrchestrator):
+		return "orchprovider.nomad"
+	case "":
+		return "orchprovider"
+	default:
+		return "orchprovider." + orchestrator
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/openebs/maya/types/v1"
+	"github.com/openebs/mayaserver/lib/tracing"
+)
+
+func TestTraceRequestHonorsTraceparent(t *testing.T) {
+	s := makeHTTPTestServer(t, nil)
+	defer s.Cleanup()
+
+	exp := tracing.NewInMemoryExporter()
+	s.Maya.tracer = tracing.NewTracer(tracingServiceName, exp)
+
+	handler := func(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+		span := s.Server.startSpan(req, "provisioner.add", tracing.SpanKindClient)
+		finishSpan(span, nil)
+		return nil, CodedError(404, "not found")
+	}
+
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/latest/volumes/", nil)
+	req.Header.Set(tracing.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	s.Server.wrap(RequestCounter, RequestDuration, handler)(resp, req)
+
+	spans := exp.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got: %d", len(spans))
+	}
+
+	child, server := spans[0], spans[1]
+
+	if server.Kind != tracing.SpanKindServer || server.Name != "POST /latest/volumes/" {
+		t.Fatalf("bad server span: %s %v", server.Name, server.Kind)
+	}
+
+	if server.Context.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		server.ParentSpanID.String() != "00f067aa0ba902b7" {
+		t.Fatalf("expected the client's trace to be continued, got: %s", server.Context.Traceparent())
+	}
+
+	if child.ParentSpanID != server.Context.SpanID {
+		t.Fatalf("expected provisioner span to be a child of the server span")
+	}
+
+	if server.Attributes["http.status_code"] != "404" || server.Err == nil {
+		t.Fatalf("expected failed server span with code 404, got: %v", server.Attributes)
+	}
+
+	if server.Attributes["request.id"] != resp.Header().Get(RequestIDHeader) {
+		t.Fatalf("expected request id in server span, got: %v", server.Attributes)
+	}
+}
+
+func TestStorageCallTraces(t *testing.T) {
+	s, client, cleanup := makeAPIClientTestServer(t)
+	defer cleanup()
+
+	exp := tracing.NewInMemoryExporter()
+	s.Maya.tracer = tracing.NewTracer(tracingServiceName, exp)
+
+	pvc := &v1.PersistentVolumeClaim{}
+	pvc.Name = "vol1"
+	if _, err := client.Volumes().Create(pvc, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	spans := map[string]*tracing.Span{}
+	for _, span := range exp.Spans() {
+		spans[span.Name] = span
+	}
+
+	server := spans["POST /latest/volumes/"]
+	if server == nil {
+		t.Fatalf("expected the server span, got: %v", spans)
+	}
+	for _, name := range []string{"provisioner.get", "provisioner.profile", "orchestrator." + storageOpAdd} {
+		span := spans[name]
+		if span == nil || span.ParentSpanID != server.Context.SpanID {
+			t.Fatalf("expected %s to be a child of the server span, got: %v", name, spans)
+		}
+	}
+	if call := spans["orchestrator."+storageOpAdd]; call.Kind != tracing.SpanKindClient || call.Attributes["volume.name"] != "vol1" {
+		t.Fatalf("bad storage call span: %#v", call)
+	}
+
+	// The trace context does not reach the labels of the claim
+	currentFakeOrchestrator.l.Lock()
+	defer currentFakeOrchestrator.l.Unlock()
+	for k := range currentFakeOrchestrator.claimLabels["vol1"] {
+		if strings.Contains(k, "trace") {
+			t.Fatalf("expected no trace label, got: %s", k)
+		}
+	}
+}
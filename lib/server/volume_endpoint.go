@@ -1,12 +1,13 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
 
 	"github.com/openebs/maya/types/v1"
-	"github.com/openebs/maya/volumes/provisioner"
+	"github.com/openebs/mayaserver/lib/audit"
 )
 
 // VSMSpecificRequest is a http handler implementation. It deals with HTTP
@@ -16,7 +17,7 @@ import (
 //    Should it return specific types than interface{} ?
 func (s *HTTPServer) VSMSpecificRequest(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
 
-	fmt.Println("[DEBUG] Processing", req.Method, "request")
+	s.requestLogger(req).Printf("[DEBUG] volume: Processing VSM %s request", req.Method)
 
 	switch req.Method {
 	case "PUT", "POST":
@@ -56,63 +57,164 @@ func (s *HTTPServer) vsmSpecificGetRequest(resp http.ResponseWriter, req *http.R
 // vsmList is the http handler that lists VSMs
 func (s *HTTPServer) vsmList(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
 
-	fmt.Println("[DEBUG] Processing VSM list request")
+	logger := s.requestLogger(req)
+	logger.Printf("[DEBUG] volume: Processing VSM list request")
 
-	// Create a PVC
-	pvc := &v1.PersistentVolumeClaim{}
-
-	// Get the persistent volume provisioner instance
-	pvp, err := provisioner.GetVolumeProvisioner(pvc.Labels)
-	if err != nil {
+	if err := s.blockingQuery(resp, req, s.maya.volumeIndex); err != nil {
 		return nil, err
 	}
 
-	// Set the volume provisioner profile to provisioner
-	_, err = pvp.Profile(pvc)
+	l, err := s.listVolumes(req)
 	if err != nil {
 		return nil, err
 	}
 
-	lister, ok, err := pvp.Lister()
-	if err != nil {
-		return nil, err
+	for i := range l.Items {
+		if err := s.maya.annotateAttachments(&l.Items[i]); err != nil {
+			return nil, err
+		}
 	}
 
-	if !ok {
-		return nil, fmt.Errorf("VSM list is not supported by '%s:%s'", pvp.Label(), pvp.Name())
+	logger.Printf("[DEBUG] volume: Processed VSM list request successfully")
+
+	return l, nil
+}
+
+// vsmRead is the http handler that fetches the details of a VSM
+func (s *HTTPServer) vsmRead(resp http.ResponseWriter, req *http.Request, vsmName string) (interface{}, error) {
+
+	logger := s.requestLogger(req).With("volume", vsmName)
+	logger.Printf("[DEBUG] volume: Processing VSM read request")
+
+	if vsmName == "" {
+		return nil, CodedError(400, fmt.Sprintf("VSM name is missing"))
 	}
 
-	l, err := lister.List()
+	if err := s.blockingQuery(resp, req, s.maya.volumeIndex); err != nil {
+		return nil, err
+	}
+
+	details, err := s.readVolume(req, vsmName)
 	if err != nil {
 		return nil, err
 	}
 
-	fmt.Println("[DEBUG] Processed VSM list request successfully")
+	if err := s.maya.annotateAttachments(details); err != nil {
+		return nil, err
+	}
 
-	return l, nil
+	logger.Printf("[DEBUG] volume: Processed VSM read request successfully")
+
+	return details, nil
 }
 
-// vsmRead is the http handler that fetches the details of a VSM
-func (s *HTTPServer) vsmRead(resp http.ResponseWriter, req *http.Request, vsmName string) (interface{}, error) {
+// vsmDelete is the http handler that fetches the details of a VSM. Every
+// request is audited along with its outcome.
+func (s *HTTPServer) vsmDelete(resp http.ResponseWriter, req *http.Request, vsmName string) (out interface{}, err error) {
+
+	logger := s.requestLogger(req).With("volume", vsmName)
+	logger.Printf("[DEBUG] volume: Processing VSM delete request")
 
-	fmt.Println("[DEBUG] Processing VSM read request")
+	defer func() {
+		s.auditRequest(req, audit.OpVolumeDelete, vsmName, nil, err)
+	}()
 
 	if vsmName == "" {
 		return nil, CodedError(400, fmt.Sprintf("VSM name is missing"))
 	}
 
+	if err := s.removeVolume(req, vsmName); err != nil {
+		return nil, err
+	}
+
+	logger.Printf("[DEBUG] volume: Processed VSM delete request successfully")
+
+	return fmt.Sprintf("VSM '%s' deleted successfully", vsmName), nil
+}
+
+// vsmAdd is the http handler that fetches the details of a VSM. Every
+// request whose spec could be decoded is audited along with its outcome.
+func (s *HTTPServer) vsmAdd(resp http.ResponseWriter, req *http.Request) (out interface{}, err error) {
+
+	logger := s.requestLogger(req)
+	logger.Printf("[DEBUG] volume: Processing VSM add request")
+
+	pvc := v1.PersistentVolumeClaim{}
+
+	// The yaml/json spec is decoded to pvc struct
+	if err := decodeBody(req, &pvc); err != nil {
+		return nil, CodedError(400, err.Error())
+	}
+
+	// The spec is audited as requested i.e. without the labels added below
+	spec := audit.Redact(&pvc)
+	defer func() {
+		s.auditRequest(req, audit.OpVolumeCreate, pvc.Name, spec, err)
+	}()
+
+	// Name is expected to be available even in the minimalist specs
+	if pvc.Name == "" {
+		return nil, CodedError(400, fmt.Sprintf("VSM name missing in '%v'", pvc))
+	}
+
+	details, err := s.addVolume(req, &pvc)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.With("volume", pvc.Name).Printf("[DEBUG] volume: Processed VSM add request successfully")
+
+	return details, nil
+}
+
+// listVolumes lists the volumes via the volume provisioner. It is shared by
+// the volume endpoints & the EC2 query API.
+func (s *HTTPServer) listVolumes(req *http.Request) (*v1.PersistentVolumeList, error) {
+	return s.maya.listVolumes(req.Context())
+}
+
+// listVolumes lists the volumes via the volume provisioner. The listing is
+// traced as a child of the span of the context.
+func (ms *MayaApiServer) listVolumes(ctx context.Context) (*v1.PersistentVolumeList, error) {
 	// Create a PVC
 	pvc := &v1.PersistentVolumeClaim{}
-	pvc.Name = vsmName
+	labelContextRequestID(ctx, pvc)
+
+	// Get the persistent volume provisioner instance with its profile set
+	pvp, err := ms.volumeProvisioner(ctx, pvc)
+	if err != nil {
+		return nil, err
+	}
+
+	lister, ok, err := pvp.Lister()
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("VSM list is not supported by '%s:%s'", pvp.Label(), pvp.Name())
+	}
 
-	// Get persistent volume provisioner instance
-	pvp, err := provisioner.GetVolumeProvisioner(pvc.Labels)
+	call := ms.startStorageCall(ctx, pvc, storageOpList)
+	l, err := lister.List()
+	call.done(err, true)
 	if err != nil {
 		return nil, err
 	}
 
-	// Set the volume provisioner profile to provisioner
-	_, err = pvp.Profile(pvc)
+	return l, nil
+}
+
+// readVolume reads the named volume via the volume provisioner. A volume
+// that does not exist is reported as a 404.
+func (s *HTTPServer) readVolume(req *http.Request, vsmName string) (*v1.PersistentVolume, error) {
+	// Create a PVC
+	pvc := &v1.PersistentVolumeClaim{}
+	pvc.Name = vsmName
+	labelRequestID(req, pvc)
+
+	// Get persistent volume provisioner instance with its profile set
+	pvp, err := s.volumeProvisioner(req, pvc)
 	if err != nil {
 		return nil, err
 	}
@@ -124,7 +226,9 @@ func (s *HTTPServer) vsmRead(resp http.ResponseWriter, req *http.Request, vsmNam
 
 	// TODO
 	// pvc should not be passed again !!
+	call := s.startStorageCall(req, pvc, storageOpRead)
 	details, err := reader.Read(pvc)
+	call.done(err, details != nil)
 	if err != nil {
 		return nil, err
 	}
@@ -133,85 +237,100 @@ func (s *HTTPServer) vsmRead(resp http.ResponseWriter, req *http.Request, vsmNam
 		return nil, CodedError(404, fmt.Sprintf("VSM '%s' not found", vsmName))
 	}
 
-	fmt.Println("[DEBUG] Processed VSM read request successfully for '" + vsmName + "'")
-
 	return details, nil
 }
 
-// vsmDelete is the http handler that fetches the details of a VSM
-func (s *HTTPServer) vsmDelete(resp http.ResponseWriter, req *http.Request, vsmName string) (interface{}, error) {
+// removeVolume removes the named volume via the volume provisioner. A volume
+// that does not exist is reported as a 404. A volume that is attached is not
+// removed. The state of the volumes is locked till the volume is removed so
+// that the volume is not attached meanwhile.
+func (s *HTTPServer) removeVolume(req *http.Request, vsmName string) error {
+	s.maya.stateLock.Lock()
+	defer s.maya.stateLock.Unlock()
 
-	fmt.Println("[DEBUG] Processing VSM delete request")
-
-	if vsmName == "" {
-		return nil, CodedError(400, fmt.Sprintf("VSM name is missing"))
+	va, err := s.maya.attachmentsOf(vsmName)
+	if err != nil {
+		return err
+	}
+	if len(va.Attachments) != 0 {
+		return CodedError(409, fmt.Sprintf("VSM '%s' is attached to node '%s'", vsmName, va.Attachments[0].NodeID))
 	}
 
 	// Create a PVC
 	pvc := &v1.PersistentVolumeClaim{}
 	pvc.Name = vsmName
+	labelRequestID(req, pvc)
 
-	// Get the persistent volume provisioner instance
-	pvp, err := provisioner.GetVolumeProvisioner(pvc.Labels)
+	// Get the persistent volume provisioner instance with its profile set
+	pvp, err := s.volumeProvisioner(req, pvc)
 	if err != nil {
-		return nil, err
-	}
-
-	// Set the volume provisioner profile to provisioner
-	_, err = pvp.Profile(pvc)
-	if err != nil {
-		return nil, err
+		return err
 	}
 
 	remover, ok, err := pvp.Remover()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	if !ok {
-		return nil, fmt.Errorf("VSM delete is not supported by '%s:%s'", pvp.Label(), pvp.Name())
+		return fmt.Errorf("VSM delete is not supported by '%s:%s'", pvp.Label(), pvp.Name())
 	}
 
+	call := s.startStorageCall(req, pvc, storageOpDelete)
 	removed, err := remover.Remove()
+	call.done(err, removed)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// If there was not any err & still no removal
 	if !removed {
-		return nil, CodedError(404, fmt.Sprintf("VSM '%s' not found", vsmName))
+		return CodedError(404, fmt.Sprintf("VSM '%s' not found", vsmName))
 	}
 
-	fmt.Println("[DEBUG] Processed VSM delete request successfully for '" + vsmName + "'")
-
-	return fmt.Sprintf("VSM '%s' deleted successfully", vsmName), nil
-}
-
-// vsmAdd is the http handler that fetches the details of a VSM
-func (s *HTTPServer) vsmAdd(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	// The fences, the detach tokens & the CHAP credentials of the volume go
+	// along with it
+	for _, bucket := range []string{attachmentsBucket, detachTokensBucket, chapBucket} {
+		if _, err := s.maya.state.Delete(bucket, vsmName); err != nil {
+			s.requestLogger(req).With("volume", vsmName).Printf("[WARN] volume: Failed to remove the %s of the VSM: %v", bucket, err)
+		}
+	}
+	if _, err := s.maya.state.Delete(ec2VolumesBucket, ec2VolumeID(vsmName)); err != nil {
+		s.requestLogger(req).With("volume", vsmName).Printf("[WARN] volume: Failed to remove the EC2 volume id of the VSM: %v", err)
+	}
 
-	fmt.Println("[DEBUG] Processing VSM add request")
+	// Release the blocking queries of the volumes
+	s.maya.volumeIndex.bump()
 
-	pvc := v1.PersistentVolumeClaim{}
+	return nil
+}
 
-	// The yaml/json spec is decoded to pvc struct
-	if err := decodeBody(req, &pvc); err != nil {
-		return nil, CodedError(400, err.Error())
+// addVolume creates the volume of the pvc via the volume provisioner. The pvc
+// inherits the settings of the storage profile it refers to. The CHAP
+// credentials of the volume are generated if the pvc requests CHAP & are
+// saved once the volume is created. The volume is removed if its credentials
+// could not be saved. The target does not enforce these as no jiva
+// controller supports CHAP yet.
+func (s *HTTPServer) addVolume(req *http.Request, pvc *v1.PersistentVolumeClaim) (*v1.PersistentVolume, error) {
+	if err := s.applyStorageProfile(pvc); err != nil {
+		return nil, err
 	}
 
-	// Name is expected to be available even in the minimalist specs
-	if pvc.Name == "" {
-		return nil, CodedError(400, fmt.Sprintf("VSM name missing in '%v'", pvc))
+	chapMode, err := chapModeOf(pvc)
+	if err != nil {
+		return nil, err
 	}
 
-	// Get persistent volume provisioner instance
-	pvp, err := provisioner.GetVolumeProvisioner(pvc.Labels)
+	creds, err := s.maya.chapCredentialsFor(pvc, chapMode)
 	if err != nil {
 		return nil, err
 	}
 
-	// Set the volume provisioner profile to provisioner
-	_, err = pvp.Profile(&pvc)
+	// Let the provisioner & orchestrator know about this request
+	labelRequestID(req, pvc)
+
+	// Get persistent volume provisioner instance with its profile set
+	pvp, err := s.volumeProvisioner(req, pvc)
 	if err != nil {
 		return nil, err
 	}
@@ -223,12 +342,29 @@ func (s *HTTPServer) vsmAdd(resp http.ResponseWriter, req *http.Request) (interf
 
 	// TODO
 	// pvc should not be passed again !!
-	details, err := adder.Add(&pvc)
+	call := s.startStorageCall(req, pvc, storageOpAdd)
+	details, err := adder.Add(pvc)
+	call.done(err, true)
 	if err != nil {
 		return nil, err
 	}
 
-	fmt.Println("[DEBUG] Processed VSM add request successfully for '" + pvc.Name + "'")
+	if creds != nil {
+		if err := s.maya.putCHAPCredentials(pvc.Name, creds); err != nil {
+			if rerr := s.removeVolume(req, pvc.Name); rerr != nil {
+				s.requestLogger(req).With("volume", pvc.Name).Printf("[ERR] volume: Failed to remove the VSM without its CHAP credentials: %v", rerr)
+			}
+			return nil, fmt.Errorf("VSM '%s' is removed as its CHAP credentials could not be saved: %v", pvc.Name, err)
+		}
+
+		s.requestLogger(req).With("volume", pvc.Name).Printf("[WARN] volume: CHAP credentials of VSM are not enforced by its target")
+	}
+
+	// The volume is resolved by its EC2 volume id via the state
+	s.putEC2VolumeID(req, pvc.Name)
+
+	// Release the blocking queries of the volumes
+	s.maya.volumeIndex.bump()
 
 	return details, nil
 }
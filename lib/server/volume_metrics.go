@@ -0,0 +1,496 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/openebs/maya/types/v1"
+	"github.com/openebs/mayaserver/lib/api"
+	"github.com/openebs/mayaserver/lib/loghelper"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// defaultVolumeMetricsTTL is the duration for which the stats of the
+	// volumes are cached. Scrapes within this duration are served from the
+	// cache instead of querying the controllers.
+	defaultVolumeMetricsTTL = 15 * time.Second
+
+	// defaultVolumeStatsTimeout is the timeout to fetch the stats of a
+	// single volume from its controller
+	defaultVolumeStatsTimeout = 2 * time.Second
+
+	// defaultVolumeScrapeTimeout is the deadline to fetch the stats of all
+	// the volumes on a scrape. The volumes whose stats are not fetched by
+	// then are not reported for that scrape.
+	defaultVolumeScrapeTimeout = 10 * time.Second
+
+	// defaultVolumeStatsWorkers is the max number of controllers that are
+	// queried concurrently on a scrape
+	defaultVolumeStatsWorkers = 8
+)
+
+var (
+	// volumeMetricLabels are the labels of every per-volume metric
+	volumeMetricLabels = []string{"volume", "namespace", "orchestrator"}
+
+	volumeReadIOPSDesc = prometheus.NewDesc(
+		"openebs_volume_read_iops",
+		"Read operations per second of the volume since the previous scrape.",
+		volumeMetricLabels, nil,
+	)
+	volumeWriteIOPSDesc = prometheus.NewDesc(
+		"openebs_volume_write_iops",
+		"Write operations per second of the volume since the previous scrape.",
+		volumeMetricLabels, nil,
+	)
+	volumeReadThroughputDesc = prometheus.NewDesc(
+		"openebs_volume_read_throughput_bytes",
+		"Bytes read per second from the volume since the previous scrape.",
+		volumeMetricLabels, nil,
+	)
+	volumeWriteThroughputDesc = prometheus.NewDesc(
+		"openebs_volume_write_throughput_bytes",
+		"Bytes written per second to the volume since the previous scrape.",
+		volumeMetricLabels, nil,
+	)
+	volumeReadLatencyDesc = prometheus.NewDesc(
+		"openebs_volume_read_latency_seconds",
+		"Average latency of the read operations of the volume since the previous scrape.",
+		volumeMetricLabels, nil,
+	)
+	volumeWriteLatencyDesc = prometheus.NewDesc(
+		"openebs_volume_write_latency_seconds",
+		"Average latency of the write operations of the volume since the previous scrape.",
+		volumeMetricLabels, nil,
+	)
+	volumeUsedBytesDesc = prometheus.NewDesc(
+		"openebs_volume_used_bytes",
+		"Bytes used by the volume.",
+		volumeMetricLabels, nil,
+	)
+	volumeProvisionedBytesDesc = prometheus.NewDesc(
+		"openebs_volume_provisioned_bytes",
+		"Bytes provisioned for the volume.",
+		volumeMetricLabels, nil,
+	)
+	volumeReplicasUpDesc = prometheus.NewDesc(
+		"openebs_volume_replicas_up",
+		"Number of replicas of the volume that are up.",
+		volumeMetricLabels, nil,
+	)
+
+	volumeInventoryDesc = prometheus.NewDesc(
+		"openebs_volumes",
+		"Number of volumes by status.",
+		[]string{"orchestrator", "status"}, nil,
+	)
+)
+
+// Statuses of a volume derived from the phases of its controller & replica
+// pods. These are the same as the ones reported by the CLI.
+const (
+	volumeStatusRunning  = api.VolumeStatusRunning
+	volumeStatusDegraded = api.VolumeStatusDegraded
+	volumeStatusPending  = api.VolumeStatusPending
+	volumeStatusFailed   = api.VolumeStatusFailed
+	volumeStatusUnknown  = api.VolumeStatusUnknown
+)
+
+// volumeStatuses are reported in the inventory even if there are no volumes
+// with that status
+var volumeStatuses = []string{
+	volumeStatusRunning,
+	volumeStatusDegraded,
+	volumeStatusPending,
+	volumeStatusFailed,
+	volumeStatusUnknown,
+}
+
+// jivaStats is the response of a Jiva controller's stats API. The counters
+// are cumulative since the controller started.
+type jivaStats struct {
+	ReplicaCounter       int64  `json:"ReplicaCounter"`
+	ReadIOPS             string `json:"ReadIOPS"`
+	TotalReadTime        string `json:"TotalReadTime"`
+	TotalReadBlockCount  string `json:"TotalReadBlockCount"`
+	WriteIOPS            string `json:"WriteIOPS"`
+	TotalWriteTime       string `json:"TotalWriteTime"`
+	TotalWriteBlockCount string `json:"TotalWriteBlockCount"`
+	UsedLogicalBlocks    string `json:"UsedLogicalBlocks"`
+	SectorSize           string `json:"SectorSize"`
+	Size                 string `json:"Size"`
+}
+
+// volumeSample is the stats of a volume at a point in time. The counters are
+// parsed from jivaStats.
+type volumeSample struct {
+	at time.Time
+
+	readOps, readNanos, readBytes    float64
+	writeOps, writeNanos, writeBytes float64
+
+	usedBytes, sizeBytes float64
+	replicasUp           float64
+}
+
+// newVolumeSample parses the stats of a volume. The block counts are
+// converted to bytes via the sector size of the volume.
+func newVolumeSample(at time.Time, st *jivaStats) (*volumeSample, error) {
+	p := &statsParser{}
+	sectorSize := p.parse("SectorSize", st.SectorSize)
+
+	s := &volumeSample{
+		at:         at,
+		readOps:    p.parse("ReadIOPS", st.ReadIOPS),
+		readNanos:  p.parse("TotalReadTime", st.TotalReadTime),
+		readBytes:  p.parse("TotalReadBlockCount", st.TotalReadBlockCount) * sectorSize,
+		writeOps:   p.parse("WriteIOPS", st.WriteIOPS),
+		writeNanos: p.parse("TotalWriteTime", st.TotalWriteTime),
+		writeBytes: p.parse("TotalWriteBlockCount", st.TotalWriteBlockCount) * sectorSize,
+		usedBytes:  p.parse("UsedLogicalBlocks", st.UsedLogicalBlocks) * sectorSize,
+		sizeBytes:  p.parse("Size", st.Size),
+		replicasUp: float64(st.ReplicaCounter),
+	}
+
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	return s, nil
+}
+
+// statsParser parses the numeric stats & retains the first error
+type statsParser struct {
+	err error
+}
+
+func (p *statsParser) parse(name, value string) float64 {
+	if p.err != nil || value == "" {
+		return 0
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		p.err = fmt.Errorf("invalid stat '%s': %v", name, err)
+	}
+	return f
+}
+
+// volumeMetrics are the metrics of a single volume
+type volumeMetrics struct {
+	labels []string
+
+	// current & previous are the latest two samples. Rates are derived
+	// only if the previous sample is available.
+	current  *volumeSample
+	previous *volumeSample
+}
+
+// volumeCollector is a Prometheus collector of per-volume metrics. The stats
+// are queried from each volume's Jiva controller on scrape & cached for the
+// ttl.
+type volumeCollector struct {
+	ttl time.Duration
+
+	// timeout is the deadline of a scrape & workers is the max number of
+	// controllers queried concurrently
+	timeout time.Duration
+	workers int
+
+	// listVolumes lists the volumes along with their controller IPs
+	listVolumes func(ctx context.Context) (*v1.PersistentVolumeList, string, string, error)
+
+	// fetchStats fetches the stats from a volume controller
+	fetchStats func(ctx context.Context, controllerIP string) (*jivaStats, error)
+
+	logger *loghelper.Logger
+
+	l         sync.Mutex
+	collected time.Time
+	volumes   map[string]*volumeMetrics
+
+	// inventory is the count of volumes by status. It is nil till the
+	// volumes are listed successfully.
+	inventory    map[string]float64
+	orchestrator string
+}
+
+// newVolumeCollector returns a collector that lists the volumes via the
+// volume provisioner
+func newVolumeCollector(ms *MayaApiServer) *volumeCollector {
+	return &volumeCollector{
+		ttl:         defaultVolumeMetricsTTL,
+		timeout:     defaultVolumeScrapeTimeout,
+		workers:     defaultVolumeStatsWorkers,
+		listVolumes: volumeLister(ms),
+		fetchStats:  fetchJivaStats,
+		logger:      ms.log,
+		volumes:     map[string]*volumeMetrics{},
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *volumeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- volumeReadIOPSDesc
+	ch <- volumeWriteIOPSDesc
+	ch <- volumeReadThroughputDesc
+	ch <- volumeWriteThroughputDesc
+	ch <- volumeReadLatencyDesc
+	ch <- volumeWriteLatencyDesc
+	ch <- volumeUsedBytesDesc
+	ch <- volumeProvisionedBytesDesc
+	ch <- volumeReplicasUpDesc
+	ch <- volumeInventoryDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *volumeCollector) Collect(ch chan<- prometheus.Metric) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if time.Since(c.collected) >= c.ttl {
+		c.refresh()
+	}
+
+	for _, vm := range c.volumes {
+		vm.collect(ch)
+	}
+
+	if c.inventory != nil {
+		for _, status := range volumeStatuses {
+			ch <- prometheus.MustNewConstMetric(volumeInventoryDesc, prometheus.GaugeValue,
+				c.inventory[status], c.orchestrator, status)
+		}
+	}
+}
+
+// refresh queries the stats of every volume. The volumes that no longer
+// exist are dropped.
+func (c *volumeCollector) refresh() {
+	c.collected = time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	pvl, namespace, orchestrator, err := c.listVolumes(ctx)
+	if err != nil {
+		c.logger.Printf("[WARN] metrics: Failed to list volumes: %v", err)
+		return
+	}
+
+	var items []v1.PersistentVolume
+	if pvl != nil {
+		items = pvl.Items
+	}
+
+	c.orchestrator = orchestrator
+	c.inventory = map[string]float64{}
+	for _, pv := range items {
+		c.inventory[volumeStatus(pv.Annotations)]++
+	}
+
+	type job struct {
+		name, ip string
+		labels   []string
+	}
+
+	var jobs []job
+	for _, pv := range items {
+		ns := pv.Namespace
+		if ns == "" {
+			ns = namespace
+		}
+		labels := []string{pv.Name, ns, orchestrator}
+
+		ip := controllerIP(pv.Annotations)
+		if ip == "" {
+			c.logger.With("volume", pv.Name).Printf("[DEBUG] metrics: Controller IP of volume is not available")
+			continue
+		}
+
+		jobs = append(jobs, job{name: pv.Name, ip: ip, labels: labels})
+	}
+
+	// The controllers are queried by a bounded number of workers
+	workers := c.workers
+	if workers <= 0 || workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	jobCh := make(chan job, len(jobs))
+	for _, j := range jobs {
+		jobCh <- j
+	}
+	close(jobCh)
+
+	results := make(chan volumeResult, len(jobs))
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := range jobCh {
+				results <- c.fetchSample(ctx, j.name, j.ip, j.labels)
+			}
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	volumes := map[string]*volumeMetrics{}
+	for r := range results {
+		vm, ok := c.volumes[r.name]
+		if !ok {
+			vm = &volumeMetrics{}
+		}
+		vm.labels = r.labels
+
+		if r.sample == nil {
+			// The stats are not reported rather than reporting stale ones
+			vm.current, vm.previous = nil, nil
+		} else {
+			vm.previous, vm.current = vm.current, r.sample
+		}
+		volumes[r.name] = vm
+	}
+	c.volumes = volumes
+}
+
+// volumeResult is the outcome of fetching the stats of a volume. The sample
+// is nil if the stats could not be fetched.
+type volumeResult struct {
+	name   string
+	labels []string
+	sample *volumeSample
+}
+
+// fetchSample fetches the stats of a volume from its controller. The stats
+// are not fetched once the scrape is past its deadline.
+func (c *volumeCollector) fetchSample(ctx context.Context, name, ip string, labels []string) volumeResult {
+	logger := c.logger.With("volume", name, "orchestrator", labels[2])
+
+	if err := ctx.Err(); err != nil {
+		logger.Printf("[WARN] metrics: Skipped stats of volume: %v", err)
+		return volumeResult{name: name, labels: labels}
+	}
+
+	st, err := c.fetchStats(ctx, ip)
+	if err != nil {
+		logger.Printf("[WARN] metrics: Failed to fetch stats of volume from '%s': %v", ip, err)
+		return volumeResult{name: name, labels: labels}
+	}
+
+	sample, err := newVolumeSample(time.Now(), st)
+	if err != nil {
+		logger.Printf("[WARN] metrics: Bad stats of volume: %v", err)
+	}
+	return volumeResult{name: name, labels: labels, sample: sample}
+}
+
+// collect sends the metrics of the volume
+func (vm *volumeMetrics) collect(ch chan<- prometheus.Metric) {
+	cur := vm.current
+	if cur == nil {
+		return
+	}
+
+	gauge := func(desc *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, vm.labels...)
+	}
+
+	gauge(volumeUsedBytesDesc, cur.usedBytes)
+	gauge(volumeProvisionedBytesDesc, cur.sizeBytes)
+	gauge(volumeReplicasUpDesc, cur.replicasUp)
+
+	prev := vm.previous
+	if prev == nil {
+		return
+	}
+
+	elapsed := cur.at.Sub(prev.at).Seconds()
+	readOps, writeOps := cur.readOps-prev.readOps, cur.writeOps-prev.writeOps
+
+	// The counters are reset if the controller restarted
+	if elapsed <= 0 || readOps < 0 || writeOps < 0 {
+		return
+	}
+
+	gauge(volumeReadIOPSDesc, readOps/elapsed)
+	gauge(volumeWriteIOPSDesc, writeOps/elapsed)
+	gauge(volumeReadThroughputDesc, (cur.readBytes-prev.readBytes)/elapsed)
+	gauge(volumeWriteThroughputDesc, (cur.writeBytes-prev.writeBytes)/elapsed)
+	gauge(volumeReadLatencyDesc, avgLatency(cur.readNanos-prev.readNanos, readOps))
+	gauge(volumeWriteLatencyDesc, avgLatency(cur.writeNanos-prev.writeNanos, writeOps))
+}
+
+// avgLatency returns the average latency in seconds of the operations
+func avgLatency(nanos, ops float64) float64 {
+	if ops <= 0 {
+		return 0
+	}
+
+	return nanos / ops / float64(time.Second)
+}
+
+// volumeStatus derives the status of a volume from the phases of its
+// controller & replica pods as set by the orchestrator
+func volumeStatus(annotations map[string]string) string {
+	return api.VolumeStatus(annotations)
+}
+
+// controllerIP returns the first controller IP set by the orchestrator while
+// reading the volume
+func controllerIP(annotations map[string]string) string {
+	if ips := api.VolumeAnnotationList(annotations, v1.ControllerIPsAPILbl); len(ips) > 0 {
+		return ips[0]
+	}
+
+	return ""
+}
+
+// volumeLister lists the volumes the same way as the volume list endpoint
+// i.e. via the default volume provisioner. The orchestrator resolves the
+// controller IPs of each volume while listing. The namespace & name of the
+// orchestrator are returned as well.
+func volumeLister(ms *MayaApiServer) func(ctx context.Context) (*v1.PersistentVolumeList, string, string, error) {
+	return func(ctx context.Context) (*v1.PersistentVolumeList, string, string, error) {
+		pvl, err := ms.listVolumes(ctx)
+		return pvl, v1.GetOrchestratorNS(nil), string(v1.GetOrchestratorName(nil)), err
+	}
+}
+
+// fetchJivaStats fetches the stats from the Jiva controller's API
+func fetchJivaStats(ctx context.Context, controllerIP string) (*jivaStats, error) {
+	client := &http.Client{Timeout: defaultVolumeStatsTimeout}
+
+	url := fmt.Sprintf("http://%s/v1/stats", net.JoinHostPort(controllerIP, string(v1.JivaAPIPortDef)))
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("controller responded with %s", resp.Status)
+	}
+
+	var st jivaStats
+	if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		return nil, err
+	}
+
+	return &st, nil
+}
@@ -0,0 +1,275 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openebs/maya/types/v1"
+	"github.com/openebs/mayaserver/lib/loghelper"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gatherVolumeMetrics scrapes the collector & returns the metric values
+// keyed by metric name & volume. The inventory is keyed by metric name &
+// status.
+func gatherVolumeMetrics(t *testing.T, c *volumeCollector) map[string]float64 {
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	values := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			labels := map[string]string{}
+			for _, lp := range m.GetLabel() {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			if mf.GetName() == "openebs_volumes" {
+				values[mf.GetName()+"/"+labels["status"]] = gaugeValue(m)
+				continue
+			}
+			if labels["namespace"] != "default" || labels["orchestrator"] != "kubernetes" {
+				t.Fatalf("bad labels of %s: %v", mf.GetName(), labels)
+			}
+			values[mf.GetName()+"/"+labels["volume"]] = gaugeValue(m)
+		}
+	}
+
+	return values
+}
+
+func gaugeValue(m *dto.Metric) float64 {
+	return m.GetGauge().GetValue()
+}
+
+func TestVolumeCollector(t *testing.T) {
+	pvl := &v1.PersistentVolumeList{}
+	for _, name := range []string{"vol1", "vol2", "vol3"} {
+		pv := v1.PersistentVolume{}
+		pv.Name = name
+		pv.Annotations = map[string]string{}
+		pvl.Items = append(pvl.Items, pv)
+	}
+	pvl.Items[0].Annotations[string(v1.ControllerIPsAPILbl)] = "10.0.0.1"
+	pvl.Items[1].Annotations[string(v1.ControllerIPsAPILbl)] = "10.0.0.2"
+	// vol3 has no controller IP yet
+
+	pvl.Items[0].Annotations[string(v1.ControllerStatusAPILbl)] = "Running"
+	pvl.Items[0].Annotations[string(v1.ReplicaStatusAPILbl)] = "Running,Running"
+	pvl.Items[1].Annotations[string(v1.ControllerStatusAPILbl)] = "Running"
+	pvl.Items[1].Annotations[string(v1.ReplicaStatusAPILbl)] = "Running,Pending"
+
+	// Stats are fetched concurrently
+	var l sync.Mutex
+	lists, fetches := 0, 0
+	c := &volumeCollector{
+		ttl:     time.Hour,
+		timeout: time.Minute,
+		workers: 2,
+		listVolumes: func(ctx context.Context) (*v1.PersistentVolumeList, string, string, error) {
+			lists++
+			return pvl, "default", "kubernetes", nil
+		},
+		fetchStats: func(ctx context.Context, ip string) (*jivaStats, error) {
+			if ip == "10.0.0.2" {
+				return nil, fmt.Errorf("connection refused")
+			}
+
+			l.Lock()
+			fetches++
+			n := int64(fetches)
+			l.Unlock()
+
+			// Every fetch adds 100 reads & 50 writes of a 4096 byte block
+			// taking 1ms each
+			return &jivaStats{
+				ReplicaCounter:       3,
+				ReadIOPS:             strconv.FormatInt(100*n, 10),
+				TotalReadTime:        strconv.FormatInt(100*n*int64(time.Millisecond), 10),
+				TotalReadBlockCount:  strconv.FormatInt(100*n, 10),
+				WriteIOPS:            strconv.FormatInt(50*n, 10),
+				TotalWriteTime:       strconv.FormatInt(50*n*int64(time.Millisecond), 10),
+				TotalWriteBlockCount: strconv.FormatInt(50*n, 10),
+				UsedLogicalBlocks:    "256",
+				SectorSize:           "4096",
+				Size:                 "5368709120",
+			}, nil
+		},
+		logger:  loghelper.NewLogger(ioutil.Discard),
+		volumes: map[string]*volumeMetrics{},
+	}
+
+	first := gatherVolumeMetrics(t, c)
+
+	if first["openebs_volume_used_bytes/vol1"] != 256*4096 ||
+		first["openebs_volume_provisioned_bytes/vol1"] != 5368709120 ||
+		first["openebs_volume_replicas_up/vol1"] != 3 {
+		t.Fatalf("bad capacity metrics: %v", first)
+	}
+
+	if _, ok := first["openebs_volume_read_iops/vol1"]; ok {
+		t.Fatalf("rates need two samples, got: %v", first)
+	}
+
+	for _, v := range []string{"vol2", "vol3"} {
+		if _, ok := first["openebs_volume_used_bytes/"+v]; ok {
+			t.Fatalf("expected no metrics of %s, got: %v", v, first)
+		}
+	}
+
+	// Volumes are counted by status irrespective of their stats
+	inventory := map[string]float64{
+		volumeStatusRunning:  1,
+		volumeStatusDegraded: 1,
+		volumeStatusPending:  0,
+		volumeStatusFailed:   0,
+		volumeStatusUnknown:  1,
+	}
+	for status, expected := range inventory {
+		if got, ok := first["openebs_volumes/"+status]; !ok || got != expected {
+			t.Fatalf("%s volumes: expected: %v, got: %v", status, expected, got)
+		}
+	}
+
+	// Scrapes within the ttl are served from the cache
+	gatherVolumeMetrics(t, c)
+	if lists != 1 {
+		t.Fatalf("expected the volumes to be listed once, listed: %d", lists)
+	}
+
+	// Expire the cache & backdate the sample to get deterministic rates
+	c.collected = time.Time{}
+	c.volumes["vol1"].current.at = time.Now().Add(-10 * time.Second)
+
+	second := gatherVolumeMetrics(t, c)
+
+	within := func(name string, expected float64) {
+		got := second[name+"/vol1"]
+		if got < expected*0.95 || got > expected*1.05 {
+			t.Fatalf("%s: expected ~%v, got: %v", name, expected, got)
+		}
+	}
+	within("openebs_volume_read_iops", 10)
+	within("openebs_volume_write_iops", 5)
+	within("openebs_volume_read_throughput_bytes", 10*4096)
+	within("openebs_volume_write_throughput_bytes", 5*4096)
+	within("openebs_volume_read_latency_seconds", 0.001)
+	within("openebs_volume_write_latency_seconds", 0.001)
+}
+
+func TestVolumeCollectorBounded(t *testing.T) {
+	pvl := &v1.PersistentVolumeList{}
+	for i := 1; i <= 6; i++ {
+		pv := v1.PersistentVolume{}
+		pv.Name = fmt.Sprintf("vol%d", i)
+		pv.Annotations = map[string]string{string(v1.ControllerIPsAPILbl): fmt.Sprintf("10.0.0.%d", i)}
+		pvl.Items = append(pvl.Items, pv)
+	}
+
+	// The controllers are slow & at most 2 of them are queried at a time
+	var l sync.Mutex
+	running, peak := 0, 0
+	c := &volumeCollector{
+		ttl:     time.Hour,
+		timeout: 250 * time.Millisecond,
+		workers: 2,
+		listVolumes: func(ctx context.Context) (*v1.PersistentVolumeList, string, string, error) {
+			return pvl, "default", "kubernetes", nil
+		},
+		fetchStats: func(ctx context.Context, ip string) (*jivaStats, error) {
+			l.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			l.Unlock()
+
+			defer func() {
+				l.Lock()
+				running--
+				l.Unlock()
+			}()
+
+			select {
+			case <-time.After(100 * time.Millisecond):
+				return &jivaStats{ReplicaCounter: 1}, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		},
+		logger:  loghelper.NewLogger(ioutil.Discard),
+		volumes: map[string]*volumeMetrics{},
+	}
+
+	start := time.Now()
+	values := gatherVolumeMetrics(t, c)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("scrape exceeded its deadline: %v", elapsed)
+	}
+
+	if peak != 2 {
+		t.Fatalf("expected 2 concurrent fetches, got: %d", peak)
+	}
+
+	// The volumes past the deadline are not reported
+	reported := 0
+	for i := 1; i <= 6; i++ {
+		if _, ok := values[fmt.Sprintf("openebs_volume_replicas_up/vol%d", i)]; ok {
+			reported++
+		}
+	}
+	if reported == 0 || reported == 6 {
+		t.Fatalf("expected some of the volumes to be reported, got: %d", reported)
+	}
+}
+
+func TestVolumeStatus(t *testing.T) {
+	cases := []struct {
+		controller, replicas, expected string
+	}{
+		{"", "", volumeStatusUnknown},
+		{"Running", "", volumeStatusUnknown},
+		{"Running", "Running,Running", volumeStatusRunning},
+		{"Running", "Running,Failed", volumeStatusDegraded},
+		{"Failed", "Running,Running", volumeStatusFailed},
+		{"Pending", "Pending,Pending", volumeStatusPending},
+		{"Running", "Unknown,Unknown", volumeStatusUnknown},
+	}
+
+	for _, c := range cases {
+		status := volumeStatus(map[string]string{
+			string(v1.ControllerStatusAPILbl): c.controller,
+			string(v1.ReplicaStatusAPILbl):    c.replicas,
+		})
+		if status != c.expected {
+			t.Fatalf("%q/%q: expected: %s, got: %s", c.controller, c.replicas, c.expected, status)
+		}
+	}
+}
+
+func TestControllerIP(t *testing.T) {
+	cases := map[string]string{
+		"":                    "",
+		"10.0.0.1":            "10.0.0.1",
+		" ,10.0.0.2,10.0.0.3": "10.0.0.2",
+	}
+
+	for annotation, expected := range cases {
+		ip := controllerIP(map[string]string{string(v1.ControllerIPsAPILbl): annotation})
+		if ip != expected {
+			t.Fatalf("%q: expected: %s, got: %s", annotation, expected, ip)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package state
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// KeyFileName is the name of the file of the key that encrypts the secrets
+// of the state within the data directory
+const KeyFileName = "state.key"
+
+// keySize is the size of an AES-256 key
+const keySize = 32
+
+// Cipher encrypts the secrets that are kept in the state e.g. the CHAP
+// credentials of the volumes. The secrets are sealed via AES-256-GCM.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// LoadCipher reads the key from the file at the path. A random key is
+// generated & written to the file if the file does not exist. The key is
+// kept in memory only if the path is empty.
+func LoadCipher(path string) (*Cipher, error) {
+	if path == "" {
+		key, err := newKey()
+		if err != nil {
+			return nil, err
+		}
+		return newCipher(key)
+	}
+
+	key, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		if key, err = newKey(); err != nil {
+			return nil, err
+		}
+		if err := writeKey(path, key); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read the state key: %v", err)
+	}
+
+	if len(key) != keySize {
+		return nil, fmt.Errorf("invalid state key '%s': expected %d bytes, got %d", path, keySize, len(key))
+	}
+	return newCipher(key)
+}
+
+func newKey() ([]byte, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate the state key: %v", err)
+	}
+	return key, nil
+}
+
+// writeKey writes the key to a new file that is readable by its owner only.
+// An existing key is never replaced.
+func writeKey(path string, key []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create the state directory: %v", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write the state key: %v", err)
+	}
+	if _, err := f.Write(key); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write the state key: %v", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync the state key: %v", err)
+	}
+	return f.Close()
+}
+
+func newCipher(key []byte) (*Cipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// Seal encrypts the plain text. The nonce & the cipher text are returned as
+// base64.
+func (c *Cipher) Seal(plain []byte) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := c.aead.Seal(nonce, nonce, plain, nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts the text sealed via Seal
+func (c *Cipher) Open(sealed string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the sealed secret: %v", err)
+	}
+
+	size := c.aead.NonceSize()
+	if len(b) < size {
+		return nil, fmt.Errorf("failed to open the sealed secret: too short")
+	}
+
+	plain, err := c.aead.Open(nil, b[:size], b[size:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the sealed secret: %v", err)
+	}
+	return plain, nil
+}
@@ -0,0 +1,62 @@
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCipher_SealOpen(t *testing.T) {
+	path, cleanup := tmpState(t)
+	defer cleanup()
+	path = filepath.Join(filepath.Dir(path), KeyFileName)
+
+	c, err := LoadCipher(path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	sealed, err := c.Seal([]byte("secret"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("expected a private key file, got: %v %v", fi, err)
+	}
+
+	// The key survives once it is loaded again
+	c, err = LoadCipher(path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	plain, err := c.Open(sealed)
+	if err != nil || string(plain) != "secret" {
+		t.Fatalf("bad plain text: %q %v", plain, err)
+	}
+
+	// Another key does not open the sealed text
+	other, err := LoadCipher("")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := other.Open(sealed); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if _, err := c.Open("bm9wZQ=="); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
+
+func TestLoadCipher_InvalidKey(t *testing.T) {
+	path, cleanup := tmpState(t)
+	defer cleanup()
+
+	os.MkdirAll(filepath.Dir(path), 0700)
+	if err := ioutil.WriteFile(path, []byte("short"), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := LoadCipher(path); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
@@ -0,0 +1,175 @@
+// Package state persists the state of maya api server e.g. the attachments
+// of the volumes. The state is a set of buckets of JSON values by their
+// keys. It is kept in memory & is written as a whole to a file on every
+// change. The file is replaced atomically. Hence a crash leaves either the
+// previous or the new state behind. The secrets are sealed via a Cipher
+// before they are put in the state.
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// FileName is the name of the state file within the data directory
+const FileName = "state.json"
+
+// Store is the state of maya api server
+type Store struct {
+	l    sync.RWMutex
+	path string
+
+	// buckets are the values by their keys by their buckets
+	buckets map[string]map[string]json.RawMessage
+}
+
+// Open reads the state from the file at the path. The state is kept in
+// memory only if the path is empty.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:    path,
+		buckets: map[string]map[string]json.RawMessage{},
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create the state directory: %v", err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the state: %v", err)
+	}
+
+	if err := json.Unmarshal(b, &s.buckets); err != nil {
+		return nil, fmt.Errorf("failed to decode the state '%s': %v", path, err)
+	}
+	return s, nil
+}
+
+// Path returns the path of the state file. It is empty if the state is kept
+// in memory only.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Get decodes the value of the key into out. It returns false if the key is
+// not set.
+func (s *Store) Get(bucket, key string, out interface{}) (bool, error) {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	v, ok := s.buckets[bucket][key]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(v, out); err != nil {
+		return false, fmt.Errorf("failed to decode '%s/%s': %v", bucket, key, err)
+	}
+	return true, nil
+}
+
+// Keys returns the sorted keys of the bucket
+func (s *Store) Keys(bucket string) []string {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	keys := make([]string, 0, len(s.buckets[bucket]))
+	for key := range s.buckets[bucket] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Put sets the value of the key. The change is undone if the state could not
+// be written.
+func (s *Store) Put(bucket, key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode '%s/%s': %v", bucket, key, err)
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if s.buckets[bucket] == nil {
+		s.buckets[bucket] = map[string]json.RawMessage{}
+	}
+	prev, existed := s.buckets[bucket][key]
+	s.buckets[bucket][key] = b
+
+	if err := s.write(); err != nil {
+		if existed {
+			s.buckets[bucket][key] = prev
+		} else {
+			delete(s.buckets[bucket], key)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes the key. It returns false if the key was not set. The
+// change is undone if the state could not be written.
+func (s *Store) Delete(bucket, key string) (bool, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	prev, ok := s.buckets[bucket][key]
+	if !ok {
+		return false, nil
+	}
+	delete(s.buckets[bucket], key)
+
+	if err := s.write(); err != nil {
+		s.buckets[bucket][key] = prev
+		return false, err
+	}
+	return true, nil
+}
+
+// write replaces the state file with the current state. It is a no-op if
+// the state is kept in memory only.
+func (s *Store) write() error {
+	if s.path == "" {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(s.buckets, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the state: %v", err)
+	}
+
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write the state: %v", err)
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write the state: %v", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync the state: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write the state: %v", err)
+	}
+
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace the state: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type record struct {
+	Node string
+	Seq  int
+}
+
+func tmpState(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "mapiserver")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return filepath.Join(dir, "state", FileName), func() { os.RemoveAll(dir) }
+}
+
+func TestStore_PutGetDelete(t *testing.T) {
+	path, cleanup := tmpState(t)
+	defer cleanup()
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var out record
+	if ok, err := s.Get("vols", "vol1", &out); ok || err != nil {
+		t.Fatalf("expected no record, got: %v %v", ok, err)
+	}
+
+	if err := s.Put("vols", "vol2", &record{Node: "n2", Seq: 2}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := s.Put("vols", "vol1", &record{Node: "n1", Seq: 1}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The state survives once the file is opened again
+	s, err = Open(path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if ok, err := s.Get("vols", "vol1", &out); !ok || err != nil {
+		t.Fatalf("expected a record, got: %v %v", ok, err)
+	}
+	if out != (record{Node: "n1", Seq: 1}) {
+		t.Fatalf("bad record: %#v", out)
+	}
+	if keys := s.Keys("vols"); !reflect.DeepEqual(keys, []string{"vol1", "vol2"}) {
+		t.Fatalf("bad keys: %v", keys)
+	}
+
+	if ok, err := s.Delete("vols", "vol1"); !ok || err != nil {
+		t.Fatalf("expected the record to be deleted, got: %v %v", ok, err)
+	}
+	if ok, err := s.Delete("vols", "vol1"); ok || err != nil {
+		t.Fatalf("expected no record, got: %v %v", ok, err)
+	}
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if keys := s.Keys("vols"); !reflect.DeepEqual(keys, []string{"vol2"}) {
+		t.Fatalf("bad keys: %v", keys)
+	}
+}
+
+func TestStore_InMemory(t *testing.T) {
+	s, err := Open("")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := s.Put("vols", "vol1", "n1"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var out string
+	if ok, err := s.Get("vols", "vol1", &out); !ok || err != nil || out != "n1" {
+		t.Fatalf("bad record: %v %v %q", ok, err, out)
+	}
+}
+
+func TestStore_WriteFailure(t *testing.T) {
+	path, cleanup := tmpState(t)
+	defer cleanup()
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := s.Put("vols", "vol1", "n1"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The state can not be replaced once its directory is gone
+	os.RemoveAll(filepath.Dir(path))
+
+	if err := s.Put("vols", "vol1", "n2"); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if err := s.Put("vols", "vol2", "n2"); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if ok, err := s.Delete("vols", "vol1"); ok || err == nil {
+		t.Fatalf("expected an error, got: %v %v", ok, err)
+	}
+
+	// The failed changes are undone
+	var out string
+	if ok, _ := s.Get("vols", "vol1", &out); !ok || out != "n1" {
+		t.Fatalf("bad record: %v %q", ok, out)
+	}
+	if keys := s.Keys("vols"); !reflect.DeepEqual(keys, []string{"vol1"}) {
+		t.Fatalf("bad keys: %v", keys)
+	}
+}
+
+func TestOpen_Corrupt(t *testing.T) {
+	path, cleanup := tmpState(t)
+	defer cleanup()
+
+	os.MkdirAll(filepath.Dir(path), 0700)
+	if err := ioutil.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
@@ -0,0 +1,332 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// otlpTracesPath is the path at which an OTLP/HTTP collector receives
+	// the spans
+	otlpTracesPath = "/v1/traces"
+
+	// defaultBatchSize is the number of spans that trigger an export
+	defaultBatchSize = 256
+
+	// defaultFlushInterval is the max duration the spans are held before
+	// being exported
+	defaultFlushInterval = 5 * time.Second
+
+	// defaultMaxQueueSize is the number of pending spans beyond which new
+	// spans are dropped
+	defaultMaxQueueSize = 2048
+)
+
+// Exporter exports the finished spans
+type Exporter interface {
+	// Export is invoked for every finished span. It should not block.
+	Export(s *Span)
+
+	// Shutdown exports the pending spans if any
+	Shutdown() error
+}
+
+// InMemoryExporter holds the finished spans in memory. It is meant for tests.
+type InMemoryExporter struct {
+	l     sync.Mutex
+	spans []*Span
+}
+
+// NewInMemoryExporter returns an exporter that holds the spans in memory
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+// Export holds the span in memory
+func (e *InMemoryExporter) Export(s *Span) {
+	e.l.Lock()
+	defer e.l.Unlock()
+
+	e.spans = append(e.spans, s)
+}
+
+// Shutdown is a no-op
+func (e *InMemoryExporter) Shutdown() error {
+	return nil
+}
+
+// Spans returns the spans exported so far
+func (e *InMemoryExporter) Spans() []*Span {
+	e.l.Lock()
+	defer e.l.Unlock()
+
+	return append([]*Span{}, e.spans...)
+}
+
+// Reset drops the spans exported so far
+func (e *InMemoryExporter) Reset() {
+	e.l.Lock()
+	defer e.l.Unlock()
+
+	e.spans = nil
+}
+
+// OTLPExporter exports the spans in batches to an OTLP/HTTP collector. The
+// spans are encoded as OTLP JSON.
+type OTLPExporter struct {
+	endpoint string
+	service  string
+	client   *http.Client
+	logger   *log.Logger
+
+	l     sync.Mutex
+	queue []*Span
+
+	flushCh    chan struct{}
+	shutdownCh chan struct{}
+	doneCh     chan struct{}
+	shutdown   sync.Once
+}
+
+// NewOTLPExporter returns an exporter that sends the spans to the collector
+// at the given address e.g. http://otel-collector:4318. The path defaults to
+// /v1/traces if not part of the address.
+func NewOTLPExporter(addr, service string, logOutput io.Writer) (*OTLPExporter, error) {
+	if !strings.HasPrefix(addr, "http://") && !strings.HasPrefix(addr, "https://") {
+		return nil, fmt.Errorf("invalid trace collector address '%s': expected http or https scheme", addr)
+	}
+
+	endpoint := strings.TrimSuffix(addr, "/")
+	if !strings.HasSuffix(endpoint, otlpTracesPath) {
+		endpoint = endpoint + otlpTracesPath
+	}
+
+	if logOutput == nil {
+		logOutput = ioutil.Discard
+	}
+
+	e := &OTLPExporter{
+		endpoint:   endpoint,
+		service:    service,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		logger:     log.New(logOutput, "", log.LstdFlags|log.Lmicroseconds),
+		flushCh:    make(chan struct{}, 1),
+		shutdownCh: make(chan struct{}),
+		doneCh:     make(chan struct{}),
+	}
+	go e.run()
+
+	return e, nil
+}
+
+// Export queues the span. A full batch is exported right away.
+func (e *OTLPExporter) Export(s *Span) {
+	e.l.Lock()
+	defer e.l.Unlock()
+
+	if len(e.queue) >= defaultMaxQueueSize {
+		return
+	}
+
+	e.queue = append(e.queue, s)
+	if len(e.queue) >= defaultBatchSize {
+		select {
+		case e.flushCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Shutdown exports the queued spans & stops the exporter
+func (e *OTLPExporter) Shutdown() error {
+	e.shutdown.Do(func() {
+		close(e.shutdownCh)
+	})
+	<-e.doneCh
+
+	return nil
+}
+
+// run exports the queued spans periodically or when a batch is full
+func (e *OTLPExporter) run() {
+	defer close(e.doneCh)
+
+	ticker := time.NewTicker(defaultFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.flushCh:
+		case <-e.shutdownCh:
+			e.flush()
+			return
+		}
+		e.flush()
+	}
+}
+
+// flush exports the queued spans
+func (e *OTLPExporter) flush() {
+	e.l.Lock()
+	spans := e.queue
+	e.queue = nil
+	e.l.Unlock()
+
+	if len(spans) == 0 {
+		return
+	}
+
+	if err := e.send(spans); err != nil {
+		e.logger.Printf("[WARN] tracing: Failed to export %d span(s) to %s: %v", len(spans), e.endpoint, err)
+	}
+}
+
+// send posts the spans to the collector
+func (e *OTLPExporter) send(spans []*Span) error {
+	b, err := json.Marshal(otlpRequest(e.service, spans))
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector responded with %s", resp.Status)
+	}
+
+	return nil
+}
+
+// The types below are the OTLP JSON encoding of the spans. Only the fields
+// used by maya api server are defined.
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// OTLP status codes
+const (
+	otlpStatusOk    = 1
+	otlpStatusError = 2
+)
+
+// otlpRequest encodes the spans of the service as an OTLP export request
+func otlpRequest(service string, spans []*Span) *otlpTraces {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		encoded = append(encoded, otlpSpanOf(s))
+	}
+
+	return &otlpTraces{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: otlpResource{
+					Attributes: []otlpKeyValue{
+						{Key: "service.name", Value: otlpValue{StringValue: service}},
+					},
+				},
+				ScopeSpans: []otlpScopeSpans{
+					{
+						Scope: otlpScope{Name: "github.com/openebs/mayaserver/lib/tracing"},
+						Spans: encoded,
+					},
+				},
+			},
+		},
+	}
+}
+
+func otlpSpanOf(s *Span) otlpSpan {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	o := otlpSpan{
+		TraceID:           s.Context.TraceID.String(),
+		SpanID:            s.Context.SpanID.String(),
+		Name:              s.Name,
+		Kind:              s.Kind,
+		StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		Status:            otlpStatus{Code: otlpStatusOk},
+	}
+
+	if s.ParentSpanID != (SpanID{}) {
+		o.ParentSpanID = s.ParentSpanID.String()
+	}
+
+	keys := make([]string, 0, len(s.Attributes))
+	for k := range s.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		o.Attributes = append(o.Attributes, otlpKeyValue{Key: k, Value: otlpValue{StringValue: s.Attributes[k]}})
+	}
+
+	if s.Err != nil {
+		o.Status = otlpStatus{Code: otlpStatusError, Message: s.Err.Error()}
+	}
+
+	return o
+}
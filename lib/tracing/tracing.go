@@ -0,0 +1,323 @@
+// Package tracing provides distributed tracing for maya api server. The trace
+// context is propagated as per W3C Trace Context i.e. the traceparent header,
+// while the spans are exported in OTLP format. This lets the spans of maya
+// api server be correlated with those of its clients & collected by any
+// OpenTelemetry collector.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceparentHeader is the W3C Trace Context header that carries the trace
+// id & the parent span id of a request
+const TraceparentHeader = "traceparent"
+
+// SpanKind describes the relationship of a span with its parent & children
+type SpanKind int
+
+// The values are the same as the ones defined by OTLP
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// SpanContext is the part of a span that is propagated across processes
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid verifies if both the trace id & span id are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent formats the span context as a W3C traceparent header value
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent parses a W3C traceparent header value. It returns false if
+// the value is not a valid traceparent.
+func ParseTraceparent(v string) (SpanContext, bool) {
+	var sc SpanContext
+
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 {
+		return sc, false
+	}
+
+	// Version ff is invalid. Version 00 has exactly four parts, while future
+	// versions may append more.
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if len(version) != 2 || version == "ff" || (version == "00" && len(parts) != 4) {
+		return sc, false
+	}
+
+	if _, err := hex.Decode(make([]byte, 1), []byte(version)); err != nil {
+		return sc, false
+	}
+
+	if len(traceID) != 32 || len(spanID) != 16 || len(flags) != 2 {
+		return sc, false
+	}
+
+	if _, err := hex.Decode(sc.TraceID[:], []byte(traceID)); err != nil {
+		return sc, false
+	}
+
+	if _, err := hex.Decode(sc.SpanID[:], []byte(spanID)); err != nil {
+		return sc, false
+	}
+
+	f := make([]byte, 1)
+	if _, err := hex.Decode(f, []byte(flags)); err != nil {
+		return sc, false
+	}
+	sc.Sampled = f[0]&0x01 == 0x01
+
+	if !sc.IsValid() {
+		return sc, false
+	}
+
+	return sc, true
+}
+
+// Span is a single timed operation of a trace
+type Span struct {
+	Name         string
+	Kind         SpanKind
+	Context      SpanContext
+	ParentSpanID SpanID
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]string
+
+	// Err is set if the operation failed
+	Err error
+
+	l      sync.Mutex
+	ended  bool
+	tracer *Tracer
+}
+
+// SetAttribute sets an attribute of the span
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	s.Attributes[key] = value
+}
+
+// SetError marks the span as failed. A nil error is ignored.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	s.Err = err
+}
+
+// Finish ends the span & hands it over to the exporter. A span is exported
+// only once even if it is finished multiple times.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+
+	s.l.Lock()
+	if s.ended {
+		s.l.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.l.Unlock()
+
+	s.tracer.export(s)
+}
+
+// Tracer starts spans & exports them once they are finished
+type Tracer struct {
+	// service is the name of the service reported along with the spans
+	service string
+
+	// exporter exports the finished spans. Spans are not exported if this
+	// is nil, though the trace context is still propagated.
+	l        sync.RWMutex
+	exporter Exporter
+}
+
+// NewTracer returns a tracer that exports the spans via the given exporter
+func NewTracer(service string, exporter Exporter) *Tracer {
+	return &Tracer{
+		service:  service,
+		exporter: exporter,
+	}
+}
+
+// Service returns the name of the service being traced
+func (t *Tracer) Service() string {
+	return t.service
+}
+
+// Start starts a span as a child of the span in the context. A remote parent
+// set via ContextWithRemoteParent is used if there is no local parent. A new
+// trace is started if there is no parent at all.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	s := &Span{
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		Attributes: map[string]string{},
+		tracer:     t,
+	}
+
+	if parent, ok := parentOf(ctx); ok {
+		s.Context.TraceID = parent.TraceID
+		s.Context.Sampled = parent.Sampled
+		s.ParentSpanID = parent.SpanID
+	} else {
+		s.Context.TraceID = newTraceID()
+		s.Context.Sampled = true
+	}
+	s.Context.SpanID = newSpanID()
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Shutdown flushes the spans pending with the exporter
+func (t *Tracer) Shutdown() error {
+	if t == nil {
+		return nil
+	}
+
+	t.l.RLock()
+	exporter := t.exporter
+	t.l.RUnlock()
+
+	if exporter == nil {
+		return nil
+	}
+	return exporter.Shutdown()
+}
+
+// SetExporter replaces the exporter of the tracer & returns the previous
+// one. The previous exporter is not shut down. Spans that finish after this
+// are exported via the new exporter.
+func (t *Tracer) SetExporter(exporter Exporter) Exporter {
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	previous := t.exporter
+	t.exporter = exporter
+	return previous
+}
+
+// export hands over the sampled span to the exporter
+func (t *Tracer) export(s *Span) {
+	if t == nil || !s.Context.Sampled {
+		return
+	}
+
+	t.l.RLock()
+	exporter := t.exporter
+	t.l.RUnlock()
+
+	if exporter != nil {
+		exporter.Export(s)
+	}
+}
+
+type spanKey struct{}
+
+type remoteParentKey struct{}
+
+// SpanFromContext returns the current span of the context. It returns nil if
+// there is no span.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// ContextWithRemoteParent sets the span context received from a remote
+// process as the parent of the spans started from the returned context
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteParentKey{}, sc)
+}
+
+// Extract returns a context with the remote parent set from the traceparent
+// header of the request. An invalid or missing traceparent is ignored.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	sc, ok := ParseTraceparent(h.Get(TraceparentHeader))
+	if !ok {
+		return ctx
+	}
+
+	return ContextWithRemoteParent(ctx, sc)
+}
+
+// Inject sets the traceparent header from the current span of the context
+func Inject(ctx context.Context, h http.Header) {
+	if s := SpanFromContext(ctx); s != nil {
+		h.Set(TraceparentHeader, s.Context.Traceparent())
+	}
+}
+
+// parentOf returns the span context of the parent of a new span
+func parentOf(ctx context.Context) (SpanContext, bool) {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.Context, true
+	}
+
+	sc, ok := ctx.Value(remoteParentKey{}).(SpanContext)
+	return sc, ok
+}
+
+func newTraceID() TraceID {
+	var t TraceID
+	rand.Read(t[:])
+	return t
+}
+
+func newSpanID() SpanID {
+	var s SpanID
+	rand.Read(s[:])
+	return s
+}
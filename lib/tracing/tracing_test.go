@@ -0,0 +1,162 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	cases := []struct {
+		value   string
+		valid   bool
+		sampled bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true, true},
+		{"", false, false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01", false, false},
+	}
+
+	for _, tc := range cases {
+		sc, ok := ParseTraceparent(tc.value)
+		if ok != tc.valid {
+			t.Fatalf("%q: expected valid: %v, got: %v", tc.value, tc.valid, ok)
+		}
+
+		if !ok {
+			continue
+		}
+
+		if sc.Sampled != tc.sampled {
+			t.Fatalf("%q: expected sampled: %v, got: %v", tc.value, tc.sampled, sc.Sampled)
+		}
+
+		if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+			t.Fatalf("%q: bad span context: %s", tc.value, sc.Traceparent())
+		}
+	}
+}
+
+func TestTracerContinuesRemoteTrace(t *testing.T) {
+	exp := NewInMemoryExporter()
+	tracer := NewTracer("test", exp)
+
+	h := http.Header{}
+	h.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx, parent := tracer.Start(Extract(context.Background(), h), "parent", SpanKindServer)
+	_, child := tracer.Start(ctx, "child", SpanKindInternal)
+	child.SetError(errors.New("failed"))
+	child.Finish()
+	parent.Finish()
+	parent.Finish()
+
+	spans := exp.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans to be exported once, got: %d", len(spans))
+	}
+
+	if spans[1].Context.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		spans[1].ParentSpanID.String() != "00f067aa0ba902b7" {
+		t.Fatalf("expected the remote parent to be continued, got: %s", spans[1].Context.Traceparent())
+	}
+
+	if spans[0].Context.TraceID != spans[1].Context.TraceID || spans[0].ParentSpanID != spans[1].Context.SpanID {
+		t.Fatalf("expected child of the parent span, got: %s", spans[0].Context.Traceparent())
+	}
+
+	if spans[0].Err == nil {
+		t.Fatalf("expected the child span to be failed")
+	}
+
+	out := http.Header{}
+	Inject(ctx, out)
+	if out.Get(TraceparentHeader) != parent.Context.Traceparent() {
+		t.Fatalf("expected traceparent of the parent span, got: %s", out.Get(TraceparentHeader))
+	}
+}
+
+func TestTracerSkipsUnsampledTrace(t *testing.T) {
+	exp := NewInMemoryExporter()
+	tracer := NewTracer("test", exp)
+
+	sc, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, span := tracer.Start(ContextWithRemoteParent(context.Background(), sc), "unsampled", SpanKindServer)
+	span.Finish()
+
+	if n := len(exp.Spans()); n != 0 {
+		t.Fatalf("expected unsampled spans to be skipped, got: %d", n)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var l sync.Mutex
+	var received []otlpTraces
+
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != otlpTracesPath {
+			t.Errorf("expected path: %s, got: %s", otlpTracesPath, r.URL.Path)
+		}
+
+		b, _ := ioutil.ReadAll(r.Body)
+		var req otlpTraces
+		if err := json.Unmarshal(b, &req); err != nil {
+			t.Errorf("err decoding export request: %v", err)
+		}
+
+		l.Lock()
+		received = append(received, req)
+		l.Unlock()
+	}))
+	defer collector.Close()
+
+	exp, err := NewOTLPExporter(collector.URL, "maya-test", nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	tracer := NewTracer("maya-test", exp)
+
+	_, span := tracer.Start(context.Background(), "op", SpanKindClient)
+	span.SetAttribute("volume.name", "vol1")
+	span.SetError(errors.New("failed"))
+	span.Finish()
+
+	// Shutdown flushes the pending spans
+	tracer.Shutdown()
+
+	l.Lock()
+	defer l.Unlock()
+
+	if len(received) != 1 {
+		t.Fatalf("expected 1 export request, got: %d", len(received))
+	}
+
+	rs := received[0].ResourceSpans[0]
+	if rs.Resource.Attributes[0].Value.StringValue != "maya-test" {
+		t.Fatalf("bad resource: %#v", rs.Resource)
+	}
+
+	got := rs.ScopeSpans[0].Spans[0]
+	if got.Name != "op" || got.Kind != SpanKindClient || got.TraceID != span.Context.TraceID.String() ||
+		got.Status.Code != otlpStatusError || got.Attributes[0].Key != "volume.name" {
+		t.Fatalf("bad span: %#v", got)
+	}
+}
+
+func TestOTLPExporterInvalidAddr(t *testing.T) {
+	if _, err := NewOTLPExporter("collector:4318", "maya-test", nil); err == nil {
+		t.Fatalf("expected error for address without scheme")
+	}
+}